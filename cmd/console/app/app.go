@@ -3,18 +3,31 @@ package app
 import (
 	"asyncKubeManager/cmd/console/app/options"
 	"asyncKubeManager/pkg/auth"
+	"asyncKubeManager/pkg/authn"
+	"asyncKubeManager/pkg/captcha"
 	"asyncKubeManager/pkg/client/cache"
 	"asyncKubeManager/pkg/client/k8s"
 	"asyncKubeManager/pkg/client/kubevirt"
 	"asyncKubeManager/pkg/client/ldap"
+	"asyncKubeManager/pkg/dao"
 	"asyncKubeManager/pkg/dbresolver"
+	"asyncKubeManager/pkg/idempotency"
+	"asyncKubeManager/pkg/manager/namespace"
 	"asyncKubeManager/pkg/manager/pvc"
 	"asyncKubeManager/pkg/manager/vm"
+	"asyncKubeManager/pkg/migration"
 	"asyncKubeManager/pkg/task/delete_task"
 	"asyncKubeManager/pkg/token"
+	"asyncKubeManager/pkg/token/denylist"
+	"asyncKubeManager/pkg/token/pat"
+	"asyncKubeManager/pkg/utils/limiter"
+	"asyncKubeManager/pkg/utils/pwdutil"
+	"context"
+	"crypto/rand"
+	"errors"
 	"fmt"
 	"github.com/gin-gonic/gin"
-	"github.com/golang-jwt/jwt/v5"
+	"go.uber.org/zap"
 	"net/http"
 	"time"
 
@@ -31,6 +44,23 @@ type ConsoleServer struct {
 	CacheClient  cache.Interface
 	Enforcer     *auth.Enforcer
 
+	IdempotencyStore idempotency.Store
+	// TokenDenylist keeps the revoked tokens in the database, nil if they are kept in redis
+	TokenDenylist  *denylist.DBDenylist
+	LoginPolicy    limiter.LoginPolicy
+	PasswordPolicy pwdutil.Policy
+	// BootstrapAdmin is created with BootstrapAdminPassword on the first start when there is no admin
+	BootstrapAdmin         string
+	BootstrapAdminPassword string
+	// UserRateLimiter and IPRateLimiter throttle the API, nil means unlimited
+	UserRateLimiter limiter.RateLimiter
+	IPRateLimiter   limiter.RateLimiter
+	// Authenticators are the enabled login providers
+	Authenticators *authn.Registry
+	// LDAPSyncer syncs the LDAP users every LDAPSyncInterval, nil if ldap or the sync is disabled
+	LDAPSyncer       *authn.LDAPSyncer
+	LDAPSyncInterval time.Duration
+
 	// 客户端
 	K8sClient      *k8s.KubeClient
 	KubevirtClient *kubevirt.KubevirtClient
@@ -38,6 +68,7 @@ type ConsoleServer struct {
 	CdiClient      *cdiCli.Clientset
 
 	// manager
+	NamespaceManager  *namespace.K8sNamespaceManager
 	VMManager         *vm.KubevirtVMManager
 	PVCManager        *pvc.K8sPVCManager
 	DeleteTaskManager deleteTask.DeleteTaskManager
@@ -52,10 +83,29 @@ func NewConsoleServer(opts *options.ServerRunOptions, stopCh <-chan struct{}) (*
 	if err != nil {
 		return nil, fmt.Errorf("failed to create db resolver: %w", err)
 	}
+	if err = dao.RegisterResourceOwnerCallback(dbResolver.GetDB()); err != nil {
+		return nil, fmt.Errorf("failed to register resource owner callback: %w", err)
+	}
 
-	cacheClient, err := cache.NewRedisClient(opts.CacheOptions, nil)
-	if err != nil {
-		return nil, fmt.Errorf("failed to create cache client: %w", err)
+	// 多副本同时启动时由数据库锁保证只有一个副本执行迁移
+	if _, err = migration.NewMigrator(dbResolver.GetDB()).Up(context.Background()); err != nil {
+		return nil, fmt.Errorf("failed to migrate database: %w", err)
+	}
+
+	// redis is optional, an empty host means it is disabled
+	var cacheClient cache.Interface
+	if opts.CacheOptions.Host != "" {
+		cacheClient, err = cache.NewRedisClient(opts.CacheOptions, stopCh)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create cache client: %w", err)
+		}
+		// 多副本部署时读写分离的会话固定记录需要在副本间共享
+		dbResolver.SetPinCache(cacheClient)
+	}
+
+	// 配置了redis时验证码保存在redis中, 任一副本都可以校验
+	if err = captcha.Init(opts.CaptchaOptions, cacheClient); err != nil {
+		return nil, fmt.Errorf("failed to init captcha: %w", err)
 	}
 
 	k8sClient, err := k8s.NewKubeClient(opts.K8sOptions)
@@ -68,39 +118,103 @@ func NewConsoleServer(opts *options.ServerRunOptions, stopCh <-chan struct{}) (*
 		return nil, fmt.Errorf("failed to create kubevirt client: %w", err)
 	}
 
-	enforcer, err := auth.NewEnforcer(dbResolver.GetDB())
+	enforcer, err := auth.NewEnforcer(dbResolver.GetDB(), opts.CasbinModelPath)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create enforcer: %w", err)
 	}
+	// 策略变更通过 redis 通知其它副本, 没有 redis 时定期重新加载
+	if err = enforcer.Watch(cacheClient); err != nil {
+		return nil, fmt.Errorf("failed to watch casbin policies: %w", err)
+	}
 
 	cdiClientSet, err := cdiCli.NewForConfig(k8sClient.GetConfig())
 	if err != nil {
 		return nil, fmt.Errorf("failed to create cdi client: %w", err)
 	}
 
-	ldapClient, err := ldap.NewLDAPClient(opts.LDAPOptions)
+	// ldap is optional, an empty host means only local accounts can log in
+	var ldapClient *ldap.LDAPClient
+	if opts.LDAPOptions.Host != "" {
+		ldapClient, err = ldap.NewLDAPClient(opts.LDAPOptions)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create ldap client: %w", err)
+		}
+	}
+
+	groupMappings, err := opts.LDAPSyncOptions.Mappings()
 	if err != nil {
-		return nil, fmt.Errorf("failed to create ldap client: %w", err)
+		return nil, fmt.Errorf("failed to parse ldap group mappings: %w", err)
 	}
+	authenticators, err := newAuthenticators(opts, dbResolver, ldapClient, groupMappings)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create authenticators: %w", err)
+	}
+
+	namespaceManager := namespace.NewK8sNamespaceManager(k8sClient.GetClientset(), opts.K8sNameSpace)
 
-	pvcManager := pvc.NewK8sPVCManager(k8sClient.GetClientset())
+	pvcManager := pvc.NewK8sPVCManager(k8sClient.GetClientset(), opts.K8sStorageClass)
 
-	vmManager := vm.NewKubevirtVMManager(kubevirtClient.GetClientset(), cdiClientSet, dbResolver, pvcManager)
+	vmManager := vm.NewKubevirtVMManager(kubevirtClient.GetClientset(), cdiClientSet, dbResolver, pvcManager, opts.K8sStorageClass)
 
 	deleteTaskManager := deleteTask.NewDeleteTaskManager(dbResolver, pvcManager, vmManager)
 	deleteTaskMonitor := deleteTask.NewDeleteTaskMonitor(dbResolver, deleteTaskManager)
 
+	idempotencyStore := idempotency.NewDBStore(dbResolver)
+	var tokenDenylist *denylist.DBDenylist
+	tokenOptions := []token.Option{
+		token.SetPersonalAccessTokens(pat.NewManager(dbResolver)),
+	}
+	if cacheClient != nil {
+		idempotencyStore = idempotency.NewCacheStore(cacheClient)
+		tokenOptions = append(tokenOptions,
+			token.SetDuration(cacheClient, time.Minute*30),
+			token.SetMaxSessions(opts.MaxSessions),
+			token.SetDenylist(cacheClient, token.DefaultCacheDuration),
+		)
+	} else {
+		// 没有redis时不保存会话, 吊销的token记录在数据库中, 各副本校验token时都会查询
+		tokenDenylist = denylist.NewDBDenylist(dbResolver)
+		tokenOptions = append(tokenOptions, token.SetDenylist(tokenDenylist, token.DefaultCacheDuration))
+		zap.L().Warn("redis is disabled, sessions are not available and revoked tokens are stored in the database")
+	}
+
+	signKey, verifyKeys, err := loadTokenKeys(opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load jwt keys: %w", err)
+	}
+	tokenOptions = append(tokenOptions, token.AddVerifyKeys(verifyKeys...))
+
 	server := &ConsoleServer{
-		TokenManager: token.NewJWTTokenManager([]byte(opts.JWTSecret), jwt.SigningMethodHS256, token.SetDuration(cacheClient, time.Minute*30)),
+		TokenManager: token.NewJWTTokenManagerWithKey(signKey, tokenOptions...),
 		DBResolver:   dbResolver,
 		CacheClient:  cacheClient,
 		Enforcer:     enforcer,
 
+		IdempotencyStore: idempotencyStore,
+		TokenDenylist:    tokenDenylist,
+		LoginPolicy: limiter.LoginPolicy{
+			UserThreshold:   opts.LoginUserThreshold,
+			IPThreshold:     opts.LoginIPThreshold,
+			Window:          opts.LoginFailWindow,
+			LockoutDuration: opts.LoginLockoutDuration,
+		},
+		UserRateLimiter: newRateLimiter(cacheClient, "rate-limit:api:", opts.APIUserRateLimit),
+		IPRateLimiter:   newRateLimiter(cacheClient, "rate-limit:api:", opts.APIIPRateLimit),
+
+		PasswordPolicy: pwdutil.Policy{
+			MinLength: opts.PasswordMinLength,
+			Rating:    pwdutil.PasswordRatingType(opts.PasswordRating),
+		},
+		BootstrapAdmin:         opts.BootstrapAdmin,
+		BootstrapAdminPassword: opts.BootstrapAdminPassword,
+		Authenticators:         authenticators,
+
 		K8sClient:      k8sClient,
 		KubevirtClient: kubevirtClient,
 		LDAPClient:     ldapClient,
 		CdiClient:      cdiClientSet,
 
+		NamespaceManager:  namespaceManager,
 		VMManager:         vmManager,
 		PVCManager:        pvcManager,
 		DeleteTaskManager: deleteTaskManager,
@@ -108,5 +222,85 @@ func NewConsoleServer(opts *options.ServerRunOptions, stopCh <-chan struct{}) (*
 		DeleteTaskMonitor: deleteTaskMonitor,
 	}
 
+	if ldapClient != nil && opts.LDAPSyncOptions.SyncInterval > 0 {
+		server.LDAPSyncer = authn.NewLDAPSyncer(ldapClient, dbResolver, enforcer, server.TokenManager, groupMappings)
+		if cacheClient != nil {
+			server.LDAPSyncer.SetLockCache(cacheClient)
+		}
+		server.LDAPSyncInterval = opts.LDAPSyncOptions.SyncInterval
+	}
+
 	return server, nil
 }
+
+// newAuthenticators returns the enabled authentication providers in the configured order
+func newAuthenticators(opts *options.ServerRunOptions, dbResolver *dbresolver.DBResolver, ldapClient *ldap.LDAPClient,
+	groupMappings authn.GroupMappings) (*authn.Registry, error) {
+	var providers []authn.Authenticator
+	for _, name := range opts.AuthProviders {
+		switch name {
+		case authn.TypeLocal:
+			providers = append(providers, authn.NewLocalAuthenticator(dbResolver))
+		case authn.TypeLDAP:
+			if ldapClient == nil {
+				zap.L().Warn("ldap auth provider is skipped, ldap-host is not set")
+				continue
+			}
+			providers = append(providers, authn.NewLDAPAuthenticator(ldapClient, groupMappings))
+		case authn.TypeOIDC:
+			if errs := opts.OIDCOptions.Validate(); len(errs) != 0 {
+				return nil, errors.Join(errs...)
+			}
+			if opts.OIDCOptions.Issuer == "" {
+				return nil, fmt.Errorf("oidc auth provider requires oidc-issuer")
+			}
+			providers = append(providers, authn.NewOIDCAuthenticator(opts.OIDCOptions))
+		default:
+			return nil, fmt.Errorf("unknown auth provider %q", name)
+		}
+	}
+	return authn.NewRegistry(providers...)
+}
+
+// loadTokenKeys returns the key signing the tokens and the keys of a previous rotation.
+func loadTokenKeys(opts *options.ServerRunOptions) (*token.Key, []*token.Key, error) {
+	var verifyKeys []*token.Key
+	for _, path := range opts.JWTVerifyKeys {
+		key, err := token.LoadVerificationKey(path)
+		if err != nil {
+			return nil, nil, err
+		}
+		verifyKeys = append(verifyKeys, key)
+	}
+
+	if opts.JWTSigningKey != "" {
+		signKey, err := token.LoadSigningKey(opts.JWTSigningKey)
+		if err != nil {
+			return nil, nil, err
+		}
+		return signKey, verifyKeys, nil
+	}
+
+	if opts.JWTSecret != "" {
+		return token.NewHMACKey([]byte(opts.JWTSecret)), verifyKeys, nil
+	}
+
+	// 未配置密钥时生成随机密钥, 重启后所有token失效, 多副本部署时必须配置
+	zap.L().Warn("neither jwt-signing-key nor jwt-secret is set, using a random secret")
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return nil, nil, err
+	}
+	return token.NewHMACKey(secret), verifyKeys, nil
+}
+
+// newRateLimiter returns a limiter allowing perMinute requests, shared by the replicas if redis is enabled.
+func newRateLimiter(cacheClient cache.Interface, prefix string, perMinute int) limiter.RateLimiter {
+	if perMinute <= 0 {
+		return nil
+	}
+	if cacheClient == nil {
+		return limiter.NewMemoryRateLimiter(limiter.PerMinute(perMinute))
+	}
+	return limiter.NewCacheRateLimiter(cacheClient, prefix, limiter.PerMinute(perMinute))
+}
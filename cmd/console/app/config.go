@@ -0,0 +1,114 @@
+package app
+
+import (
+	"asyncKubeManager/cmd/console/app/options"
+	"asyncKubeManager/pkg/server/config"
+)
+
+// configToServerRunOptions 将配置文件转换为服务启动参数, 配置文件中未设置的字段使用 NewDefaultConfig 中的默认值
+func configToServerRunOptions(cfg *config.Config) *options.ServerRunOptions {
+	s := options.NewServerRunOptions()
+	defaults := config.NewDefaultConfig()
+
+	// Server
+	if cfg.Server.ConfigFilePath != "" {
+		s.GenericServerRunOptions.ConfigFilePath = cfg.Server.ConfigFilePath
+	}
+	s.GenericServerRunOptions.BindAddress = cfg.Server.BindAddress
+	s.GenericServerRunOptions.Port = cfg.Server.Port
+	s.GenericServerRunOptions.TlsCertFile = cfg.Server.TlsCertFile
+	s.GenericServerRunOptions.TlsPrivateKey = cfg.Server.TlsPrivateKey
+	s.DebugMode = cfg.Server.DebugMode
+	s.JWTSecret = cfg.Server.JWTSecret
+	s.JWTSigningKey = cfg.Server.JWTSigningKey
+	s.JWTVerifyKeys = cfg.Server.JWTVerifyKeys
+	s.CasbinModelPath = cfg.Server.CasbinModelPath
+	s.MaxSessions = cfg.Server.MaxSessions
+	s.LoginUserThreshold = cfg.Server.LoginUserThreshold
+	s.LoginIPThreshold = cfg.Server.LoginIPThreshold
+	s.LoginFailWindow = cfg.Server.LoginFailWindow
+	s.LoginLockoutDuration = cfg.Server.LoginLockoutDuration
+	s.APIUserRateLimit = cfg.Server.APIUserRateLimit
+	s.APIIPRateLimit = cfg.Server.APIIPRateLimit
+	s.BootstrapAdmin = cfg.Server.BootstrapAdmin
+	s.BootstrapAdminPassword = cfg.Server.BootstrapAdminPassword
+	s.PasswordMinLength = cfg.Server.PasswordMinLength
+	s.PasswordRating = cfg.Server.PasswordRating
+	s.AuthProviders = cfg.Server.AuthProviders
+
+	// server.k8s-namespace 优先, 未修改默认值时使用 kubernetes.kube-namespace
+	s.K8sNameSpace = cfg.Server.K8sNameSpace
+	if s.K8sNameSpace == defaults.Server.K8sNameSpace && cfg.K8s.KubeNameSpace != "" {
+		s.K8sNameSpace = cfg.K8s.KubeNameSpace
+	}
+	s.K8sStorageClass = cfg.Server.K8sStorageClass
+	if s.K8sStorageClass == defaults.Server.K8sStorageClass && cfg.K8s.KubeStorageClass != "" {
+		s.K8sStorageClass = cfg.K8s.KubeStorageClass
+	}
+
+	// Cache
+	s.CacheOptions.Host = cfg.Cache.Host
+	s.CacheOptions.Password = cfg.Cache.Password
+	s.CacheOptions.DB = cfg.Cache.DB
+
+	// MySQL
+	s.RDBOptions.RdbDriver = cfg.MySQL.RdbDriver
+	s.RDBOptions.RdbUser = cfg.MySQL.RdbUser
+	s.RDBOptions.RdbPassword = cfg.MySQL.RdbPassword
+	s.RDBOptions.RdbHost = cfg.MySQL.RdbHost
+	s.RDBOptions.RdbPort = cfg.MySQL.RdbPort
+	s.RDBOptions.RdbDbname = cfg.MySQL.RdbDbname
+	s.RDBOptions.RdbLogLevel = cfg.MySQL.RdbLogLevel
+	s.RDBOptions.RdbReplicas = cfg.MySQL.RdbReplicas
+	s.RDBOptions.RdbReadYourWritesTTL = cfg.MySQL.RdbReadYourWritesTTL
+
+	// LDAP
+	s.LDAPOptions.Host = cfg.LDAP.Host
+	s.LDAPOptions.Port = cfg.LDAP.Port
+	s.LDAPOptions.LDAPUserName = cfg.LDAP.LDAPUserName
+	s.LDAPOptions.LDAPPassword = cfg.LDAP.LDAPPassword
+	s.LDAPOptions.BaseDN = cfg.LDAP.BaseDN
+	s.LDAPOptions.TLSMode = cfg.LDAP.TLSMode
+	s.LDAPOptions.CAFile = cfg.LDAP.CAFile
+	s.LDAPOptions.ServerName = cfg.LDAP.ServerName
+	s.LDAPOptions.InsecureSkipVerify = cfg.LDAP.InsecureSkipVerify
+	s.LDAPOptions.PoolSize = cfg.LDAP.PoolSize
+	s.LDAPOptions.Timeout = cfg.LDAP.Timeout
+	s.LDAPOptions.HealthCheckInterval = cfg.LDAP.HealthCheckInterval
+	s.LDAPSyncOptions.GroupMappings = cfg.LDAP.GroupMappings
+	s.LDAPSyncOptions.SyncInterval = cfg.LDAP.SyncInterval
+
+	// Kubernetes, kubevirt 与 k8s 使用同一个集群
+	s.K8sOptions.KubeConfigPath = cfg.K8s.KubeConfigPath
+	s.K8sOptions.KubeContext = cfg.K8s.KubeContext
+	s.K8sOptions.InCluster = cfg.K8s.InCluster
+	s.KubevirtOptions.KubeConfigPath = cfg.K8s.KubeConfigPath
+	s.KubevirtOptions.KubeContext = cfg.K8s.KubeContext
+	s.KubevirtOptions.InCluster = cfg.K8s.InCluster
+
+	// Logger
+	s.LoggerOptions.LogLevel = cfg.Logger.LogLevel
+	s.LoggerOptions.AddStackLevel = cfg.Logger.AddStackLevel
+	s.LoggerOptions.Filename = cfg.Logger.Filename
+	s.LoggerOptions.MaxSize = cfg.Logger.MaxSize
+	s.LoggerOptions.MaxBackups = cfg.Logger.MaxBackups
+	s.LoggerOptions.MaxAge = cfg.Logger.MaxAge
+	s.LoggerOptions.Compress = cfg.Logger.Compress
+
+	// Captcha
+	s.CaptchaOptions.Driver = cfg.Captcha.Driver
+	s.CaptchaOptions.Length = cfg.Captcha.Length
+	s.CaptchaOptions.Noise = cfg.Captcha.Noise
+	s.CaptchaOptions.TTL = cfg.Captcha.TTL
+	s.CaptchaOptions.AudioLanguage = cfg.Captcha.AudioLanguage
+
+	// OIDC
+	s.OIDCOptions.Name = cfg.OIDC.Name
+	s.OIDCOptions.Issuer = cfg.OIDC.Issuer
+	s.OIDCOptions.ClientID = cfg.OIDC.ClientID
+	s.OIDCOptions.ClientSecret = cfg.OIDC.ClientSecret
+	s.OIDCOptions.RedirectURL = cfg.OIDC.RedirectURL
+	s.OIDCOptions.Scopes = cfg.OIDC.Scopes
+
+	return s
+}
@@ -0,0 +1,104 @@
+package app
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"asyncKubeManager/pkg/server/config"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testConfig = `
+server:
+  port: 8080
+  casbin-model: /etc/async-km/casbin_model.conf
+  max-sessions: 3
+  jwt-signing-key: /etc/async-km/jwt.pem
+  jwt-verify-keys:
+    - /etc/async-km/jwt-old.pub
+  login-user-threshold: 3
+  login-fail-window: 5m
+  api-user-rate-limit: 100
+  bootstrap-admin: root
+  password-min-length: 12
+  password-rating: veryStrong
+  auth-providers: [local, oidc]
+cache:
+  redis-host: redis:6379
+mysql:
+  rdb-driver: postgres
+  rdb-replicas: [replica-1:5432]
+  rdb-read-your-writes-ttl: 10s
+ldap:
+  ldap-group-mappings: [console-admins=admin]
+  ldap-sync-interval: 1h
+  ldap-tls-mode: starttls
+  ldap-pool-size: 8
+kubernetes:
+  kube-namespace: vms
+captcha:
+  captcha-driver: string
+oidc:
+  oidc-issuer: https://sso.example.com
+  oidc-client-id: console
+  oidc-redirect-url: https://console.example.com/oidc
+`
+
+func TestConfigToServerRunOptions(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	require.NoError(t, os.WriteFile(path, []byte(testConfig), 0o600))
+	require.NoError(t, config.ParseConfigFile(path))
+
+	defaults := config.NewDefaultConfig()
+	s := configToServerRunOptions(config.GetGlobalConfig())
+	assert.Equal(t, 8080, s.GenericServerRunOptions.Port)
+	assert.Equal(t, "/etc/async-km/casbin_model.conf", s.CasbinModelPath)
+	assert.Equal(t, 3, s.MaxSessions)
+	assert.Equal(t, "/etc/async-km/jwt.pem", s.JWTSigningKey)
+	assert.Equal(t, []string{"/etc/async-km/jwt-old.pub"}, s.JWTVerifyKeys)
+	assert.EqualValues(t, 3, s.LoginUserThreshold)
+	assert.EqualValues(t, defaults.Server.LoginIPThreshold, s.LoginIPThreshold)
+	assert.Equal(t, 5*time.Minute, s.LoginFailWindow)
+	assert.Equal(t, defaults.Server.LoginLockoutDuration, s.LoginLockoutDuration)
+	assert.Equal(t, 100, s.APIUserRateLimit)
+	assert.Equal(t, "root", s.BootstrapAdmin)
+	assert.Equal(t, 12, s.PasswordMinLength)
+	assert.Equal(t, "veryStrong", s.PasswordRating)
+	assert.Equal(t, []string{"local", "oidc"}, s.AuthProviders)
+	assert.Equal(t, "vms", s.K8sNameSpace)
+
+	assert.Equal(t, "redis:6379", s.CacheOptions.Host)
+	assert.Equal(t, "postgres", s.RDBOptions.RdbDriver)
+	assert.Equal(t, []string{"replica-1:5432"}, s.RDBOptions.RdbReplicas)
+	assert.Equal(t, 10*time.Second, s.RDBOptions.RdbReadYourWritesTTL)
+
+	assert.Equal(t, []string{"console-admins=admin"}, s.LDAPSyncOptions.GroupMappings)
+	assert.Equal(t, time.Hour, s.LDAPSyncOptions.SyncInterval)
+	assert.Equal(t, "starttls", s.LDAPOptions.TLSMode)
+	assert.Equal(t, 8, s.LDAPOptions.PoolSize)
+	assert.Equal(t, defaults.LDAP.Timeout, s.LDAPOptions.Timeout)
+
+	assert.Equal(t, "string", s.CaptchaOptions.Driver)
+	assert.Equal(t, defaults.Captcha.TTL, s.CaptchaOptions.TTL)
+
+	assert.Equal(t, "https://sso.example.com", s.OIDCOptions.Issuer)
+	assert.Equal(t, "console", s.OIDCOptions.ClientID)
+	assert.Equal(t, []string{"openid", "profile", "email"}, s.OIDCOptions.Scopes)
+}
+
+func TestConfigBootstrapAdmin(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+
+	// 默认创建 admin, 配置为空时不创建
+	require.NoError(t, os.WriteFile(path, []byte("server:\n  port: 8080\n"), 0o600))
+	require.NoError(t, config.ParseConfigFile(path))
+	assert.Equal(t, "admin", configToServerRunOptions(config.GetGlobalConfig()).BootstrapAdmin)
+
+	require.NoError(t, os.WriteFile(path, []byte("server:\n  bootstrap-admin: \"\"\n"), 0o600))
+	require.NoError(t, config.ParseConfigFile(path))
+	assert.Empty(t, configToServerRunOptions(config.GetGlobalConfig()).BootstrapAdmin)
+}
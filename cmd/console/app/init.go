@@ -1,8 +1,21 @@
 package app
 
 import (
+	"asyncKubeManager/pkg/dao"
+	"asyncKubeManager/pkg/idempotency"
+	"asyncKubeManager/pkg/migration"
+	"asyncKubeManager/pkg/model"
+	"asyncKubeManager/pkg/token/denylist"
+	"asyncKubeManager/pkg/utils"
+	"asyncKubeManager/pkg/utils/pwdutil"
 	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
 	"go.uber.org/zap"
+	"gorm.io/gorm"
+	"os"
 	"time"
 )
 
@@ -19,7 +32,165 @@ func (s *ConsoleServer) initSystem() (err error) {
 		}
 	}(time.Now())
 
+	if err = s.ensureDefaultProject(context.Background()); err != nil {
+		return err
+	}
+
+	if err = s.ensureBootstrapAdmin(context.Background()); err != nil {
+		return err
+	}
+
+	if err = s.initPolicies(context.Background()); err != nil {
+		return err
+	}
+
 	s.DeleteTaskMonitor.Start(context.Background(), time.Second*10)
 
+	if cleaner, ok := s.IdempotencyStore.(idempotency.Cleaner); ok {
+		cleaner.Start(context.Background(), idempotency.DefaultCleanupInterval)
+	}
+
+	if s.TokenDenylist != nil {
+		s.TokenDenylist.Start(context.Background(), denylist.DefaultCleanupInterval)
+	}
+
+	if s.LDAPSyncer != nil {
+		s.LDAPSyncer.Start(context.Background(), s.LDAPSyncInterval)
+	}
+
 	return err
 }
+
+// ensureDefaultProject 确保默认项目存在, 默认项目使用配置的 namespace, 已有的虚拟机归属于它
+func (s *ConsoleServer) ensureDefaultProject(ctx context.Context) error {
+	found, project, err := dao.GetProjectByName(ctx, s.DBResolver, model.DefaultProjectName)
+	if err != nil {
+		return err
+	}
+
+	if !found {
+		err = s.DBResolver.GetDB().Transaction(func(tx *gorm.DB) error {
+			project, err = dao.InsertProjectWithDB(ctx, tx, utils.NextID(), model.DefaultProjectName,
+				s.NamespaceManager.NamespaceForProject(model.DefaultProjectName), "default project")
+			if err != nil {
+				return err
+			}
+			// 项目功能上线前创建的虚拟机归属默认项目
+			return tx.WithContext(ctx).Model(&model.VM{}).Where("project_id = ?", 0).Update("project_id", project.ID).Error
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	_, err = s.NamespaceManager.CreateNamespace(ctx, project.Namespace, project.UID)
+	return err
+}
+
+// bootstrapAdminUID is the fixed UID of the bootstrap admin, replicas starting at the same time insert
+// the same row, so that only one of them creates the admin
+const bootstrapAdminUID = "bootstrap-admin"
+
+// errBootstrapAdminSkipped stops the creation of the bootstrap admin without failing the start
+var errBootstrapAdminSkipped = errors.New("bootstrap admin skipped")
+
+// ensureBootstrapAdmin 没有管理员时创建本地管理员账号, 持有迁移锁, 多副本同时启动时只有一个副本创建.
+// 是否有管理员以角色绑定为准, 用户写入之后角色绑定失败的 bootstrap admin 在下次启动时补全
+func (s *ConsoleServer) ensureBootstrapAdmin(ctx context.Context) error {
+	if s.BootstrapAdmin == "" {
+		return nil
+	}
+	return migration.NewMigrator(s.DBResolver.GetDB()).WithLock(ctx, func() error {
+		return s.createBootstrapAdmin(ctx)
+	})
+}
+
+func (s *ConsoleServer) createBootstrapAdmin(ctx context.Context) error {
+	// 重新加载角色绑定, 其他副本写入的绑定可能还没有同步过来
+	if err := s.Enforcer.LoadPolicy(); err != nil {
+		return err
+	}
+	admins, err := s.Enforcer.GetUsersForRole(string(model.UserRoleAdmin))
+	if err != nil || len(admins) != 0 {
+		return err
+	}
+
+	password := s.BootstrapAdminPassword
+	if password == "" {
+		b := make([]byte, 18)
+		if _, err = rand.Read(b); err != nil {
+			return err
+		}
+		password = base64.RawURLEncoding.EncodeToString(b)
+	}
+	passwordHash, err := pwdutil.PasswordHash(password)
+	if err != nil {
+		return err
+	}
+
+	err = s.DBResolver.GetDB().Transaction(func(tx *gorm.DB) error {
+		found, user, err := dao.GetUserByUIDWithDB(ctx, tx.Unscoped(), bootstrapAdminUID)
+		if err != nil {
+			return err
+		}
+		operation := "bootstrap admin"
+		switch {
+		case found && user.DeletedAt.Valid:
+			zap.L().Info("bootstrap admin is not created, it was deleted", zap.String("username", user.Username))
+			return errBootstrapAdminSkipped
+		case found:
+			// 上次启动写入了用户但没有绑定角色, 随机密码也没有输出, 重新设置密码
+			operation = "bootstrap admin completed"
+			if err = dao.UpdateUserByUIDWithDB(ctx, tx, bootstrapAdminUID, map[string]interface{}{
+				"role":                model.UserRoleAdmin,
+				"password_hash":       passwordHash,
+				"password_updated_at": time.Now().UnixMilli(),
+			}); err != nil {
+				return err
+			}
+		default:
+			found, _, err = dao.GetUserByUserNameWithDB(ctx, tx, s.BootstrapAdmin)
+			if err != nil {
+				return err
+			}
+			if found {
+				zap.L().Warn("bootstrap admin is not created, the username is taken", zap.String("username", s.BootstrapAdmin))
+				return errBootstrapAdminSkipped
+			}
+			if _, err = dao.InsertLocalUserWithDB(ctx, tx, bootstrapAdminUID, s.BootstrapAdmin, passwordHash, model.UserRoleAdmin); err != nil {
+				return err
+			}
+		}
+
+		return dao.InsertUserOperatorLogByModelWithDB(ctx, tx, &model.UserOperatorLog{
+			UID:       bootstrapAdminUID,
+			Operator:  model.UserOperatorCreate,
+			Operation: operation,
+			CreatedAt: time.Now().UnixMilli(),
+		})
+	})
+	if errors.Is(err, errBootstrapAdminSkipped) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	// 角色绑定失败时启动失败, 下次启动重新绑定
+	if err = s.Enforcer.SetUserRole(bootstrapAdminUID, string(model.UserRoleAdmin)); err != nil {
+		return err
+	}
+
+	zap.L().Info("bootstrap admin created", zap.String("username", s.BootstrapAdmin))
+	if s.BootstrapAdminPassword == "" {
+		// 随机密码不写入日志, 日志会被收集和长期保存
+		fmt.Fprintf(os.Stderr, "bootstrap admin %q created with password %s, change it after login\n", s.BootstrapAdmin, password)
+	}
+	return nil
+}
+
+// initPolicies 写入缺少的默认策略, 持有迁移锁, 多副本同时启动时只有一个副本写入.
+// 用户和 service account 的角色绑定在分配角色时写入, 不在启动时重建
+func (s *ConsoleServer) initPolicies(ctx context.Context) error {
+	return migration.NewMigrator(s.DBResolver.GetDB()).WithLock(ctx, s.Enforcer.SeedDefaultPolicies)
+}
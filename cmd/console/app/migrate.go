@@ -0,0 +1,105 @@
+package app
+
+import (
+	"asyncKubeManager/cmd/console/app/options"
+	"asyncKubeManager/pkg/dbresolver"
+	"asyncKubeManager/pkg/migration"
+	"fmt"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+func newMigrateCommand(s *options.ServerRunOptions) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "migrate",
+		Short: "Manage the database schema migrations",
+		Long: `Apply, revert or list the versioned database schema migrations.
+The API server applies pending migrations on startup as well.`,
+		SilenceUsage: true,
+	}
+
+	cmd.AddCommand(&cobra.Command{
+		Use:   "up",
+		Short: "Apply all pending migrations",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return withMigrator(cmd, s, func(m *migration.Migrator) error {
+				applied, err := m.Up(cmd.Context())
+				for _, mi := range applied {
+					fmt.Fprintf(cmd.OutOrStdout(), "applied %d %s\n", mi.Version, mi.Name)
+				}
+				if err == nil && len(applied) == 0 {
+					fmt.Fprintln(cmd.OutOrStdout(), "no pending migrations")
+				}
+				return err
+			})
+		},
+	})
+
+	var steps int
+	downCmd := &cobra.Command{
+		Use:   "down",
+		Short: "Revert the last applied migrations",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if steps <= 0 {
+				return fmt.Errorf("steps must be positive")
+			}
+			return withMigrator(cmd, s, func(m *migration.Migrator) error {
+				reverted, err := m.Down(cmd.Context(), steps)
+				for _, mi := range reverted {
+					fmt.Fprintf(cmd.OutOrStdout(), "reverted %d %s\n", mi.Version, mi.Name)
+				}
+				return err
+			})
+		},
+	}
+	downCmd.Flags().IntVar(&steps, "steps", 1, "Number of migrations to revert.")
+	cmd.AddCommand(downCmd)
+
+	cmd.AddCommand(&cobra.Command{
+		Use:   "status",
+		Short: "List the migrations and whether they are applied",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return withMigrator(cmd, s, func(m *migration.Migrator) error {
+				statuses, err := m.Status(cmd.Context())
+				if err != nil {
+					return err
+				}
+
+				w := tabwriter.NewWriter(cmd.OutOrStdout(), 0, 0, 2, ' ', 0)
+				fmt.Fprintln(w, "VERSION\tNAME\tAPPLIED AT")
+				for _, status := range statuses {
+					appliedAt := "pending"
+					if status.Applied {
+						appliedAt = time.UnixMilli(status.AppliedAt).Format(time.RFC3339)
+					}
+					fmt.Fprintf(w, "%d\t%s\t%s\n", status.Version, status.Name, appliedAt)
+				}
+				return w.Flush()
+			})
+		},
+	})
+
+	return cmd
+}
+
+func withMigrator(cmd *cobra.Command, s *options.ServerRunOptions, f func(m *migration.Migrator) error) error {
+	opts, err := completeOptions(cmd, s)
+	if err != nil {
+		return err
+	}
+
+	dbResolver, err := dbresolver.NewDBResolver(opts.RDBOptions)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = dbResolver.Close()
+	}()
+
+	return f(migration.NewMigrator(dbResolver.GetDB()))
+}
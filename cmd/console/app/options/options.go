@@ -1,6 +1,9 @@
 package options
 
 import (
+	"asyncKubeManager/pkg/auth"
+	"asyncKubeManager/pkg/authn"
+	"asyncKubeManager/pkg/captcha"
 	"asyncKubeManager/pkg/client/cache"
 	"asyncKubeManager/pkg/client/k8s"
 	"asyncKubeManager/pkg/client/kubevirt"
@@ -8,7 +11,11 @@ import (
 	"asyncKubeManager/pkg/client/mysql"
 	"asyncKubeManager/pkg/logger"
 	genericoptions "asyncKubeManager/pkg/server/options"
+	"asyncKubeManager/pkg/utils/limiter"
+	"asyncKubeManager/pkg/utils/pwdutil"
+	"time"
 
+	"github.com/spf13/pflag"
 	cliflag "k8s.io/component-base/cli/flag"
 )
 
@@ -20,19 +27,42 @@ type ServerRunOptions struct {
 	K8sOptions              *k8s.Options
 	KubevirtOptions         *kubevirt.Options
 	LDAPOptions             *ldap.Options
+	CaptchaOptions          *captcha.Options
+	OIDCOptions             *authn.OIDCOptions
+	LDAPSyncOptions         *authn.LDAPSyncOptions
 
 	K8sNameSpace    string
 	K8sStorageClass string
 	DebugMode       bool
 	JWTSecret       string
+	CasbinModelPath string
+	// MaxSessions limits the concurrent login sessions of a user, 0 means unlimited
+	MaxSessions int
+	// JWTSigningKey is a PEM private key file, it takes precedence over JWTSecret
+	JWTSigningKey string
+	// JWTVerifyKeys are PEM public key files of the previous signing keys, kept during a key rotation
+	JWTVerifyKeys []string
+	// LoginUserThreshold and LoginIPThreshold are the failed logins before a user or a client IP is locked
+	LoginUserThreshold   int64
+	LoginIPThreshold     int64
+	LoginFailWindow      time.Duration
+	LoginLockoutDuration time.Duration
+	// APIUserRateLimit and APIIPRateLimit are the API requests allowed per minute, 0 means unlimited
+	APIUserRateLimit int
+	APIIPRateLimit   int
+	// BootstrapAdmin is the local admin created on the first start when there is no admin, empty disables it
+	BootstrapAdmin string
+	// BootstrapAdminPassword is the password of BootstrapAdmin, a random one is printed to stderr once if empty
+	BootstrapAdminPassword string
+	// PasswordMinLength and PasswordRating are the strength required of the passwords of local accounts
+	PasswordMinLength int
+	PasswordRating    string
+	// AuthProviders are the enabled authentication providers, the password providers are tried in order
+	AuthProviders []string
 }
 
-var S ServerRunOptions
-
-const defaultJwtSecret = "cebc04fc7d4383ebf11bf661ba69977e" //MD5 async-km
-
 func NewServerRunOptions() *ServerRunOptions {
-	S = ServerRunOptions{
+	return &ServerRunOptions{
 		GenericServerRunOptions: genericoptions.NewServerRunOptions(),
 		CacheOptions:            cache.NewRedisOptions(),
 		RDBOptions:              mysql.NewMysqlOptions(),
@@ -40,16 +70,44 @@ func NewServerRunOptions() *ServerRunOptions {
 		K8sOptions:              k8s.NewKubeOptions(),
 		KubevirtOptions:         kubevirt.NewKubeOptions(),
 		LDAPOptions:             ldap.NewLDAPOptions(),
+		CaptchaOptions:          captcha.NewDefaultOptions(),
+		OIDCOptions:             authn.NewOIDCOptions(),
+		LDAPSyncOptions:         authn.NewLDAPSyncOptions(),
+		K8sNameSpace:            "async-km",
+		K8sStorageClass:         "async-km-sc",
+		CasbinModelPath:         auth.DefaultModelPath,
+		LoginUserThreshold:      limiter.DefaultLoginPolicy.UserThreshold,
+		LoginIPThreshold:        limiter.DefaultLoginPolicy.IPThreshold,
+		LoginFailWindow:         limiter.DefaultLoginPolicy.Window,
+		LoginLockoutDuration:    limiter.DefaultLoginPolicy.LockoutDuration,
+		BootstrapAdmin:          "admin",
+		PasswordMinLength:       pwdutil.DefaultPolicy.MinLength,
+		PasswordRating:          string(pwdutil.DefaultPolicy.Rating),
+		AuthProviders:           []string{authn.TypeLocal, authn.TypeLDAP},
 	}
-	return &S
 }
 
 func (s *ServerRunOptions) Flags() (fss cliflag.NamedFlagSets) {
 	fs := fss.FlagSet("generic")
-	fs.BoolVar(&s.DebugMode, "debug", false, "Don't enable this if you don't know what it means.")
-	fs.StringVar(&s.K8sNameSpace, "k8s-namespace", "async-km", "The namespace of k8s cluster.")
-	fs.StringVar(&s.K8sStorageClass, "k8s-storage-class", "async-km-sc", "The storage class of k8s cluster.")
-	fs.StringVar(&s.JWTSecret, "jwt-secret", defaultJwtSecret, "The secret of jet.")
+	fs.BoolVar(&s.DebugMode, "debug", s.DebugMode, "Don't enable this if you don't know what it means.")
+	fs.StringVar(&s.K8sNameSpace, "k8s-namespace", s.K8sNameSpace, "The namespace of k8s cluster.")
+	fs.StringVar(&s.K8sStorageClass, "k8s-storage-class", s.K8sStorageClass, "The storage class of k8s cluster.")
+	fs.StringVar(&s.JWTSecret, "jwt-secret", s.JWTSecret, "The HS256 secret of jwt, a random secret is generated if neither it nor --jwt-signing-key is set.")
+	fs.StringVar(&s.JWTSigningKey, "jwt-signing-key", s.JWTSigningKey, "The PEM file of the RSA, ECDSA or Ed25519 private key signing jwt.")
+	fs.StringSliceVar(&s.JWTVerifyKeys, "jwt-verify-keys", s.JWTVerifyKeys, "The PEM files of the public keys still accepted when verifying jwt, e.g. the previous signing key.")
+	fs.StringVar(&s.CasbinModelPath, "casbin-model", s.CasbinModelPath, "The casbin model file of the API authorization.")
+	fs.IntVar(&s.MaxSessions, "max-sessions", s.MaxSessions, "The maximum concurrent login sessions of a user, the oldest session is logged out when exceeded. 0 means unlimited.")
+	fs.Int64Var(&s.LoginUserThreshold, "login-user-threshold", s.LoginUserThreshold, "The failed logins of a user before the user is locked, 0 disables the limit.")
+	fs.Int64Var(&s.LoginIPThreshold, "login-ip-threshold", s.LoginIPThreshold, "The failed logins from a client IP before the IP is blocked, 0 disables the limit.")
+	fs.DurationVar(&s.LoginFailWindow, "login-fail-window", s.LoginFailWindow, "How long a failed login is counted.")
+	fs.DurationVar(&s.LoginLockoutDuration, "login-lockout-duration", s.LoginLockoutDuration, "How long a user or a client IP stays locked after reaching the threshold.")
+	fs.IntVar(&s.APIUserRateLimit, "api-user-rate-limit", s.APIUserRateLimit, "The API requests allowed per minute of a user, 0 means unlimited.")
+	fs.IntVar(&s.APIIPRateLimit, "api-ip-rate-limit", s.APIIPRateLimit, "The API requests allowed per minute of a client IP, 0 means unlimited.")
+	fs.StringVar(&s.BootstrapAdmin, "bootstrap-admin", s.BootstrapAdmin, "The username of the local admin created on the first start when there is no admin, empty disables it.")
+	fs.StringVar(&s.BootstrapAdminPassword, "bootstrap-admin-password", s.BootstrapAdminPassword, "The password of the bootstrap admin, a random password is generated and printed to stderr once if empty.")
+	fs.IntVar(&s.PasswordMinLength, "password-min-length", s.PasswordMinLength, "The minimum length of the passwords of local accounts.")
+	fs.StringVar(&s.PasswordRating, "password-rating", s.PasswordRating, "The strength required of the passwords of local accounts, one of week, moderate, strong and veryStrong.")
+	fs.StringSliceVar(&s.AuthProviders, "auth-providers", s.AuthProviders, "The enabled authentication providers, any of local, ldap and oidc. The password providers are tried in this order.")
 	s.GenericServerRunOptions.AddFlags(fs)
 	s.CacheOptions.AddFlags(fss.FlagSet("cache"))
 	s.RDBOptions.AddFlags(fss.FlagSet("rdb"))
@@ -57,6 +115,38 @@ func (s *ServerRunOptions) Flags() (fss cliflag.NamedFlagSets) {
 	s.K8sOptions.AddFlags(fss.FlagSet("k8s"))
 	s.KubevirtOptions.AddFlags(fss.FlagSet("kubevirt"))
 	s.LDAPOptions.AddFlags(fss.FlagSet("ldap"))
+	s.LDAPSyncOptions.AddFlags(fss.FlagSet("ldap"))
+	s.CaptchaOptions.AddFlags(fss.FlagSet("captcha"))
+	s.OIDCOptions.AddFlags(fss.FlagSet("oidc"))
 
 	return fss
 }
+
+// ApplyChangedFlags copies the flags explicitly set on the command line into s,
+// so that they take precedence over the values loaded from the config file.
+// Flags are registered with the current values as defaults, so unchanged values are kept.
+func (s *ServerRunOptions) ApplyChangedFlags(changed *pflag.FlagSet) error {
+	fss := s.Flags()
+
+	var err error
+	changed.Visit(func(f *pflag.Flag) {
+		if err != nil {
+			return
+		}
+		for _, fs := range fss.FlagSets {
+			target := fs.Lookup(f.Name)
+			if target == nil {
+				continue
+			}
+			if src, ok := f.Value.(pflag.SliceValue); ok {
+				if dst, ok := target.Value.(pflag.SliceValue); ok {
+					err = dst.Replace(src.GetSlice())
+					return
+				}
+			}
+			err = target.Value.Set(f.Value.String())
+			return
+		}
+	})
+	return err
+}
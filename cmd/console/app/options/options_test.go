@@ -0,0 +1,36 @@
+package options
+
+import (
+	"testing"
+
+	"github.com/spf13/pflag"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestServerRunOptions_ApplyChangedFlags(t *testing.T) {
+	// 模拟命令行解析
+	cmdOpts := NewServerRunOptions()
+	fs := pflag.NewFlagSet("test", pflag.ContinueOnError)
+	for _, f := range cmdOpts.Flags().FlagSets {
+		fs.AddFlagSet(f)
+	}
+	err := fs.Parse([]string{
+		"--k8s-namespace=from-flag",
+		"--kube-in-cluster=true",
+	})
+	require.NoError(t, err)
+
+	// 模拟从配置文件加载的参数
+	opts := NewServerRunOptions()
+	opts.K8sNameSpace = "from-config"
+	opts.K8sStorageClass = "sc-from-config"
+
+	err = opts.ApplyChangedFlags(fs)
+	require.NoError(t, err)
+
+	// 显式指定的参数覆盖配置文件, 未指定的保持配置文件的值
+	assert.Equal(t, "from-flag", opts.K8sNameSpace)
+	assert.Equal(t, true, opts.K8sOptions.InCluster)
+	assert.Equal(t, "sc-from-config", opts.K8sStorageClass)
+}
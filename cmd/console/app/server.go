@@ -3,10 +3,17 @@ package app
 import (
 	"asyncKubeManager/cmd/console/app/options"
 	"asyncKubeManager/pkg/apis/v1/admin"
+	"asyncKubeManager/pkg/apis/v1/directory"
 	"asyncKubeManager/pkg/apis/v1/disk"
+	"asyncKubeManager/pkg/apis/v1/grant"
 	"asyncKubeManager/pkg/apis/v1/logs"
 	"asyncKubeManager/pkg/apis/v1/passport"
+	"asyncKubeManager/pkg/apis/v1/policy"
+	"asyncKubeManager/pkg/apis/v1/project"
+	"asyncKubeManager/pkg/apis/v1/serviceaccount"
 	"asyncKubeManager/pkg/apis/v1/vm"
+	"asyncKubeManager/pkg/apis/wellknown"
+	"asyncKubeManager/pkg/idempotency"
 	"asyncKubeManager/pkg/logger"
 	"asyncKubeManager/pkg/server"
 	"asyncKubeManager/pkg/server/config"
@@ -38,22 +45,18 @@ for managing virtual machines and related resources.`,
 		RunE: func(cmd *cobra.Command, args []string) error {
 			verflag.PrintAndExitIfRequested()
 
-			if errs := s.Validate(); len(errs) != 0 {
-				return utilerrors.NewAggregate(errs)
-			}
-
-			if err := config.ParseConfigFile(s.GenericServerRunOptions.ConfigFilePath); err != nil {
+			opts, err := completeOptions(cmd, s)
+			if err != nil {
 				return err
 			}
 
-			s = config.ConfigToServerRunOptions(config.GetGlobalConfig())
-
-			return Run(s, server.SetupSignalHandler())
+			return Run(opts, server.SetupSignalHandler())
 		},
 		SilenceUsage: true,
 	}
 
-	fs := cmd.Flags()
+	// 标志对子命令同样生效
+	fs := cmd.PersistentFlags()
 	namedFlagSets := s.Flags()
 
 	// 添加全局标志
@@ -69,9 +72,30 @@ for managing virtual machines and related resources.`,
 	cols, _, _ := term.TerminalSize(cmd.OutOrStdout())
 	cliflag.SetUsageAndHelpFunc(cmd, namedFlagSets, cols)
 
+	cmd.AddCommand(newMigrateCommand(s))
+
 	return cmd
 }
 
+// completeOptions loads the config file and applies the flags explicitly set on the command line on top of it.
+func completeOptions(cmd *cobra.Command, s *options.ServerRunOptions) (*options.ServerRunOptions, error) {
+	if err := config.ParseConfigFile(s.GenericServerRunOptions.ConfigFilePath); err != nil {
+		return nil, err
+	}
+
+	// 配置文件作为基础, 命令行显式指定的参数优先
+	opts := configToServerRunOptions(config.GetGlobalConfig())
+	if err := opts.ApplyChangedFlags(cmd.Flags()); err != nil {
+		return nil, err
+	}
+
+	if errs := opts.Validate(); len(errs) != 0 {
+		return nil, utilerrors.NewAggregate(errs)
+	}
+
+	return opts, nil
+}
+
 func Run(s *options.ServerRunOptions, stopCh <-chan struct{}) error {
 	// 创建并初始化服务器
 	server, err := NewConsoleServer(s, stopCh)
@@ -99,7 +123,7 @@ func (s *ConsoleServer) PrepareRun(stopCh <-chan struct{}) error {
 		AllowAllOrigins:  true,
 		AllowCredentials: true,
 		AllowMethods:     []string{http.MethodGet, http.MethodPost, http.MethodPut, http.MethodDelete, http.MethodOptions},
-		AllowHeaders:     []string{"Origin", "Content-Type", "Authorization"},
+		AllowHeaders:     []string{"Origin", "Content-Type", "Authorization", idempotency.HeaderKey, middleware.HeaderProjectID},
 	}))
 
 	if err := s.initSystem(); err != nil {
@@ -145,11 +169,32 @@ func (s *ConsoleServer) Run(stopCh <-chan struct{}) error {
 }
 
 func (s *ConsoleServer) installAPIs() {
+	wellknown.RegisterRouter(&s.router.RouterGroup, s.TokenManager)
+
 	apiV1Group := s.router.Group("/api/v1")
+	if s.IPRateLimiter != nil {
+		apiV1Group.Use(middleware.RateLimit(s.IPRateLimiter, middleware.KeyByIP))
+	}
 	apiV1Group.Use(middleware.AddAuditLog(s.DBResolver))
-	admin.RegisterRouter(apiV1Group, s.TokenManager, s.DBResolver)
-	disk.RegisterRouter(apiV1Group, s.TokenManager, s.DBResolver, s.PVCManager)
-	logs.RegisterRouter(apiV1Group, s.TokenManager, s.DBResolver)
-	passport.RegisterRouter(apiV1Group, s.TokenManager, s.DBResolver, s.LDAPClient)
-	vm.RegisterRouter(apiV1Group, s.TokenManager, s.DBResolver, s.VMManager)
+	// 需要登录的路由依次校验 token, 按用户限流, 校验 casbin 策略, 最后处理 Idempotency-Key
+	authChain := &middleware.AuthChain{
+		TokenManager:     s.TokenManager,
+		Enforcer:         s.Enforcer,
+		UserRateLimiter:  s.UserRateLimiter,
+		IdempotencyStore: s.IdempotencyStore,
+	}
+	// admin, disk 和 vm 的路由在外层路由组统一校验 token 和 casbin 策略
+	authorizedGroup := apiV1Group.Group("", authChain.Handlers()...)
+	admin.RegisterRouter(authorizedGroup, s.TokenManager, s.DBResolver)
+	if s.LDAPClient != nil {
+		directory.RegisterRouter(apiV1Group, authChain, s.DBResolver, s.LDAPClient, s.PasswordPolicy)
+	}
+	disk.RegisterRouter(authorizedGroup, s.TokenManager, s.DBResolver, s.PVCManager)
+	grant.RegisterRouter(apiV1Group, authChain, s.DBResolver)
+	logs.RegisterRouter(apiV1Group, authChain, s.DBResolver)
+	passport.RegisterRouter(apiV1Group, authChain, s.DBResolver, s.Authenticators, s.CacheClient, s.LoginPolicy, s.PasswordPolicy)
+	policy.RegisterRouter(apiV1Group, authChain)
+	project.RegisterRouter(apiV1Group, authChain, s.DBResolver, s.NamespaceManager)
+	serviceaccount.RegisterRouter(apiV1Group, authChain, s.DBResolver)
+	vm.RegisterRouter(authorizedGroup, s.TokenManager, s.DBResolver, s.VMManager)
 }
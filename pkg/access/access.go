@@ -0,0 +1,119 @@
+// Package access checks the roles of users on individual VMs and disks.
+//
+// Every resource has an owner, its creator, and may be shared with other users or
+// groups as viewer or operator. Groups are the casbin roles of the user except the
+// built-in roles, which every user of the console is bound to, see auth.Enforcer.AddUserToGroup.
+// Admins may access every resource, the admins are the users bound to the admin role.
+// The dao functions of VMs and disks check the role of the subject, this package resolves
+// the subject and the project of a request for them.
+package access
+
+import (
+	"asyncKubeManager/pkg/auth"
+	"asyncKubeManager/pkg/dao"
+	"asyncKubeManager/pkg/dbresolver"
+	"asyncKubeManager/pkg/model"
+	"asyncKubeManager/pkg/server/errutil"
+	"asyncKubeManager/pkg/tenant"
+	"asyncKubeManager/pkg/token"
+	"context"
+)
+
+// Subject is the user accessing a resource, the dao functions of VMs and disks check its role.
+type Subject = dao.Subject
+
+// SubjectFromCtx returns the user of the request, its groups are the roles it is bound to in the enforcer.
+// The role claim of the token is not used, it is stale until the token expires when the role of the user changes.
+func SubjectFromCtx(ctx context.Context, enforcer *auth.Enforcer) (Subject, error) {
+	payload, err := token.PayloadFromCtx(ctx)
+	if err != nil {
+		return Subject{}, errutil.ErrUnauthorized
+	}
+
+	roles, err := enforcer.GetUserRoles(payload.UID)
+	if err != nil {
+		return Subject{}, err
+	}
+	// 内置角色不是用户组, 授权给 normal 等同于共享给所有用户
+	subject := Subject{UID: payload.UID}
+	for _, role := range roles {
+		switch {
+		case role == string(model.UserRoleAdmin):
+			subject.Admin = true
+		case !model.UserRole(role).Builtin():
+			subject.Groups = append(subject.Groups, role)
+		}
+	}
+	return subject, nil
+}
+
+// Role returns the role of the subject on the resource, admins are owners of every resource.
+func Role(ctx context.Context, dbResolver *dbresolver.DBResolver, subject Subject, resourceType model.ResourceType, resourceID int64) (model.ResourceRole, error) {
+	return dao.GetSubjectResourceRole(ctx, dbResolver, subject, resourceType, resourceID)
+}
+
+// Check returns errutil.ErrPermissionDenied if the subject doesn't have the role need on the resource.
+func Check(ctx context.Context, dbResolver *dbresolver.DBResolver, subject Subject, resourceType model.ResourceType, resourceID int64, need model.ResourceRole) error {
+	role, err := Role(ctx, dbResolver, subject, resourceType, resourceID)
+	if err != nil {
+		return err
+	}
+	if !role.Allows(need) {
+		return errutil.ErrPermissionDenied
+	}
+	return nil
+}
+
+// GetVM retrieves the VM and checks that the subject has the role need on it.
+// A VM the subject can't see at all is reported as not found.
+func GetVM(ctx context.Context, dbResolver *dbresolver.DBResolver, subject Subject, id int64, need model.ResourceRole) (*model.VM, error) {
+	found, vm, err := dao.GetVMByID(ctx, dbResolver, subject, id, need)
+	if err != nil {
+		return nil, err
+	}
+	if !found {
+		return nil, errutil.ErrNotFound
+	}
+	return vm, nil
+}
+
+// GetVMByName is GetVM of the VM with the name in the project of the request, see middleware.ProjectScope.
+func GetVMByName(ctx context.Context, dbResolver *dbresolver.DBResolver, subject Subject, name string, need model.ResourceRole) (*model.VM, error) {
+	projectID := tenant.GetProjectIDFromCtx(ctx)
+	if projectID == 0 {
+		return nil, errutil.ErrProjectNotFound
+	}
+	found, vm, err := dao.GetVMByName(ctx, dbResolver, subject, projectID, name, need)
+	if err != nil {
+		return nil, err
+	}
+	if !found {
+		return nil, errutil.ErrNotFound
+	}
+	return vm, nil
+}
+
+// CheckDisk checks that the subject has the role need on the disk, a disk the subject
+// can't see at all is reported as not found like GetVM.
+func CheckDisk(ctx context.Context, dbResolver *dbresolver.DBResolver, subject Subject, id int64, need model.ResourceRole) error {
+	return dao.CheckDisk(ctx, dbResolver, subject, id, need)
+}
+
+// ListVMs retrieves the VMs of the project of the request visible to the subject, admins see all VMs of the project.
+func ListVMs(ctx context.Context, dbResolver *dbresolver.DBResolver, subject Subject) ([]model.VM, error) {
+	projectID := tenant.GetProjectIDFromCtx(ctx)
+	if projectID == 0 {
+		return nil, errutil.ErrProjectNotFound
+	}
+	return dao.ListVMs(ctx, dbResolver, subject, projectID)
+}
+
+// ListDiskIDs retrieves the ids of the disks of the project of the request visible to the subject,
+// admins see all disks of the project.
+func ListDiskIDs(ctx context.Context, dbResolver *dbresolver.DBResolver, subject Subject) ([]int64, error) {
+	projectID := tenant.GetProjectIDFromCtx(ctx)
+	if projectID == 0 {
+		return nil, errutil.ErrProjectNotFound
+	}
+	return dao.ListDiskIDs(ctx, dbResolver, subject, projectID)
+}
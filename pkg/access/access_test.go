@@ -0,0 +1,151 @@
+package access
+
+import (
+	"asyncKubeManager/pkg/auth"
+	"asyncKubeManager/pkg/dao"
+	"asyncKubeManager/pkg/model"
+	"asyncKubeManager/pkg/server/errutil"
+	"asyncKubeManager/pkg/tenant"
+	"asyncKubeManager/pkg/testutil"
+	"asyncKubeManager/pkg/token"
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestVMAccess(t *testing.T) {
+	dr := testutil.NewDBResolver(t)
+	ctx := token.WithPayload(context.Background(), token.Info{UID: "alice", RoleID: model.UserRoleNormal})
+
+	vm, err := dao.InsertVM(ctx, dr, 1, "vm-1", "ubuntu", "vm-uid-1", 2, 2048)
+	require.NoError(t, err)
+	_, err = dao.InsertVM(ctx, dr, 1, "vm-2", "ubuntu", "vm-uid-2", 2, 2048)
+	require.NoError(t, err)
+	// 其他项目中的同名虚拟机
+	_, err = dao.InsertVM(token.WithPayload(ctx, token.Info{UID: "dave"}), dr, 2, "vm-1", "ubuntu", "vm-uid-3", 2, 2048)
+	require.NoError(t, err)
+
+	alice := Subject{UID: "alice", Groups: []string{"normal"}}
+	bob := Subject{UID: "bob", Groups: []string{"normal"}}
+	carol := Subject{UID: "carol", Groups: []string{"ops"}}
+	admin := Subject{UID: "root", Admin: true}
+
+	_, err = GetVM(ctx, dr, alice, vm.ID, model.ResourceRoleOwner)
+	assert.NoError(t, err)
+	// 没有任何授权的虚拟机对用户不可见
+	_, err = GetVM(ctx, dr, bob, vm.ID, model.ResourceRoleViewer)
+	assert.Equal(t, errutil.ErrNotFound, err)
+	_, err = GetVM(ctx, dr, admin, vm.ID, model.ResourceRoleOwner)
+	assert.NoError(t, err)
+	// 按名称查找时只查找请求所在项目的虚拟机
+	_, err = GetVMByName(ctx, dr, alice, "vm-1", model.ResourceRoleOwner)
+	assert.Equal(t, errutil.ErrProjectNotFound, err)
+	projectCtx := tenant.WithProject(ctx, &model.Project{ID: 1})
+	got, err := GetVMByName(projectCtx, dr, alice, "vm-1", model.ResourceRoleOwner)
+	require.NoError(t, err)
+	assert.Equal(t, vm.ID, got.ID)
+	_, err = GetVMByName(projectCtx, dr, bob, "vm-1", model.ResourceRoleViewer)
+	assert.Equal(t, errutil.ErrNotFound, err)
+	got, err = GetVMByName(tenant.WithProject(ctx, &model.Project{ID: 2}), dr, Subject{UID: "dave"}, "vm-1", model.ResourceRoleOwner)
+	require.NoError(t, err)
+	assert.NotEqual(t, vm.ID, got.ID)
+
+	require.NoError(t, dao.SaveResourceGrant(ctx, dr, &model.ResourceGrant{
+		ResourceType: model.ResourceTypeVM, ResourceID: vm.ID,
+		SubjectType: model.GrantSubjectUser, Subject: "bob", Role: model.ResourceRoleViewer,
+	}))
+	require.NoError(t, dao.SaveResourceGrant(ctx, dr, &model.ResourceGrant{
+		ResourceType: model.ResourceTypeVM, ResourceID: vm.ID,
+		SubjectType: model.GrantSubjectGroup, Subject: "ops", Role: model.ResourceRoleOperator,
+	}))
+
+	_, err = GetVM(ctx, dr, bob, vm.ID, model.ResourceRoleViewer)
+	assert.NoError(t, err)
+	_, err = GetVM(ctx, dr, bob, vm.ID, model.ResourceRoleOperator)
+	assert.Equal(t, errutil.ErrPermissionDenied, err)
+	assert.NoError(t, Check(ctx, dr, carol, model.ResourceTypeVM, vm.ID, model.ResourceRoleOperator))
+	assert.Equal(t, errutil.ErrPermissionDenied, Check(ctx, dr, carol, model.ResourceTypeVM, vm.ID, model.ResourceRoleOwner))
+
+	// 再次授权时更新角色
+	require.NoError(t, dao.SaveResourceGrant(ctx, dr, &model.ResourceGrant{
+		ResourceType: model.ResourceTypeVM, ResourceID: vm.ID,
+		SubjectType: model.GrantSubjectUser, Subject: "bob", Role: model.ResourceRoleOperator,
+	}))
+	assert.NoError(t, Check(ctx, dr, bob, model.ResourceTypeVM, vm.ID, model.ResourceRoleOperator))
+
+	// 列表只包含请求所在项目的虚拟机
+	_, err = ListVMs(ctx, dr, alice)
+	assert.Equal(t, errutil.ErrProjectNotFound, err)
+	vms, err := ListVMs(projectCtx, dr, alice)
+	require.NoError(t, err)
+	assert.Len(t, vms, 2)
+	vms, err = ListVMs(projectCtx, dr, bob)
+	require.NoError(t, err)
+	require.Len(t, vms, 1)
+	assert.Equal(t, vm.ID, vms[0].ID)
+	vms, err = ListVMs(projectCtx, dr, admin)
+	require.NoError(t, err)
+	assert.Len(t, vms, 2)
+
+	grants, err := dao.ListResourceGrants(ctx, dr, model.ResourceTypeVM, vm.ID)
+	require.NoError(t, err)
+	require.Len(t, grants, 3)
+	assert.Equal(t, model.ResourceRoleOwner, grants[0].Role)
+
+	// 删除虚拟机时删除所有授权
+	assert.Equal(t, errutil.ErrPermissionDenied, dao.DeleteVMByID(ctx, dr, bob, vm.ID))
+	require.NoError(t, dao.DeleteVMByID(ctx, dr, alice, vm.ID))
+	grants, err = dao.ListResourceGrants(ctx, dr, model.ResourceTypeVM, vm.ID)
+	require.NoError(t, err)
+	assert.Empty(t, grants)
+}
+
+func TestSubjectFromCtx(t *testing.T) {
+	dr := testutil.NewDBResolver(t)
+	enforcer, err := auth.NewEnforcer(dr.GetDB(), "../../"+auth.DefaultModelPath)
+	require.NoError(t, err)
+	require.NoError(t, enforcer.SetUserRole("alice", string(model.UserRoleAdmin)))
+	require.NoError(t, enforcer.AddUserToGroup("alice", "ops"))
+
+	_, err = SubjectFromCtx(context.Background(), enforcer)
+	assert.Equal(t, errutil.ErrUnauthorized, err)
+
+	ctx := token.WithPayload(context.Background(), token.Info{UID: "alice", RoleID: model.UserRoleAdmin})
+	subject, err := SubjectFromCtx(ctx, enforcer)
+	require.NoError(t, err)
+	assert.Equal(t, Subject{UID: "alice", Groups: []string{"ops"}, Admin: true}, subject)
+
+	// 降级后即使 token 中仍是管理员也不再是管理员, 用户组保留
+	require.NoError(t, enforcer.SetUserRole("alice", string(model.UserRoleNormal)))
+	subject, err = SubjectFromCtx(ctx, enforcer)
+	require.NoError(t, err)
+	assert.Equal(t, Subject{UID: "alice", Groups: []string{"ops"}}, subject)
+
+	// 内置角色不作为用户组
+	require.NoError(t, enforcer.SetUserRole("bob", string(model.UserRoleNormal)))
+	ctx = token.WithPayload(context.Background(), token.Info{UID: "bob", RoleID: model.UserRoleNormal})
+	subject, err = SubjectFromCtx(ctx, enforcer)
+	require.NoError(t, err)
+	assert.Empty(t, subject.Groups)
+	assert.ErrorIs(t, enforcer.AddUserToGroup("bob", string(model.UserRoleAdmin)), auth.ErrBuiltinGroup)
+}
+
+func TestCheckDisk(t *testing.T) {
+	dr := testutil.NewDBResolver(t)
+	ctx := context.Background()
+	require.NoError(t, dao.SaveResourceGrant(ctx, dr, &model.ResourceGrant{
+		ResourceType: model.ResourceTypeDisk, ResourceID: 1,
+		SubjectType: model.GrantSubjectUser, Subject: "alice", Role: model.ResourceRoleOwner,
+	}))
+	require.NoError(t, dao.SaveResourceGrant(ctx, dr, &model.ResourceGrant{
+		ResourceType: model.ResourceTypeDisk, ResourceID: 1,
+		SubjectType: model.GrantSubjectUser, Subject: "bob", Role: model.ResourceRoleViewer,
+	}))
+
+	assert.NoError(t, CheckDisk(ctx, dr, Subject{UID: "alice"}, 1, model.ResourceRoleOwner))
+	assert.Equal(t, errutil.ErrPermissionDenied, CheckDisk(ctx, dr, Subject{UID: "bob"}, 1, model.ResourceRoleOperator))
+	assert.Equal(t, errutil.ErrNotFound, CheckDisk(ctx, dr, Subject{UID: "carol"}, 1, model.ResourceRoleViewer))
+	assert.NoError(t, CheckDisk(ctx, dr, Subject{UID: "root", Admin: true}, 1, model.ResourceRoleOwner))
+}
@@ -0,0 +1,541 @@
+package directory
+
+import (
+	"asyncKubeManager/pkg/apis/v1/logs"
+	"asyncKubeManager/pkg/authn"
+	"asyncKubeManager/pkg/client/ldap"
+	"asyncKubeManager/pkg/dao"
+	"asyncKubeManager/pkg/dbresolver"
+	"asyncKubeManager/pkg/model"
+	"asyncKubeManager/pkg/server/encoding"
+	"asyncKubeManager/pkg/server/errutil"
+	"asyncKubeManager/pkg/server/request"
+	"asyncKubeManager/pkg/token"
+	"asyncKubeManager/pkg/types"
+	"asyncKubeManager/pkg/utils"
+	"asyncKubeManager/pkg/utils/pwdutil"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+type directoryHandlerOption struct {
+	dbResolver     *dbresolver.DBResolver
+	userLogout     *authn.UserLogout
+	ldapClient     *ldap.LDAPClient
+	passwordPolicy pwdutil.Policy
+}
+
+type directoryHandler struct {
+	directoryHandlerOption
+}
+
+func newDirectoryHandler(option directoryHandlerOption) *directoryHandler {
+	return &directoryHandler{
+		directoryHandlerOption: option,
+	}
+}
+
+// 获取 LDAP 用户列表
+func (h *directoryHandler) listUsers(c *gin.Context) {
+	users, err := h.ldapClient.ListUsers()
+	if err != nil {
+		h.handleLDAPError(c, "ListUsers", err)
+		return
+	}
+
+	resp := make([]ldapUser, 0, len(users))
+	for _, u := range users {
+		resp = append(resp, toLDAPUser(u))
+	}
+	encoding.HandleSuccessList(c, int64(len(resp)), resp)
+}
+
+// 获取 LDAP 用户详情
+func (h *directoryHandler) getUser(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c, types.DefaultTimeout)
+	defer cancel()
+
+	req := userReq{}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		encoding.HandleError(c, errutil.ErrJSONFormat)
+		return
+	}
+
+	if err := request.ValidateStruct(ctx, req); err != nil {
+		encoding.HandleError(c, err)
+		return
+	}
+
+	user, err := h.ldapClient.FindUserByUID(req.UID)
+	if err != nil {
+		h.handleLDAPError(c, "FindUserByUID", err)
+		return
+	}
+
+	encoding.HandleSuccess(c, toLDAPUser(user))
+}
+
+// 创建 LDAP 用户, 密码通过密码修改扩展操作设置
+func (h *directoryHandler) createUser(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c, types.DefaultTimeout)
+	defer cancel()
+
+	req := createUserReq{}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		encoding.HandleError(c, errutil.ErrJSONFormat)
+		return
+	}
+
+	if err := request.ValidateStruct(ctx, req); err != nil {
+		encoding.HandleError(c, err)
+		return
+	}
+
+	if req.Password != "" {
+		if err := h.passwordPolicy.Check(req.Password); err != nil {
+			encoding.HandleError(c, errutil.NewError(http.StatusBadRequest, err.Error()))
+			return
+		}
+	}
+
+	user := &model.LdapUser{
+		DN:              h.ldapClient.UserDN(req.CN, req.OU),
+		CN:              req.CN,
+		OU:              req.OU,
+		UID:             req.UID,
+		SN:              req.SN,
+		GivenName:       req.GivenName,
+		TelephoneNumber: req.Tel,
+		Mail:            req.Mail,
+		GIDNumber:       req.GIDNumber,
+		UIDNumber:       req.UIDNumber,
+		HomeDirectory:   req.HomeDirectory,
+	}
+	if user.HomeDirectory == "" {
+		user.HomeDirectory = "/home/" + req.UID
+	}
+	if err := user.Validate(); err != nil {
+		encoding.HandleError(c, errutil.NewError(http.StatusBadRequest, err.Error()))
+		return
+	}
+
+	if err := h.ldapClient.CreateUser(user, req.Password); err != nil {
+		h.handleLDAPError(c, "CreateUser", err)
+		return
+	}
+	h.audit(ctx, model.UserOperatorLDAPUser, fmt.Sprintf("user %s created as %s", user.UID, user.DN))
+
+	encoding.HandleSuccess(c, toLDAPUser(user))
+}
+
+// 更新 LDAP 用户属性, cn 和 ou 属于 DN 不能修改
+func (h *directoryHandler) updateUser(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c, types.DefaultTimeout)
+	defer cancel()
+
+	req := updateUserReq{}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		encoding.HandleError(c, errutil.ErrJSONFormat)
+		return
+	}
+
+	if err := request.ValidateStruct(ctx, req); err != nil {
+		encoding.HandleError(c, err)
+		return
+	}
+
+	user, err := h.ldapClient.FindUserByUID(req.UID)
+	if err != nil {
+		h.handleLDAPError(c, "FindUserByUID", err)
+		return
+	}
+
+	var changes []string
+	for _, field := range []struct {
+		name  string
+		value string
+		dest  *string
+	}{
+		{"sn", req.SN, &user.SN},
+		{"givenName", req.GivenName, &user.GivenName},
+		{"mail", req.Mail, &user.Mail},
+		{"telephoneNumber", req.Tel, &user.TelephoneNumber},
+		{"gidNumber", req.GIDNumber, &user.GIDNumber},
+		{"homeDirectory", req.HomeDirectory, &user.HomeDirectory},
+	} {
+		if field.value == "" || field.value == *field.dest {
+			continue
+		}
+		changes = append(changes, fmt.Sprintf("%s changed from %s to %s", field.name, *field.dest, field.value))
+		*field.dest = field.value
+	}
+	if len(changes) == 0 {
+		encoding.HandleSuccess(c, toLDAPUser(user))
+		return
+	}
+
+	if err = user.Validate(); err != nil {
+		encoding.HandleError(c, errutil.NewError(http.StatusBadRequest, err.Error()))
+		return
+	}
+	if err = h.ldapClient.UpdateUser(user); err != nil {
+		h.handleLDAPError(c, "UpdateUser", err)
+		return
+	}
+	h.audit(ctx, model.UserOperatorLDAPUser, fmt.Sprintf("user %s updated: %v", user.UID, changes))
+
+	encoding.HandleSuccess(c, toLDAPUser(user))
+}
+
+// 禁用 LDAP 用户, 已登录过的平台用户同时被禁用并下线
+func (h *directoryHandler) disableUser(c *gin.Context) {
+	h.setUserDisabled(c, true)
+}
+
+// 启用 LDAP 用户, 平台用户同时被启用
+func (h *directoryHandler) enableUser(c *gin.Context) {
+	h.setUserDisabled(c, false)
+}
+
+func (h *directoryHandler) setUserDisabled(c *gin.Context, disabled bool) {
+	ctx, cancel := context.WithTimeout(c, types.DefaultTimeout)
+	defer cancel()
+
+	req := userReq{}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		encoding.HandleError(c, errutil.ErrJSONFormat)
+		return
+	}
+
+	if err := request.ValidateStruct(ctx, req); err != nil {
+		encoding.HandleError(c, err)
+		return
+	}
+
+	user, err := h.ldapClient.FindUserByUID(req.UID)
+	if err != nil {
+		h.handleLDAPError(c, "FindUserByUID", err)
+		return
+	}
+	if err = h.ldapClient.SetUserDisabled(user.DN, disabled); err != nil {
+		h.handleLDAPError(c, "SetUserDisabled", err)
+		return
+	}
+
+	status := model.UserStatusEnabled
+	if disabled {
+		status = model.UserStatusDisabled
+	}
+	operation := fmt.Sprintf("user %s %s", user.UID, status)
+
+	// 同步平台用户状态, 否则禁用的用户在 token 过期前仍可访问
+	found, consoleUser, err := dao.GetUserByIdentity(ctx, h.dbResolver, model.AuthSourceLDAP, user.UID)
+	if err != nil {
+		zap.L().Error("GetUserByIdentity", zap.Error(err))
+		encoding.HandleError(c, errutil.ErrInternalServer)
+		return
+	}
+	if found && consoleUser.Status != status {
+		if err = dao.UpdateUserByID(ctx, h.dbResolver, consoleUser.UID, map[string]interface{}{"status": status}); err != nil {
+			zap.L().Error("UpdateUserByID", zap.Error(err))
+			encoding.HandleError(c, errutil.ErrInternalServer)
+			return
+		}
+		if disabled {
+			if err = h.userLogout.Logout(ctx, consoleUser.UID); err != nil {
+				zap.L().Error("Logout", zap.Error(err))
+				encoding.HandleError(c, errutil.ErrInternalServer)
+				return
+			}
+		}
+		operation += fmt.Sprintf(", console user %s %s", consoleUser.UID, status)
+	}
+	h.audit(ctx, model.UserOperatorLDAPUser, operation)
+
+	encoding.HandleSuccess(c)
+}
+
+// 重置 LDAP 用户密码
+func (h *directoryHandler) resetPassword(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c, types.DefaultTimeout)
+	defer cancel()
+
+	req := resetPasswordReq{}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		encoding.HandleError(c, errutil.ErrJSONFormat)
+		return
+	}
+
+	if err := request.ValidateStruct(ctx, req); err != nil {
+		encoding.HandleError(c, err)
+		return
+	}
+
+	if err := h.passwordPolicy.Check(req.Password); err != nil {
+		encoding.HandleError(c, errutil.NewError(http.StatusBadRequest, err.Error()))
+		return
+	}
+
+	user, err := h.ldapClient.FindUserByUID(req.UID)
+	if err != nil {
+		h.handleLDAPError(c, "FindUserByUID", err)
+		return
+	}
+	if err = h.ldapClient.ResetPassword(user.DN, req.Password); err != nil {
+		h.handleLDAPError(c, "ResetPassword", err)
+		return
+	}
+	operation := fmt.Sprintf("user %s password reset", user.UID)
+
+	// 与本地用户修改密码一样, 旧密码签发的 token 全部失效
+	found, consoleUser, err := dao.GetUserByIdentity(ctx, h.dbResolver, model.AuthSourceLDAP, user.UID)
+	if err != nil {
+		zap.L().Error("GetUserByIdentity", zap.Error(err))
+		encoding.HandleError(c, errutil.ErrInternalServer)
+		return
+	}
+	if found {
+		if err = h.userLogout.Logout(ctx, consoleUser.UID); err != nil {
+			zap.L().Error("Logout", zap.Error(err))
+			encoding.HandleError(c, errutil.ErrInternalServer)
+			return
+		}
+		operation += fmt.Sprintf(", console user %s logged out", consoleUser.UID)
+	}
+	h.audit(ctx, model.UserOperatorLDAPUser, operation)
+
+	encoding.HandleSuccess(c)
+}
+
+// 获取 LDAP 组列表
+func (h *directoryHandler) listGroups(c *gin.Context) {
+	groups, err := h.ldapClient.ListGroups()
+	if err != nil {
+		h.handleLDAPError(c, "ListGroups", err)
+		return
+	}
+
+	resp := make([]ldapGroup, 0, len(groups))
+	for _, g := range groups {
+		resp = append(resp, toLDAPGroup(g))
+	}
+	encoding.HandleSuccessList(c, int64(len(resp)), resp)
+}
+
+// 获取 LDAP 组详情
+func (h *directoryHandler) getGroup(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c, types.DefaultTimeout)
+	defer cancel()
+
+	req := groupReq{}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		encoding.HandleError(c, errutil.ErrJSONFormat)
+		return
+	}
+
+	if err := request.ValidateStruct(ctx, req); err != nil {
+		encoding.HandleError(c, err)
+		return
+	}
+
+	group, err := h.ldapClient.FindGroupByCN(req.CN)
+	if err != nil {
+		h.handleLDAPError(c, "FindGroupByCN", err)
+		return
+	}
+
+	encoding.HandleSuccess(c, toLDAPGroup(group))
+}
+
+// 创建 LDAP 组
+func (h *directoryHandler) createGroup(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c, types.DefaultTimeout)
+	defer cancel()
+
+	req := createGroupReq{}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		encoding.HandleError(c, errutil.ErrJSONFormat)
+		return
+	}
+
+	if err := request.ValidateStruct(ctx, req); err != nil {
+		encoding.HandleError(c, err)
+		return
+	}
+
+	group := &model.LdapGroup{
+		DN:         h.ldapClient.GroupDN(req.CN, req.OU),
+		CN:         req.CN,
+		OU:         req.OU,
+		GIDNumber:  req.GIDNumber,
+		MemberUIDs: req.MemberUIDs,
+	}
+	if err := group.Validate(); err != nil {
+		encoding.HandleError(c, errutil.NewError(http.StatusBadRequest, err.Error()))
+		return
+	}
+
+	if err := h.ldapClient.CreateGroup(group); err != nil {
+		h.handleLDAPError(c, "CreateGroup", err)
+		return
+	}
+	h.audit(ctx, model.UserOperatorLDAPGroup, fmt.Sprintf("group %s created as %s with members %v", group.CN, group.DN, group.MemberUIDs))
+
+	encoding.HandleSuccess(c, toLDAPGroup(group))
+}
+
+// 更新 LDAP 组的 gidNumber
+func (h *directoryHandler) updateGroup(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c, types.DefaultTimeout)
+	defer cancel()
+
+	req := updateGroupReq{}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		encoding.HandleError(c, errutil.ErrJSONFormat)
+		return
+	}
+
+	if err := request.ValidateStruct(ctx, req); err != nil {
+		encoding.HandleError(c, err)
+		return
+	}
+
+	group, err := h.ldapClient.FindGroupByCN(req.CN)
+	if err != nil {
+		h.handleLDAPError(c, "FindGroupByCN", err)
+		return
+	}
+	if group.GIDNumber == req.GIDNumber {
+		encoding.HandleSuccess(c, toLDAPGroup(group))
+		return
+	}
+
+	change := fmt.Sprintf("gidNumber changed from %s to %s", group.GIDNumber, req.GIDNumber)
+	group.GIDNumber = req.GIDNumber
+	if err = group.Validate(); err != nil {
+		encoding.HandleError(c, errutil.NewError(http.StatusBadRequest, err.Error()))
+		return
+	}
+	if err = h.ldapClient.UpdateGroup(group); err != nil {
+		h.handleLDAPError(c, "UpdateGroup", err)
+		return
+	}
+	h.audit(ctx, model.UserOperatorLDAPGroup, fmt.Sprintf("group %s updated: %s", group.CN, change))
+
+	encoding.HandleSuccess(c, toLDAPGroup(group))
+}
+
+// 删除 LDAP 组, 组映射的角色和项目在下次同步时收回
+func (h *directoryHandler) deleteGroup(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c, types.DefaultTimeout)
+	defer cancel()
+
+	req := groupReq{}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		encoding.HandleError(c, errutil.ErrJSONFormat)
+		return
+	}
+
+	if err := request.ValidateStruct(ctx, req); err != nil {
+		encoding.HandleError(c, err)
+		return
+	}
+
+	group, err := h.ldapClient.FindGroupByCN(req.CN)
+	if err != nil {
+		h.handleLDAPError(c, "FindGroupByCN", err)
+		return
+	}
+	if err = h.ldapClient.Delete(group.DN); err != nil {
+		h.handleLDAPError(c, "Delete", err)
+		return
+	}
+	h.audit(ctx, model.UserOperatorLDAPGroup, fmt.Sprintf("group %s deleted with members %v", group.DN, group.MemberUIDs))
+
+	encoding.HandleSuccess(c)
+}
+
+// 添加 LDAP 组成员
+func (h *directoryHandler) addGroupMember(c *gin.Context) {
+	h.changeGroupMember(c, true)
+}
+
+// 移除 LDAP 组成员
+func (h *directoryHandler) removeGroupMember(c *gin.Context) {
+	h.changeGroupMember(c, false)
+}
+
+func (h *directoryHandler) changeGroupMember(c *gin.Context, add bool) {
+	ctx, cancel := context.WithTimeout(c, types.DefaultTimeout)
+	defer cancel()
+
+	req := groupMemberReq{}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		encoding.HandleError(c, errutil.ErrJSONFormat)
+		return
+	}
+
+	if err := request.ValidateStruct(ctx, req); err != nil {
+		encoding.HandleError(c, err)
+		return
+	}
+
+	group, err := h.ldapClient.FindGroupByCN(req.CN)
+	if err != nil {
+		h.handleLDAPError(c, "FindGroupByCN", err)
+		return
+	}
+
+	var operation string
+	if add {
+		// 只能添加目录中存在的用户
+		if _, err = h.ldapClient.FindUserByUID(req.UID); err != nil {
+			h.handleLDAPError(c, "FindUserByUID", err)
+			return
+		}
+		err = h.ldapClient.AddGroupMember(group.DN, req.UID)
+		operation = fmt.Sprintf("user %s added to group %s", req.UID, group.CN)
+	} else {
+		err = h.ldapClient.RemoveGroupMember(group.DN, req.UID)
+		operation = fmt.Sprintf("user %s removed from group %s", req.UID, group.CN)
+	}
+	if err != nil {
+		h.handleLDAPError(c, "changeGroupMember", err)
+		return
+	}
+	h.audit(ctx, model.UserOperatorLDAPGroup, operation)
+
+	encoding.HandleSuccess(c)
+}
+
+// audit 记录管理员对目录的修改, UID 为操作的管理员
+func (h *directoryHandler) audit(ctx context.Context, operator model.UserOperatorType, operation string) {
+	uid := token.GetUIDFromCtx(ctx)
+	logs.UserOperatorLogChannel <- &model.UserOperatorLog{
+		UID:       uid,
+		Operator:  operator,
+		Operation: utils.TruncateString(operation, 255),
+		CreatedAt: time.Now().UnixMilli(),
+		Creator:   uid,
+	}
+}
+
+func (h *directoryHandler) handleLDAPError(c *gin.Context, op string, err error) {
+	switch {
+	case errors.Is(err, ldap.ErrUserNotFound):
+		encoding.HandleError(c, errutil.ErrUserNotFound)
+	case errors.Is(err, ldap.ErrGroupNotFound):
+		encoding.HandleError(c, errutil.ErrNotFound)
+	case errors.Is(err, ldap.ErrEntryExists):
+		encoding.HandleError(c, errutil.NewError(http.StatusBadRequest, "ldap entry already exists"))
+	default:
+		zap.L().Error(op, zap.Error(err))
+		encoding.HandleError(c, errutil.ErrInternalServer)
+	}
+}
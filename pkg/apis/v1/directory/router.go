@@ -0,0 +1,42 @@
+package directory
+
+import (
+	"asyncKubeManager/pkg/authn"
+	"asyncKubeManager/pkg/client/ldap"
+	"asyncKubeManager/pkg/dbresolver"
+	"asyncKubeManager/pkg/server/middleware"
+	"asyncKubeManager/pkg/utils/pwdutil"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RegisterRouter 注册 LDAP 用户与组的管理路由, 默认策略下只有管理员可以访问
+func RegisterRouter(group *gin.RouterGroup, authChain *middleware.AuthChain, dbResolver *dbresolver.DBResolver,
+	ldapClient *ldap.LDAPClient, passwordPolicy pwdutil.Policy) {
+	directoryG := group.Group("/directory")
+
+	handler := newDirectoryHandler(directoryHandlerOption{
+		dbResolver:     dbResolver,
+		userLogout:     authn.NewUserLogout(authChain.TokenManager, dbResolver),
+		ldapClient:     ldapClient,
+		passwordPolicy: passwordPolicy,
+	})
+
+	directoryG.Use(authChain.Handlers()...)
+
+	directoryG.POST("/user/list", handler.listUsers)
+	directoryG.POST("/user/get", handler.getUser)
+	directoryG.POST("/user/create", handler.createUser)
+	directoryG.POST("/user/update", handler.updateUser)
+	directoryG.POST("/user/disable", handler.disableUser)
+	directoryG.POST("/user/enable", handler.enableUser)
+	directoryG.POST("/user/reset_password", handler.resetPassword)
+
+	directoryG.POST("/group/list", handler.listGroups)
+	directoryG.POST("/group/get", handler.getGroup)
+	directoryG.POST("/group/create", handler.createGroup)
+	directoryG.POST("/group/update", handler.updateGroup)
+	directoryG.POST("/group/delete", handler.deleteGroup)
+	directoryG.POST("/group/add_member", handler.addGroupMember)
+	directoryG.POST("/group/remove_member", handler.removeGroupMember)
+}
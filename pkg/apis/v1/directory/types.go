@@ -0,0 +1,115 @@
+package directory
+
+import "asyncKubeManager/pkg/model"
+
+type (
+	createUserReq struct {
+		UID       string `json:"uid" validate:"required,lte=32"`
+		CN        string `json:"cn" validate:"required,lte=64"`
+		SN        string `json:"sn" validate:"required,lte=64"`
+		GivenName string `json:"given_name" validate:"omitempty,lte=64"`
+		// OU is the organizational unit under the base DN the user is created in
+		OU            string `json:"ou" validate:"required,lte=64"`
+		Mail          string `json:"mail" validate:"omitempty,email"`
+		Tel           string `json:"tel" validate:"omitempty,lte=32"`
+		UIDNumber     string `json:"uid_number" validate:"required,numeric"`
+		GIDNumber     string `json:"gid_number" validate:"required,numeric"`
+		HomeDirectory string `json:"home_directory" validate:"omitempty,startswith=/"`
+		// Password is checked by the password policy, the user can't log in until a password is set if empty
+		Password string `json:"password" validate:"omitempty"`
+	}
+
+	// 为空的字段保持不变
+	updateUserReq struct {
+		UID           string `json:"uid" validate:"required,lte=32"`
+		SN            string `json:"sn" validate:"omitempty,lte=64"`
+		GivenName     string `json:"given_name" validate:"omitempty,lte=64"`
+		Mail          string `json:"mail" validate:"omitempty,email"`
+		Tel           string `json:"tel" validate:"omitempty,lte=32"`
+		GIDNumber     string `json:"gid_number" validate:"omitempty,numeric"`
+		HomeDirectory string `json:"home_directory" validate:"omitempty,startswith=/"`
+	}
+
+	userReq struct {
+		UID string `json:"uid" validate:"required,lte=32"`
+	}
+
+	resetPasswordReq struct {
+		UID      string `json:"uid" validate:"required,lte=32"`
+		Password string `json:"password" validate:"required"`
+	}
+
+	createGroupReq struct {
+		CN         string   `json:"cn" validate:"required,lte=64"`
+		OU         string   `json:"ou" validate:"required,lte=64"`
+		GIDNumber  string   `json:"gid_number" validate:"required,numeric"`
+		MemberUIDs []string `json:"member_uids" validate:"omitempty,dive,required,lte=32"`
+	}
+
+	updateGroupReq struct {
+		CN        string `json:"cn" validate:"required,lte=64"`
+		GIDNumber string `json:"gid_number" validate:"required,numeric"`
+	}
+
+	groupReq struct {
+		CN string `json:"cn" validate:"required,lte=64"`
+	}
+
+	groupMemberReq struct {
+		CN  string `json:"cn" validate:"required,lte=64"`
+		UID string `json:"uid" validate:"required,lte=32"`
+	}
+
+	// ldapUser is model.LdapUser without the password
+	ldapUser struct {
+		DN            string   `json:"dn"`
+		CN            string   `json:"cn"`
+		OU            string   `json:"ou"`
+		UID           string   `json:"uid"`
+		SN            string   `json:"sn"`
+		GivenName     string   `json:"given_name"`
+		Mail          string   `json:"mail"`
+		Tel           string   `json:"tel"`
+		UIDNumber     string   `json:"uid_number"`
+		GIDNumber     string   `json:"gid_number"`
+		HomeDirectory string   `json:"home_directory"`
+		MemberOf      []string `json:"member_of"`
+		Disabled      bool     `json:"disabled"`
+	}
+
+	ldapGroup struct {
+		DN         string   `json:"dn"`
+		CN         string   `json:"cn"`
+		OU         string   `json:"ou"`
+		GIDNumber  string   `json:"gid_number"`
+		MemberUIDs []string `json:"member_uids"`
+	}
+)
+
+func toLDAPUser(u *model.LdapUser) ldapUser {
+	return ldapUser{
+		DN:            u.DN,
+		CN:            u.CN,
+		OU:            u.OU,
+		UID:           u.UID,
+		SN:            u.SN,
+		GivenName:     u.GivenName,
+		Mail:          u.Mail,
+		Tel:           u.TelephoneNumber,
+		UIDNumber:     u.UIDNumber,
+		GIDNumber:     u.GIDNumber,
+		HomeDirectory: u.HomeDirectory,
+		MemberOf:      u.MemberOf,
+		Disabled:      u.Disabled(),
+	}
+}
+
+func toLDAPGroup(g *model.LdapGroup) ldapGroup {
+	return ldapGroup{
+		DN:         g.DN,
+		CN:         g.CN,
+		OU:         g.OU,
+		GIDNumber:  g.GIDNumber,
+		MemberUIDs: g.MemberUIDs,
+	}
+}
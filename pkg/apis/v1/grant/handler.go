@@ -0,0 +1,255 @@
+package grant
+
+import (
+	"asyncKubeManager/pkg/access"
+	"asyncKubeManager/pkg/auth"
+	"asyncKubeManager/pkg/dao"
+	"asyncKubeManager/pkg/dbresolver"
+	"asyncKubeManager/pkg/model"
+	"asyncKubeManager/pkg/server/encoding"
+	"asyncKubeManager/pkg/server/errutil"
+	"asyncKubeManager/pkg/server/request"
+	"context"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+type grantHandlerOption struct {
+	dbResolver *dbresolver.DBResolver
+	enforcer   *auth.Enforcer
+}
+
+type grantHandler struct {
+	grantHandlerOption
+}
+
+func newGrantHandler(option grantHandlerOption) *grantHandler {
+	return &grantHandler{
+		grantHandlerOption: option,
+	}
+}
+
+// checkResource 检查资源存在且当前用户在资源上至少拥有 need 角色
+func (h *grantHandler) checkResource(ctx context.Context, ref resourceRef, need model.ResourceRole) error {
+	subject, err := access.SubjectFromCtx(ctx, h.enforcer)
+	if err != nil {
+		return err
+	}
+
+	switch ref.ResourceType {
+	case model.ResourceTypeVM:
+		_, err = access.GetVM(ctx, h.dbResolver, subject, ref.ResourceID, need)
+		return err
+	case model.ResourceTypeDisk:
+		return access.CheckDisk(ctx, h.dbResolver, subject, ref.ResourceID, need)
+	default:
+		return errutil.ErrIllegalParameter
+	}
+}
+
+// 获取资源的所有授权, 需要 viewer 权限
+func (h *grantHandler) listGrants(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c, time.Second*30)
+	defer cancel()
+
+	req := listGrantsReq{}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		encoding.HandleError(c, errutil.ErrJSONFormat)
+		return
+	}
+
+	if err := request.ValidateStruct(ctx, req); err != nil {
+		encoding.HandleError(c, err)
+		return
+	}
+
+	if err := h.checkResource(ctx, req.resourceRef, model.ResourceRoleViewer); err != nil {
+		encoding.HandleError(c, err)
+		return
+	}
+
+	grants, err := dao.ListResourceGrants(ctx, h.dbResolver, req.ResourceType, req.ResourceID)
+	if err != nil {
+		zap.L().Error("failed to list resource grants", zap.Error(err))
+		encoding.HandleError(c, errutil.ErrInternalServer)
+		return
+	}
+
+	resp := make([]grantResp, 0, len(grants))
+	for _, grant := range grants {
+		resp = append(resp, grantResp{
+			SubjectType: grant.SubjectType,
+			Subject:     grant.Subject,
+			Role:        grant.Role,
+			CreatedAt:   grant.CreatedAt,
+			Creator:     grant.Creator,
+		})
+	}
+
+	encoding.HandleSuccessList(c, int64(len(resp)), resp)
+}
+
+// 共享资源, 需要 owner 权限
+func (h *grantHandler) addGrant(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c, time.Second*30)
+	defer cancel()
+
+	req := addGrantReq{}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		encoding.HandleError(c, errutil.ErrJSONFormat)
+		return
+	}
+
+	if err := request.ValidateStruct(ctx, req); err != nil {
+		encoding.HandleError(c, err)
+		return
+	}
+
+	if err := h.checkResource(ctx, req.resourceRef, model.ResourceRoleOwner); err != nil {
+		encoding.HandleError(c, err)
+		return
+	}
+
+	// 内置角色包含所有用户, 不能作为用户组被授权
+	if req.SubjectType == model.GrantSubjectGroup && model.UserRole(req.Subject).Builtin() {
+		encoding.HandleError(c, errutil.ErrIllegalParameter)
+		return
+	}
+
+	if req.SubjectType == model.GrantSubjectUser {
+		found, _, err := dao.GetUserByUID(ctx, h.dbResolver, req.Subject)
+		if err != nil {
+			zap.L().Error("failed to get user", zap.Error(err))
+			encoding.HandleError(c, errutil.ErrInternalServer)
+			return
+		}
+		if !found {
+			encoding.HandleError(c, errutil.ErrUserNotFound)
+			return
+		}
+
+		// 所有者的角色只能通过转移改变
+		role, err := dao.GetResourceRole(ctx, h.dbResolver, req.ResourceType, req.ResourceID, req.Subject, nil)
+		if err != nil {
+			zap.L().Error("failed to get resource role", zap.Error(err))
+			encoding.HandleError(c, errutil.ErrInternalServer)
+			return
+		}
+		if role == model.ResourceRoleOwner {
+			encoding.HandleError(c, errutil.ErrIllegalOperation)
+			return
+		}
+	}
+
+	err := dao.SaveResourceGrant(ctx, h.dbResolver, &model.ResourceGrant{
+		ResourceType: req.ResourceType,
+		ResourceID:   req.ResourceID,
+		SubjectType:  req.SubjectType,
+		Subject:      req.Subject,
+		Role:         req.Role,
+	})
+	if err != nil {
+		zap.L().Error("failed to save resource grant", zap.Error(err))
+		encoding.HandleError(c, errutil.ErrInternalServer)
+		return
+	}
+
+	encoding.HandleSuccess(c)
+}
+
+// 取消共享, 需要 owner 权限, 所有者的授权不能删除
+func (h *grantHandler) removeGrant(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c, time.Second*30)
+	defer cancel()
+
+	req := removeGrantReq{}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		encoding.HandleError(c, errutil.ErrJSONFormat)
+		return
+	}
+
+	if err := request.ValidateStruct(ctx, req); err != nil {
+		encoding.HandleError(c, err)
+		return
+	}
+
+	if err := h.checkResource(ctx, req.resourceRef, model.ResourceRoleOwner); err != nil {
+		encoding.HandleError(c, err)
+		return
+	}
+
+	if req.SubjectType == model.GrantSubjectUser {
+		role, err := dao.GetResourceRole(ctx, h.dbResolver, req.ResourceType, req.ResourceID, req.Subject, nil)
+		if err != nil {
+			zap.L().Error("failed to get resource role", zap.Error(err))
+			encoding.HandleError(c, errutil.ErrInternalServer)
+			return
+		}
+		if role == model.ResourceRoleOwner {
+			encoding.HandleError(c, errutil.ErrIllegalOperation)
+			return
+		}
+	}
+
+	if err := dao.DeleteResourceGrant(ctx, h.dbResolver, req.ResourceType, req.ResourceID, req.SubjectType, req.Subject); err != nil {
+		zap.L().Error("failed to delete resource grant", zap.Error(err))
+		encoding.HandleError(c, errutil.ErrInternalServer)
+		return
+	}
+
+	encoding.HandleSuccess(c)
+}
+
+// 转移所有者, 需要 owner 权限, 新所有者原有的共享授权被替换
+func (h *grantHandler) transferOwner(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c, time.Second*30)
+	defer cancel()
+
+	req := transferOwnerReq{}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		encoding.HandleError(c, errutil.ErrJSONFormat)
+		return
+	}
+
+	if err := request.ValidateStruct(ctx, req); err != nil {
+		encoding.HandleError(c, err)
+		return
+	}
+
+	if err := h.checkResource(ctx, req.resourceRef, model.ResourceRoleOwner); err != nil {
+		encoding.HandleError(c, err)
+		return
+	}
+
+	found, _, err := dao.GetUserByUID(ctx, h.dbResolver, req.UID)
+	if err != nil {
+		zap.L().Error("failed to get user", zap.Error(err))
+		encoding.HandleError(c, errutil.ErrInternalServer)
+		return
+	}
+	if !found {
+		encoding.HandleError(c, errutil.ErrUserNotFound)
+		return
+	}
+
+	err = h.dbResolver.GetDB().Transaction(func(tx *gorm.DB) error {
+		err := tx.WithContext(ctx).
+			Where("resource_type = ? AND resource_id = ? AND subject_type = ? AND subject = ?",
+				req.ResourceType, req.ResourceID, model.GrantSubjectUser, req.UID).
+			Delete(&model.ResourceGrant{}).Error
+		if err != nil {
+			return err
+		}
+		return dao.SetResourceOwnerWithDB(ctx, tx, req.ResourceType, req.ResourceID, req.UID)
+	})
+	if err != nil {
+		zap.L().Error("failed to transfer resource owner", zap.Error(err))
+		encoding.HandleError(c, errutil.ErrInternalServer)
+		return
+	}
+
+	encoding.HandleSuccess(c)
+}
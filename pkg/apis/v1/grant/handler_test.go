@@ -0,0 +1,103 @@
+package grant
+
+import (
+	"asyncKubeManager/pkg/auth"
+	"asyncKubeManager/pkg/dao"
+	"asyncKubeManager/pkg/dbresolver"
+	"asyncKubeManager/pkg/model"
+	"asyncKubeManager/pkg/server/middleware"
+	"asyncKubeManager/pkg/testutil"
+	"asyncKubeManager/pkg/token"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type grantTestServer struct {
+	router  *gin.Engine
+	manager token.Manager
+	dr      *dbresolver.DBResolver
+}
+
+func newGrantTestServer(t *testing.T) *grantTestServer {
+	gin.SetMode(gin.TestMode)
+	dr := testutil.NewDBResolver(t)
+	enforcer, err := auth.NewEnforcer(dr.GetDB(), "../../../../"+auth.DefaultModelPath)
+	require.NoError(t, err)
+	require.NoError(t, enforcer.SeedDefaultPolicies())
+	require.NoError(t, enforcer.SetUserRole("root", string(model.UserRoleAdmin)))
+	for _, uid := range []string{"alice", "bob", "carol"} {
+		_, err = dao.InsertUserWithDB(context.Background(), dr.GetDB(), uid, uid, "", "", "", model.UserRoleNormal)
+		require.NoError(t, err)
+		require.NoError(t, enforcer.SetUserRole(uid, string(model.UserRoleNormal)))
+	}
+	// carol 的角色是自定义的 ops, 可以作为用户组被授权
+	require.NoError(t, enforcer.SetUserRole("carol", "ops"))
+	require.NoError(t, enforcer.AddPolicy("ops", "/api/v1/grant/*", auth.ActionAny))
+
+	manager := token.NewJWTTokenManagerWithKey(token.NewHMACKey([]byte("grant-test")))
+	router := gin.New()
+	router.ContextWithFallback = true
+	RegisterRouter(router.Group("/api/v1"), &middleware.AuthChain{TokenManager: manager, Enforcer: enforcer}, dr)
+	return &grantTestServer{router: router, manager: manager, dr: dr}
+}
+
+func (s *grantTestServer) post(t *testing.T, uid, path string, body interface{}) int {
+	role := model.UserRoleNormal
+	if uid == "root" {
+		role = model.UserRoleAdmin
+	}
+	jwt, err := s.manager.IssueTo(token.Info{UID: uid, RoleID: role}, time.Hour)
+	require.NoError(t, err)
+	data, err := json.Marshal(body)
+	require.NoError(t, err)
+
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/grant"+path, strings.NewReader(string(data)))
+	req.Header.Set("Authorization", "Bearer "+jwt)
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	s.router.ServeHTTP(w, req)
+	return w.Code
+}
+
+func TestGrantHandler(t *testing.T) {
+	s := newGrantTestServer(t)
+	ctx := token.WithPayload(context.Background(), token.Info{UID: "alice", RoleID: model.UserRoleNormal})
+	vm, err := dao.InsertVM(ctx, s.dr, 1, "vm-1", "ubuntu", "vm-uid-1", 2, 2048)
+	require.NoError(t, err)
+	ref := resourceRef{ResourceType: model.ResourceTypeVM, ResourceID: vm.ID}
+	grant := func(subjectType model.GrantSubjectType, subject string, role model.ResourceRole) addGrantReq {
+		return addGrantReq{resourceRef: ref, SubjectType: subjectType, Subject: subject, Role: role}
+	}
+
+	// 没有任何授权的用户看不到虚拟机
+	assert.Equal(t, http.StatusNotFound, s.post(t, "bob", "/list", listGrantsReq{resourceRef: ref}))
+	assert.Equal(t, http.StatusNotFound, s.post(t, "bob", "/add", grant(model.GrantSubjectUser, "bob", model.ResourceRoleOperator)))
+	assert.Equal(t, http.StatusNotFound, s.post(t, "bob", "/list", listGrantsReq{
+		resourceRef: resourceRef{ResourceType: model.ResourceTypeDisk, ResourceID: 1},
+	}))
+	assert.Equal(t, http.StatusOK, s.post(t, "alice", "/list", listGrantsReq{resourceRef: ref}))
+	assert.Equal(t, http.StatusOK, s.post(t, "root", "/list", listGrantsReq{resourceRef: ref}))
+
+	// viewer 只能查看, 不能管理授权和转移所有者
+	require.Equal(t, http.StatusOK, s.post(t, "alice", "/add", grant(model.GrantSubjectUser, "bob", model.ResourceRoleViewer)))
+	assert.Equal(t, http.StatusOK, s.post(t, "bob", "/list", listGrantsReq{resourceRef: ref}))
+	assert.Equal(t, http.StatusForbidden, s.post(t, "bob", "/add", grant(model.GrantSubjectUser, "bob", model.ResourceRoleOperator)))
+	assert.Equal(t, http.StatusForbidden, s.post(t, "bob", "/transfer", transferOwnerReq{resourceRef: ref, UID: "bob"}))
+
+	// 内置角色不能作为用户组被授权
+	for _, role := range []model.UserRole{model.UserRoleNormal, model.UserRoleAdmin, model.UserRoleServiceAccount} {
+		assert.Equal(t, http.StatusBadRequest, s.post(t, "alice", "/add", grant(model.GrantSubjectGroup, string(role), model.ResourceRoleViewer)))
+	}
+	assert.Equal(t, http.StatusNotFound, s.post(t, "carol", "/list", listGrantsReq{resourceRef: ref}))
+	require.Equal(t, http.StatusOK, s.post(t, "alice", "/add", grant(model.GrantSubjectGroup, "ops", model.ResourceRoleViewer)))
+	assert.Equal(t, http.StatusOK, s.post(t, "carol", "/list", listGrantsReq{resourceRef: ref}))
+}
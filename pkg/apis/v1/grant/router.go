@@ -0,0 +1,26 @@
+package grant
+
+import (
+	"asyncKubeManager/pkg/dbresolver"
+	"asyncKubeManager/pkg/server/middleware"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RegisterRouter 注册虚拟机与磁盘的共享授权路由
+func RegisterRouter(group *gin.RouterGroup, authChain *middleware.AuthChain, dbResolver *dbresolver.DBResolver) {
+	grantG := group.Group("/grant")
+
+	handler := newGrantHandler(grantHandlerOption{
+		dbResolver: dbResolver,
+		enforcer:   authChain.Enforcer,
+	})
+
+	// 所有接口都需要token验证
+	grantG.Use(authChain.Handlers()...)
+
+	grantG.POST("/list", handler.listGrants)
+	grantG.POST("/add", handler.addGrant)
+	grantG.POST("/remove", handler.removeGrant)
+	grantG.POST("/transfer", handler.transferOwner)
+}
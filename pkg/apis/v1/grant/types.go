@@ -0,0 +1,43 @@
+package grant
+
+import "asyncKubeManager/pkg/model"
+
+type (
+	// 授权作用的资源, resource_type 为 VM 或 Disk
+	resourceRef struct {
+		ResourceType model.ResourceType `json:"resource_type" validate:"required"`
+		ResourceID   int64              `json:"resource_id" validate:"required,gt=0"`
+	}
+
+	listGrantsReq struct {
+		resourceRef
+	}
+
+	// 把资源以 viewer 或 operator 角色共享给用户或用户组(角色)
+	addGrantReq struct {
+		resourceRef
+		SubjectType model.GrantSubjectType `json:"subject_type" validate:"required,oneof=user group"`
+		Subject     string                 `json:"subject" validate:"required,lte=64"`
+		Role        model.ResourceRole     `json:"role" validate:"required,oneof=viewer operator"`
+	}
+
+	removeGrantReq struct {
+		resourceRef
+		SubjectType model.GrantSubjectType `json:"subject_type" validate:"required,oneof=user group"`
+		Subject     string                 `json:"subject" validate:"required,lte=64"`
+	}
+
+	// 转移资源的所有者
+	transferOwnerReq struct {
+		resourceRef
+		UID string `json:"uid" validate:"required"`
+	}
+
+	grantResp struct {
+		SubjectType model.GrantSubjectType `json:"subject_type"`
+		Subject     string                 `json:"subject"`
+		Role        model.ResourceRole     `json:"role"`
+		CreatedAt   int64                  `json:"created_at"`
+		Creator     string                 `json:"creator"`
+	}
+)
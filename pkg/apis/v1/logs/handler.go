@@ -7,6 +7,8 @@ import (
 	"asyncKubeManager/pkg/server/encoding"
 	"asyncKubeManager/pkg/server/errutil"
 	"asyncKubeManager/pkg/server/request"
+	"asyncKubeManager/pkg/token"
+	"asyncKubeManager/pkg/utils"
 	"context"
 	"github.com/gin-gonic/gin"
 	"go.uber.org/zap"
@@ -43,11 +45,25 @@ func (h *logHandler) listEventLogs(c *gin.Context) {
 		return
 	}
 
+	// 非管理员只能查看自己所在项目的事件
+	if token.GetUserRoleFromCtx(ctx) != model.UserRoleAdmin {
+		if req.ProjectID == 0 {
+			encoding.HandleError(c, errutil.ErrPermissionDenied)
+			return
+		}
+		if !h.isProjectMember(c, ctx, req.ProjectID) {
+			return
+		}
+		req.ResourceType, req.Creator = "", ""
+	}
+
 	var logs []model.EventLog
 	var err error
 
 	if req.ResourceType != "" {
 		logs, err = dao.ListEventLogsByType(ctx, h.dbResolver, model.EventType(req.EventType))
+	} else if req.ProjectID != 0 {
+		logs, err = dao.ListEventLogsByProjectID(ctx, h.dbResolver, req.ProjectID)
 	} else if req.Creator != "" {
 		logs, err = dao.ListEventLogsByCreator(ctx, h.dbResolver, req.Creator)
 	} else {
@@ -60,7 +76,13 @@ func (h *logHandler) listEventLogs(c *gin.Context) {
 		return
 	}
 
-	encoding.HandleSuccessList(c, int64(len(logs)), logs)
+	resp, err := h.toEventLogResps(ctx, logs)
+	if err != nil {
+		zap.L().Error("failed to resolve service accounts", zap.Error(err))
+		encoding.HandleError(c, errutil.ErrInternalServer)
+		return
+	}
+	encoding.HandleSuccessList(c, int64(len(resp)), resp)
 }
 
 // 获取事件日志详情
@@ -89,8 +111,32 @@ func (h *logHandler) getEventLog(c *gin.Context) {
 		encoding.HandleError(c, errutil.ErrNotFound)
 		return
 	}
+	if token.GetUserRoleFromCtx(ctx) != model.UserRoleAdmin && !h.isProjectMember(c, ctx, log.ProjectID) {
+		return
+	}
+
+	resp, err := h.toEventLogResps(ctx, []model.EventLog{*log})
+	if err != nil {
+		zap.L().Error("failed to resolve service accounts", zap.Error(err))
+		encoding.HandleError(c, errutil.ErrInternalServer)
+		return
+	}
+	encoding.HandleSuccess(c, resp[0])
+}
 
-	encoding.HandleSuccess(c, log)
+// isProjectMember checks that the current user is a member of the project, the error response is written otherwise
+func (h *logHandler) isProjectMember(c *gin.Context, ctx context.Context, projectID int64) bool {
+	found, _, err := dao.GetProjectMember(ctx, h.dbResolver, projectID, token.GetUIDFromCtx(ctx))
+	if err != nil {
+		zap.L().Error("failed to get project member", zap.Error(err))
+		encoding.HandleError(c, errutil.ErrInternalServer)
+		return false
+	}
+	if !found {
+		encoding.HandleError(c, errutil.ErrPermissionDenied)
+		return false
+	}
+	return true
 }
 
 // 获取用户操作日志列表
@@ -124,7 +170,13 @@ func (h *logHandler) listUserOperatorLogs(c *gin.Context) {
 		return
 	}
 
-	encoding.HandleSuccessList(c, int64(len(logs)), logs)
+	resp, err := h.toUserOperatorLogResps(ctx, logs)
+	if err != nil {
+		zap.L().Error("failed to resolve service accounts", zap.Error(err))
+		encoding.HandleError(c, errutil.ErrInternalServer)
+		return
+	}
+	encoding.HandleSuccessList(c, int64(len(resp)), resp)
 }
 
 // 获取用户操作日志详情
@@ -150,5 +202,86 @@ func (h *logHandler) getUserOperatorLog(c *gin.Context) {
 		return
 	}
 
-	encoding.HandleSuccess(c, log)
+	resp, err := h.toUserOperatorLogResps(ctx, []model.UserOperatorLog{*log})
+	if err != nil {
+		zap.L().Error("failed to resolve service accounts", zap.Error(err))
+		encoding.HandleError(c, errutil.ErrInternalServer)
+		return
+	}
+	encoding.HandleSuccess(c, resp[0])
+}
+
+func (h *logHandler) toEventLogResps(ctx context.Context, logs []model.EventLog) ([]eventLogResp, error) {
+	uids := make([]string, 0, len(logs))
+	for _, log := range logs {
+		uids = append(uids, log.Creator)
+	}
+	refs, err := h.serviceAccountRefs(ctx, uids)
+	if err != nil {
+		return nil, err
+	}
+
+	resp := make([]eventLogResp, 0, len(logs))
+	for _, log := range logs {
+		resp = append(resp, eventLogResp{EventLog: log, ServiceAccount: refs[log.Creator]})
+	}
+	return resp, nil
+}
+
+func (h *logHandler) toUserOperatorLogResps(ctx context.Context, logs []model.UserOperatorLog) ([]userOperatorLogResp, error) {
+	uids := make([]string, 0, 2*len(logs))
+	for _, log := range logs {
+		uids = append(uids, log.Creator, log.UID)
+	}
+	refs, err := h.serviceAccountRefs(ctx, uids)
+	if err != nil {
+		return nil, err
+	}
+
+	resp := make([]userOperatorLogResp, 0, len(logs))
+	for _, log := range logs {
+		ref := refs[log.Creator]
+		if ref == nil {
+			ref = refs[log.UID]
+		}
+		resp = append(resp, userOperatorLogResp{UserOperatorLog: log, ServiceAccount: ref})
+	}
+	return resp, nil
+}
+
+// serviceAccountRefs returns the service accounts among the uids with the users who created them, keyed by uid
+func (h *logHandler) serviceAccountRefs(ctx context.Context, uids []string) (map[string]*serviceAccountRef, error) {
+	uids = utils.RemoveDuplicates(uids)
+	refs := map[string]*serviceAccountRef{}
+	if len(uids) == 0 {
+		return refs, nil
+	}
+
+	sas, err := dao.ListServiceAccountsByUIDs(ctx, h.dbResolver, uids)
+	if err != nil || len(sas) == 0 {
+		return refs, err
+	}
+	creators := make([]string, 0, len(sas))
+	for _, sa := range sas {
+		creators = append(creators, sa.Creator)
+	}
+	users, err := dao.ListUsersByUIDs(ctx, h.dbResolver, utils.RemoveDuplicates(creators))
+	if err != nil {
+		return nil, err
+	}
+	names := make(map[string]string, len(users))
+	for _, user := range users {
+		names[user.UID] = user.Username
+	}
+
+	for _, sa := range sas {
+		refs[sa.UID] = &serviceAccountRef{
+			UID:         sa.UID,
+			Name:        sa.Name,
+			ProjectID:   sa.ProjectID,
+			Creator:     sa.Creator,
+			CreatorName: names[sa.Creator],
+		}
+	}
+	return refs, nil
 }
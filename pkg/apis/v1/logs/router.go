@@ -3,12 +3,11 @@ package logs
 import (
 	"asyncKubeManager/pkg/dbresolver"
 	"asyncKubeManager/pkg/server/middleware"
-	"asyncKubeManager/pkg/token"
 	"github.com/gin-gonic/gin"
 )
 
 // RegisterRouter 注册日志相关路由
-func RegisterRouter(group *gin.RouterGroup, tokenManager token.Manager, dbResolver *dbresolver.DBResolver) {
+func RegisterRouter(group *gin.RouterGroup, authChain *middleware.AuthChain, dbResolver *dbresolver.DBResolver) {
 	// 初始化日志监听器
 	startEventLogListener(dbResolver)
 	startUserOperatorLogListener(dbResolver)
@@ -22,7 +21,7 @@ func RegisterRouter(group *gin.RouterGroup, tokenManager token.Manager, dbResolv
 	})
 
 	// 所有接口都需要token验证
-	logG.Use(middleware.CheckToken(tokenManager))
+	logG.Use(authChain.Handlers()...)
 
 	// 事件日志接口
 	logG.POST("/event/list", handler.listEventLogs)
@@ -1,5 +1,7 @@
 package logs
 
+import "asyncKubeManager/pkg/model"
+
 type (
 	// 获取事件日志列表请求
 	listEventLogsReq struct {
@@ -7,6 +9,7 @@ type (
 		ResourceUID  string `json:"resource_uid" validate:"omitempty"`
 		EventType    string `json:"event_type" validate:"omitempty"`
 		Creator      string `json:"creator" validate:"omitempty"`
+		ProjectID    int64  `json:"project_id" validate:"omitempty"`
 	}
 
 	// 获取事件日志详情请求
@@ -24,4 +27,25 @@ type (
 	getUserOperatorLogReq struct {
 		ID int64 `json:"id" validate:"required"`
 	}
+
+	// serviceAccountRef 日志中的 service account 及创建它的用户
+	serviceAccountRef struct {
+		UID         string `json:"uid"`
+		Name        string `json:"name"`
+		ProjectID   int64  `json:"project_id"`
+		Creator     string `json:"creator"`
+		CreatorName string `json:"creator_name"`
+	}
+
+	// ServiceAccount 在事件由 service account 触发时设置
+	eventLogResp struct {
+		model.EventLog
+		ServiceAccount *serviceAccountRef `json:"service_account,omitempty"`
+	}
+
+	// ServiceAccount 在操作者或被操作的对象是 service account 时设置, 操作者优先
+	userOperatorLogResp struct {
+		model.UserOperatorLog
+		ServiceAccount *serviceAccountRef `json:"service_account,omitempty"`
+	}
 )
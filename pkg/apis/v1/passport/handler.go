@@ -2,8 +2,10 @@ package passport
 
 import (
 	"asyncKubeManager/pkg/apis/v1/logs"
+	"asyncKubeManager/pkg/auth"
+	"asyncKubeManager/pkg/authn"
 	"asyncKubeManager/pkg/captcha"
-	"asyncKubeManager/pkg/client/ldap"
+	"asyncKubeManager/pkg/client/cache"
 	"asyncKubeManager/pkg/dao"
 	"asyncKubeManager/pkg/dbresolver"
 	"asyncKubeManager/pkg/model"
@@ -11,16 +13,26 @@ import (
 	"asyncKubeManager/pkg/server/errutil"
 	"asyncKubeManager/pkg/server/request"
 	"asyncKubeManager/pkg/token"
+	"asyncKubeManager/pkg/token/pat"
+	"asyncKubeManager/pkg/token/refresh"
 	"asyncKubeManager/pkg/types"
 	"asyncKubeManager/pkg/utils"
 	"asyncKubeManager/pkg/utils/limiter"
+	"asyncKubeManager/pkg/utils/pwdutil"
 	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"github.com/gin-gonic/gin"
 	"go.uber.org/zap"
+	"golang.org/x/oauth2"
 	"gorm.io/gorm"
 	"net/http"
+	"path"
+	"slices"
 	"strings"
 	"time"
 )
@@ -28,9 +40,19 @@ import (
 type authHandlerOption struct {
 	tokenManager   token.Manager
 	dbResolver     *dbresolver.DBResolver
-	captchaLimiter *limiter.KeyLimiter
+	captchaLimiter limiter.RateLimiter
 	loginLimiter   *limiter.LoginLimiter
-	ldapClient     *ldap.LDAPClient
+	authenticators *authn.Registry
+	stateCache     cache.Interface
+	enforcer       *auth.Enforcer
+	refreshManager *refresh.Manager
+	loginPolicy    limiter.LoginPolicy
+	passwordPolicy pwdutil.Policy
+	mfa            *authn.MFA
+	patManager     *pat.Manager
+	userLogout     *authn.UserLogout
+	// serviceAccounts authenticates the client credentials of the service accounts
+	serviceAccounts *authn.ServiceAccounts
 }
 
 type authHandler struct {
@@ -43,12 +65,192 @@ func newAuthHandler(option authHandlerOption) *authHandler {
 	}
 }
 
+// 吊销当前请求使用的token
 func (h *authHandler) logout(c *gin.Context) {
+	t, err := h.tokenManager.GetTokenFromCtx(c)
+	if err != nil {
+		encoding.HandleError(c, errutil.ErrUnauthorized)
+		return
+	}
+	// 个人访问令牌没有会话, 只能删除
+	if token.IsPersonalAccessToken(t) {
+		encoding.HandleError(c, errutil.ErrPersonalAccessTokenLogout)
+		return
+	}
+
+	if err = h.refreshManager.RevokeSession(c, token.GetUIDFromCtx(c), token.SessionID(t)); err != nil {
+		zap.L().Error("refresh RevokeSession", zap.Error(err))
+		encoding.HandleError(c, errutil.ErrInternalServer)
+		return
+	}
+
+	if err = h.tokenManager.Revoke(t); err != nil {
+		zap.L().Error("Revoke", zap.Error(err))
+		encoding.HandleError(c, errutil.ErrInternalServer)
+		return
+	}
+
+	logs.UserOperatorLogChannel <- &model.UserOperatorLog{
+		UID:       token.GetUIDFromCtx(c),
+		Operator:  model.UserOperatorLogout,
+		CreatedAt: time.Now().UnixMilli(),
+		Creator:   token.GetUIDFromCtx(c),
+	}
+
+	encoding.HandleSuccess(c)
+}
+
+// 吊销当前用户的所有token, 包括其他设备上的登录
+func (h *authHandler) logoutAll(c *gin.Context) {
+	uid := token.GetUIDFromCtx(c)
+	if err := h.refreshManager.RevokeUser(c, uid); err != nil {
+		zap.L().Error("refresh RevokeUser", zap.Error(err))
+		encoding.HandleError(c, errutil.ErrInternalServer)
+		return
+	}
+
+	if err := h.tokenManager.RevokeUser(uid); err != nil {
+		zap.L().Error("RevokeUser", zap.Error(err))
+		encoding.HandleError(c, errutil.ErrInternalServer)
+		return
+	}
+
+	logs.UserOperatorLogChannel <- &model.UserOperatorLog{
+		UID:       uid,
+		Operator:  model.UserOperatorLogoutAll,
+		CreatedAt: time.Now().UnixMilli(),
+		Creator:   uid,
+	}
+
+	encoding.HandleSuccess(c)
+}
+
+// 列出当前用户的登录会话
+func (h *authHandler) listSessions(c *gin.Context) {
+	sessions, err := h.tokenManager.ListSessions(token.GetUIDFromCtx(c))
+	if errors.Is(err, token.ErrSessionDisabled) {
+		encoding.HandleError(c, errutil.ErrSessionDisabled)
+		return
+	}
+	if err != nil {
+		zap.L().Error("ListSessions", zap.Error(err))
+		encoding.HandleError(c, errutil.ErrInternalServer)
+		return
+	}
+
+	current := ""
+	if t, err := h.tokenManager.GetTokenFromCtx(c); err == nil {
+		current = token.SessionID(t)
+	}
+
+	resp := make([]sessionResp, 0, len(sessions))
+	for _, s := range sessions {
+		resp = append(resp, sessionResp{Session: s, Current: s.ID == current})
+	}
+
+	encoding.HandleSuccessList(c, int64(len(resp)), resp)
+}
+
+// 注销当前用户的某个登录会话
+func (h *authHandler) revokeSession(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c, types.DefaultTimeout)
+	defer cancel()
+
+	req := revokeSessionReq{}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		encoding.HandleError(c, errutil.ErrJSONFormat)
+		return
+	}
+
+	if err := request.ValidateStruct(ctx, req); err != nil {
+		encoding.HandleError(c, err)
+		return
+	}
+
+	uid := token.GetUIDFromCtx(ctx)
+	if err := h.refreshManager.RevokeSession(ctx, uid, req.SessionID); err != nil {
+		zap.L().Error("refresh RevokeSession", zap.Error(err))
+		encoding.HandleError(c, errutil.ErrInternalServer)
+		return
+	}
+
+	if err := h.tokenManager.RevokeSession(uid, req.SessionID); err != nil {
+		if errors.Is(err, token.ErrSessionNotFound) {
+			encoding.HandleError(c, errutil.ErrNotFound)
+			return
+		}
+		if errors.Is(err, token.ErrSessionDisabled) {
+			encoding.HandleError(c, errutil.ErrSessionDisabled)
+			return
+		}
+		zap.L().Error("RevokeSession", zap.Error(err))
+		encoding.HandleError(c, errutil.ErrInternalServer)
+		return
+	}
+
+	logs.UserOperatorLogChannel <- &model.UserOperatorLog{
+		UID:       uid,
+		Operator:  model.UserOperatorLogout,
+		Operation: fmt.Sprintf("session %s logged out", req.SessionID),
+		CreatedAt: time.Now().UnixMilli(),
+		Creator:   uid,
+	}
+
+	encoding.HandleSuccess(c)
+}
+
+// 管理员强制用户下线
+func (h *authHandler) forceLogout(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c, types.DefaultTimeout)
+	defer cancel()
+
+	if !h.requireAdmin(c, ctx) {
+		return
+	}
+
+	req := forceLogoutReq{}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		encoding.HandleError(c, errutil.ErrJSONFormat)
+		return
+	}
+
+	if err := request.ValidateStruct(ctx, req); err != nil {
+		encoding.HandleError(c, err)
+		return
+	}
+
+	found, _, err := dao.GetUserByUID(ctx, h.dbResolver, req.UID)
+	if err != nil {
+		zap.L().Error("GetUserByUID", zap.Error(err))
+		encoding.HandleError(c, errutil.ErrInternalServer)
+		return
+	}
+	if !found {
+		encoding.HandleError(c, errutil.ErrNotFound)
+		return
+	}
+
+	if err = h.userLogout.Logout(ctx, req.UID); err != nil {
+		zap.L().Error("Logout", zap.Error(err))
+		encoding.HandleError(c, errutil.ErrInternalServer)
+		return
+	}
+
+	logs.UserOperatorLogChannel <- &model.UserOperatorLog{
+		UID:       req.UID,
+		Operator:  model.UserOperatorForceLogout,
+		CreatedAt: time.Now().UnixMilli(),
+		Creator:   token.GetUIDFromCtx(ctx),
+	}
+
 	encoding.HandleSuccess(c)
 }
 
 func (h *authHandler) createCaptcha(c *gin.Context) {
-	if !h.captchaLimiter.AllowKey(utils.MD5Hex(c.Request.UserAgent())) {
+	res, err := h.captchaLimiter.Allow(c, utils.MD5Hex(c.Request.UserAgent()))
+	if err != nil {
+		zap.L().Error("captcha limiter allow failed", zap.Error(err))
+	} else if !res.Allowed {
 		encoding.HandleError(c, errutil.NewError(http.StatusBadRequest, "The captcha request is too fast"))
 		return
 	}
@@ -95,123 +297,670 @@ func (h *authHandler) login(c *gin.Context) {
 		return
 	}
 
+	// 同一 IP 或同一账号连续登录失败达到阈值后拒绝登录, 即使密码正确
+	ipKey := "ip:" + c.ClientIP()
+	if h.loginPolicy.IPThreshold > 0 && h.loginLimiter.IsLimit(ipKey, h.loginPolicy.IPThreshold) {
+		encoding.HandleError(c, errutil.NewError(http.StatusTooManyRequests, "too many failed login attempts, please try again later"))
+		return
+	}
+
 	// Verify CAPTCHA value
 	if !captcha.VerifyCaptcha(req.CaptchaID, strings.ToLower(req.CaptchaValue)) {
 		encoding.HandleError(c, errutil.NewError(http.StatusBadRequest, "captcha value is wrong"))
 		return
 	}
 
-	// Look up the user in LDAP
-	ldapUser, err := h.ldapClient.FindUserByUID(req.UserID)
+	// 未指定 provider 时依次尝试各个启用的密码认证方式
+	// 账号由认证方式和外部 ID 确定, 不同认证方式的同名用户分别计数
+	identity, err := h.authenticators.Authenticate(ctx, req.Provider, req.UserID, req.Password)
+	var (
+		source     model.AuthSource
+		externalID string
+	)
+	if identity != nil {
+		source, externalID = model.AuthSource(identity.Provider), identity.ExternalID
+	}
+	if externalID != "" && h.accountLocked(source, externalID) {
+		if errors.Is(err, authn.ErrInvalidCredentials) {
+			h.loginFailed(ctx, "", "", ipKey)
+		}
+		encoding.HandleError(c, errutil.ErrAccountLocked)
+		return
+	}
 	if err != nil {
-		zap.L().Error("FindUserByUID", zap.Error(err))
-		encoding.HandleError(c, errutil.NewError(http.StatusBadRequest, "user not found"))
+		switch {
+		case errors.Is(err, authn.ErrInvalidCredentials):
+			zap.L().Info("login failed", zap.String("user", req.UserID), zap.Error(err))
+			h.loginFailed(ctx, source, externalID, ipKey)
+			encoding.HandleError(c, errutil.NewError(http.StatusBadRequest, "password is wrong"))
+		case errors.Is(err, authn.ErrUserNotFound):
+			h.loginFailed(ctx, "", "", ipKey)
+			encoding.HandleError(c, errutil.NewError(http.StatusBadRequest, "user not found"))
+		case errors.Is(err, authn.ErrUnknownProvider):
+			encoding.HandleError(c, errutil.NewError(http.StatusBadRequest, err.Error()))
+		default:
+			zap.L().Error("Authenticate", zap.Error(err))
+			encoding.HandleError(c, errutil.ErrInternalServer)
+		}
 		return
 	}
 
-	// Perform LDAP bind to verify user credentials
-	if err = h.ldapClient.Bind(ldapUser.DN, req.Password); err != nil {
-		zap.L().Error("ldap bind failed", zap.Error(err))
-		encoding.HandleError(c, errutil.NewError(http.StatusBadRequest, "password is wrong"))
+	h.loginLimiter.Clean(loginKey(source, externalID))
+
+	user, err := h.userOfIdentity(ctx, identity)
+	if err != nil {
+		zap.L().Error("userOfIdentity", zap.Error(err))
+		logs.UserOperatorLogChannel <- &model.UserOperatorLog{
+			UID:       req.UserID,
+			Operator:  model.UserOperatorError, // Store the JSON string as operator details
+			Operation: fmt.Sprintf("user login error : %s", err),
+			CreatedAt: time.Now().UnixMilli(),
+			Creator:   tokenUser, // Creator of the operation
+		}
+		encoding.HandleError(c, errutil.ErrInternalServer)
 		return
 	}
 
-	// Check if the user already exists in the system's database
-	found, user, err := dao.GetUserByUserName(c, h.dbResolver, ldapUser.UID)
+	h.issueLogin(c, ctx, user, req.Device)
+}
+
+// userOfIdentity returns the console user of an authenticated identity, the user is created on its first login.
+// Users are mapped by provider and external ID, never by username.
+func (h *authHandler) userOfIdentity(ctx context.Context, identity *authn.Identity) (*model.User, error) {
+	source := model.AuthSource(identity.Provider)
+	found, user, err := dao.GetUserByIdentity(ctx, h.dbResolver, source, identity.ExternalID)
+	if err != nil || found {
+		return user, err
+	}
+
+	err = h.dbResolver.GetDB().Transaction(func(tx *gorm.DB) error {
+		user, err = dao.InsertExternalUserWithDB(ctx, tx, utils.NextID(), utils.TruncateString(identity.Username, 32),
+			utils.TruncateString(identity.Tel, 32), utils.TruncateString(identity.Email, 32), fmt.Sprintf("%s user", identity.Provider),
+			identity.Role, source, identity.ExternalID)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	// 角色绑定不在数据库事务中, 提交后再修改
+	if err = h.enforcer.SetUserRole(user.UID, string(user.Role)); err != nil {
+		return nil, err
+	}
+	// 之后由目录同步维护组映射的项目
+	if identity.Projects != nil {
+		if _, err = authn.SyncProjectMembers(ctx, h.dbResolver, user.UID, identity.Projects); err != nil {
+			zap.L().Error("SyncProjectMembers", zap.String("uid", user.UID), zap.Error(err))
+		}
+	}
+
+	logs.UserOperatorLogChannel <- &model.UserOperatorLog{
+		UID:       user.UID,
+		Operator:  model.UserOperatorFirstLogin,
+		Operation: fmt.Sprintf("%s user %s", identity.Provider, identity.ExternalID),
+		CreatedAt: time.Now().UnixMilli(),
+		Creator:   token.GetUIDFromCtx(ctx),
+	}
+	return user, nil
+}
+
+// oidcStateTTL is how long the user has to finish the login at the OpenID Connect provider
+const oidcStateTTL = 10 * time.Minute
+
+// oidcStateCookie binds the state of an OpenID Connect login to the browser which started it
+const oidcStateCookie = "oidc_state"
+
+// listProviders returns the enabled providers for the login page
+func (h *authHandler) listProviders(c *gin.Context) {
+	list := make([]providerResp, 0, len(h.authenticators.List()))
+	for _, p := range h.authenticators.List() {
+		list = append(list, providerResp{Name: p.Name(), Type: p.Type()})
+	}
+	encoding.HandleSuccessList(c, int64(len(list)), list)
+}
+
+// oidcLogin returns the authorization URL of the provider, the state, nonce and PKCE verifier are kept
+// in the cache until the callback
+func (h *authHandler) oidcLogin(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c, types.DefaultTimeout)
+	defer cancel()
+
+	res, err := h.captchaLimiter.Allow(c, "oidc:"+c.ClientIP())
+	if err != nil {
+		zap.L().Error("oidc login limiter allow failed", zap.Error(err))
+	} else if !res.Allowed {
+		encoding.HandleError(c, errutil.NewError(http.StatusTooManyRequests, "too many requests, please try again later"))
+		return
+	}
+
+	name := c.Query("provider")
+	p, ok := h.authenticators.Get(name)
+	rp, isRedirect := p.(authn.RedirectAuthenticator)
+	if !ok || !isRedirect {
+		encoding.HandleError(c, errutil.NewError(http.StatusBadRequest, fmt.Sprintf("%s %q", authn.ErrUnknownProvider, name)))
+		return
+	}
+
+	state, err := randomString()
 	if err != nil {
-		zap.L().Error("GetUserByUserName", zap.Error(err))
 		encoding.HandleError(c, errutil.ErrInternalServer)
 		return
 	}
+	nonce, err := randomString()
+	if err != nil {
+		encoding.HandleError(c, errutil.ErrInternalServer)
+		return
+	}
+	st := oidcState{Provider: name, Nonce: nonce, CodeVerifier: oauth2.GenerateVerifier()}
 
-	if found {
-		if user != nil {
-			t, err := h.tokenManager.IssueTo(token.Info{
-				UID:      user.UID,
-				Username: user.Username,
-				Name:     user.Username,
-				Primary:  true,
-			}, token.DefaultCacheDuration)
-			if err != nil {
-				zap.L().Error("IssueTo", zap.Error(err))
-				encoding.HandleError(c, errutil.NewError(http.StatusInternalServerError, "failed to issue token"))
-				return
-			}
+	url, err := rp.AuthCodeURL(ctx, state, st.Nonce, st.CodeVerifier)
+	if err != nil {
+		zap.L().Error("AuthCodeURL", zap.String("provider", name), zap.Error(err))
+		encoding.HandleError(c, errutil.NewError(http.StatusBadGateway, "the authentication provider is unavailable"))
+		return
+	}
+	data, _ := json.Marshal(st)
+	if err = h.stateCache.Set(ctx, oidcStateKey(state), string(data), oidcStateTTL); err != nil {
+		zap.L().Error("save oidc state", zap.Error(err))
+		encoding.HandleError(c, errutil.ErrInternalServer)
+		return
+	}
+	setOIDCStateCookie(c, state, int(oidcStateTTL.Seconds()))
 
-			logs.UserOperatorLogChannel <- &model.UserOperatorLog{
-				UID:       ldapUser.UID,
-				Operator:  model.UserOperatorLogin, // Add the operation type, here it's "user login"
-				CreatedAt: time.Now().UnixMilli(),
-				Creator:   token.GetUIDFromCtx(c), // Creator of the operation
-			}
+	encoding.HandleSuccess(c, oidcLoginResp{URL: url, State: state})
+}
 
-			// Return the token and user info
-			encoding.HandleSuccess(c, loginResp{
-				UID:      user.UID,
-				Token:    t,
-				Username: user.Username,
-			})
-			return
-		}
-	} else {
-		// Start a new transaction
-		err = h.dbResolver.GetDB().Transaction(func(tx *gorm.DB) error {
-			// If user doesn't exist, create a new user with LDAP data
-			userRole := model.UserRoleNormal
-			if strings.Contains(ldapUser.OU, "admin") {
-				userRole = model.UserRoleAdmin
-			}
+// oidcCallback exchanges the authorization code posted by the redirect page and logs the user in
+func (h *authHandler) oidcCallback(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c, types.DefaultTimeout)
+	defer cancel()
 
-			newUser, err := dao.InsertUserWithDB(c, tx, ldapUser.UID, "", ldapUser.TelephoneNumber, ldapUser.Mail, "LDAP User", userRole)
-			if err != nil {
-				return err
-			}
+	req := oidcCallbackReq{}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		zap.L().Error("c.ShouldBindJSON", zap.Error(err))
+		encoding.HandleError(c, errutil.ErrJSONFormat)
+		return
+	}
+	if err := request.ValidateStruct(ctx, req); err != nil {
+		encoding.HandleError(c, err)
+		return
+	}
 
-			// Issue a token for the newly created user
-			t, err := h.tokenManager.IssueTo(token.Info{
-				UID:      newUser.UID,
-				Username: newUser.Username,
-				Name:     newUser.Username,
-				Primary:  true,
-			}, token.DefaultCacheDuration)
-			if err != nil {
-				return err
-			}
+	ipKey := "ip:" + c.ClientIP()
+	if h.loginPolicy.IPThreshold > 0 && h.loginLimiter.IsLimit(ipKey, h.loginPolicy.IPThreshold) {
+		encoding.HandleError(c, errutil.NewError(http.StatusTooManyRequests, "too many failed login attempts, please try again later"))
+		return
+	}
 
-			logs.UserOperatorLogChannel <- &model.UserOperatorLog{
-				UID:       ldapUser.UID,
-				Operator:  model.UserOperatorFirstLogin, // Add the operation type, here it's "user login"
-				CreatedAt: time.Now().UnixMilli(),
-				Creator:   token.GetUIDFromCtx(c), // Creator of the operation
-			}
+	// state 必须来自发起登录的浏览器, 且只能使用一次
+	cookieState, _ := c.Cookie(oidcStateCookie)
+	setOIDCStateCookie(c, "", -1)
+	if subtle.ConstantTimeCompare([]byte(cookieState), []byte(req.State)) != 1 {
+		h.loginFailed(ctx, "", "", ipKey)
+		encoding.HandleError(c, errutil.NewError(http.StatusBadRequest, "the login was not started in this browser, please try again"))
+		return
+	}
+	data, err := h.stateCache.GetDel(ctx, oidcStateKey(req.State))
+	if err != nil {
+		h.loginFailed(ctx, "", "", ipKey)
+		encoding.HandleError(c, errutil.NewError(http.StatusBadRequest, "the login is expired, please try again"))
+		return
+	}
 
-			// Return the token and new user info
-			encoding.HandleSuccess(c, loginResp{
-				UID:      newUser.UID,
-				Token:    t,
-				Username: newUser.Username,
-			})
+	st := oidcState{}
+	if err = json.Unmarshal([]byte(data), &st); err != nil {
+		encoding.HandleError(c, errutil.ErrInternalServer)
+		return
+	}
+	p, _ := h.authenticators.Get(st.Provider)
+	rp, ok := p.(authn.RedirectAuthenticator)
+	if !ok {
+		encoding.HandleError(c, errutil.NewError(http.StatusBadRequest, fmt.Sprintf("%s %q", authn.ErrUnknownProvider, st.Provider)))
+		return
+	}
 
-			return nil
-		})
+	identity, err := rp.Exchange(ctx, req.Code, st.Nonce, st.CodeVerifier)
+	if err != nil {
+		zap.L().Info("oidc login failed", zap.String("provider", st.Provider), zap.Error(err))
+		h.loginFailed(ctx, "", "", ipKey)
+		encoding.HandleError(c, errutil.NewError(http.StatusBadRequest, "the login is rejected by the authentication provider"))
+		return
+	}
 
-		if err != nil {
-			zap.L().Error("Transaction failed", zap.Error(err))
+	user, err := h.userOfIdentity(ctx, identity)
+	if err != nil {
+		zap.L().Error("userOfIdentity", zap.Error(err))
+		encoding.HandleError(c, errutil.ErrInternalServer)
+		return
+	}
+
+	h.issueLogin(c, ctx, user, req.Device)
+}
+
+func oidcStateKey(state string) string {
+	return "oidc-state:" + state
+}
+
+// setOIDCStateCookie sets the state cookie for the callback of the login, a negative maxAge deletes it
+func setOIDCStateCookie(c *gin.Context, state string, maxAge int) {
+	secure := c.Request.TLS != nil || c.GetHeader("X-Forwarded-Proto") == "https"
+	c.SetSameSite(http.SameSiteLaxMode)
+	c.SetCookie(oidcStateCookie, state, maxAge, path.Dir(c.FullPath()), "", secure, true)
+}
+
+// randomString returns 32 bytes of crypto random data encoded as base64url
+func randomString() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// issueLogin issues the tokens of a user whose password has been verified, or an MFA challenge
+// if the user has to pass a second factor
+func (h *authHandler) issueLogin(c *gin.Context, ctx context.Context, user *model.User, device string) {
+	if user.Status == model.UserStatusDisabled {
+		encoding.HandleError(c, errutil.NewError(http.StatusForbidden, "the user is disabled"))
+		return
+	}
+
+	required, enrolled, err := h.mfa.Required(ctx, user)
+	if err != nil {
+		zap.L().Error("mfa Required", zap.Error(err))
+		encoding.HandleError(c, errutil.ErrInternalServer)
+		return
+	}
+	if required {
+		h.issueMFAChallenge(c, ctx, user, device, !enrolled)
+		return
+	}
+
+	h.issueTokens(c, ctx, user, device, nil)
+}
+
+// issueTokens issues the access and refresh tokens of a user who passed all factors,
+// recoveryCodes are returned once if the login confirmed the MFA enrollment
+func (h *authHandler) issueTokens(c *gin.Context, ctx context.Context, user *model.User, device string, recoveryCodes []string) {
+	// 只有因登录失败被锁定且已到期的账号在登录成功后自动解锁, 其他锁定需要管理员解锁
+	if user.Status == model.UserStatusLocked {
+		if user.LockedUntil == 0 || time.Now().UnixMilli() < user.LockedUntil {
+			encoding.HandleError(c, errutil.ErrAccountLocked)
+			return
+		}
+		if err := h.unlockUser(ctx, user, token.GetUIDFromCtx(c)); err != nil {
+			zap.L().Error("unlockUser", zap.Error(err))
 			encoding.HandleError(c, errutil.ErrInternalServer)
 			return
 		}
 	}
-	defer func() {
+
+	// 角色可能被管理员修改过, 登录时同步角色绑定
+	if err := h.enforcer.SetUserRole(user.UID, string(user.Role)); err != nil {
+		zap.L().Error("SetUserRole", zap.Error(err))
+		encoding.HandleError(c, errutil.ErrInternalServer)
+		return
+	}
+
+	t, err := h.tokenManager.IssueSession(token.Info{
+		UID:      user.UID,
+		Username: user.Username,
+		Name:     user.Username,
+		RoleID:   user.Role,
+		Primary:  true,
+	}, token.DefaultAccessTokenDuration, sessionMeta(c, device))
+	if err != nil {
+		zap.L().Error("IssueTo", zap.Error(err))
+		encoding.HandleError(c, errutil.NewError(http.StatusInternalServerError, "failed to issue token"))
+		return
+	}
+
+	refreshToken, err := h.refreshManager.Issue(ctx, user.UID, token.SessionID(t))
+	if err != nil {
+		zap.L().Error("refresh Issue", zap.Error(err))
+		encoding.HandleError(c, errutil.NewError(http.StatusInternalServerError, "failed to issue token"))
+		return
+	}
+
+	logs.UserOperatorLogChannel <- &model.UserOperatorLog{
+		UID:       user.UID,
+		Operator:  model.UserOperatorLogin, // Add the operation type, here it's "user login"
+		CreatedAt: time.Now().UnixMilli(),
+		Creator:   token.GetUIDFromCtx(c), // Creator of the operation
+	}
+
+	// Return the token and user info
+	encoding.HandleSuccess(c, loginResp{
+		UID:           user.UID,
+		Token:         t,
+		Username:      user.Username,
+		RefreshToken:  refreshToken,
+		ExpiresIn:     int64(token.DefaultAccessTokenDuration.Seconds()),
+		RecoveryCodes: recoveryCodes,
+	})
+}
+
+// 用 refresh token 换取新的 access token, refresh token 每次使用后轮换
+func (h *authHandler) refresh(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c, types.DefaultTimeout)
+	defer cancel()
+
+	req := refreshReq{}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		encoding.HandleError(c, errutil.ErrJSONFormat)
+		return
+	}
+
+	if err := request.ValidateStruct(ctx, req); err != nil {
+		encoding.HandleError(c, err)
+		return
+	}
+
+	// 事务中只做数据库操作, 新会话的 ID 预先生成, access token 在提交之后签发
+	var user *model.User
+	sessionID := utils.NextID()
+	refreshToken, old, err := h.refreshManager.Rotate(ctx, req.RefreshToken, sessionID, func(old *model.RefreshToken) error {
+		found, u, err := dao.GetUserByUID(ctx, h.dbResolver, old.UID)
 		if err != nil {
-			logs.UserOperatorLogChannel <- &model.UserOperatorLog{
-				UID:       req.UserID,
-				Operator:  model.UserOperatorError, // Store the JSON string as operator details
-				Operation: fmt.Sprintf("user login error : %s", err),
-				CreatedAt: time.Now().UnixMilli(),
-				Creator:   tokenUser, // Creator of the operation
+			return err
+		}
+		if !found || u.Status != model.UserStatusEnabled {
+			return refresh.ErrInvalidToken
+		}
+		user = u
+		return nil
+	})
+	if err != nil {
+		switch {
+		case errors.Is(err, refresh.ErrTokenReused):
+			// refresh token 被重复使用, 可能已经泄露, 整个 token family 已被吊销, 其中所有会话下线
+			var reused *refresh.ReusedError
+			if errors.As(err, &reused) {
+				zap.L().Warn("refresh token reused", zap.String("uid", reused.UID), zap.String("family", reused.FamilyID))
+				for _, sessionID := range reused.SessionIDs {
+					if err = h.tokenManager.RevokeSession(reused.UID, sessionID); err != nil && !isSessionGone(err) {
+						zap.L().Error("RevokeSession", zap.Error(err))
+					}
+				}
 			}
+			encoding.HandleError(c, errutil.ErrUnauthorized)
+		case errors.Is(err, refresh.ErrInvalidToken):
+			encoding.HandleError(c, errutil.ErrUnauthorized)
+		default:
+			zap.L().Error("refresh Rotate", zap.Error(err))
+			encoding.HandleError(c, errutil.ErrInternalServer)
 		}
-	}()
+		return
+	}
+
+	// 新的 access token 沿用原会话的设备名, 原会话下线
+	meta := sessionMeta(c, h.sessionDevice(old.UID, old.SessionID))
+	meta.SessionID = sessionID
+	if err = h.tokenManager.RevokeSession(old.UID, old.SessionID); err != nil && !isSessionGone(err) {
+		zap.L().Error("RevokeSession", zap.Error(err))
+	}
+
+	t, err := h.tokenManager.IssueSession(token.Info{
+		UID:      user.UID,
+		Username: user.Username,
+		Name:     user.Username,
+		RoleID:   user.Role,
+		Primary:  true,
+	}, token.DefaultAccessTokenDuration, meta)
+	if err != nil {
+		zap.L().Error("IssueSession", zap.Error(err))
+		// 没有 access token 的 refresh token 不能再使用
+		if err = h.refreshManager.RevokeSession(ctx, user.UID, sessionID); err != nil {
+			zap.L().Error("refresh RevokeSession", zap.Error(err))
+		}
+		encoding.HandleError(c, errutil.NewError(http.StatusInternalServerError, "failed to issue token"))
+		return
+	}
+
+	encoding.HandleSuccess(c, loginResp{
+		UID:          user.UID,
+		Token:        t,
+		Username:     user.Username,
+		RefreshToken: refreshToken,
+		ExpiresIn:    int64(token.DefaultAccessTokenDuration.Seconds()),
+	})
+}
+
+// sessionDevice returns the device name of a session, empty if the session has expired
+func (h *authHandler) sessionDevice(uid, sessionID string) string {
+	sessions, err := h.tokenManager.ListSessions(uid)
+	if err != nil {
+		return ""
+	}
+	for _, s := range sessions {
+		if s.ID == sessionID {
+			return s.Device
+		}
+	}
+	return ""
+}
+
+// loginFailed counts a failed login of the account and the client IP, the account is locked when
+// the count reaches the threshold. externalID is empty if the account is unknown, ipKey is empty
+// if the IP is not counted.
+func (h *authHandler) loginFailed(ctx context.Context, source model.AuthSource, externalID, ipKey string) {
+	if ipKey != "" && h.loginPolicy.IPThreshold > 0 && h.loginLimiter.LoginFailToReachLimit(ipKey, h.loginPolicy.IPThreshold) {
+		h.loginLimiter.Lock(ipKey, h.loginPolicy.LockoutDuration)
+		zap.L().Warn("login locked", zap.String("key", ipKey))
+	}
+
+	userKey := loginKey(source, externalID)
+	if externalID == "" || h.loginPolicy.UserThreshold <= 0 || !h.loginLimiter.LoginFailToReachLimit(userKey, h.loginPolicy.UserThreshold) {
+		return
+	}
+	h.loginLimiter.Lock(userKey, h.loginPolicy.LockoutDuration)
+	zap.L().Warn("login locked", zap.String("key", userKey))
+
+	found, user, err := dao.GetUserByIdentity(ctx, h.dbResolver, source, externalID)
+	if err != nil {
+		zap.L().Error("GetUserByIdentity", zap.Error(err))
+		return
+	}
+	// 首次登录前的用户还没有记录, 只由 loginLimiter 锁定
+	if !found || user.Status != model.UserStatusEnabled {
+		return
+	}
+
+	if err = dao.UpdateUserByID(ctx, h.dbResolver, user.UID, map[string]interface{}{
+		"status":       model.UserStatusLocked,
+		"locked_until": time.Now().Add(h.loginPolicy.LockoutDuration).UnixMilli(),
+	}); err != nil {
+		zap.L().Error("UpdateUserByID", zap.Error(err))
+		return
+	}
+
+	logs.UserOperatorLogChannel <- &model.UserOperatorLog{
+		UID:       user.UID,
+		Operator:  model.UserOperatorLock,
+		Operation: fmt.Sprintf("locked after %d failed logins", h.loginPolicy.UserThreshold),
+		CreatedAt: time.Now().UnixMilli(),
+		Creator:   user.UID,
+	}
+}
+
+// accountLocked reports whether the failed logins of the account reached the threshold
+func (h *authHandler) accountLocked(source model.AuthSource, externalID string) bool {
+	return h.loginPolicy.UserThreshold > 0 && h.loginLimiter.IsLimit(loginKey(source, externalID), h.loginPolicy.UserThreshold)
+}
+
+// loginKey is the loginLimiter key of an account
+func loginKey(source model.AuthSource, externalID string) string {
+	return "user:" + string(source) + ":" + externalID
+}
+
+// unlockUser clears the failed logins of the user and enables the account
+func (h *authHandler) unlockUser(ctx context.Context, user *model.User, operator string) error {
+	h.loginLimiter.Clean(loginKey(user.AuthSource, user.ExternalID))
+
+	if err := dao.UpdateUserByID(ctx, h.dbResolver, user.UID, map[string]interface{}{
+		"status":       model.UserStatusEnabled,
+		"locked_until": 0,
+	}); err != nil {
+		return err
+	}
+	user.Status = model.UserStatusEnabled
+	user.LockedUntil = 0
+
+	logs.UserOperatorLogChannel <- &model.UserOperatorLog{
+		UID:       user.UID,
+		Operator:  model.UserOperatorUnlock,
+		CreatedAt: time.Now().UnixMilli(),
+		Creator:   operator,
+	}
+	return nil
+}
+
+// 管理员解锁因登录失败被锁定的用户
+func (h *authHandler) unlock(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c, types.DefaultTimeout)
+	defer cancel()
+
+	if !h.requireAdmin(c, ctx) {
+		return
+	}
+
+	req := unlockReq{}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		encoding.HandleError(c, errutil.ErrJSONFormat)
+		return
+	}
+
+	if err := request.ValidateStruct(ctx, req); err != nil {
+		encoding.HandleError(c, err)
+		return
+	}
+
+	found, user, err := dao.GetUserByUID(ctx, h.dbResolver, req.UID)
+	if err != nil {
+		zap.L().Error("GetUserByUID", zap.Error(err))
+		encoding.HandleError(c, errutil.ErrInternalServer)
+		return
+	}
+	if !found {
+		encoding.HandleError(c, errutil.ErrNotFound)
+		return
+	}
+	if user.Status == model.UserStatusDisabled {
+		encoding.HandleError(c, errutil.NewError(http.StatusBadRequest, "the user is disabled"))
+		return
+	}
+
+	if err = h.unlockUser(ctx, user, token.GetUIDFromCtx(ctx)); err != nil {
+		zap.L().Error("unlockUser", zap.Error(err))
+		encoding.HandleError(c, errutil.ErrInternalServer)
+		return
+	}
+
+	encoding.HandleSuccess(c)
+}
+
+// 本地账号修改自己的密码, 修改后所有登录会话下线
+func (h *authHandler) changePassword(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c, types.DefaultTimeout)
+	defer cancel()
+
+	req := changePasswordReq{}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		encoding.HandleError(c, errutil.ErrJSONFormat)
+		return
+	}
+
+	if err := request.ValidateStruct(ctx, req); err != nil {
+		encoding.HandleError(c, err)
+		return
+	}
+
+	uid := token.GetUIDFromCtx(ctx)
+	found, user, err := dao.GetUserByUID(ctx, h.dbResolver, uid)
+	if err != nil {
+		zap.L().Error("GetUserByUID", zap.Error(err))
+		encoding.HandleError(c, errutil.ErrInternalServer)
+		return
+	}
+	if !found {
+		encoding.HandleError(c, errutil.ErrNotFound)
+		return
+	}
+	if user.AuthSource != model.AuthSourceLocal {
+		encoding.HandleError(c, errutil.NewError(http.StatusBadRequest, fmt.Sprintf("the password of %s accounts can't be changed here", user.AuthSource)))
+		return
+	}
+	if !pwdutil.PasswordVerify(req.OldPassword, user.PasswordHash) {
+		encoding.HandleError(c, errutil.NewError(http.StatusBadRequest, "old password is wrong"))
+		return
+	}
+	if err = h.passwordPolicy.Check(req.NewPassword); err != nil {
+		encoding.HandleError(c, errutil.NewError(http.StatusBadRequest, err.Error()))
+		return
+	}
+
+	passwordHash, err := pwdutil.PasswordHash(req.NewPassword)
+	if err != nil {
+		zap.L().Error("PasswordHash", zap.Error(err))
+		encoding.HandleError(c, errutil.ErrInternalServer)
+		return
+	}
+	if err = dao.UpdateUserPassword(ctx, h.dbResolver, uid, passwordHash); err != nil {
+		zap.L().Error("UpdateUserPassword", zap.Error(err))
+		encoding.HandleError(c, errutil.ErrInternalServer)
+		return
+	}
+	if err = h.userLogout.Logout(ctx, uid); err != nil {
+		zap.L().Error("Logout", zap.Error(err))
+		encoding.HandleError(c, errutil.ErrInternalServer)
+		return
+	}
+
+	logs.UserOperatorLogChannel <- &model.UserOperatorLog{
+		UID:       uid,
+		Operator:  model.UserOperatorPassword,
+		CreatedAt: time.Now().UnixMilli(),
+		Creator:   uid,
+	}
+
+	encoding.HandleSuccess(c)
+}
+
+// isAdmin tells whether the user of the request is bound to the admin role. The role claim of the
+// token is not used, it is stale until the token expires when the role of the user changes.
+func (h *authHandler) isAdmin(ctx context.Context) (bool, error) {
+	roles, err := h.enforcer.GetUserRoles(token.GetUIDFromCtx(ctx))
+	if err != nil {
+		return false, err
+	}
+	return slices.Contains(roles, string(model.UserRoleAdmin)), nil
+}
+
+// requireAdmin answers the request with 403 unless the user of the request is an admin
+func (h *authHandler) requireAdmin(c *gin.Context, ctx context.Context) bool {
+	admin, err := h.isAdmin(ctx)
+	if err != nil {
+		zap.L().Error("isAdmin", zap.Error(err))
+		encoding.HandleError(c, errutil.ErrInternalServer)
+		return false
+	}
+	if !admin {
+		encoding.HandleError(c, errutil.ErrPermissionDenied)
+		return false
+	}
+	return true
+}
+
+// sessionMeta describes the client of the login request
+func sessionMeta(c *gin.Context, device string) token.SessionMeta {
+	userAgent := c.Request.UserAgent()
+	if device == "" {
+		device = token.DeviceFromUserAgent(userAgent)
+	}
+	return token.SessionMeta{
+		Device:    device,
+		IP:        c.ClientIP(),
+		UserAgent: userAgent,
+	}
 }
 
 func (h *authHandler) update(c *gin.Context) {
@@ -256,6 +1005,87 @@ func (h *authHandler) update(c *gin.Context) {
 		return
 	}
 
+	// 普通用户只能修改自己的资料, 角色, 认证方式和密码重置由管理员操作
+	admin, err := h.isAdmin(ctx)
+	if err != nil {
+		zap.L().Error("isAdmin", zap.Error(err))
+		encoding.HandleError(c, errutil.ErrInternalServer)
+		return
+	}
+	if !admin && (req.UID != tokenUser || req.Role != "" || req.AuthSource != "" || req.Password != "") {
+		encoding.HandleError(c, errutil.ErrPermissionDenied)
+		return
+	}
+
+	authSource := user.AuthSource
+	if req.AuthSource != "" {
+		authSource = req.AuthSource
+	}
+	if req.Password != "" && authSource != model.AuthSourceLocal {
+		encoding.HandleError(c, errutil.NewError(http.StatusBadRequest, "only the password of local accounts can be set"))
+		return
+	}
+	if authSource == model.AuthSourceLocal && user.PasswordHash == "" && req.Password == "" {
+		encoding.HandleError(c, errutil.NewError(http.StatusBadRequest, "password is required for a local account"))
+		return
+	}
+
+	// 未传用户名时保留原用户名
+	username := user.Username
+	if req.Username != "" {
+		username = req.Username
+	}
+
+	// 本地账号以用户名登录, 同一认证方式下用户名不能重复, 不同认证方式的同名用户互不影响
+	if username != user.Username || authSource != user.AuthSource {
+		var (
+			taken     bool
+			takenUser *model.User
+		)
+		if taken, takenUser, err = dao.GetUserBySourceAndUserName(ctx, h.dbResolver, authSource, username); err != nil {
+			encoding.HandleError(c, errutil.ErrInternalServer)
+			return
+		}
+		if taken && takenUser.UID != user.UID {
+			encoding.HandleError(c, errutil.NewError(http.StatusBadRequest, "username already exists"))
+			return
+		}
+	}
+
+	// 外部 ID: 本地账号为 UID, LDAP 账号为 LDAP 的 uid 即用户名
+	externalID := user.ExternalID
+	if authSource != user.AuthSource {
+		externalID = user.UID
+		if authSource == model.AuthSourceLDAP {
+			externalID = username
+			if externalID == "" {
+				encoding.HandleError(c, errutil.NewError(http.StatusBadRequest, "username is required for an ldap account"))
+				return
+			}
+			var mapped bool
+			if mapped, _, err = dao.GetUserByIdentity(ctx, h.dbResolver, authSource, externalID); err != nil {
+				encoding.HandleError(c, errutil.ErrInternalServer)
+				return
+			}
+			if mapped {
+				encoding.HandleError(c, errutil.NewError(http.StatusBadRequest, "the ldap account is already mapped to another user"))
+				return
+			}
+		}
+	}
+
+	passwordHash := ""
+	if req.Password != "" {
+		if err = h.passwordPolicy.Check(req.Password); err != nil {
+			encoding.HandleError(c, errutil.NewError(http.StatusBadRequest, err.Error()))
+			return
+		}
+		if passwordHash, err = pwdutil.PasswordHash(req.Password); err != nil {
+			encoding.HandleError(c, errutil.ErrInternalServer)
+			return
+		}
+	}
+
 	updated := map[string]interface{}{}
 	operatorDetails := map[string]string{}
 	if req.Username != "" {
@@ -278,6 +1108,16 @@ func (h *authHandler) update(c *gin.Context) {
 		updated["role"] = req.Role
 		operatorDetails["role"] = fmt.Sprintf("role changed from %s to %s", user.Role, req.Role)
 	}
+	if authSource != user.AuthSource {
+		updated["auth_source"] = authSource
+		updated["external_id"] = externalID
+		operatorDetails["auth_source"] = fmt.Sprintf("auth source changed from %s to %s", user.AuthSource, authSource)
+	}
+	if passwordHash != "" {
+		updated["password_hash"] = passwordHash
+		updated["password_updated_at"] = time.Now().UnixMilli()
+		operatorDetails["password"] = "password reset"
+	}
 	// Convert updated fields to JSON format
 	operatorDetailsJson, err := json.Marshal(operatorDetails)
 	if err != nil {
@@ -286,30 +1126,44 @@ func (h *authHandler) update(c *gin.Context) {
 		return
 	}
 
-	// Start a new transaction
-	err = h.dbResolver.GetDB().Transaction(func(tx *gorm.DB) error {
-		// Update the user in the database
-		if err = dao.UpdateUserByUIDWithDB(ctx, tx, req.UID, updated); err != nil {
-			return err
-		}
+	// Update the user in the database
+	if err = dao.UpdateUserByUIDWithDB(ctx, h.dbResolver.GetDB(), req.UID, updated); err != nil {
+		zap.L().Error("UpdateUserByUID", zap.Error(err))
+		encoding.HandleError(c, errutil.ErrInternalServer)
+		return
+	}
 
-		logs.UserOperatorLogChannel <- &model.UserOperatorLog{
-			UID:       user.UID,
-			Operator:  model.UserOperatorUpdate, // Store the JSON string as operator details
-			Operation: string(operatorDetailsJson),
-			CreatedAt: time.Now().UnixMilli(),
-			Creator:   token.GetUIDFromCtx(c), // Creator of the operation
+	// 角色绑定和会话不在数据库事务中, 用户更新提交后再修改
+	if req.Role != "" {
+		if err = h.enforcer.SetUserRole(req.UID, string(req.Role)); err != nil {
+			zap.L().Error("SetUserRole", zap.Error(err))
+			encoding.HandleError(c, errutil.ErrInternalServer)
+			return
 		}
+	}
+	// 密码重置, 角色或认证方式变更后, 用户的所有会话下线, 已签发的 token 中的角色随之失效
+	if passwordHash != "" || (req.Role != "" && req.Role != user.Role) || authSource != user.AuthSource {
+		if err = h.userLogout.Logout(ctx, req.UID); err != nil {
+			zap.L().Error("Logout", zap.Error(err))
+			encoding.HandleError(c, errutil.ErrInternalServer)
+			return
+		}
+	}
 
-		// Return success response
-		encoding.HandleSuccess(c)
+	logs.UserOperatorLogChannel <- &model.UserOperatorLog{
+		UID:       user.UID,
+		Operator:  model.UserOperatorUpdate, // Store the JSON string as operator details
+		Operation: string(operatorDetailsJson),
+		CreatedAt: time.Now().UnixMilli(),
+		Creator:   token.GetUIDFromCtx(c), // Creator of the operation
+	}
 
-		return nil
-	})
+	// Return success response
+	encoding.HandleSuccess(c)
+}
 
-	if err != nil {
-		zap.L().Error("Transaction failed", zap.Error(err))
-		encoding.HandleError(c, errutil.ErrInternalServer)
-		return
-	}
+// isSessionGone reports whether RevokeSession failed only because the session is not stored,
+// either it is already logged out or sessions are disabled without redis
+func isSessionGone(err error) bool {
+	return errors.Is(err, token.ErrSessionNotFound) || errors.Is(err, token.ErrSessionDisabled)
 }
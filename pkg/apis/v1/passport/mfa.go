@@ -0,0 +1,459 @@
+package passport
+
+import (
+	"asyncKubeManager/pkg/apis/v1/logs"
+	"asyncKubeManager/pkg/authn"
+	"asyncKubeManager/pkg/dao"
+	"asyncKubeManager/pkg/model"
+	"asyncKubeManager/pkg/server/encoding"
+	"asyncKubeManager/pkg/server/errutil"
+	"asyncKubeManager/pkg/server/request"
+	"asyncKubeManager/pkg/token"
+	"asyncKubeManager/pkg/types"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+const (
+	// mfaChallengeTTL is how long the user has to enter the one-time password after the password
+	mfaChallengeTTL = 5 * time.Minute
+	// mfaChallengeAttempts is the number of wrong one-time passwords after which the challenge is dropped
+	mfaChallengeAttempts = 5
+)
+
+func mfaChallengeKey(challengeToken string) string {
+	return "mfa-challenge:" + challengeToken
+}
+
+func mfaAttemptsKey(challengeToken string) string {
+	return "mfa-challenge-attempts:" + challengeToken
+}
+
+// issueMFAChallenge returns a challenge token instead of the tokens, the password has been verified
+func (h *authHandler) issueMFAChallenge(c *gin.Context, ctx context.Context, user *model.User, device string, enrollRequired bool) {
+	challengeToken, err := randomString()
+	if err != nil {
+		encoding.HandleError(c, errutil.ErrInternalServer)
+		return
+	}
+	data, _ := json.Marshal(mfaChallenge{UID: user.UID, Device: device})
+	if err = h.stateCache.Set(ctx, mfaChallengeKey(challengeToken), string(data), mfaChallengeTTL); err != nil {
+		zap.L().Error("save mfa challenge", zap.Error(err))
+		encoding.HandleError(c, errutil.ErrInternalServer)
+		return
+	}
+
+	encoding.HandleSuccess(c, loginResp{
+		UID:            user.UID,
+		Username:       user.Username,
+		MFARequired:    true,
+		ChallengeToken: challengeToken,
+		EnrollRequired: enrollRequired,
+	})
+}
+
+// mfaChallengeUser returns the user of a pending challenge
+func (h *authHandler) mfaChallengeUser(ctx context.Context, challengeToken string) (*mfaChallenge, *model.User, error) {
+	data, err := h.stateCache.Get(ctx, mfaChallengeKey(challengeToken))
+	if err != nil {
+		return nil, nil, errutil.NewError(http.StatusBadRequest, "the login is expired, please log in again")
+	}
+	ch := mfaChallenge{}
+	if err = json.Unmarshal([]byte(data), &ch); err != nil {
+		return nil, nil, err
+	}
+
+	found, user, err := dao.GetUserByUID(ctx, h.dbResolver, ch.UID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if !found {
+		return nil, nil, errutil.ErrUserNotFound
+	}
+	if user.Status == model.UserStatusDisabled {
+		return nil, nil, errutil.NewError(http.StatusForbidden, "the user is disabled")
+	}
+	return &ch, user, nil
+}
+
+// mfaVerify exchanges the challenge token and a one-time password for the tokens. A user who has to
+// enroll confirms the enrollment with the code and gets the recovery codes with the tokens.
+func (h *authHandler) mfaVerify(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c, types.DefaultTimeout)
+	defer cancel()
+
+	req := mfaVerifyReq{}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		encoding.HandleError(c, errutil.ErrJSONFormat)
+		return
+	}
+
+	if err := request.ValidateStruct(ctx, req); err != nil {
+		encoding.HandleError(c, err)
+		return
+	}
+
+	ipKey := "ip:" + c.ClientIP()
+	if h.loginPolicy.IPThreshold > 0 && h.loginLimiter.IsLimit(ipKey, h.loginPolicy.IPThreshold) {
+		encoding.HandleError(c, errutil.NewError(http.StatusTooManyRequests, "too many failed login attempts, please try again later"))
+		return
+	}
+
+	ch, user, err := h.mfaChallengeUser(ctx, req.ChallengeToken)
+	if err != nil {
+		h.handleMFAError(c, err)
+		return
+	}
+	if h.accountLocked(user.AuthSource, user.ExternalID) {
+		encoding.HandleError(c, errutil.ErrAccountLocked)
+		return
+	}
+
+	enrolled, err := h.mfa.Enrolled(ctx, user.UID)
+	if err != nil {
+		h.handleMFAError(c, err)
+		return
+	}
+	var recoveryCodes []string
+	if enrolled {
+		err = h.mfa.Verify(ctx, user.UID, req.Code)
+	} else {
+		recoveryCodes, err = h.mfa.Confirm(ctx, user.UID, req.Code)
+	}
+	if errors.Is(err, authn.ErrInvalidOTP) {
+		h.loginFailed(ctx, user.AuthSource, user.ExternalID, ipKey)
+		// 错误次数过多时作废本次登录, 需要重新输入密码
+		attemptsKey := mfaAttemptsKey(req.ChallengeToken)
+		if attempts, incrErr := h.stateCache.Incr(ctx, attemptsKey); incrErr != nil || attempts >= mfaChallengeAttempts {
+			_ = h.stateCache.Del(ctx, mfaChallengeKey(req.ChallengeToken), attemptsKey)
+		} else if attempts == 1 {
+			_ = h.stateCache.Expire(ctx, attemptsKey, mfaChallengeTTL)
+		}
+	}
+	if err != nil {
+		h.handleMFAError(c, err)
+		return
+	}
+
+	// challenge 只能使用一次
+	_ = h.stateCache.Del(ctx, mfaChallengeKey(req.ChallengeToken), mfaAttemptsKey(req.ChallengeToken))
+	h.loginLimiter.Clean(loginKey(user.AuthSource, user.ExternalID))
+	if !enrolled {
+		h.auditMFA(ctx, user.UID, "mfa enrolled on login")
+	}
+
+	h.issueTokens(c, ctx, user, ch.Device, recoveryCodes)
+}
+
+// mfaChallengeEnroll starts the enrollment of a user MFA is enforced for, during the login
+func (h *authHandler) mfaChallengeEnroll(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c, types.DefaultTimeout)
+	defer cancel()
+
+	req := mfaChallengeReq{}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		encoding.HandleError(c, errutil.ErrJSONFormat)
+		return
+	}
+
+	if err := request.ValidateStruct(ctx, req); err != nil {
+		encoding.HandleError(c, err)
+		return
+	}
+
+	_, user, err := h.mfaChallengeUser(ctx, req.ChallengeToken)
+	if err != nil {
+		h.handleMFAError(c, err)
+		return
+	}
+
+	secret, uri, err := h.mfa.Enroll(ctx, user)
+	if err != nil {
+		h.handleMFAError(c, err)
+		return
+	}
+
+	encoding.HandleSuccess(c, mfaEnrollResp{Secret: secret, URI: uri})
+}
+
+// 获取当前用户的 MFA 状态
+func (h *authHandler) mfaStatus(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c, types.DefaultTimeout)
+	defer cancel()
+
+	uid := token.GetUIDFromCtx(ctx)
+	enrolled, err := h.mfa.Enrolled(ctx, uid)
+	if err != nil {
+		h.handleMFAError(c, err)
+		return
+	}
+	enforced, err := dao.IsMFAEnforcedForRole(ctx, h.dbResolver, token.GetUserRoleFromCtx(ctx))
+	if err != nil {
+		h.handleMFAError(c, err)
+		return
+	}
+	left, err := dao.CountUnusedMFARecoveryCodes(ctx, h.dbResolver, uid)
+	if err != nil {
+		h.handleMFAError(c, err)
+		return
+	}
+
+	encoding.HandleSuccess(c, mfaStatusResp{Enrolled: enrolled, Enforced: enforced, RecoveryCodesLeft: left})
+}
+
+// 当前用户开始绑定 TOTP, 返回密钥和二维码 URI
+func (h *authHandler) mfaEnroll(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c, types.DefaultTimeout)
+	defer cancel()
+
+	found, user, err := dao.GetUserByUID(ctx, h.dbResolver, token.GetUIDFromCtx(ctx))
+	if err != nil {
+		h.handleMFAError(c, err)
+		return
+	}
+	if !found {
+		encoding.HandleError(c, errutil.ErrUserNotFound)
+		return
+	}
+
+	secret, uri, err := h.mfa.Enroll(ctx, user)
+	if err != nil {
+		h.handleMFAError(c, err)
+		return
+	}
+
+	encoding.HandleSuccess(c, mfaEnrollResp{Secret: secret, URI: uri})
+}
+
+// 当前用户用第一个验证码确认绑定, 返回恢复码
+func (h *authHandler) mfaConfirm(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c, types.DefaultTimeout)
+	defer cancel()
+
+	req := mfaCodeReq{}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		encoding.HandleError(c, errutil.ErrJSONFormat)
+		return
+	}
+
+	if err := request.ValidateStruct(ctx, req); err != nil {
+		encoding.HandleError(c, err)
+		return
+	}
+
+	uid := token.GetUIDFromCtx(ctx)
+	recoveryCodes, err := h.mfa.Confirm(ctx, uid, req.Code)
+	if err != nil {
+		h.handleMFAError(c, err)
+		return
+	}
+	h.auditMFA(ctx, uid, "mfa enrolled")
+
+	encoding.HandleSuccess(c, mfaRecoveryCodesResp{RecoveryCodes: recoveryCodes})
+}
+
+// 当前用户解绑 TOTP, 角色强制 MFA 时不允许
+func (h *authHandler) mfaDisable(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c, types.DefaultTimeout)
+	defer cancel()
+
+	req := mfaCodeReq{}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		encoding.HandleError(c, errutil.ErrJSONFormat)
+		return
+	}
+
+	if err := request.ValidateStruct(ctx, req); err != nil {
+		encoding.HandleError(c, err)
+		return
+	}
+
+	enforced, err := dao.IsMFAEnforcedForRole(ctx, h.dbResolver, token.GetUserRoleFromCtx(ctx))
+	if err != nil {
+		h.handleMFAError(c, err)
+		return
+	}
+	if enforced {
+		encoding.HandleError(c, errutil.NewError(http.StatusBadRequest, "mfa is enforced for your role"))
+		return
+	}
+
+	uid := token.GetUIDFromCtx(ctx)
+	if err = h.verifyMFACode(ctx, uid, req.Code); err != nil {
+		h.handleMFAError(c, err)
+		return
+	}
+	if err = h.mfa.Disable(ctx, uid); err != nil {
+		h.handleMFAError(c, err)
+		return
+	}
+	h.auditMFA(ctx, uid, "mfa disabled")
+
+	encoding.HandleSuccess(c)
+}
+
+// 当前用户重新生成恢复码, 旧的恢复码失效
+func (h *authHandler) mfaRegenerateRecoveryCodes(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c, types.DefaultTimeout)
+	defer cancel()
+
+	req := mfaCodeReq{}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		encoding.HandleError(c, errutil.ErrJSONFormat)
+		return
+	}
+
+	if err := request.ValidateStruct(ctx, req); err != nil {
+		encoding.HandleError(c, err)
+		return
+	}
+
+	uid := token.GetUIDFromCtx(ctx)
+	if err := h.verifyMFACode(ctx, uid, req.Code); err != nil {
+		h.handleMFAError(c, err)
+		return
+	}
+	recoveryCodes, err := h.mfa.RegenerateRecoveryCodes(ctx, uid)
+	if err != nil {
+		h.handleMFAError(c, err)
+		return
+	}
+	h.auditMFA(ctx, uid, "mfa recovery codes regenerated")
+
+	encoding.HandleSuccess(c, mfaRecoveryCodesResp{RecoveryCodes: recoveryCodes})
+}
+
+// 管理员重置丢失设备的用户的 MFA, 用户下次登录时重新绑定
+func (h *authHandler) mfaReset(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c, types.DefaultTimeout)
+	defer cancel()
+
+	if !h.requireAdmin(c, ctx) {
+		return
+	}
+
+	req := mfaResetReq{}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		encoding.HandleError(c, errutil.ErrJSONFormat)
+		return
+	}
+
+	if err := request.ValidateStruct(ctx, req); err != nil {
+		encoding.HandleError(c, err)
+		return
+	}
+
+	found, _, err := dao.GetUserByUID(ctx, h.dbResolver, req.UID)
+	if err != nil {
+		h.handleMFAError(c, err)
+		return
+	}
+	if !found {
+		encoding.HandleError(c, errutil.ErrUserNotFound)
+		return
+	}
+	if err = h.mfa.Disable(ctx, req.UID); err != nil {
+		h.handleMFAError(c, err)
+		return
+	}
+	h.auditMFA(ctx, req.UID, "mfa reset by the administrator")
+
+	encoding.HandleSuccess(c)
+}
+
+// 获取强制 MFA 的角色
+func (h *authHandler) listMFARolePolicies(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c, types.DefaultTimeout)
+	defer cancel()
+
+	if !h.requireAdmin(c, ctx) {
+		return
+	}
+
+	policies, err := dao.ListMFARolePolicies(ctx, h.dbResolver)
+	if err != nil {
+		h.handleMFAError(c, err)
+		return
+	}
+
+	encoding.HandleSuccessList(c, int64(len(policies)), policies)
+}
+
+// 管理员设置角色是否强制 MFA, 未绑定的用户下次登录时必须绑定
+func (h *authHandler) setMFARolePolicy(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c, types.DefaultTimeout)
+	defer cancel()
+
+	if !h.requireAdmin(c, ctx) {
+		return
+	}
+
+	req := mfaRolePolicyReq{}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		encoding.HandleError(c, errutil.ErrJSONFormat)
+		return
+	}
+
+	if err := request.ValidateStruct(ctx, req); err != nil {
+		encoding.HandleError(c, err)
+		return
+	}
+
+	if err := dao.SetMFARolePolicy(ctx, h.dbResolver, req.Role, req.Enforced); err != nil {
+		h.handleMFAError(c, err)
+		return
+	}
+	zap.L().Info("mfa role policy set", zap.Any("policy", req), zap.String("operator", token.GetUIDFromCtx(ctx)))
+
+	encoding.HandleSuccess(c)
+}
+
+// verifyMFACode checks the code of a logged in user, wrong codes count as failed logins
+func (h *authHandler) verifyMFACode(ctx context.Context, uid, code string) error {
+	found, user, err := dao.GetUserByUID(ctx, h.dbResolver, uid)
+	if err != nil {
+		return err
+	}
+	if !found {
+		return errutil.ErrUserNotFound
+	}
+	if h.accountLocked(user.AuthSource, user.ExternalID) {
+		return errutil.ErrAccountLocked
+	}
+	err = h.mfa.Verify(ctx, uid, code)
+	if errors.Is(err, authn.ErrInvalidOTP) {
+		h.loginFailed(ctx, user.AuthSource, user.ExternalID, "")
+	}
+	return err
+}
+
+func (h *authHandler) auditMFA(ctx context.Context, uid, operation string) {
+	logs.UserOperatorLogChannel <- &model.UserOperatorLog{
+		UID:       uid,
+		Operator:  model.UserOperatorMFA,
+		Operation: operation,
+		CreatedAt: time.Now().UnixMilli(),
+		Creator:   token.GetUIDFromCtx(ctx),
+	}
+}
+
+func (h *authHandler) handleMFAError(c *gin.Context, err error) {
+	var e errutil.ServiceError
+	switch {
+	case errors.As(err, &e):
+		encoding.HandleError(c, e)
+	case errors.Is(err, authn.ErrInvalidOTP):
+		encoding.HandleError(c, errutil.NewError(http.StatusBadRequest, "one-time password is wrong"))
+	case errors.Is(err, authn.ErrMFANotEnrolled), errors.Is(err, authn.ErrMFAEnrolled):
+		encoding.HandleError(c, errutil.NewError(http.StatusBadRequest, err.Error()))
+	default:
+		zap.L().Error("mfa", zap.Error(err))
+		encoding.HandleError(c, errutil.ErrInternalServer)
+	}
+}
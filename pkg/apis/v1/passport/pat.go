@@ -0,0 +1,165 @@
+package passport
+
+import (
+	"asyncKubeManager/pkg/apis/v1/logs"
+	"asyncKubeManager/pkg/model"
+	"asyncKubeManager/pkg/server/encoding"
+	"asyncKubeManager/pkg/server/errutil"
+	"asyncKubeManager/pkg/server/request"
+	"asyncKubeManager/pkg/token"
+	"asyncKubeManager/pkg/token/pat"
+	"asyncKubeManager/pkg/types"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// 创建个人访问令牌, 令牌只在创建时返回一次
+func (h *authHandler) createPersonalAccessToken(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c, types.DefaultTimeout)
+	defer cancel()
+
+	req := createPersonalAccessTokenReq{}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		encoding.HandleError(c, errutil.ErrJSONFormat)
+		return
+	}
+
+	if err := request.ValidateStruct(ctx, req); err != nil {
+		encoding.HandleError(c, err)
+		return
+	}
+
+	uid := token.GetUIDFromCtx(ctx)
+	tokenString, t, err := h.patManager.Issue(ctx, uid, req.Name, req.Scopes, time.Duration(req.ExpiresInDays)*24*time.Hour)
+	if err != nil {
+		h.handlePersonalAccessTokenError(c, err)
+		return
+	}
+	h.auditPersonalAccessToken(ctx, uid, fmt.Sprintf("personal access token %q created", t.Name))
+
+	encoding.HandleSuccess(c, createPersonalAccessTokenResp{
+		personalAccessTokenResp: newPersonalAccessTokenResp(t),
+		Token:                   tokenString,
+	})
+}
+
+// 获取当前用户的个人访问令牌
+func (h *authHandler) listPersonalAccessTokens(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c, types.DefaultTimeout)
+	defer cancel()
+
+	h.listPersonalAccessTokensOf(c, ctx, token.GetUIDFromCtx(ctx))
+}
+
+// 管理员获取所有用户的个人访问令牌, 可按用户过滤
+func (h *authHandler) listAllPersonalAccessTokens(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c, types.DefaultTimeout)
+	defer cancel()
+
+	if !h.requireAdmin(c, ctx) {
+		return
+	}
+
+	req := listPersonalAccessTokensReq{}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		encoding.HandleError(c, errutil.ErrJSONFormat)
+		return
+	}
+
+	if err := request.ValidateStruct(ctx, req); err != nil {
+		encoding.HandleError(c, err)
+		return
+	}
+
+	h.listPersonalAccessTokensOf(c, ctx, req.UID)
+}
+
+func (h *authHandler) listPersonalAccessTokensOf(c *gin.Context, ctx context.Context, uid string) {
+	tokens, err := h.patManager.List(ctx, uid)
+	if err != nil {
+		h.handlePersonalAccessTokenError(c, err)
+		return
+	}
+
+	resp := make([]personalAccessTokenResp, 0, len(tokens))
+	for i := range tokens {
+		resp = append(resp, newPersonalAccessTokenResp(&tokens[i]))
+	}
+	encoding.HandleSuccessList(c, int64(len(resp)), resp)
+}
+
+// 吊销个人访问令牌, 管理员可以吊销任何用户的令牌
+func (h *authHandler) revokePersonalAccessToken(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c, types.DefaultTimeout)
+	defer cancel()
+
+	req := revokePersonalAccessTokenReq{}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		encoding.HandleError(c, errutil.ErrJSONFormat)
+		return
+	}
+
+	if err := request.ValidateStruct(ctx, req); err != nil {
+		encoding.HandleError(c, err)
+		return
+	}
+
+	admin, err := h.isAdmin(ctx)
+	if err != nil {
+		zap.L().Error("isAdmin", zap.Error(err))
+		encoding.HandleError(c, errutil.ErrInternalServer)
+		return
+	}
+	uid := token.GetUIDFromCtx(ctx)
+	if admin {
+		uid = ""
+	}
+	if err = h.patManager.Revoke(ctx, req.ID, uid); err != nil {
+		h.handlePersonalAccessTokenError(c, err)
+		return
+	}
+	h.auditPersonalAccessToken(ctx, token.GetUIDFromCtx(ctx), fmt.Sprintf("personal access token %d revoked", req.ID))
+
+	encoding.HandleSuccess(c)
+}
+
+func (h *authHandler) auditPersonalAccessToken(ctx context.Context, uid, operation string) {
+	logs.UserOperatorLogChannel <- &model.UserOperatorLog{
+		UID:       uid,
+		Operator:  model.UserOperatorPersonalAccessToken,
+		Operation: operation,
+		CreatedAt: time.Now().UnixMilli(),
+		Creator:   token.GetUIDFromCtx(ctx),
+	}
+}
+
+func (h *authHandler) handlePersonalAccessTokenError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, pat.ErrTokenNotFound):
+		encoding.HandleError(c, errutil.NewError(http.StatusNotFound, err.Error()))
+	case errors.Is(err, pat.ErrInvalidScope), errors.Is(err, pat.ErrDuplicateName), errors.Is(err, pat.ErrTooManyTokens):
+		encoding.HandleError(c, errutil.NewError(http.StatusBadRequest, err.Error()))
+	default:
+		zap.L().Error("personal access token", zap.Error(err))
+		encoding.HandleError(c, errutil.ErrInternalServer)
+	}
+}
+
+func newPersonalAccessTokenResp(t *model.PersonalAccessToken) personalAccessTokenResp {
+	return personalAccessTokenResp{
+		ID:         t.ID,
+		UID:        t.UID,
+		Name:       t.Name,
+		Scopes:     t.ScopeList(),
+		ExpiresAt:  t.ExpiresAt,
+		LastUsedAt: t.LastUsedAt,
+		RevokedAt:  t.RevokedAt,
+		CreatedAt:  t.CreatedAt,
+	}
+}
@@ -1,29 +1,78 @@
 package passport
 
 import (
-	"asyncKubeManager/pkg/client/ldap"
+	"asyncKubeManager/pkg/authn"
+	"asyncKubeManager/pkg/client/cache"
 	"asyncKubeManager/pkg/dbresolver"
 	"asyncKubeManager/pkg/server/middleware"
-	"asyncKubeManager/pkg/token"
+	"asyncKubeManager/pkg/token/pat"
+	"asyncKubeManager/pkg/token/refresh"
 	"asyncKubeManager/pkg/utils/limiter"
+	"asyncKubeManager/pkg/utils/pwdutil"
 	"github.com/gin-gonic/gin"
-	"golang.org/x/time/rate"
 	"time"
 )
 
-func RegisterRouter(group *gin.RouterGroup, tokenManager token.Manager, dbResolver *dbresolver.DBResolver, ldapClient *ldap.LDAPClient) {
+// RegisterRouter 注册认证路由, cacheClient 为 nil 时登录失败次数和 OIDC 登录状态只在本进程内保存, authenticators 为启用的认证方式
+func RegisterRouter(group *gin.RouterGroup, authChain *middleware.AuthChain, dbResolver *dbresolver.DBResolver, authenticators *authn.Registry,
+	cacheClient cache.Interface, loginPolicy limiter.LoginPolicy, passwordPolicy pwdutil.Policy) {
 	authG := group.Group("/auth")
+	tokenManager := authChain.TokenManager
+	captchaLimit := limiter.Limit{Interval: time.Second, Burst: 3}
+	captchaLimiter := limiter.NewMemoryRateLimiter(captchaLimit)
+	loginLimiter := limiter.NewLoginLimiter(loginPolicy.Window)
+	var stateCache cache.Interface = cache.NewMemoryClient()
+	if cacheClient != nil {
+		captchaLimiter = limiter.NewCacheRateLimiter(cacheClient, "rate-limit:captcha:", captchaLimit)
+		loginLimiter = limiter.NewCacheLoginLimiter(cacheClient, loginPolicy.Window)
+		stateCache = cacheClient
+	}
 	handler := newAuthHandler(authHandlerOption{
-		tokenManager:   tokenManager,
-		dbResolver:     dbResolver,
-		captchaLimiter: limiter.NewKeyLimiter(rate.Every(time.Second), 3),
-		loginLimiter:   limiter.NewLoginLimiter(),
-		ldapClient:     ldapClient,
+		tokenManager:    tokenManager,
+		dbResolver:      dbResolver,
+		captchaLimiter:  captchaLimiter,
+		loginLimiter:    loginLimiter,
+		authenticators:  authenticators,
+		stateCache:      stateCache,
+		enforcer:        authChain.Enforcer,
+		refreshManager:  refresh.NewManager(dbResolver, refresh.DefaultDuration),
+		loginPolicy:     loginPolicy,
+		passwordPolicy:  passwordPolicy,
+		mfa:             authn.NewMFA(dbResolver, authn.DefaultMFAIssuer),
+		patManager:      pat.NewManager(dbResolver),
+		userLogout:      authn.NewUserLogout(tokenManager, dbResolver),
+		serviceAccounts: authn.NewServiceAccounts(dbResolver),
 	})
 
 	authG.POST("/login", handler.login)
 	authG.GET("/captcha", handler.createCaptcha)
+	authG.POST("/refresh", handler.refresh)
+	authG.GET("/providers", handler.listProviders)
+	authG.GET("/oidc/login", handler.oidcLogin)
+	authG.POST("/oidc/callback", handler.oidcCallback)
+	authG.POST("/mfa/verify", handler.mfaVerify)
+	authG.POST("/mfa/challenge/enroll", handler.mfaChallengeEnroll)
+	authG.POST("/token", handler.clientCredentials)
 
-	authG.Use(middleware.CheckToken(tokenManager))
+	authG.Use(authChain.Handlers()...)
 	authG.POST("/logout", handler.logout)
+	authG.POST("/logout/all", handler.logoutAll)
+	authG.POST("/session/list", handler.listSessions)
+	authG.POST("/session/revoke", handler.revokeSession)
+	authG.POST("/force-logout", handler.forceLogout)
+	authG.POST("/unlock", handler.unlock)
+	authG.POST("/password", handler.changePassword)
+	authG.POST("/user/update", handler.update)
+	authG.POST("/mfa/status", handler.mfaStatus)
+	authG.POST("/mfa/enroll", handler.mfaEnroll)
+	authG.POST("/mfa/confirm", handler.mfaConfirm)
+	authG.POST("/mfa/disable", handler.mfaDisable)
+	authG.POST("/mfa/recovery-codes", handler.mfaRegenerateRecoveryCodes)
+	authG.POST("/mfa/reset", handler.mfaReset)
+	authG.POST("/mfa/policy/list", handler.listMFARolePolicies)
+	authG.POST("/mfa/policy/set", handler.setMFARolePolicy)
+	authG.POST("/pat/create", handler.createPersonalAccessToken)
+	authG.POST("/pat/list", handler.listPersonalAccessTokens)
+	authG.POST("/pat/revoke", handler.revokePersonalAccessToken)
+	authG.POST("/pat/list_all", handler.listAllPersonalAccessTokens)
 }
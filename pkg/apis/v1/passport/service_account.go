@@ -0,0 +1,112 @@
+package passport
+
+import (
+	"asyncKubeManager/pkg/apis/v1/logs"
+	"asyncKubeManager/pkg/authn"
+	"asyncKubeManager/pkg/model"
+	"asyncKubeManager/pkg/server/encoding"
+	"asyncKubeManager/pkg/server/errutil"
+	"asyncKubeManager/pkg/server/request"
+	"asyncKubeManager/pkg/token"
+	"asyncKubeManager/pkg/types"
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// clientCredentials exchanges the client credentials of a service account for an access token.
+// There is no refresh token, the client exchanges its credentials again when the token expires.
+func (h *authHandler) clientCredentials(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c, types.DefaultTimeout)
+	defer cancel()
+
+	req := clientCredentialsReq{}
+	if err := c.ShouldBind(&req); err != nil {
+		encoding.HandleError(c, errutil.ErrIllegalParameter)
+		return
+	}
+
+	if err := request.ValidateStruct(ctx, req); err != nil {
+		encoding.HandleError(c, err)
+		return
+	}
+	if clientID, clientSecret, ok := c.Request.BasicAuth(); ok {
+		req.ClientID, req.ClientSecret = clientID, clientSecret
+	}
+	if req.ClientID == "" || req.ClientSecret == "" {
+		encoding.HandleError(c, errutil.ErrUnauthorized)
+		return
+	}
+
+	ipKey := "ip:" + c.ClientIP()
+	if h.loginPolicy.IPThreshold > 0 && h.loginLimiter.IsLimit(ipKey, h.loginPolicy.IPThreshold) {
+		encoding.HandleError(c, errutil.NewError(http.StatusTooManyRequests, "too many failed login attempts, please try again later"))
+		return
+	}
+	clientKey := "client:" + req.ClientID
+	if h.loginPolicy.UserThreshold > 0 && h.loginLimiter.IsLimit(clientKey, h.loginPolicy.UserThreshold) {
+		encoding.HandleError(c, errutil.NewError(http.StatusForbidden, "the client is locked, please try again later"))
+		return
+	}
+
+	sa, err := h.serviceAccounts.Authenticate(ctx, req.ClientID, req.ClientSecret)
+	if errors.Is(err, authn.ErrInvalidClient) {
+		// service account 只由 loginLimiter 锁定, 不修改其状态
+		h.loginFailed(ctx, "", "", ipKey)
+		if h.loginPolicy.UserThreshold > 0 && h.loginLimiter.LoginFailToReachLimit(clientKey, h.loginPolicy.UserThreshold) {
+			h.loginLimiter.Lock(clientKey, h.loginPolicy.LockoutDuration)
+			zap.L().Warn("login locked", zap.String("key", clientKey))
+		}
+		encoding.HandleError(c, errutil.NewError(http.StatusUnauthorized, err.Error()))
+		return
+	}
+	if err != nil {
+		zap.L().Error("Authenticate service account", zap.Error(err))
+		encoding.HandleError(c, errutil.ErrInternalServer)
+		return
+	}
+	h.loginLimiter.Clean(clientKey)
+
+	// 角色可能被管理员修改过, 签发时同步角色绑定
+	if err = h.enforcer.SetUserRole(sa.UID, string(sa.Role)); err != nil {
+		zap.L().Error("SetUserRole", zap.Error(err))
+		encoding.HandleError(c, errutil.ErrInternalServer)
+		return
+	}
+
+	t, err := h.tokenManager.IssueSession(token.Info{
+		UID:      sa.UID,
+		Username: sa.Name,
+		Name:     sa.Name,
+		RoleID:   sa.Role,
+	}, token.DefaultAccessTokenDuration, token.SessionMeta{
+		Device:    "service account",
+		IP:        c.ClientIP(),
+		UserAgent: c.Request.UserAgent(),
+		Unlimited: true,
+	})
+	if err != nil {
+		zap.L().Error("IssueSession", zap.Error(err))
+		encoding.HandleError(c, errutil.ErrInternalServer)
+		return
+	}
+
+	// Creator 为创建 service account 的用户
+	logs.UserOperatorLogChannel <- &model.UserOperatorLog{
+		UID:       sa.UID,
+		Operator:  model.UserOperatorLogin,
+		Operation: "client credentials",
+		CreatedAt: time.Now().UnixMilli(),
+		Creator:   sa.Creator,
+	}
+
+	encoding.HandleSuccess(c, clientCredentialsResp{
+		AccessToken: t,
+		TokenType:   "Bearer",
+		ExpiresIn:   int64(token.DefaultAccessTokenDuration.Seconds()),
+	})
+}
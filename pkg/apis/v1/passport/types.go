@@ -1,6 +1,9 @@
 package passport
 
-import "asyncKubeManager/pkg/model"
+import (
+	"asyncKubeManager/pkg/model"
+	"asyncKubeManager/pkg/token"
+)
 
 type (
 	loginReq struct {
@@ -8,11 +11,48 @@ type (
 		Password     string `json:"password" validate:"required"`
 		CaptchaID    string `json:"captcha_id" validate:"required"`
 		CaptchaValue string `json:"captcha_value" validate:"required"`
+		// Provider names the password provider, every enabled one is tried in order if empty
+		Provider string `json:"provider" validate:"omitempty,lte=16"`
+		// Device names the client in the session list, derived from the user agent if empty
+		Device string `json:"device" validate:"omitempty,lte=64"`
 	}
 	loginResp struct {
-		UID      string `json:"uid"`
-		Username string `json:"username"`
-		Token    string `json:"token"`
+		UID          string `json:"uid"`
+		Username     string `json:"username"`
+		Token        string `json:"token"`
+		RefreshToken string `json:"refresh_token,omitempty"`
+		// ExpiresIn is the lifetime of the access token in seconds
+		ExpiresIn int64 `json:"expires_in,omitempty"`
+		// MFARequired is set instead of the tokens when the user has to pass a second factor,
+		// ChallengeToken is exchanged for the tokens with a one-time password by /auth/mfa/verify
+		MFARequired    bool   `json:"mfa_required,omitempty"`
+		ChallengeToken string `json:"challenge_token,omitempty"`
+		// EnrollRequired is set when MFA is enforced for the role of a user who hasn't enrolled,
+		// the user enrolls with the ChallengeToken by /auth/mfa/challenge/enroll first
+		EnrollRequired bool `json:"enroll_required,omitempty"`
+		// RecoveryCodes are returned once by the login confirming the enrollment
+		RecoveryCodes []string `json:"recovery_codes,omitempty"`
+	}
+
+	refreshReq struct {
+		RefreshToken string `json:"refresh_token" validate:"required"`
+	}
+
+	sessionResp struct {
+		token.Session
+		Current bool `json:"current"`
+	}
+
+	revokeSessionReq struct {
+		SessionID string `json:"session_id" validate:"required"`
+	}
+
+	unlockReq struct {
+		UID string `json:"uid" validate:"required"`
+	}
+
+	forceLogoutReq struct {
+		UID string `json:"uid" validate:"required"`
 	}
 
 	createCaptchaResp struct {
@@ -22,11 +62,135 @@ type (
 
 	updateUserReq struct {
 		UID      string         `json:"uid" validate:"required"`
-		Username string         `json:"username" validate:"required,gt=0,lte=50"`
+		Username string         `json:"username" validate:"omitempty,lte=50"` // Optional, the current username is kept if empty
 		Email    string         `json:"email" validate:"email"`
 		Tel      string         `json:"tel" validate:"omitempty"`
 		Desc     string         `json:"desc" validate:"omitempty"`
-		Password string         `json:"password" validate:"omitempty,min=6"` // Optional password field
-		Role     model.UserRole `json:"role" validate:"omitempty"`
+		Password string         `json:"password" validate:"omitempty"` // Optional password field, only for local accounts
+		Role     model.UserRole `json:"role" validate:"omitempty,oneof=admin normal"`
+		// AuthSource switches the user between ldap and local, a local account needs a password
+		AuthSource model.AuthSource `json:"auth_source" validate:"omitempty,oneof=ldap local"`
+	}
+
+	providerResp struct {
+		Name string `json:"name"`
+		Type string `json:"type"`
+	}
+
+	oidcLoginResp struct {
+		URL   string `json:"url"`
+		State string `json:"state"`
+	}
+
+	oidcCallbackReq struct {
+		State  string `json:"state" validate:"required"`
+		Code   string `json:"code" validate:"required"`
+		Device string `json:"device" validate:"omitempty,lte=64"`
+	}
+
+	// oidcState is kept in the cache between the redirect and the callback
+	oidcState struct {
+		Provider     string `json:"provider"`
+		Nonce        string `json:"nonce"`
+		CodeVerifier string `json:"code_verifier"`
+	}
+
+	changePasswordReq struct {
+		OldPassword string `json:"old_password" validate:"required"`
+		NewPassword string `json:"new_password" validate:"required"`
+	}
+
+	// mfaChallenge is kept in the cache between the password and the one-time password of a login
+	mfaChallenge struct {
+		UID    string `json:"uid"`
+		Device string `json:"device"`
+	}
+
+	mfaVerifyReq struct {
+		ChallengeToken string `json:"challenge_token" validate:"required"`
+		// Code is a TOTP code or a recovery code
+		Code string `json:"code" validate:"required,lte=32"`
+	}
+
+	mfaChallengeReq struct {
+		ChallengeToken string `json:"challenge_token" validate:"required"`
+	}
+
+	mfaCodeReq struct {
+		Code string `json:"code" validate:"required,lte=32"`
+	}
+
+	mfaEnrollResp struct {
+		Secret string `json:"secret"`
+		// URI is the otpauth URI shown as a QR code to the authenticator app
+		URI string `json:"uri"`
+	}
+
+	mfaRecoveryCodesResp struct {
+		RecoveryCodes []string `json:"recovery_codes"`
+	}
+
+	mfaStatusResp struct {
+		Enrolled bool `json:"enrolled"`
+		// Enforced is set if MFA is enforced for the role of the user, it can't be disabled then
+		Enforced          bool  `json:"enforced"`
+		RecoveryCodesLeft int64 `json:"recovery_codes_left"`
+	}
+
+	mfaResetReq struct {
+		UID string `json:"uid" validate:"required"`
+	}
+
+	mfaRolePolicyReq struct {
+		Role     model.UserRole `json:"role" validate:"required,lte=32"`
+		Enforced bool           `json:"enforced"`
+	}
+
+	createPersonalAccessTokenReq struct {
+		Name string `json:"name" validate:"required,lte=64"`
+		// Scopes are the API groups the token can access, e.g. vm and disk
+		Scopes        []string `json:"scopes" validate:"required,min=1,dive,required"`
+		ExpiresInDays int      `json:"expires_in_days" validate:"required,min=1,max=365"`
+	}
+
+	createPersonalAccessTokenResp struct {
+		personalAccessTokenResp
+		// Token is returned only once, it is stored hashed
+		Token string `json:"token"`
+	}
+
+	personalAccessTokenResp struct {
+		ID         int64    `json:"id"`
+		UID        string   `json:"uid"`
+		Name       string   `json:"name"`
+		Scopes     []string `json:"scopes"`
+		ExpiresAt  int64    `json:"expires_at"`
+		LastUsedAt int64    `json:"last_used_at"`
+		RevokedAt  int64    `json:"revoked_at"`
+		CreatedAt  int64    `json:"created_at"`
+	}
+
+	listPersonalAccessTokensReq struct {
+		// UID filters the tokens of all users listed by an admin
+		UID string `json:"uid" validate:"omitempty,lte=32"`
+	}
+
+	revokePersonalAccessTokenReq struct {
+		ID int64 `json:"id" validate:"required"`
+	}
+
+	// clientCredentialsReq is the client credentials grant of RFC 6749, the credentials may be sent
+	// by HTTP basic authentication instead
+	clientCredentialsReq struct {
+		GrantType    string `form:"grant_type" json:"grant_type" validate:"required,eq=client_credentials"`
+		ClientID     string `form:"client_id" json:"client_id" validate:"omitempty,lte=32"`
+		ClientSecret string `form:"client_secret" json:"client_secret" validate:"omitempty,lte=128"`
+	}
+
+	clientCredentialsResp struct {
+		AccessToken string `json:"access_token"`
+		TokenType   string `json:"token_type"`
+		// ExpiresIn is the lifetime of the access token in seconds
+		ExpiresIn int64 `json:"expires_in"`
 	}
 )
@@ -0,0 +1,143 @@
+package policy
+
+import (
+	"asyncKubeManager/pkg/auth"
+	"asyncKubeManager/pkg/model"
+	"asyncKubeManager/pkg/server/encoding"
+	"asyncKubeManager/pkg/server/errutil"
+	"asyncKubeManager/pkg/server/request"
+	"asyncKubeManager/pkg/token"
+	"context"
+	"errors"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+type policyHandlerOption struct {
+	enforcer *auth.Enforcer
+}
+
+type policyHandler struct {
+	policyHandlerOption
+}
+
+func newPolicyHandler(option policyHandlerOption) *policyHandler {
+	return &policyHandler{
+		policyHandlerOption: option,
+	}
+}
+
+// 获取所有策略与角色绑定
+func (h *policyHandler) listPolicies(c *gin.Context) {
+	resp := listPoliciesResp{
+		Policies:     make([]policy, 0),
+		RoleBindings: make([]roleBinding, 0),
+	}
+	for _, rule := range h.enforcer.GetPolicies() {
+		resp.Policies = append(resp.Policies, policy{Subject: rule[0], Object: rule[1], Action: rule[2]})
+	}
+	for _, rule := range h.enforcer.GetRoleBindings() {
+		resp.RoleBindings = append(resp.RoleBindings, roleBinding{UID: rule[0], Role: rule[1]})
+	}
+
+	encoding.HandleSuccess(c, resp)
+}
+
+// 添加策略, 立即生效
+func (h *policyHandler) addPolicy(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c, time.Second*30)
+	defer cancel()
+
+	req := policy{}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		encoding.HandleError(c, errutil.ErrJSONFormat)
+		return
+	}
+
+	if err := request.ValidateStruct(ctx, req); err != nil {
+		encoding.HandleError(c, err)
+		return
+	}
+
+	if err := h.enforcer.AddPolicy(req.Subject, req.Object, req.Action); err != nil {
+		zap.L().Error("failed to add policy", zap.Any("policy", req), zap.Error(err))
+		encoding.HandleError(c, errutil.ErrInternalServer)
+		return
+	}
+	zap.L().Info("policy added", zap.Any("policy", req), zap.String("operator", token.GetUIDFromCtx(c)))
+
+	encoding.HandleSuccess(c)
+}
+
+// 删除策略, 立即生效
+func (h *policyHandler) removePolicy(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c, time.Second*30)
+	defer cancel()
+
+	req := policy{}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		encoding.HandleError(c, errutil.ErrJSONFormat)
+		return
+	}
+
+	if err := request.ValidateStruct(ctx, req); err != nil {
+		encoding.HandleError(c, err)
+		return
+	}
+
+	// 管理员角色的策略不允许删除, 避免所有管理员失去管理权限
+	if req.Subject == string(model.UserRoleAdmin) {
+		encoding.HandleError(c, errutil.ErrIllegalOperation)
+		return
+	}
+
+	if err := h.enforcer.RemovePolicy(req.Subject, req.Object, req.Action); err != nil {
+		zap.L().Error("failed to remove policy", zap.Any("policy", req), zap.Error(err))
+		encoding.HandleError(c, errutil.ErrInternalServer)
+		return
+	}
+	zap.L().Info("policy removed", zap.Any("policy", req), zap.String("operator", token.GetUIDFromCtx(c)))
+
+	encoding.HandleSuccess(c)
+}
+
+// 将用户加入用户组, 立即生效
+func (h *policyHandler) addGroupMember(c *gin.Context) {
+	h.updateGroupMember(c, "added to", h.enforcer.AddUserToGroup)
+}
+
+// 将用户移出用户组, 立即生效
+func (h *policyHandler) removeGroupMember(c *gin.Context) {
+	h.updateGroupMember(c, "removed from", h.enforcer.RemoveUserFromGroup)
+}
+
+func (h *policyHandler) updateGroupMember(c *gin.Context, operation string, update func(userID, group string) error) {
+	ctx, cancel := context.WithTimeout(c, time.Second*30)
+	defer cancel()
+
+	req := groupMember{}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		encoding.HandleError(c, errutil.ErrJSONFormat)
+		return
+	}
+
+	if err := request.ValidateStruct(ctx, req); err != nil {
+		encoding.HandleError(c, err)
+		return
+	}
+
+	if err := update(req.UID, req.Group); err != nil {
+		if errors.Is(err, auth.ErrBuiltinGroup) {
+			encoding.HandleError(c, errutil.ErrIllegalParameter)
+			return
+		}
+		zap.L().Error("failed to update group member", zap.Any("member", req), zap.Error(err))
+		encoding.HandleError(c, errutil.ErrInternalServer)
+		return
+	}
+	zap.L().Info("user "+operation+" group", zap.Any("member", req), zap.String("operator", token.GetUIDFromCtx(c)))
+
+	encoding.HandleSuccess(c)
+}
@@ -0,0 +1,24 @@
+package policy
+
+import (
+	"asyncKubeManager/pkg/server/middleware"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RegisterRouter 注册策略管理路由, 默认策略下只有管理员可以访问
+func RegisterRouter(group *gin.RouterGroup, authChain *middleware.AuthChain) {
+	policyG := group.Group("/policy")
+
+	handler := newPolicyHandler(policyHandlerOption{
+		enforcer: authChain.Enforcer,
+	})
+
+	policyG.Use(authChain.Handlers()...)
+
+	policyG.POST("/list", handler.listPolicies)
+	policyG.POST("/add", handler.addPolicy)
+	policyG.POST("/remove", handler.removePolicy)
+	policyG.POST("/group/add", handler.addGroupMember)
+	policyG.POST("/group/remove", handler.removeGroupMember)
+}
@@ -0,0 +1,27 @@
+package policy
+
+type (
+	// 策略, subject 为角色或用户 uid, object 为接口路由, action 为 HTTP 方法或 *
+	policy struct {
+		Subject string `json:"subject" validate:"required,lte=64"`
+		Object  string `json:"object" validate:"required,startswith=/,lte=255"`
+		Action  string `json:"action" validate:"required,lte=16"`
+	}
+
+	// 用户组成员, 授权给用户组的资源共享给组内的用户, 内置角色不能作为用户组
+	groupMember struct {
+		UID   string `json:"uid" validate:"required,lte=32"`
+		Group string `json:"group" validate:"required,lte=64"`
+	}
+
+	// 用户与角色或用户组的绑定
+	roleBinding struct {
+		UID  string `json:"uid"`
+		Role string `json:"role"`
+	}
+
+	listPoliciesResp struct {
+		Policies     []policy      `json:"policies"`
+		RoleBindings []roleBinding `json:"role_bindings"`
+	}
+)
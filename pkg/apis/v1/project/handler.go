@@ -0,0 +1,594 @@
+package project
+
+import (
+	"asyncKubeManager/pkg/dao"
+	"asyncKubeManager/pkg/dbresolver"
+	"asyncKubeManager/pkg/manager/namespace"
+	"asyncKubeManager/pkg/model"
+	"asyncKubeManager/pkg/server/encoding"
+	"asyncKubeManager/pkg/server/errutil"
+	"asyncKubeManager/pkg/server/request"
+	"asyncKubeManager/pkg/tenant"
+	"asyncKubeManager/pkg/token"
+	"asyncKubeManager/pkg/utils"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+	"k8s.io/apimachinery/pkg/util/validation"
+)
+
+type projectHandlerOption struct {
+	dbResolver       *dbresolver.DBResolver
+	namespaceManager namespace.NamespaceManager
+}
+
+type projectHandler struct {
+	projectHandlerOption
+}
+
+func newProjectHandler(option projectHandlerOption) *projectHandler {
+	return &projectHandler{
+		projectHandlerOption: option,
+	}
+}
+
+// 创建项目, 同时创建对应的 namespace 和 ResourceQuota
+func (h *projectHandler) createProject(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c, time.Second*30)
+	defer cancel()
+
+	if token.GetUserRoleFromCtx(ctx) != model.UserRoleAdmin {
+		encoding.HandleError(c, errutil.ErrPermissionDenied)
+		return
+	}
+
+	req := createProjectReq{}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		encoding.HandleError(c, errutil.ErrJSONFormat)
+		return
+	}
+
+	if err := request.ValidateStruct(ctx, req); err != nil {
+		encoding.HandleError(c, err)
+		return
+	}
+
+	ns := h.namespaceManager.NamespaceForProject(req.Name)
+	if errs := validation.IsDNS1123Label(ns); len(errs) > 0 {
+		encoding.HandleError(c, errutil.NewError(http.StatusBadRequest,
+			fmt.Sprintf("invalid namespace %q: %s", ns, strings.Join(errs, "; "))))
+		return
+	}
+
+	found, _, err := dao.GetProjectByName(ctx, h.dbResolver, req.Name)
+	if err != nil {
+		zap.L().Error("failed to get project", zap.Error(err))
+		encoding.HandleError(c, errutil.ErrInternalServer)
+		return
+	}
+	if found {
+		encoding.HandleError(c, errutil.ErrDuplicateName)
+		return
+	}
+
+	var (
+		project *model.Project
+		quota   *model.ProjectQuota
+	)
+	err = h.dbResolver.GetDB().Transaction(func(tx *gorm.DB) error {
+		var err error
+		project, err = dao.InsertProjectWithDB(ctx, tx, utils.NextID(), req.Name, ns, req.Desc)
+		if err != nil {
+			return err
+		}
+
+		// 创建者默认为项目管理员
+		if _, err = dao.InsertProjectMemberWithDB(ctx, tx, project.ID, token.GetUIDFromCtx(ctx), model.ProjectRoleAdmin); err != nil {
+			return err
+		}
+
+		if req.Quota != nil {
+			quota = req.Quota.toModel(project.ID)
+			return dao.SaveProjectQuotaWithDB(ctx, tx, quota)
+		}
+		return nil
+	})
+	if err != nil {
+		zap.L().Error("failed to create project", zap.Error(err))
+		encoding.HandleError(c, errutil.ErrInternalServer)
+		return
+	}
+
+	// namespace 在事务提交后创建, 失败时删除 namespace 和已提交的项目
+	if err = h.provisionNamespace(ctx, project, quota); err != nil {
+		zap.L().Error("failed to create project namespace", zap.String("namespace", project.Namespace), zap.Error(err))
+		h.undoCreateProject(ctx, project)
+		encoding.HandleError(c, errutil.ErrInternalServer)
+		return
+	}
+
+	encoding.HandleSuccess(c, project)
+}
+
+// 获取项目列表, 普通用户只能看到自己所在的项目
+func (h *projectHandler) listProjects(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c, time.Second*30)
+	defer cancel()
+
+	var (
+		projects []model.Project
+		err      error
+	)
+	if token.GetUserRoleFromCtx(ctx) == model.UserRoleAdmin {
+		projects, err = dao.ListProjects(ctx, h.dbResolver)
+	} else {
+		projects, err = dao.ListProjectsByMember(ctx, h.dbResolver, token.GetUIDFromCtx(ctx))
+	}
+	if err != nil {
+		zap.L().Error("failed to list projects", zap.Error(err))
+		encoding.HandleError(c, errutil.ErrInternalServer)
+		return
+	}
+
+	encoding.HandleSuccessList(c, int64(len(projects)), projects)
+}
+
+// 获取项目详情
+func (h *projectHandler) getProject(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c, time.Second*30)
+	defer cancel()
+
+	req := projectReq{}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		encoding.HandleError(c, errutil.ErrJSONFormat)
+		return
+	}
+
+	if err := request.ValidateStruct(ctx, req); err != nil {
+		encoding.HandleError(c, err)
+		return
+	}
+
+	found, project, err := dao.GetProjectByUID(ctx, h.dbResolver, req.ProjectUID)
+	if err != nil {
+		zap.L().Error("failed to get project", zap.Error(err))
+		encoding.HandleError(c, errutil.ErrInternalServer)
+		return
+	}
+	if !found {
+		encoding.HandleError(c, errutil.ErrProjectNotFound)
+		return
+	}
+
+	if token.GetUserRoleFromCtx(ctx) != model.UserRoleAdmin {
+		found, _, err = dao.GetProjectMember(ctx, h.dbResolver, project.ID, token.GetUIDFromCtx(ctx))
+		if err != nil {
+			zap.L().Error("failed to get project member", zap.Error(err))
+			encoding.HandleError(c, errutil.ErrInternalServer)
+			return
+		}
+		if !found {
+			encoding.HandleError(c, errutil.ErrPermissionDenied)
+			return
+		}
+	}
+
+	resp := projectResp{Project: *project}
+	found, quota, err := dao.GetProjectQuota(ctx, h.dbResolver, project.ID)
+	if err != nil {
+		zap.L().Error("failed to get project quota", zap.Error(err))
+		encoding.HandleError(c, errutil.ErrInternalServer)
+		return
+	}
+	if found {
+		resp.Quota = quota
+	}
+
+	resp.Members, err = dao.ListProjectMembers(ctx, h.dbResolver, project.ID)
+	if err != nil {
+		zap.L().Error("failed to list project members", zap.Error(err))
+		encoding.HandleError(c, errutil.ErrInternalServer)
+		return
+	}
+
+	encoding.HandleSuccess(c, resp)
+}
+
+// 删除项目, 项目下仍有虚拟机时不允许删除
+func (h *projectHandler) deleteProject(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c, time.Second*30)
+	defer cancel()
+
+	if token.GetUserRoleFromCtx(ctx) != model.UserRoleAdmin {
+		encoding.HandleError(c, errutil.ErrPermissionDenied)
+		return
+	}
+
+	req := projectReq{}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		encoding.HandleError(c, errutil.ErrJSONFormat)
+		return
+	}
+
+	if err := request.ValidateStruct(ctx, req); err != nil {
+		encoding.HandleError(c, err)
+		return
+	}
+
+	found, project, err := dao.GetProjectByUID(ctx, h.dbResolver, req.ProjectUID)
+	if err != nil {
+		zap.L().Error("failed to get project", zap.Error(err))
+		encoding.HandleError(c, errutil.ErrInternalServer)
+		return
+	}
+	if !found {
+		encoding.HandleError(c, errutil.ErrProjectNotFound)
+		return
+	}
+	if project.Name == model.DefaultProjectName {
+		encoding.HandleError(c, errutil.ErrIllegalOperation)
+		return
+	}
+
+	count, err := dao.CountVMsByProjectID(ctx, h.dbResolver, project.ID)
+	if err != nil {
+		zap.L().Error("failed to count project vms", zap.Error(err))
+		encoding.HandleError(c, errutil.ErrInternalServer)
+		return
+	}
+	if count > 0 {
+		encoding.HandleError(c, errutil.ErrProjectNotEmpty)
+		return
+	}
+	// 删除 namespace 会一并删除其中的磁盘
+	hasDisks, err := h.namespaceManager.HasPersistentVolumeClaims(ctx, project.Namespace)
+	if err != nil {
+		zap.L().Error("failed to list project disks", zap.String("namespace", project.Namespace), zap.Error(err))
+		encoding.HandleError(c, errutil.ErrInternalServer)
+		return
+	}
+	if hasDisks {
+		encoding.HandleError(c, errutil.ErrProjectNotEmpty)
+		return
+	}
+
+	// 删除失败时用于恢复项目
+	members, err := dao.ListProjectMembers(ctx, h.dbResolver, project.ID)
+	if err != nil {
+		zap.L().Error("failed to list project members", zap.Error(err))
+		encoding.HandleError(c, errutil.ErrInternalServer)
+		return
+	}
+	_, quota, err := dao.GetProjectQuota(ctx, h.dbResolver, project.ID)
+	if err != nil {
+		zap.L().Error("failed to get project quota", zap.Error(err))
+		encoding.HandleError(c, errutil.ErrInternalServer)
+		return
+	}
+
+	deletedSince := time.Now()
+	err = h.dbResolver.GetDB().Transaction(func(tx *gorm.DB) error {
+		return dao.DeleteProjectByIDWithDB(ctx, tx, project.ID)
+	})
+	if err != nil {
+		zap.L().Error("failed to delete project", zap.Error(err))
+		encoding.HandleError(c, errutil.ErrInternalServer)
+		return
+	}
+
+	// namespace 在事务提交后删除, 失败时恢复项目以便重试
+	if err = h.namespaceManager.DeleteNamespace(ctx, project.Namespace); err != nil {
+		zap.L().Error("failed to delete project namespace", zap.String("namespace", project.Namespace), zap.Error(err))
+		h.undoDeleteProject(ctx, project, members, quota, deletedSince)
+		encoding.HandleError(c, errutil.ErrInternalServer)
+		return
+	}
+
+	// namespace 删除后彻底删除项目, 以便再次使用项目名称
+	err = h.dbResolver.GetDB().Transaction(func(tx *gorm.DB) error {
+		return dao.PurgeProjectByIDWithDB(ctx, tx, project.ID)
+	})
+	if err != nil {
+		zap.L().Error("failed to purge project", zap.String("project", project.UID), zap.Error(err))
+	}
+
+	encoding.HandleSuccess(c, nil)
+}
+
+// 获取项目成员列表
+func (h *projectHandler) listMembers(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c, time.Second*30)
+	defer cancel()
+
+	members, err := dao.ListProjectMembers(ctx, h.dbResolver, tenant.GetProjectIDFromCtx(ctx))
+	if err != nil {
+		zap.L().Error("failed to list project members", zap.Error(err))
+		encoding.HandleError(c, errutil.ErrInternalServer)
+		return
+	}
+
+	encoding.HandleSuccessList(c, int64(len(members)), members)
+}
+
+// 添加项目成员
+func (h *projectHandler) addMember(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c, time.Second*30)
+	defer cancel()
+
+	req := memberReq{}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		encoding.HandleError(c, errutil.ErrJSONFormat)
+		return
+	}
+
+	if err := request.ValidateStruct(ctx, req); err != nil {
+		encoding.HandleError(c, err)
+		return
+	}
+	if req.Role == "" {
+		req.Role = model.ProjectRoleMember
+	}
+
+	found, _, err := dao.GetUserByUID(ctx, h.dbResolver, req.UID)
+	if err != nil {
+		zap.L().Error("failed to get user", zap.Error(err))
+		encoding.HandleError(c, errutil.ErrInternalServer)
+		return
+	}
+	if !found {
+		encoding.HandleError(c, errutil.ErrUserNotFound)
+		return
+	}
+
+	projectID := tenant.GetProjectIDFromCtx(ctx)
+	found, _, err = dao.GetProjectMember(ctx, h.dbResolver, projectID, req.UID)
+	if err != nil {
+		zap.L().Error("failed to get project member", zap.Error(err))
+		encoding.HandleError(c, errutil.ErrInternalServer)
+		return
+	}
+	if found {
+		encoding.HandleError(c, errutil.ErrIllegalOperation)
+		return
+	}
+
+	member, err := dao.InsertProjectMember(ctx, h.dbResolver, projectID, req.UID, req.Role)
+	if err != nil {
+		zap.L().Error("failed to add project member", zap.Error(err))
+		encoding.HandleError(c, errutil.ErrInternalServer)
+		return
+	}
+
+	encoding.HandleSuccess(c, member)
+}
+
+// 修改项目成员角色
+func (h *projectHandler) updateMember(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c, time.Second*30)
+	defer cancel()
+
+	req := memberReq{}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		encoding.HandleError(c, errutil.ErrJSONFormat)
+		return
+	}
+
+	if err := request.ValidateStruct(ctx, req); err != nil {
+		encoding.HandleError(c, err)
+		return
+	}
+	if req.Role == "" {
+		encoding.HandleError(c, errutil.ErrIllegalParameter)
+		return
+	}
+
+	projectID := tenant.GetProjectIDFromCtx(ctx)
+	found, member, err := dao.GetProjectMember(ctx, h.dbResolver, projectID, req.UID)
+	if err != nil {
+		zap.L().Error("failed to get project member", zap.Error(err))
+		encoding.HandleError(c, errutil.ErrInternalServer)
+		return
+	}
+	if !found {
+		encoding.HandleError(c, errutil.ErrUserNotFound)
+		return
+	}
+
+	err = h.dbResolver.GetDB().Transaction(func(tx *gorm.DB) error {
+		if member.Role == model.ProjectRoleAdmin && req.Role != model.ProjectRoleAdmin {
+			if err := ensureAnotherAdmin(ctx, tx, projectID); err != nil {
+				return err
+			}
+		}
+		return tx.WithContext(ctx).Model(&model.ProjectMember{}).
+			Where("project_id = ? AND uid = ?", projectID, req.UID).Update("role", req.Role).Error
+	})
+	if err != nil {
+		h.handleMemberError(c, "failed to update project member", err)
+		return
+	}
+
+	encoding.HandleSuccess(c, nil)
+}
+
+// 移除项目成员
+func (h *projectHandler) removeMember(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c, time.Second*30)
+	defer cancel()
+
+	req := memberReq{}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		encoding.HandleError(c, errutil.ErrJSONFormat)
+		return
+	}
+
+	if err := request.ValidateStruct(ctx, req); err != nil {
+		encoding.HandleError(c, err)
+		return
+	}
+
+	projectID := tenant.GetProjectIDFromCtx(ctx)
+	found, member, err := dao.GetProjectMember(ctx, h.dbResolver, projectID, req.UID)
+	if err != nil {
+		zap.L().Error("failed to get project member", zap.Error(err))
+		encoding.HandleError(c, errutil.ErrInternalServer)
+		return
+	}
+	if !found {
+		encoding.HandleSuccess(c, nil)
+		return
+	}
+
+	err = h.dbResolver.GetDB().Transaction(func(tx *gorm.DB) error {
+		if member.Role == model.ProjectRoleAdmin {
+			if err := ensureAnotherAdmin(ctx, tx, projectID); err != nil {
+				return err
+			}
+		}
+		return tx.WithContext(ctx).Where("project_id = ? AND uid = ?", projectID, req.UID).Delete(&model.ProjectMember{}).Error
+	})
+	if err != nil {
+		h.handleMemberError(c, "failed to remove project member", err)
+		return
+	}
+
+	encoding.HandleSuccess(c, nil)
+}
+
+// 更新项目配额, 同步到 namespace 的 ResourceQuota. 配额限制的是项目本身, 只有平台管理员可以修改
+func (h *projectHandler) updateQuota(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c, time.Second*30)
+	defer cancel()
+
+	if token.GetUserRoleFromCtx(ctx) != model.UserRoleAdmin {
+		encoding.HandleError(c, errutil.ErrPermissionDenied)
+		return
+	}
+
+	req := updateQuotaReq{}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		encoding.HandleError(c, errutil.ErrJSONFormat)
+		return
+	}
+
+	if err := request.ValidateStruct(ctx, req); err != nil {
+		encoding.HandleError(c, err)
+		return
+	}
+
+	project, err := tenant.ProjectFromCtx(ctx)
+	if err != nil {
+		encoding.HandleError(c, errutil.ErrProjectNotFound)
+		return
+	}
+
+	found, previous, err := dao.GetProjectQuota(ctx, h.dbResolver, project.ID)
+	if err != nil {
+		zap.L().Error("failed to get project quota", zap.Error(err))
+		encoding.HandleError(c, errutil.ErrInternalServer)
+		return
+	}
+
+	quota := req.toModel(project.ID)
+	if err = dao.SaveProjectQuotaWithDB(ctx, h.dbResolver.GetDB(), quota); err != nil {
+		zap.L().Error("failed to update project quota", zap.Error(err))
+		encoding.HandleError(c, errutil.ErrInternalServer)
+		return
+	}
+
+	// ResourceQuota 在保存后更新, 失败时恢复原来的配额
+	if err = h.namespaceManager.ApplyResourceQuota(ctx, project.Namespace, quota); err != nil {
+		zap.L().Error("failed to apply project quota", zap.String("namespace", project.Namespace), zap.Error(err))
+		h.undoUpdateQuota(ctx, project.ID, found, previous)
+		encoding.HandleError(c, errutil.ErrInternalServer)
+		return
+	}
+
+	encoding.HandleSuccess(c, quota)
+}
+
+// provisionNamespace creates the namespace of a new project and applies its quota
+func (h *projectHandler) provisionNamespace(ctx context.Context, project *model.Project, quota *model.ProjectQuota) error {
+	if _, err := h.namespaceManager.CreateNamespace(ctx, project.Namespace, project.UID); err != nil {
+		return err
+	}
+	if quota != nil {
+		return h.namespaceManager.ApplyResourceQuota(ctx, project.Namespace, quota)
+	}
+	return nil
+}
+
+// undoCreateProject deletes the namespace and the committed rows of a project whose namespace could not be created.
+// It runs with a fresh timeout since the request context may already be done.
+func (h *projectHandler) undoCreateProject(ctx context.Context, project *model.Project) {
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), time.Second*30)
+	defer cancel()
+
+	if err := h.namespaceManager.DeleteNamespace(ctx, project.Namespace); err != nil {
+		zap.L().Error("failed to delete namespace of failed project", zap.String("namespace", project.Namespace), zap.Error(err))
+	}
+	err := h.dbResolver.GetDB().Transaction(func(tx *gorm.DB) error {
+		return dao.PurgeProjectByIDWithDB(ctx, tx, project.ID)
+	})
+	if err != nil {
+		zap.L().Error("failed to delete failed project", zap.String("project", project.UID), zap.Error(err))
+	}
+}
+
+// undoDeleteProject restores a deleted project whose namespace could not be deleted
+func (h *projectHandler) undoDeleteProject(ctx context.Context, project *model.Project, members []model.ProjectMember,
+	quota *model.ProjectQuota, deletedSince time.Time) {
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), time.Second*30)
+	defer cancel()
+
+	err := h.dbResolver.GetDB().Transaction(func(tx *gorm.DB) error {
+		return dao.RestoreProjectWithDB(ctx, tx, project.ID, members, quota, deletedSince)
+	})
+	if err != nil {
+		zap.L().Error("failed to restore project", zap.String("project", project.UID), zap.Error(err))
+	}
+}
+
+// undoUpdateQuota restores the previous quota of the project, found is false if the project had none
+func (h *projectHandler) undoUpdateQuota(ctx context.Context, projectID int64, found bool, previous *model.ProjectQuota) {
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), time.Second*30)
+	defer cancel()
+
+	var err error
+	if found {
+		err = dao.SaveProjectQuotaWithDB(ctx, h.dbResolver.GetDB(), previous)
+	} else {
+		err = dao.DeleteProjectQuotaWithDB(ctx, h.dbResolver.GetDB(), projectID)
+	}
+	if err != nil {
+		zap.L().Error("failed to restore project quota", zap.Int64("project", projectID), zap.Error(err))
+	}
+}
+
+// ensureAnotherAdmin fails unless the project keeps an admin after one of its admins is removed or demoted
+func ensureAnotherAdmin(ctx context.Context, tx *gorm.DB, projectID int64) error {
+	count, err := dao.CountProjectAdminsWithDB(ctx, tx, projectID)
+	if err != nil {
+		return err
+	}
+	if count <= 1 {
+		return errutil.ErrLastProjectAdmin
+	}
+	return nil
+}
+
+func (h *projectHandler) handleMemberError(c *gin.Context, msg string, err error) {
+	if errors.Is(err, errutil.ErrLastProjectAdmin) {
+		encoding.HandleError(c, errutil.ErrLastProjectAdmin)
+		return
+	}
+	zap.L().Error(msg, zap.Error(err))
+	encoding.HandleError(c, errutil.ErrInternalServer)
+}
@@ -0,0 +1,37 @@
+package project
+
+import (
+	"asyncKubeManager/pkg/dbresolver"
+	"asyncKubeManager/pkg/manager/namespace"
+	"asyncKubeManager/pkg/model"
+	"asyncKubeManager/pkg/server/middleware"
+	"github.com/gin-gonic/gin"
+)
+
+// RegisterRouter 注册项目相关路由
+func RegisterRouter(group *gin.RouterGroup, authChain *middleware.AuthChain, dbResolver *dbresolver.DBResolver, namespaceManager namespace.NamespaceManager) {
+	projectG := group.Group("/project")
+
+	handler := newProjectHandler(projectHandlerOption{
+		dbResolver:       dbResolver,
+		namespaceManager: namespaceManager,
+	})
+
+	// 所有接口都需要token验证
+	authG := projectG.Group("", authChain.Handlers()...)
+	authG.POST("/create", handler.createProject)
+	authG.POST("/list", handler.listProjects)
+	authG.POST("/detail", handler.getProject)
+	authG.POST("/delete", handler.deleteProject)
+
+	// 成员与配额接口作用于 X-Project-ID 指定的项目, 修改成员需要项目管理员权限, 修改配额需要平台管理员权限.
+	// 项目的校验在 Idempotency-Key 之前, 因此每个路由组使用完整的中间件链
+	scopedG := projectG.Group("", authChain.Handlers(middleware.ProjectScope(dbResolver))...)
+	scopedG.POST("/member/list", handler.listMembers)
+	scopedG.POST("/quota/update", handler.updateQuota)
+
+	adminG := projectG.Group("", authChain.Handlers(middleware.ProjectScope(dbResolver), middleware.RequireProjectRole(model.ProjectRoleAdmin))...)
+	adminG.POST("/member/add", handler.addMember)
+	adminG.POST("/member/update", handler.updateMember)
+	adminG.POST("/member/remove", handler.removeMember)
+}
@@ -0,0 +1,51 @@
+package project
+
+import "asyncKubeManager/pkg/model"
+
+type (
+	// 创建项目请求
+	createProjectReq struct {
+		Name  string     `json:"name" validate:"required,lte=50,_project_name"`
+		Desc  string     `json:"desc" validate:"omitempty,lte=255"`
+		Quota *quotaSpec `json:"quota" validate:"omitempty"`
+	}
+
+	quotaSpec struct {
+		VMs     int64  `json:"vms" validate:"gte=0"`
+		CPU     string `json:"cpu" validate:"omitempty"`
+		Memory  string `json:"memory" validate:"omitempty"`
+		Storage string `json:"storage" validate:"omitempty"`
+	}
+
+	// 项目详情/删除请求
+	projectReq struct {
+		ProjectUID string `json:"project_uid" validate:"required"`
+	}
+
+	projectResp struct {
+		model.Project
+		Quota   *model.ProjectQuota   `json:"quota,omitempty"`
+		Members []model.ProjectMember `json:"members,omitempty"`
+	}
+
+	// 项目成员请求, 项目由 X-Project-ID 请求头指定
+	memberReq struct {
+		UID  string            `json:"uid" validate:"required"`
+		Role model.ProjectRole `json:"role" validate:"omitempty,oneof=admin member viewer"`
+	}
+
+	// 更新项目配额请求, 项目由 X-Project-ID 请求头指定
+	updateQuotaReq struct {
+		quotaSpec
+	}
+)
+
+func (q quotaSpec) toModel(projectID int64) *model.ProjectQuota {
+	return &model.ProjectQuota{
+		ProjectID: projectID,
+		VMs:       q.VMs,
+		CPU:       q.CPU,
+		Memory:    q.Memory,
+		Storage:   q.Storage,
+	}
+}
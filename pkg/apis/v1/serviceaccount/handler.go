@@ -0,0 +1,456 @@
+package serviceaccount
+
+import (
+	"asyncKubeManager/pkg/apis/v1/logs"
+	"asyncKubeManager/pkg/auth"
+	"asyncKubeManager/pkg/authn"
+	"asyncKubeManager/pkg/dao"
+	"asyncKubeManager/pkg/dbresolver"
+	"asyncKubeManager/pkg/model"
+	"asyncKubeManager/pkg/server/encoding"
+	"asyncKubeManager/pkg/server/errutil"
+	"asyncKubeManager/pkg/server/request"
+	"asyncKubeManager/pkg/tenant"
+	"asyncKubeManager/pkg/token"
+	"asyncKubeManager/pkg/types"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+// adminProjectUID lists the accounts owned by the admins
+const adminProjectUID = "-"
+
+var errServiceAccountNotFound = errutil.NewError(http.StatusNotFound, "service account not found")
+
+type serviceAccountHandlerOption struct {
+	dbResolver      *dbresolver.DBResolver
+	tokenManager    token.Manager
+	enforcer        *auth.Enforcer
+	serviceAccounts *authn.ServiceAccounts
+}
+
+type serviceAccountHandler struct {
+	serviceAccountHandlerOption
+}
+
+func newServiceAccountHandler(option serviceAccountHandlerOption) *serviceAccountHandler {
+	return &serviceAccountHandler{
+		serviceAccountHandlerOption: option,
+	}
+}
+
+// scope returns the project of a /project/service_account request, whose accounts the request is limited to.
+// The /service_account requests are only allowed for admins and see every account, project is nil then.
+func (h *serviceAccountHandler) scope(ctx context.Context) (*model.Project, error) {
+	if project, err := tenant.ProjectFromCtx(ctx); err == nil {
+		return project, nil
+	}
+	if token.GetUserRoleFromCtx(ctx) != model.UserRoleAdmin {
+		return nil, errutil.ErrPermissionDenied
+	}
+	return nil, nil
+}
+
+// getServiceAccount returns the account of uid if it is in the scope of the request
+func (h *serviceAccountHandler) getServiceAccount(ctx context.Context, uid string) (*model.ServiceAccount, error) {
+	project, err := h.scope(ctx)
+	if err != nil {
+		return nil, err
+	}
+	found, sa, err := dao.GetServiceAccountByUID(ctx, h.dbResolver, uid)
+	if err != nil {
+		return nil, err
+	}
+	if !found || (project != nil && sa.ProjectID != project.ID) {
+		return nil, errServiceAccountNotFound
+	}
+	return sa, nil
+}
+
+// 获取 service account 列表
+func (h *serviceAccountHandler) list(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c, types.DefaultTimeout)
+	defer cancel()
+
+	req := listReq{}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		encoding.HandleError(c, errutil.ErrJSONFormat)
+		return
+	}
+
+	if err := request.ValidateStruct(ctx, req); err != nil {
+		encoding.HandleError(c, err)
+		return
+	}
+
+	project, err := h.scope(ctx)
+	if err != nil {
+		h.handleError(c, "scope", err)
+		return
+	}
+	projectID := int64(-1)
+	switch {
+	case project != nil:
+		projectID = project.ID
+	case req.ProjectUID == adminProjectUID:
+		projectID = 0
+	case req.ProjectUID != "":
+		found, p, err := dao.GetProjectByUID(ctx, h.dbResolver, req.ProjectUID)
+		if err != nil {
+			h.handleError(c, "GetProjectByUID", err)
+			return
+		}
+		if !found {
+			encoding.HandleError(c, errutil.ErrProjectNotFound)
+			return
+		}
+		projectID = p.ID
+	}
+
+	sas, err := dao.ListServiceAccounts(ctx, h.dbResolver, projectID)
+	if err != nil {
+		h.handleError(c, "ListServiceAccounts", err)
+		return
+	}
+
+	encoding.HandleSuccessList(c, int64(len(sas)), sas)
+}
+
+// 获取 service account 详情
+func (h *serviceAccountHandler) get(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c, types.DefaultTimeout)
+	defer cancel()
+
+	req := serviceAccountReq{}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		encoding.HandleError(c, errutil.ErrJSONFormat)
+		return
+	}
+
+	if err := request.ValidateStruct(ctx, req); err != nil {
+		encoding.HandleError(c, err)
+		return
+	}
+
+	sa, err := h.getServiceAccount(ctx, req.UID)
+	if err != nil {
+		h.handleError(c, "getServiceAccount", err)
+		return
+	}
+
+	encoding.HandleSuccess(c, sa)
+}
+
+// 创建 service account, client secret 只在创建时返回一次.
+// 项目管理员创建的 service account 属于当前项目, 角色固定为 service_account
+func (h *serviceAccountHandler) create(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c, types.DefaultTimeout)
+	defer cancel()
+
+	req := createReq{}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		encoding.HandleError(c, errutil.ErrJSONFormat)
+		return
+	}
+
+	if err := request.ValidateStruct(ctx, req); err != nil {
+		encoding.HandleError(c, err)
+		return
+	}
+
+	project, err := h.scope(ctx)
+	if err != nil {
+		h.handleError(c, "scope", err)
+		return
+	}
+	if project != nil {
+		if req.Role != "" && req.Role != model.UserRoleServiceAccount {
+			encoding.HandleError(c, errutil.ErrPermissionDenied)
+			return
+		}
+	} else if req.ProjectUID != "" {
+		found, p, err := dao.GetProjectByUID(ctx, h.dbResolver, req.ProjectUID)
+		if err != nil {
+			h.handleError(c, "GetProjectByUID", err)
+			return
+		}
+		if !found {
+			encoding.HandleError(c, errutil.ErrProjectNotFound)
+			return
+		}
+		project = p
+	}
+
+	sa := &model.ServiceAccount{
+		Name: req.Name,
+		Desc: req.Desc,
+		Role: req.Role,
+	}
+	if sa.Role == "" {
+		sa.Role = model.UserRoleServiceAccount
+	}
+	if project != nil {
+		sa.ProjectID = project.ID
+		sa.ProjectRole = req.ProjectRole
+		if sa.ProjectRole == "" {
+			sa.ProjectRole = model.ProjectRoleMember
+		}
+	}
+
+	exists, err := dao.ExistsServiceAccountName(ctx, h.dbResolver, sa.ProjectID, sa.Name)
+	if err != nil {
+		h.handleError(c, "ExistsServiceAccountName", err)
+		return
+	}
+	if exists {
+		encoding.HandleError(c, errutil.ErrDuplicateName)
+		return
+	}
+
+	secret, err := h.serviceAccounts.Create(ctx, sa)
+	if err != nil {
+		h.handleError(c, "CreateServiceAccount", err)
+		return
+	}
+	if err = h.enforcer.SetUserRole(sa.UID, string(sa.Role)); err != nil {
+		h.handleError(c, "SetUserRole", err)
+		return
+	}
+	h.audit(ctx, sa.UID, fmt.Sprintf("service account %s created with role %s in project %d", sa.Name, sa.Role, sa.ProjectID))
+
+	encoding.HandleSuccess(c, credentialsResp{ServiceAccount: *sa, ClientID: sa.UID, ClientSecret: secret})
+}
+
+// 更新 service account, 角色变更后已签发的 token 失效
+func (h *serviceAccountHandler) update(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c, types.DefaultTimeout)
+	defer cancel()
+
+	req := updateReq{}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		encoding.HandleError(c, errutil.ErrJSONFormat)
+		return
+	}
+
+	if err := request.ValidateStruct(ctx, req); err != nil {
+		encoding.HandleError(c, err)
+		return
+	}
+
+	sa, err := h.getServiceAccount(ctx, req.UID)
+	if err != nil {
+		h.handleError(c, "getServiceAccount", err)
+		return
+	}
+	roleChanged := req.Role != "" && req.Role != sa.Role
+	if roleChanged {
+		if project, _ := h.scope(ctx); project != nil {
+			encoding.HandleError(c, errutil.ErrPermissionDenied)
+			return
+		}
+	}
+	if req.ProjectRole != "" && sa.ProjectID == 0 {
+		encoding.HandleError(c, errutil.NewError(http.StatusBadRequest, "the service account doesn't belong to a project"))
+		return
+	}
+
+	updates := map[string]interface{}{}
+	if req.Name != "" && req.Name != sa.Name {
+		exists, err := dao.ExistsServiceAccountName(ctx, h.dbResolver, sa.ProjectID, req.Name)
+		if err != nil {
+			h.handleError(c, "ExistsServiceAccountName", err)
+			return
+		}
+		if exists {
+			encoding.HandleError(c, errutil.ErrDuplicateName)
+			return
+		}
+		updates["name"] = req.Name
+	}
+	if req.Desc != "" {
+		updates["desc"] = req.Desc
+	}
+	if roleChanged {
+		updates["role"] = req.Role
+	}
+	if len(updates) > 0 {
+		if err = dao.UpdateServiceAccountByUID(ctx, h.dbResolver, sa.UID, updates); err != nil {
+			h.handleError(c, "UpdateServiceAccountByUID", err)
+			return
+		}
+	}
+	if req.ProjectRole != "" && req.ProjectRole != sa.ProjectRole {
+		if err = h.serviceAccounts.SetProjectRole(ctx, sa, req.ProjectRole); err != nil {
+			h.handleError(c, "SetProjectRole", err)
+			return
+		}
+	}
+	if roleChanged {
+		if err = h.enforcer.SetUserRole(sa.UID, string(req.Role)); err != nil {
+			h.handleError(c, "SetUserRole", err)
+			return
+		}
+		if err = h.tokenManager.RevokeUser(sa.UID); err != nil {
+			h.handleError(c, "RevokeUser", err)
+			return
+		}
+	}
+	h.audit(ctx, sa.UID, fmt.Sprintf("service account %s updated", sa.Name))
+
+	sa, err = h.getServiceAccount(ctx, req.UID)
+	if err != nil {
+		h.handleError(c, "getServiceAccount", err)
+		return
+	}
+	encoding.HandleSuccess(c, sa)
+}
+
+// 禁用 service account, 已签发的 token 立即失效
+func (h *serviceAccountHandler) disable(c *gin.Context) {
+	h.setStatus(c, model.UserStatusDisabled)
+}
+
+// 启用 service account
+func (h *serviceAccountHandler) enable(c *gin.Context) {
+	h.setStatus(c, model.UserStatusEnabled)
+}
+
+func (h *serviceAccountHandler) setStatus(c *gin.Context, status model.UserStatus) {
+	ctx, cancel := context.WithTimeout(c, types.DefaultTimeout)
+	defer cancel()
+
+	req := serviceAccountReq{}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		encoding.HandleError(c, errutil.ErrJSONFormat)
+		return
+	}
+
+	if err := request.ValidateStruct(ctx, req); err != nil {
+		encoding.HandleError(c, err)
+		return
+	}
+
+	sa, err := h.getServiceAccount(ctx, req.UID)
+	if err != nil {
+		h.handleError(c, "getServiceAccount", err)
+		return
+	}
+	if err = dao.UpdateServiceAccountByUID(ctx, h.dbResolver, sa.UID, map[string]interface{}{"status": status}); err != nil {
+		h.handleError(c, "UpdateServiceAccountByUID", err)
+		return
+	}
+	if status == model.UserStatusDisabled {
+		if err = h.tokenManager.RevokeUser(sa.UID); err != nil {
+			h.handleError(c, "RevokeUser", err)
+			return
+		}
+	}
+	h.audit(ctx, sa.UID, fmt.Sprintf("service account %s %s", sa.Name, status))
+
+	encoding.HandleSuccess(c)
+}
+
+// 删除 service account, 同时删除其项目成员关系和 casbin 策略, 已签发的 token 立即失效
+func (h *serviceAccountHandler) delete(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c, types.DefaultTimeout)
+	defer cancel()
+
+	req := serviceAccountReq{}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		encoding.HandleError(c, errutil.ErrJSONFormat)
+		return
+	}
+
+	if err := request.ValidateStruct(ctx, req); err != nil {
+		encoding.HandleError(c, err)
+		return
+	}
+
+	sa, err := h.getServiceAccount(ctx, req.UID)
+	if err != nil {
+		h.handleError(c, "getServiceAccount", err)
+		return
+	}
+	if err = h.serviceAccounts.Delete(ctx, sa); err != nil {
+		h.handleError(c, "DeleteServiceAccount", err)
+		return
+	}
+	if err = h.enforcer.DeleteUser(sa.UID); err != nil {
+		h.handleError(c, "DeleteUser", err)
+		return
+	}
+	if err = h.tokenManager.RevokeUser(sa.UID); err != nil {
+		h.handleError(c, "RevokeUser", err)
+		return
+	}
+	h.audit(ctx, sa.UID, fmt.Sprintf("service account %s deleted", sa.Name))
+
+	encoding.HandleSuccess(c)
+}
+
+// 轮换 client secret, 旧的 secret 和已签发的 token 立即失效
+func (h *serviceAccountHandler) rotateSecret(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c, types.DefaultTimeout)
+	defer cancel()
+
+	req := serviceAccountReq{}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		encoding.HandleError(c, errutil.ErrJSONFormat)
+		return
+	}
+
+	if err := request.ValidateStruct(ctx, req); err != nil {
+		encoding.HandleError(c, err)
+		return
+	}
+
+	sa, err := h.getServiceAccount(ctx, req.UID)
+	if err != nil {
+		h.handleError(c, "getServiceAccount", err)
+		return
+	}
+	secret, err := h.serviceAccounts.RotateSecret(ctx, sa.UID)
+	if err != nil {
+		h.handleError(c, "RotateSecret", err)
+		return
+	}
+	if err = h.tokenManager.RevokeUser(sa.UID); err != nil {
+		h.handleError(c, "RevokeUser", err)
+		return
+	}
+	h.audit(ctx, sa.UID, fmt.Sprintf("service account %s secret rotated", sa.Name))
+
+	encoding.HandleSuccess(c, credentialsResp{ServiceAccount: *sa, ClientID: sa.UID, ClientSecret: secret})
+}
+
+// audit 记录 service account 的变更, UID 为 service account, Creator 为操作的用户
+func (h *serviceAccountHandler) audit(ctx context.Context, uid, operation string) {
+	logs.UserOperatorLogChannel <- &model.UserOperatorLog{
+		UID:       uid,
+		Operator:  model.UserOperatorServiceAccount,
+		Operation: operation,
+		CreatedAt: time.Now().UnixMilli(),
+		Creator:   token.GetUIDFromCtx(ctx),
+	}
+}
+
+func (h *serviceAccountHandler) handleError(c *gin.Context, op string, err error) {
+	if e, ok := err.(errutil.ServiceError); ok {
+		encoding.HandleError(c, e)
+		return
+	}
+	// 并发创建或改名时同名的 service account 由唯一索引拒绝
+	if errors.Is(err, gorm.ErrDuplicatedKey) {
+		encoding.HandleError(c, errutil.ErrDuplicateName)
+		return
+	}
+	zap.L().Error(op, zap.Error(err))
+	encoding.HandleError(c, errutil.ErrInternalServer)
+}
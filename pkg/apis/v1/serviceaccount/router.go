@@ -0,0 +1,40 @@
+package serviceaccount
+
+import (
+	"asyncKubeManager/pkg/authn"
+	"asyncKubeManager/pkg/dbresolver"
+	"asyncKubeManager/pkg/model"
+	"asyncKubeManager/pkg/server/middleware"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RegisterRouter 注册 service account 的管理路由. 管理员通过 /service_account 管理所有 service account,
+// 项目管理员通过 /project/service_account 管理 X-Project-ID 指定项目的 service account
+func RegisterRouter(group *gin.RouterGroup, authChain *middleware.AuthChain, dbResolver *dbresolver.DBResolver) {
+	handler := newServiceAccountHandler(serviceAccountHandlerOption{
+		dbResolver:      dbResolver,
+		tokenManager:    authChain.TokenManager,
+		enforcer:        authChain.Enforcer,
+		serviceAccounts: authn.NewServiceAccounts(dbResolver),
+	})
+
+	saG := group.Group("/service_account")
+	saG.Use(authChain.Handlers()...)
+	registerRoutes(saG, handler)
+
+	projectG := group.Group("/project/service_account")
+	projectG.Use(authChain.Handlers(middleware.ProjectScope(dbResolver), middleware.RequireProjectRole(model.ProjectRoleAdmin))...)
+	registerRoutes(projectG, handler)
+}
+
+func registerRoutes(g *gin.RouterGroup, handler *serviceAccountHandler) {
+	g.POST("/list", handler.list)
+	g.POST("/get", handler.get)
+	g.POST("/create", handler.create)
+	g.POST("/update", handler.update)
+	g.POST("/disable", handler.disable)
+	g.POST("/enable", handler.enable)
+	g.POST("/delete", handler.delete)
+	g.POST("/rotate_secret", handler.rotateSecret)
+}
@@ -0,0 +1,41 @@
+package serviceaccount
+
+import "asyncKubeManager/pkg/model"
+
+type (
+	listReq struct {
+		// ProjectUID filters the accounts listed by an admin, the accounts of the admins are listed if it is "-"
+		ProjectUID string `json:"project_uid" validate:"omitempty,lte=32"`
+	}
+
+	createReq struct {
+		Name string `json:"name" validate:"required,lte=64"`
+		Desc string `json:"desc" validate:"omitempty,lte=255"`
+		// ProjectUID is the project owning an account created by an admin, the admins own it if empty.
+		// The accounts created by a project admin belong to the project of X-Project-ID.
+		ProjectUID  string            `json:"project_uid" validate:"omitempty,lte=32"`
+		ProjectRole model.ProjectRole `json:"project_role" validate:"omitempty,oneof=member viewer"`
+		// Role is the casbin role of the account, only admins can choose it
+		Role model.UserRole `json:"role" validate:"omitempty,oneof=admin normal service_account"`
+	}
+
+	// 为空的字段保持不变
+	updateReq struct {
+		UID         string            `json:"uid" validate:"required,lte=32"`
+		Name        string            `json:"name" validate:"omitempty,lte=64"`
+		Desc        string            `json:"desc" validate:"omitempty,lte=255"`
+		ProjectRole model.ProjectRole `json:"project_role" validate:"omitempty,oneof=member viewer"`
+		Role        model.UserRole    `json:"role" validate:"omitempty,oneof=admin normal service_account"`
+	}
+
+	serviceAccountReq struct {
+		UID string `json:"uid" validate:"required,lte=32"`
+	}
+
+	// credentialsResp is returned once when the account is created or its secret is rotated
+	credentialsResp struct {
+		model.ServiceAccount
+		ClientID     string `json:"client_id"`
+		ClientSecret string `json:"client_secret"`
+	}
+)
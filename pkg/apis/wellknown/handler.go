@@ -0,0 +1,28 @@
+package wellknown
+
+import (
+	"asyncKubeManager/pkg/token"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+type wellKnownHandlerOption struct {
+	tokenManager token.Manager
+}
+
+type wellKnownHandler struct {
+	wellKnownHandlerOption
+}
+
+func newWellKnownHandler(option wellKnownHandlerOption) *wellKnownHandler {
+	return &wellKnownHandler{
+		wellKnownHandlerOption: option,
+	}
+}
+
+// jwks 按 RFC 7517 格式返回公钥, 不使用统一的响应封装
+func (h *wellKnownHandler) jwks(c *gin.Context) {
+	c.Header("Cache-Control", "public, max-age=300")
+	c.JSON(http.StatusOK, h.tokenManager.JWKS())
+}
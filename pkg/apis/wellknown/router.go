@@ -0,0 +1,18 @@
+package wellknown
+
+import (
+	"asyncKubeManager/pkg/token"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RegisterRouter 注册 /.well-known 路由, 供其他内部服务获取验证 token 的公钥, 无需登录
+func RegisterRouter(group *gin.RouterGroup, tokenManager token.Manager) {
+	wellKnownG := group.Group("/.well-known")
+
+	handler := newWellKnownHandler(wellKnownHandlerOption{
+		tokenManager: tokenManager,
+	})
+
+	wellKnownG.GET("/jwks.json", handler.jwks)
+}
@@ -1,14 +1,43 @@
 package auth
 
 import (
+	"asyncKubeManager/pkg/model"
+	"errors"
+	"fmt"
+
 	casbinmodel "github.com/casbin/casbin/v2/model"
 	"github.com/casbin/casbin/v2/persist"
 	"gorm.io/gorm"
 )
 
+// maxFields is the number of rule fields the casbin_rules table can store.
+const maxFields = 6
+
+var (
+	_ persist.Adapter         = (*Adapter)(nil)
+	_ persist.BatchAdapter    = (*Adapter)(nil)
+	_ persist.FilteredAdapter = (*Adapter)(nil)
+)
+
+// Filter selects the rules loaded by LoadFilteredPolicy, an empty field matches every value.
+// For example Filter{Ptype: []string{"p", "g"}, V1: []string{"project-a"}} loads the rules
+// of the project-a domain.
+type Filter struct {
+	Ptype []string
+	V0    []string
+	V1    []string
+	V2    []string
+	V3    []string
+	V4    []string
+	V5    []string
+}
+
 // Adapter represents the Gorm adapter for policy storage.
+// It stores every section (p, g, g2 ...) in the casbin_rules table, so that role inheritance
+// and domains are persisted as well.
 type Adapter struct {
-	db *gorm.DB
+	db       *gorm.DB
+	filtered bool
 }
 
 // NewAdapter creates a new Adapter.
@@ -17,84 +46,178 @@ func NewAdapter(db *gorm.DB) *Adapter {
 }
 
 // LoadPolicy loads policy from database.
-func (a *Adapter) LoadPolicy(model casbinmodel.Model) error {
-	var policies []Permission
-	if err := a.db.Find(&policies).Error; err != nil {
+func (a *Adapter) LoadPolicy(m casbinmodel.Model) error {
+	var rules []model.CasbinRule
+	if err := a.db.Order("id").Find(&rules).Error; err != nil {
 		return err
 	}
 
-	for _, policy := range policies {
-		line := []string{"p", policy.UserID, policy.Resource, policy.Action}
-		persist.LoadPolicyArray(line, model)
+	for _, rule := range rules {
+		persist.LoadPolicyArray(ruleToArray(rule), m)
 	}
+	a.filtered = false
 
 	return nil
 }
 
-// SavePolicy saves policy to database.
-func (a *Adapter) SavePolicy(model casbinmodel.Model) error {
-	// Clear existing policies
-	if err := a.db.Exec("DELETE FROM permissions").Error; err != nil {
+// LoadFilteredPolicy loads the rules matching filter, which must be a Filter or *Filter.
+func (a *Adapter) LoadFilteredPolicy(m casbinmodel.Model, filter interface{}) error {
+	var f Filter
+	switch t := filter.(type) {
+	case Filter:
+		f = t
+	case *Filter:
+		if t != nil {
+			f = *t
+		}
+	case nil:
+		return a.LoadPolicy(m)
+	default:
+		return fmt.Errorf("invalid filter type %T", filter)
+	}
+
+	query := a.db.Order("id")
+	for i, values := range [][]string{f.Ptype, f.V0, f.V1, f.V2, f.V3, f.V4, f.V5} {
+		if len(values) == 0 {
+			continue
+		}
+		column := "ptype"
+		if i > 0 {
+			column = fmt.Sprintf("v%d", i-1)
+		}
+		query = query.Where(column+" IN ?", values)
+	}
+
+	var rules []model.CasbinRule
+	if err := query.Find(&rules).Error; err != nil {
 		return err
 	}
 
-	// Save new policies
-	for _, ast := range model["p"] {
-		for _, rule := range ast.Policy {
-			policy := Permission{
-				UserID:   rule[1],
-				Resource: rule[2],
-				Action:   rule[3],
-			}
-			if err := a.db.Create(&policy).Error; err != nil {
-				return err
+	for _, rule := range rules {
+		persist.LoadPolicyArray(ruleToArray(rule), m)
+	}
+	a.filtered = true
+
+	return nil
+}
+
+// IsFiltered returns true if the loaded policy has been filtered.
+func (a *Adapter) IsFiltered() bool {
+	return a.filtered
+}
+
+// SavePolicy saves policy to database.
+func (a *Adapter) SavePolicy(m casbinmodel.Model) error {
+	var rules []model.CasbinRule
+	for _, sec := range []string{"p", "g"} {
+		for ptype, ast := range m[sec] {
+			for _, rule := range ast.Policy {
+				r, err := arrayToRule(ptype, rule)
+				if err != nil {
+					return err
+				}
+				rules = append(rules, r)
 			}
 		}
 	}
 
-	return nil
+	return a.db.Transaction(func(tx *gorm.DB) error {
+		// Clear existing policies
+		if err := tx.Where("1 = 1").Delete(&model.CasbinRule{}).Error; err != nil {
+			return err
+		}
+		if len(rules) == 0 {
+			return nil
+		}
+		return tx.CreateInBatches(&rules, 100).Error
+	})
 }
 
 // AddPolicy adds a policy rule to the storage.
 func (a *Adapter) AddPolicy(sec string, ptype string, rule []string) error {
-	policy := Permission{
-		UserID:   rule[1],
-		Resource: rule[2],
-		Action:   rule[3],
+	r, err := arrayToRule(ptype, rule)
+	if err != nil {
+		return err
+	}
+	return a.db.Create(&r).Error
+}
+
+// AddPolicies adds policy rules to the storage in one transaction.
+func (a *Adapter) AddPolicies(sec string, ptype string, rules [][]string) error {
+	records := make([]model.CasbinRule, 0, len(rules))
+	for _, rule := range rules {
+		r, err := arrayToRule(ptype, rule)
+		if err != nil {
+			return err
+		}
+		records = append(records, r)
+	}
+	if len(records) == 0 {
+		return nil
 	}
-	return a.db.Create(&policy).Error
+	return a.db.Transaction(func(tx *gorm.DB) error {
+		return tx.CreateInBatches(&records, 100).Error
+	})
 }
 
 // RemovePolicy removes a policy rule from the storage.
 func (a *Adapter) RemovePolicy(sec string, ptype string, rule []string) error {
-	return a.db.Where("user_id = ? AND resource = ? AND action = ?", rule[1], rule[2], rule[3]).Delete(&Permission{}).Error
+	return removeRule(a.db, ptype, rule)
+}
+
+// RemovePolicies removes policy rules from the storage in one transaction.
+func (a *Adapter) RemovePolicies(sec string, ptype string, rules [][]string) error {
+	return a.db.Transaction(func(tx *gorm.DB) error {
+		for _, rule := range rules {
+			if err := removeRule(tx, ptype, rule); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
 }
 
 // RemoveFilteredPolicy removes policy rules that match the filter from the storage.
+// An empty field value matches every value.
 func (a *Adapter) RemoveFilteredPolicy(sec string, ptype string, fieldIndex int, fieldValues ...string) error {
-	query := "1=1"
-	var args []interface{}
+	if fieldIndex < 0 || fieldIndex+len(fieldValues) > maxFields {
+		return fmt.Errorf("invalid filter field index %d with %d values", fieldIndex, len(fieldValues))
+	}
 
-	if fieldIndex <= 0 && 0 < fieldIndex+len(fieldValues) {
-		query += " AND user_id = ?"
-		args = append(args, fieldValues[0])
+	query := a.db.Where("ptype = ?", ptype)
+	for i, value := range fieldValues {
+		if value != "" {
+			query = query.Where(fmt.Sprintf("v%d = ?", fieldIndex+i), value)
+		}
 	}
-	if fieldIndex <= 1 && 1 < fieldIndex+len(fieldValues) {
-		query += " AND resource = ?"
-		args = append(args, fieldValues[1])
+
+	return query.Delete(&model.CasbinRule{}).Error
+}
+
+func removeRule(db *gorm.DB, ptype string, rule []string) error {
+	r, err := arrayToRule(ptype, rule)
+	if err != nil {
+		return err
 	}
-	if fieldIndex <= 2 && 2 < fieldIndex+len(fieldValues) {
-		query += " AND action = ?"
-		args = append(args, fieldValues[2])
+	return db.Where("ptype = ? AND v0 = ? AND v1 = ? AND v2 = ? AND v3 = ? AND v4 = ? AND v5 = ?",
+		r.Ptype, r.V0, r.V1, r.V2, r.V3, r.V4, r.V5).Delete(&model.CasbinRule{}).Error
+}
+
+func arrayToRule(ptype string, rule []string) (model.CasbinRule, error) {
+	if len(rule) > maxFields {
+		return model.CasbinRule{}, errors.New("casbin rule has more than 6 fields")
 	}
 
-	return a.db.Where(query, args...).Delete(&Permission{}).Error
+	var v [maxFields]string
+	copy(v[:], rule)
+	return model.CasbinRule{Ptype: ptype, V0: v[0], V1: v[1], V2: v[2], V3: v[3], V4: v[4], V5: v[5]}, nil
 }
 
-// Permission represents a permission policy in the database.
-type Permission struct {
-	ID       uint   `gorm:"primaryKey"`
-	UserID   string `gorm:"not null"`
-	Resource string `gorm:"not null"`
-	Action   string `gorm:"not null"`
+func ruleToArray(rule model.CasbinRule) []string {
+	line := []string{rule.Ptype, rule.V0, rule.V1, rule.V2, rule.V3, rule.V4, rule.V5}
+	// 去掉末尾未使用的字段
+	for len(line) > 1 && line[len(line)-1] == "" {
+		line = line[:len(line)-1]
+	}
+	return line
 }
@@ -0,0 +1,124 @@
+package auth
+
+import (
+	"asyncKubeManager/pkg/model"
+	"asyncKubeManager/pkg/testutil"
+	"testing"
+
+	"github.com/casbin/casbin/v2"
+	casbinmodel "github.com/casbin/casbin/v2/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// domainModel binds users to roles per project and groups resources with g2
+const domainModel = `
+[request_definition]
+r = sub, dom, obj, act
+
+[policy_definition]
+p = sub, dom, obj, act
+
+[role_definition]
+g = _, _, _
+g2 = _, _
+
+[policy_effect]
+e = some(where (p.eft == allow))
+
+[matchers]
+m = g(r.sub, p.sub, r.dom) && r.dom == p.dom && g2(r.obj, p.obj) && r.act == p.act
+`
+
+func newDomainEnforcer(t *testing.T, adapter *Adapter) *casbin.Enforcer {
+	m, err := casbinmodel.NewModelFromString(domainModel)
+	require.NoError(t, err)
+	e, err := casbin.NewEnforcer(m, adapter)
+	require.NoError(t, err)
+	return e
+}
+
+func TestAdapter(t *testing.T) {
+	db := testutil.NewDBResolver(t).GetDB()
+	adapter := NewAdapter(db)
+	e := newDomainEnforcer(t, adapter)
+
+	// 批量写入
+	_, err := e.AddPolicies([][]string{
+		{"admin", "project-a", "vm", "write"},
+		{"admin", "project-b", "vm", "write"},
+		{"viewer", "project-a", "vm", "read"},
+	})
+	require.NoError(t, err)
+	_, err = e.AddGroupingPolicies([][]string{
+		{"alice", "admin", "project-a"},
+		{"bob", "viewer", "project-a"},
+		{"bob", "admin", "project-b"},
+	})
+	require.NoError(t, err)
+	_, err = e.AddNamedGroupingPolicy("g2", "disk", "vm")
+	require.NoError(t, err)
+
+	var count int64
+	require.NoError(t, db.Model(&model.CasbinRule{}).Count(&count).Error)
+	assert.EqualValues(t, 7, count)
+
+	// 重新加载后规则与继承关系保持不变
+	reloaded := newDomainEnforcer(t, NewAdapter(db))
+	cases := []struct {
+		sub, dom, obj, act string
+		allowed            bool
+	}{
+		{"alice", "project-a", "vm", "write", true},
+		{"alice", "project-a", "disk", "write", true},
+		{"alice", "project-b", "vm", "write", false},
+		{"bob", "project-a", "vm", "write", false},
+		{"bob", "project-a", "disk", "read", true},
+		{"bob", "project-b", "vm", "write", true},
+	}
+	for _, tc := range cases {
+		allowed, err := reloaded.Enforce(tc.sub, tc.dom, tc.obj, tc.act)
+		require.NoError(t, err)
+		assert.Equal(t, tc.allowed, allowed, "%v", tc)
+	}
+
+	// 只加载 project-a 的规则
+	filtered := newDomainEnforcer(t, NewAdapter(db))
+	require.NoError(t, filtered.LoadFilteredPolicy(Filter{Ptype: []string{"p"}, V1: []string{"project-a"}}))
+	assert.True(t, filtered.IsFiltered())
+	assert.Len(t, filtered.GetPolicy(), 2)
+	assert.Empty(t, filtered.GetGroupingPolicy())
+	require.NoError(t, filtered.LoadFilteredPolicy(&Filter{Ptype: []string{"g"}, V2: []string{"project-b"}}))
+	assert.Equal(t, [][]string{{"bob", "admin", "project-b"}}, filtered.GetGroupingPolicy())
+	assert.Error(t, filtered.SavePolicy())
+
+	// 批量删除与按条件删除
+	_, err = e.RemovePolicies([][]string{
+		{"admin", "project-b", "vm", "write"},
+		{"viewer", "project-a", "vm", "read"},
+	})
+	require.NoError(t, err)
+	_, err = e.RemoveFilteredGroupingPolicy(2, "project-a")
+	require.NoError(t, err)
+
+	reloaded = newDomainEnforcer(t, NewAdapter(db))
+	assert.Equal(t, [][]string{{"admin", "project-a", "vm", "write"}}, reloaded.GetPolicy())
+	assert.Equal(t, [][]string{{"bob", "admin", "project-b"}}, reloaded.GetGroupingPolicy())
+	assert.Equal(t, [][]string{{"disk", "vm"}}, reloaded.GetNamedGroupingPolicy("g2"))
+
+	// SavePolicy 用内存中的规则覆盖数据库
+	e.ClearPolicy()
+	_, err = e.AddPolicy("viewer", "project-c", "vm", "read")
+	require.NoError(t, err)
+	require.NoError(t, e.SavePolicy())
+	reloaded = newDomainEnforcer(t, NewAdapter(db))
+	assert.Equal(t, [][]string{{"viewer", "project-c", "vm", "read"}}, reloaded.GetPolicy())
+	assert.Empty(t, reloaded.GetGroupingPolicy())
+}
+
+func TestAdapter_InvalidRule(t *testing.T) {
+	adapter := NewAdapter(testutil.NewDBResolver(t).GetDB())
+	assert.Error(t, adapter.AddPolicy("p", "p", []string{"1", "2", "3", "4", "5", "6", "7"}))
+	assert.Error(t, adapter.RemoveFilteredPolicy("p", "p", 5, "a", "b"))
+	assert.Error(t, adapter.LoadFilteredPolicy(nil, "project-a"))
+}
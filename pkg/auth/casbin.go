@@ -1,25 +1,218 @@
 package auth
 
 import (
+	"asyncKubeManager/pkg/client/cache"
+	"asyncKubeManager/pkg/model"
+	"errors"
+
 	"github.com/casbin/casbin/v2"
+	"go.uber.org/zap"
 	"gorm.io/gorm"
 )
 
+// DefaultModelPath is the casbin model shipped with the repository.
+const DefaultModelPath = "config/casbin_model.conf"
+
+// ActionAny matches every action of a policy.
+const ActionAny = "*"
+
+// ErrBuiltinGroup is returned when a built-in role is used as a group, every user is bound to one of them.
+var ErrBuiltinGroup = errors.New("a built-in role is not a group")
+
+// selfServiceAuthRoutes are the routes of the passport API every user may call for their own account.
+// The other /api/v1/auth routes, e.g. force-logout, unlock and the MFA policies, are only allowed to the admins.
+var selfServiceAuthRoutes = []string{
+	"/api/v1/auth/logout",
+	"/api/v1/auth/logout/all",
+	"/api/v1/auth/session/list",
+	"/api/v1/auth/session/revoke",
+	"/api/v1/auth/password",
+	"/api/v1/auth/user/update",
+	"/api/v1/auth/mfa/status",
+	"/api/v1/auth/mfa/enroll",
+	"/api/v1/auth/mfa/confirm",
+	"/api/v1/auth/mfa/disable",
+	"/api/v1/auth/mfa/recovery-codes",
+	"/api/v1/auth/pat/create",
+	"/api/v1/auth/pat/list",
+	"/api/v1/auth/pat/revoke",
+}
+
+// defaultPolicies are seeded on startup, objects are API route patterns matched with keyMatch
+// and actions are HTTP methods.
+var defaultPolicies = map[string][][]string{
+	"admin": {
+		{"admin", "/api/v1/*", ActionAny},
+	},
+	"normal": append(rolePolicies("normal", selfServiceAuthRoutes),
+		[]string{"normal", "/api/v1/vm/*", ActionAny},
+		[]string{"normal", "/api/v1/disk/*", ActionAny},
+		[]string{"normal", "/api/v1/grant/*", ActionAny},
+		[]string{"normal", "/api/v1/project/*", ActionAny},
+		[]string{"normal", "/api/v1/logs/*", ActionAny},
+	),
+	// service accounts operate the resources of their projects, they never log in by the passport API
+	"service_account": {
+		{"service_account", "/api/v1/vm/*", ActionAny},
+		{"service_account", "/api/v1/disk/*", ActionAny},
+		{"service_account", "/api/v1/project/*", ActionAny},
+		{"service_account", "/api/v1/logs/*", ActionAny},
+	},
+}
+
+// retiredPolicies were seeded by earlier versions and are removed on startup,
+// the wildcard let normal users call the admin routes of the passport API.
+var retiredPolicies = [][]string{
+	{"normal", "/api/v1/auth/*", ActionAny},
+}
+
+func rolePolicies(role string, routes []string) [][]string {
+	policies := make([][]string, 0, len(routes))
+	for _, route := range routes {
+		policies = append(policies, []string{role, route, ActionAny})
+	}
+	return policies
+}
+
 // Enforcer represents the Casbin enforcer with database storage.
+// Subjects of the policies are roles or user ids, users are bound to their role by "g" rules.
+// The role bindings are stored as well, they are written whenever the role of a user is set and
+// are not rebuilt on startup, see SetUserRole. Only the default policies are seeded on startup.
 type Enforcer struct {
-	e *casbin.Enforcer
+	e *casbin.SyncedEnforcer
 }
 
-// NewEnforcer creates a new Enforcer.
-func NewEnforcer(db *gorm.DB) (*Enforcer, error) {
+// NewEnforcer creates a new Enforcer with the model file at modelPath.
+func NewEnforcer(db *gorm.DB, modelPath string) (*Enforcer, error) {
 	adapter := NewAdapter(db)
-	e, err := casbin.NewEnforcer("configs/casbin_model.conf", adapter)
+	e, err := casbin.NewSyncedEnforcer(modelPath, adapter)
 	if err != nil {
 		return nil, err
 	}
 	return &Enforcer{e: e}, nil
 }
 
+// Watch keeps the policies of the replicas of the console in sync. With the shared cache the changes
+// of a replica are picked up by the others within DefaultWatchInterval, without it the policies are
+// reloaded from the database every DefaultReloadInterval.
+func (e *Enforcer) Watch(cacheClient cache.Interface) error {
+	if cacheClient == nil {
+		e.e.StartAutoLoadPolicy(DefaultReloadInterval)
+		return nil
+	}
+
+	w := newCacheWatcher(cacheClient, DefaultWatchInterval)
+	if err := e.e.SetWatcher(w); err != nil {
+		return err
+	}
+	// the callback set by casbin ignores the error
+	return w.SetUpdateCallback(func(string) {
+		if err := e.e.LoadPolicy(); err != nil {
+			zap.L().Error("reload casbin policies failed", zap.Error(err))
+		}
+	})
+}
+
+// SeedDefaultPolicies adds every missing default policy and removes the retired ones,
+// a default policy removed by an admin is added again on the next start.
+// Replicas starting at the same time must not seed concurrently, see migration.Migrator.WithLock.
+func (e *Enforcer) SeedDefaultPolicies() error {
+	var missing [][]string
+	for _, policies := range defaultPolicies {
+		for _, policy := range policies {
+			if !e.e.HasPolicy(policy) {
+				missing = append(missing, policy)
+			}
+		}
+	}
+	if len(missing) != 0 {
+		if _, err := e.e.AddPolicies(missing); err != nil {
+			return err
+		}
+	}
+
+	var retired [][]string
+	for _, policy := range retiredPolicies {
+		if e.e.HasPolicy(policy) {
+			retired = append(retired, policy)
+		}
+	}
+	if len(retired) == 0 {
+		return nil
+	}
+	_, err := e.e.RemovePolicies(retired)
+	return err
+}
+
+// SetUserRole binds the user to the built-in role, replacing the previous built-in role.
+// The groups of the user are kept, see AddUserToGroup.
+func (e *Enforcer) SetUserRole(userID, role string) error {
+	roles, err := e.e.GetRolesForUser(userID)
+	if err != nil {
+		return err
+	}
+
+	bound := false
+	for _, r := range roles {
+		if r == role {
+			bound = true
+			continue
+		}
+		if !model.UserRole(r).Builtin() {
+			continue
+		}
+		if _, err = e.e.DeleteRoleForUser(userID, r); err != nil {
+			return err
+		}
+	}
+	if bound {
+		return nil
+	}
+	_, err = e.e.AddRoleForUser(userID, role)
+	return err
+}
+
+// AddUserToGroup binds the user to a group, resources granted to the group are shared with the user.
+// Groups are the roles other than the built-in ones.
+func (e *Enforcer) AddUserToGroup(userID, group string) error {
+	if model.UserRole(group).Builtin() {
+		return ErrBuiltinGroup
+	}
+	_, err := e.e.AddRoleForUser(userID, group)
+	return err
+}
+
+// RemoveUserFromGroup removes the user from a group added by AddUserToGroup.
+func (e *Enforcer) RemoveUserFromGroup(userID, group string) error {
+	if model.UserRole(group).Builtin() {
+		return ErrBuiltinGroup
+	}
+	_, err := e.e.DeleteRoleForUser(userID, group)
+	return err
+}
+
+// DeleteUser removes the role bindings and the policies of the user, e.g. a deleted service account.
+func (e *Enforcer) DeleteUser(userID string) error {
+	_, err := e.e.DeleteUser(userID)
+	return err
+}
+
+// GetUsersForRole returns the users bound to the role.
+func (e *Enforcer) GetUsersForRole(role string) ([]string, error) {
+	return e.e.GetUsersForRole(role)
+}
+
+// LoadPolicy reloads the policies and role bindings from the database, e.g. to see the bindings another
+// replica wrote before the changes are picked up by Watch.
+func (e *Enforcer) LoadPolicy() error {
+	return e.e.LoadPolicy()
+}
+
+// GetUserRoles returns the roles the user is bound to.
+func (e *Enforcer) GetUserRoles(userID string) ([]string, error) {
+	return e.e.GetRolesForUser(userID)
+}
+
 // AddPolicy adds a policy rule.
 func (e *Enforcer) AddPolicy(userID, resource, action string) error {
 	_, err := e.e.AddPolicy(userID, resource, action)
@@ -32,6 +225,16 @@ func (e *Enforcer) RemovePolicy(userID, resource, action string) error {
 	return err
 }
 
+// GetPolicies returns all policy rules as (sub, obj, act).
+func (e *Enforcer) GetPolicies() [][]string {
+	return e.e.GetPolicy()
+}
+
+// GetRoleBindings returns all role bindings as (user, role).
+func (e *Enforcer) GetRoleBindings() [][]string {
+	return e.e.GetGroupingPolicy()
+}
+
 // Enforce checks if a user has permission to perform an action on a resource.
 func (e *Enforcer) Enforce(userID, resource, action string) (bool, error) {
 	return e.e.Enforce(userID, resource, action)
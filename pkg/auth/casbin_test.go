@@ -0,0 +1,149 @@
+package auth
+
+import (
+	"asyncKubeManager/pkg/client/cache"
+	"asyncKubeManager/pkg/testutil"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testModelPath = "../../" + DefaultModelPath
+
+func TestEnforcer(t *testing.T) {
+	dr := testutil.NewDBResolver(t)
+	e, err := NewEnforcer(dr.GetDB(), testModelPath)
+	require.NoError(t, err)
+
+	require.NoError(t, e.SeedDefaultPolicies())
+	require.NoError(t, e.SetUserRole("alice", "admin"))
+	require.NoError(t, e.SetUserRole("bob", "normal"))
+	require.NoError(t, e.SetUserRole("ci", "service_account"))
+
+	cases := []struct {
+		user    string
+		obj     string
+		allowed bool
+	}{
+		{"alice", "/api/v1/policy/add", true},
+		{"alice", "/api/v1/vm/create", true},
+		{"bob", "/api/v1/vm/create", true},
+		{"bob", "/api/v1/admin/user/list", false},
+		{"bob", "/api/v1/policy/add", false},
+		{"bob", "/api/v1/auth/pat/create", true},
+		{"bob", "/api/v1/auth/force-logout", false},
+		{"bob", "/api/v1/auth/pat/list_all", false},
+		{"alice", "/api/v1/auth/force-logout", true},
+		{"carol", "/api/v1/vm/create", false},
+		{"ci", "/api/v1/vm/create", true},
+		{"ci", "/api/v1/auth/pat/create", false},
+	}
+	for _, tc := range cases {
+		allowed, err := e.Enforce(tc.user, tc.obj, "POST")
+		require.NoError(t, err)
+		assert.Equal(t, tc.allowed, allowed, "%s %s", tc.user, tc.obj)
+	}
+
+	// 角色变更后旧角色的权限失效, 用户组保留
+	require.NoError(t, e.AddUserToGroup("alice", "ops"))
+	require.NoError(t, e.SetUserRole("alice", "normal"))
+	allowed, err := e.Enforce("alice", "/api/v1/policy/add", "POST")
+	require.NoError(t, err)
+	assert.False(t, allowed)
+	roles, err := e.GetUserRoles("alice")
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []string{"normal", "ops"}, roles)
+	require.NoError(t, e.RemoveUserFromGroup("alice", "ops"))
+	assert.ErrorIs(t, e.RemoveUserFromGroup("alice", "normal"), ErrBuiltinGroup)
+	roles, err = e.GetUserRoles("alice")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"normal"}, roles)
+
+	// 删除的 service account 失去所有权限
+	require.NoError(t, e.DeleteUser("ci"))
+	allowed, err = e.Enforce("ci", "/api/v1/vm/create", "POST")
+	require.NoError(t, err)
+	assert.False(t, allowed)
+
+	// 策略持久化, 再次启动时补上缺少的默认策略并删除旧版本的通配策略
+	require.NoError(t, e.AddPolicy("bob", "/api/v1/admin/user/list", "POST"))
+	require.NoError(t, e.RemovePolicy("normal", "/api/v1/logs/*", ActionAny))
+	require.NoError(t, e.AddPolicy("normal", "/api/v1/auth/*", ActionAny))
+
+	reloaded, err := NewEnforcer(dr.GetDB(), testModelPath)
+	require.NoError(t, err)
+	require.NoError(t, reloaded.SeedDefaultPolicies())
+	assert.ElementsMatch(t, e.GetRoleBindings(), reloaded.GetRoleBindings())
+	policies := reloaded.GetPolicies()
+	assert.Contains(t, policies, []string{"bob", "/api/v1/admin/user/list", "POST"})
+	assert.Contains(t, policies, []string{"normal", "/api/v1/logs/*", ActionAny})
+	assert.NotContains(t, policies, []string{"normal", "/api/v1/auth/*", ActionAny})
+
+	require.NoError(t, reloaded.SeedDefaultPolicies())
+	assert.ElementsMatch(t, policies, reloaded.GetPolicies())
+}
+
+func TestEnforcer_Watch(t *testing.T) {
+	dr := testutil.NewDBResolver(t)
+	e1, err := NewEnforcer(dr.GetDB(), testModelPath)
+	require.NoError(t, err)
+	e2, err := NewEnforcer(dr.GetDB(), testModelPath)
+	require.NoError(t, err)
+	require.NoError(t, e1.SeedDefaultPolicies())
+
+	cacheClient := cache.NewMemoryClient()
+	w1 := newCacheWatcher(cacheClient, time.Hour)
+	defer w1.Close()
+	require.NoError(t, e1.e.SetWatcher(w1))
+	w2 := newCacheWatcher(cacheClient, time.Hour)
+	defer w2.Close()
+	require.NoError(t, e2.e.SetWatcher(w2))
+
+	// 一个副本修改角色后, 其它副本在下一次检查时重新加载策略
+	require.NoError(t, e1.SetUserRole("bob", "admin"))
+	allowed, err := e2.Enforce("bob", "/api/v1/policy/add", "POST")
+	require.NoError(t, err)
+	assert.False(t, allowed)
+
+	w2.check()
+	allowed, err = e2.Enforce("bob", "/api/v1/policy/add", "POST")
+	require.NoError(t, err)
+	assert.True(t, allowed)
+
+	// 自身的修改不会触发重新加载
+	reloaded := false
+	require.NoError(t, w1.SetUpdateCallback(func(string) { reloaded = true }))
+	w1.check()
+	assert.False(t, reloaded)
+}
+
+func TestCacheWatcher_UpdateAfterOtherReplica(t *testing.T) {
+	cacheClient := cache.NewMemoryClient()
+	w1 := newCacheWatcher(cacheClient, time.Hour)
+	defer w1.Close()
+	w2 := newCacheWatcher(cacheClient, time.Hour)
+	defer w2.Close()
+
+	reloaded := make(chan string, 1)
+	require.NoError(t, w1.SetUpdateCallback(func(revision string) { reloaded <- revision }))
+
+	// 连续的自身修改不会触发重新加载
+	require.NoError(t, w1.Update())
+	require.NoError(t, w1.Update())
+	w1.check()
+	assert.Empty(t, reloaded)
+
+	// 其它副本的修改在自身修改之前没有被检查到, 自身修改时重新加载
+	require.NoError(t, w2.Update())
+	require.NoError(t, w1.Update())
+	select {
+	case revision := <-reloaded:
+		assert.Equal(t, "4", revision)
+	case <-time.After(time.Second):
+		t.Fatal("the change of the other replica is not reloaded")
+	}
+	w1.check()
+	assert.Empty(t, reloaded)
+}
@@ -0,0 +1,32 @@
+package auth
+
+import (
+	"slices"
+	"strings"
+)
+
+// apiPrefix is the prefix of the route patterns the scopes apply to
+const apiPrefix = "/api/v1/"
+
+// PersonalAccessTokenScopes are the API groups a personal access token can be scoped to.
+// The passport API is never reachable with a personal access token, so a token can't create
+// another token or change the password. The casbin policies of the user are checked as well.
+var PersonalAccessTokenScopes = []string{"vm", "disk", "project", "grant", "logs", "policy", "directory", "admin"}
+
+// ValidScope reports whether scope is one of PersonalAccessTokenScopes
+func ValidScope(scope string) bool {
+	return slices.Contains(PersonalAccessTokenScopes, scope)
+}
+
+// ScopeAllows reports whether the scopes allow the route pattern, the API group of the route is its
+// first path segment after /api/v1/. Empty scopes are not restricted.
+func ScopeAllows(scopes []string, obj string) bool {
+	if len(scopes) == 0 {
+		return true
+	}
+	if !strings.HasPrefix(obj, apiPrefix) {
+		return false
+	}
+	group, _, _ := strings.Cut(strings.TrimPrefix(obj, apiPrefix), "/")
+	return ValidScope(group) && slices.Contains(scopes, group)
+}
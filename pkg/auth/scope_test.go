@@ -0,0 +1,16 @@
+package auth
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestScopeAllows(t *testing.T) {
+	assert.True(t, ScopeAllows(nil, "/api/v1/auth/logout"))
+	assert.True(t, ScopeAllows([]string{"vm"}, "/api/v1/vm/create"))
+	assert.False(t, ScopeAllows([]string{"vm"}, "/api/v1/disk/create"))
+	// passport 不在可选的 scope 中
+	assert.False(t, ScopeAllows([]string{"auth"}, "/api/v1/auth/pat/create"))
+	assert.False(t, ScopeAllows([]string{"vm"}, "/healthz"))
+}
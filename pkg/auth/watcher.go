@@ -0,0 +1,135 @@
+package auth
+
+import (
+	"asyncKubeManager/pkg/client/cache"
+	"context"
+	"strconv"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+const (
+	// DefaultWatchInterval is how often the replicas check for policy changes of each other
+	DefaultWatchInterval = time.Second * 2
+	// DefaultReloadInterval is how often the policies are reloaded when there is no shared cache
+	DefaultReloadInterval = time.Second * 30
+
+	policyRevisionKey = "casbin:policy:revision"
+	watcherTimeout    = time.Second * 3
+)
+
+// cacheWatcher shares policy changes between the replicas of the console through a revision counter
+// in the shared cache. Update bumps the counter, every replica polls it and reloads the policies
+// from the database when it changed.
+type cacheWatcher struct {
+	cache    cache.Interface
+	interval time.Duration
+
+	mu       sync.Mutex
+	callback func(string)
+	revision string
+
+	stopOnce sync.Once
+	stopCh   chan struct{}
+}
+
+func newCacheWatcher(cacheClient cache.Interface, interval time.Duration) *cacheWatcher {
+	w := &cacheWatcher{
+		cache:    cacheClient,
+		interval: interval,
+		stopCh:   make(chan struct{}),
+	}
+	w.revision, _ = w.currentRevision()
+	go w.run()
+	return w
+}
+
+// SetUpdateCallback sets the function called when another replica changed the policies.
+func (w *cacheWatcher) SetUpdateCallback(callback func(string)) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.callback = callback
+	return nil
+}
+
+// Update notifies the other replicas that the policies changed.
+func (w *cacheWatcher) Update() error {
+	ctx, cancel := context.WithTimeout(context.Background(), watcherTimeout)
+	defer cancel()
+
+	revision, err := w.cache.Incr(ctx, policyRevisionKey)
+	if err != nil {
+		return err
+	}
+
+	// the change is already applied locally, only the other replicas reload. A revision skipped since the
+	// last check is the change of another replica, check wouldn't see it anymore, so reload here
+	w.mu.Lock()
+	previous, _ := strconv.ParseInt(w.revision, 10, 64)
+	w.revision = formatRevision(revision)
+	callback := w.callback
+	w.mu.Unlock()
+
+	if revision != previous+1 && callback != nil {
+		// casbin notifies the watcher holding the lock of the enforcer, the reload waits for the lock
+		go callback(formatRevision(revision))
+	}
+	return nil
+}
+
+// Close stops polling the revision.
+func (w *cacheWatcher) Close() {
+	w.stopOnce.Do(func() {
+		close(w.stopCh)
+	})
+}
+
+func (w *cacheWatcher) run() {
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-w.stopCh:
+			return
+		case <-ticker.C:
+			w.check()
+		}
+	}
+}
+
+// check calls the callback if the revision changed since the last check
+func (w *cacheWatcher) check() {
+	revision, err := w.currentRevision()
+	if err != nil {
+		zap.L().Warn("get casbin policy revision failed", zap.Error(err))
+		return
+	}
+
+	w.mu.Lock()
+	changed := revision != w.revision
+	w.revision = revision
+	callback := w.callback
+	w.mu.Unlock()
+
+	if changed && callback != nil {
+		callback(revision)
+	}
+}
+
+func (w *cacheWatcher) currentRevision() (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), watcherTimeout)
+	defer cancel()
+
+	exists, err := w.cache.Exists(ctx, policyRevisionKey)
+	if err != nil || !exists {
+		return "", err
+	}
+	return w.cache.Get(ctx, policyRevisionKey)
+}
+
+func formatRevision(revision int64) string {
+	return strconv.FormatInt(revision, 10)
+}
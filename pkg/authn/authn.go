@@ -0,0 +1,119 @@
+package authn
+
+import (
+	"asyncKubeManager/pkg/model"
+	"context"
+	"errors"
+	"fmt"
+)
+
+// Types of the authentication providers
+const (
+	TypeLocal = "local"
+	TypeLDAP  = "ldap"
+	TypeOIDC  = "oidc"
+)
+
+var (
+	// ErrUserNotFound is returned when the provider doesn't know the user, the next provider can be tried
+	ErrUserNotFound = errors.New("user not found")
+	// ErrInvalidCredentials is returned when the user exists but the password is wrong
+	ErrInvalidCredentials = errors.New("password is wrong")
+	// ErrUnknownProvider is returned for a provider that is not enabled or can't be used for the login
+	ErrUnknownProvider = errors.New("unknown authentication provider")
+)
+
+// Identity is a user authenticated by a provider. A console user is mapped by (Provider, ExternalID),
+// the username is only displayed, so that users of different providers with the same name are never merged.
+type Identity struct {
+	Provider   string
+	ExternalID string
+	Username   string
+	Email      string
+	Tel        string
+	// Role is the role of the user created on the first login
+	Role model.UserRole
+	// Projects are the project roles mapped from the directory groups, nil if projects aren't mapped
+	Projects map[string]model.ProjectRole
+}
+
+// Authenticator is an authentication provider
+type Authenticator interface {
+	// Name is the provider name stored as model.User.AuthSource
+	Name() string
+	// Type is one of TypeLocal, TypeLDAP and TypeOIDC
+	Type() string
+}
+
+// PasswordAuthenticator verifies the username and password posted to the login API.
+// With ErrInvalidCredentials it returns the Provider and ExternalID of the user if it is known,
+// so that the failed logins are counted per account rather than per typed username.
+type PasswordAuthenticator interface {
+	Authenticator
+	Authenticate(ctx context.Context, username, password string) (*Identity, error)
+}
+
+// RedirectAuthenticator redirects the user to the provider and exchanges the returned
+// authorization code, the code verifier is the PKCE secret of the login.
+type RedirectAuthenticator interface {
+	Authenticator
+	AuthCodeURL(ctx context.Context, state, nonce, codeVerifier string) (string, error)
+	Exchange(ctx context.Context, code, nonce, codeVerifier string) (*Identity, error)
+}
+
+// Registry holds the enabled providers in the order they are tried
+type Registry struct {
+	providers []Authenticator
+	byName    map[string]Authenticator
+}
+
+func NewRegistry(providers ...Authenticator) (*Registry, error) {
+	r := &Registry{byName: map[string]Authenticator{}}
+	for _, p := range providers {
+		if _, ok := r.byName[p.Name()]; ok {
+			return nil, fmt.Errorf("duplicate authentication provider %q", p.Name())
+		}
+		r.providers = append(r.providers, p)
+		r.byName[p.Name()] = p
+	}
+	return r, nil
+}
+
+func (r *Registry) Get(name string) (Authenticator, bool) {
+	p, ok := r.byName[name]
+	return p, ok
+}
+
+// List returns the providers in order
+func (r *Registry) List() []Authenticator {
+	return r.providers
+}
+
+// Authenticate verifies the password with the named provider, or with every password provider
+// in order until one knows the user if name is empty.
+func (r *Registry) Authenticate(ctx context.Context, name, username, password string) (*Identity, error) {
+	if name != "" {
+		p, ok := r.byName[name]
+		if !ok {
+			return nil, fmt.Errorf("%w %q", ErrUnknownProvider, name)
+		}
+		pp, ok := p.(PasswordAuthenticator)
+		if !ok {
+			return nil, fmt.Errorf("%w %q, it doesn't support password login", ErrUnknownProvider, name)
+		}
+		return pp.Authenticate(ctx, username, password)
+	}
+
+	for _, p := range r.providers {
+		pp, ok := p.(PasswordAuthenticator)
+		if !ok {
+			continue
+		}
+		identity, err := pp.Authenticate(ctx, username, password)
+		if errors.Is(err, ErrUserNotFound) {
+			continue
+		}
+		return identity, err
+	}
+	return nil, ErrUserNotFound
+}
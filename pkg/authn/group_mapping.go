@@ -0,0 +1,179 @@
+package authn
+
+import (
+	"asyncKubeManager/pkg/model"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/spf13/pflag"
+)
+
+// GroupMapping maps the members of a directory group to a console role, or to a role in a project
+type GroupMapping struct {
+	// Group is the cn of the group
+	Group string
+	// Role is the console role of the members, empty for a project mapping
+	Role model.UserRole
+	// Project is the name of the project the members join with ProjectRole
+	Project     string
+	ProjectRole model.ProjectRole
+}
+
+// ParseGroupMapping parses "<group>=<role>" or "<group>=<project>:<project role>",
+// e.g. "console-admins=admin" or "team-a=demo:member".
+func ParseGroupMapping(s string) (GroupMapping, error) {
+	group, target, ok := strings.Cut(s, "=")
+	group, target = strings.TrimSpace(group), strings.TrimSpace(target)
+	if !ok || group == "" || target == "" {
+		return GroupMapping{}, fmt.Errorf("invalid group mapping %q, want <group>=<role> or <group>=<project>:<project role>", s)
+	}
+
+	project, projectRole, isProject := strings.Cut(target, ":")
+	if !isProject {
+		switch role := model.UserRole(target); role {
+		case model.UserRoleAdmin, model.UserRoleNormal:
+			return GroupMapping{Group: group, Role: role}, nil
+		default:
+			return GroupMapping{}, fmt.Errorf("invalid role %q of group mapping %q", target, s)
+		}
+	}
+
+	switch role := model.ProjectRole(projectRole); role {
+	case model.ProjectRoleAdmin, model.ProjectRoleMember, model.ProjectRoleViewer:
+		if project == "" {
+			return GroupMapping{}, fmt.Errorf("empty project of group mapping %q", s)
+		}
+		return GroupMapping{Group: group, Project: project, ProjectRole: role}, nil
+	default:
+		return GroupMapping{}, fmt.Errorf("invalid project role %q of group mapping %q", projectRole, s)
+	}
+}
+
+// GroupMappings resolves the role and projects of the groups of a directory user
+type GroupMappings []GroupMapping
+
+// MapsRole reports whether any mapping gives a console role, the role of a user is left unchanged otherwise
+func (m GroupMappings) MapsRole() bool {
+	for _, mapping := range m {
+		if mapping.Role != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// MapsProjects reports whether any mapping gives a project role
+func (m GroupMappings) MapsProjects() bool {
+	for _, mapping := range m {
+		if mapping.Project != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// Role returns admin if any group maps to admin, otherwise normal
+func (m GroupMappings) Role(groups []string) model.UserRole {
+	role := model.UserRoleNormal
+	for _, mapping := range m {
+		if mapping.Role == model.UserRoleAdmin && containsFold(groups, mapping.Group) {
+			role = model.UserRoleAdmin
+		}
+	}
+	return role
+}
+
+// Projects returns the highest role of each project mapped from the groups
+func (m GroupMappings) Projects(groups []string) map[string]model.ProjectRole {
+	projects := map[string]model.ProjectRole{}
+	for _, mapping := range m {
+		if mapping.Project == "" || !containsFold(groups, mapping.Group) {
+			continue
+		}
+		if projectRoleLevels[mapping.ProjectRole] > projectRoleLevels[projects[mapping.Project]] {
+			projects[mapping.Project] = mapping.ProjectRole
+		}
+	}
+	return projects
+}
+
+var projectRoleLevels = map[model.ProjectRole]int{
+	model.ProjectRoleViewer: 1,
+	model.ProjectRoleMember: 2,
+	model.ProjectRoleAdmin:  3,
+}
+
+// LDAP 的 cn 比较不区分大小写
+func containsFold(list []string, s string) bool {
+	for _, v := range list {
+		if strings.EqualFold(v, s) {
+			return true
+		}
+	}
+	return false
+}
+
+// groupsOf returns the cn of the groups listing the uid in memberUid, and of the memberOf DNs of the user
+func groupsOf(user *model.LdapUser, groups []*model.LdapGroup) []string {
+	var names []string
+	for _, g := range groups {
+		if containsFold(g.MemberUIDs, user.UID) {
+			names = append(names, g.CN)
+		}
+	}
+	for _, dn := range user.MemberOf {
+		// 只需要 cn, 没有 ou 的 DN 也可以使用
+		g := model.LdapGroup{DN: dn}
+		_ = g.ParseDN()
+		if g.CN != "" {
+			names = append(names, g.CN)
+		}
+	}
+	return names
+}
+
+// LDAPSyncOptions configures the group mappings and the periodic sync of the LDAP users
+type LDAPSyncOptions struct {
+	// GroupMappings are parsed by ParseGroupMapping. Without a role mapping the role of the first login is
+	// admin if the ou of the user contains "admin", as before group mappings existed.
+	GroupMappings []string
+	// SyncInterval is the interval of the directory sync, 0 disables it
+	SyncInterval time.Duration
+}
+
+func NewLDAPSyncOptions() *LDAPSyncOptions {
+	return &LDAPSyncOptions{
+		SyncInterval: 10 * time.Minute,
+	}
+}
+
+// Mappings returns the parsed group mappings
+func (o *LDAPSyncOptions) Mappings() (GroupMappings, error) {
+	mappings := make(GroupMappings, 0, len(o.GroupMappings))
+	for _, s := range o.GroupMappings {
+		mapping, err := ParseGroupMapping(s)
+		if err != nil {
+			return nil, err
+		}
+		mappings = append(mappings, mapping)
+	}
+	return mappings, nil
+}
+
+func (o *LDAPSyncOptions) Validate() []error {
+	var errs []error
+	if _, err := o.Mappings(); err != nil {
+		errs = append(errs, err)
+	}
+	if o.SyncInterval < 0 {
+		errs = append(errs, fmt.Errorf("invalid ldap sync interval"))
+	}
+	return errs
+}
+
+// AddFlags add option flags to command line flags
+func (o *LDAPSyncOptions) AddFlags(fs *pflag.FlagSet) {
+	fs.StringSliceVar(&o.GroupMappings, "ldap-group-mappings", o.GroupMappings, "The mappings of LDAP groups to console roles or project roles, e.g. console-admins=admin,team-a=demo:member.")
+	fs.DurationVar(&o.SyncInterval, "ldap-sync-interval", o.SyncInterval, "The interval of syncing roles, projects, status, email and phone of the LDAP users, 0 disables it.")
+}
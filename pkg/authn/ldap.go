@@ -0,0 +1,84 @@
+package authn
+
+import (
+	"asyncKubeManager/pkg/client/ldap"
+	"asyncKubeManager/pkg/model"
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// ldapAuthenticator finds the user by its uid attribute and binds as the user to verify the password.
+// The role and projects of the user are mapped from its groups.
+type ldapAuthenticator struct {
+	client   *ldap.LDAPClient
+	mappings GroupMappings
+}
+
+func NewLDAPAuthenticator(client *ldap.LDAPClient, mappings GroupMappings) PasswordAuthenticator {
+	return &ldapAuthenticator{client: client, mappings: mappings}
+}
+
+func (a *ldapAuthenticator) Name() string {
+	return string(model.AuthSourceLDAP)
+}
+
+func (a *ldapAuthenticator) Type() string {
+	return TypeLDAP
+}
+
+func (a *ldapAuthenticator) Authenticate(ctx context.Context, username, password string) (*Identity, error) {
+	// 空密码在 LDAP 中是匿名绑定, 总是成功
+	if password == "" {
+		return nil, ErrInvalidCredentials
+	}
+
+	ldapUser, err := a.client.FindUserByUID(username)
+	if err != nil {
+		if errors.Is(err, ldap.ErrUserNotFound) {
+			return nil, ErrUserNotFound
+		}
+		return nil, err
+	}
+
+	identity := &Identity{
+		Provider:   a.Name(),
+		ExternalID: ldapUser.UID,
+		Username:   ldapUser.UID,
+		Email:      ldapUser.Mail,
+		Tel:        ldapUser.TelephoneNumber,
+		Role:       model.UserRoleNormal,
+	}
+
+	// 管理员禁用的账号, LDAP 绑定不检查 shadowExpire
+	if ldapUser.Disabled() {
+		return identity, errors.Join(ErrInvalidCredentials, fmt.Errorf("%s is disabled", ldapUser.DN))
+	}
+
+	if err = a.client.Bind(ldapUser.DN, password); err != nil {
+		return identity, errors.Join(ErrInvalidCredentials, fmt.Errorf("bind %s: %w", ldapUser.DN, err))
+	}
+	if !a.mappings.MapsRole() && !a.mappings.MapsProjects() {
+		// 未配置组映射时沿用 ou 判断管理员
+		if strings.Contains(ldapUser.OU, "admin") {
+			identity.Role = model.UserRoleAdmin
+		}
+		return identity, nil
+	}
+
+	groups, err := a.client.FindGroupsByMemberUID(ldapUser.UID)
+	if err != nil {
+		return nil, err
+	}
+	names := groupsOf(ldapUser, groups)
+	if a.mappings.MapsRole() {
+		identity.Role = a.mappings.Role(names)
+	} else if strings.Contains(ldapUser.OU, "admin") {
+		identity.Role = model.UserRoleAdmin
+	}
+	if a.mappings.MapsProjects() {
+		identity.Projects = a.mappings.Projects(names)
+	}
+	return identity, nil
+}
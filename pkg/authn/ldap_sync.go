@@ -0,0 +1,285 @@
+package authn
+
+import (
+	"asyncKubeManager/pkg/auth"
+	"asyncKubeManager/pkg/client/cache"
+	"asyncKubeManager/pkg/dao"
+	"asyncKubeManager/pkg/dbresolver"
+	"asyncKubeManager/pkg/model"
+	"asyncKubeManager/pkg/token"
+	"asyncKubeManager/pkg/utils"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// LDAPSyncOperator is the creator of the changes of the directory sync. The project memberships created by it
+// are the ones it manages, memberships added by the project admins are never removed by the sync.
+const LDAPSyncOperator = "ldap-sync"
+
+// ldapSyncLockKey is held by the replica running the sync round of an interval
+const ldapSyncLockKey = "ldap-sync:lock"
+
+// Directory lists the users and groups of the LDAP server
+type Directory interface {
+	ListUsers() ([]*model.LdapUser, error)
+	ListGroups() ([]*model.LdapGroup, error)
+}
+
+// LDAPSyncer applies the directory to the LDAP users: the roles and projects are mapped from the groups,
+// email and phone are refreshed, and users removed from the directory are disabled and logged out.
+type LDAPSyncer struct {
+	directory  Directory
+	dbResolver *dbresolver.DBResolver
+	enforcer   *auth.Enforcer
+	userLogout *UserLogout
+	mappings   GroupMappings
+	// lockCache elects the replica syncing each round, nil lets every replica sync
+	lockCache cache.Interface
+}
+
+func NewLDAPSyncer(directory Directory, dbResolver *dbresolver.DBResolver, enforcer *auth.Enforcer,
+	tokenManager token.Manager, mappings GroupMappings) *LDAPSyncer {
+	return &LDAPSyncer{
+		directory:  directory,
+		dbResolver: dbResolver,
+		enforcer:   enforcer,
+		userLogout: NewUserLogout(tokenManager, dbResolver),
+		mappings:   mappings,
+	}
+}
+
+// SetLockCache makes the replicas sharing cacheClient take turns, only one of them syncs in an interval
+func (s *LDAPSyncer) SetLockCache(cacheClient cache.Interface) {
+	s.lockCache = cacheClient
+}
+
+// Start syncs the directory now and then every interval until ctx is done
+func (s *LDAPSyncer) Start(ctx context.Context, interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			if s.lock(ctx, interval) {
+				if err := s.Sync(ctx); err != nil {
+					zap.L().Error("ldap sync failed", zap.Error(err))
+				}
+			}
+
+			select {
+			case <-ticker.C:
+			case <-ctx.Done():
+				zap.L().Info("Stopping ldap sync")
+				return
+			}
+		}
+	}()
+}
+
+// lock reports whether this replica syncs the round. The lock isn't released but expires before the next round,
+// so that a round runs once even if the replicas tick at different times, and another replica takes over if the holder dies.
+func (s *LDAPSyncer) lock(ctx context.Context, interval time.Duration) bool {
+	if s.lockCache == nil {
+		return true
+	}
+	holder, _ := os.Hostname()
+	ok, err := s.lockCache.SetNX(ctx, ldapSyncLockKey, holder, interval-interval/10)
+	if err != nil {
+		zap.L().Error("ldap sync lock failed", zap.Error(err))
+		return false
+	}
+	return ok
+}
+
+// Sync applies the directory to every LDAP user once, a failed user is logged and retried by the next sync
+func (s *LDAPSyncer) Sync(ctx context.Context) error {
+	ctx = token.WithPayload(ctx, token.Info{UID: LDAPSyncOperator})
+
+	ldapUsers, err := s.directory.ListUsers()
+	if err != nil {
+		return err
+	}
+	var groups []*model.LdapGroup
+	if s.mappings.MapsRole() || s.mappings.MapsProjects() {
+		if groups, err = s.directory.ListGroups(); err != nil {
+			return err
+		}
+	}
+	users, err := dao.ListUsersBySource(ctx, s.dbResolver, model.AuthSourceLDAP)
+	if err != nil {
+		return err
+	}
+
+	// 目录为空多半是 base dn 配置错误或服务异常, 不能因此禁用所有用户
+	if len(ldapUsers) == 0 && len(users) != 0 {
+		return errors.New("no user found in the directory, skip the sync")
+	}
+
+	byUID := make(map[string]*model.LdapUser, len(ldapUsers))
+	for _, u := range ldapUsers {
+		// 目录中禁用的账号和删除的账号一样处理
+		if !u.Disabled() {
+			byUID[u.UID] = u
+		}
+	}
+	for i := range users {
+		if err = s.syncUser(ctx, &users[i], byUID[users[i].ExternalID], groups); err != nil {
+			zap.L().Error("ldap sync user failed", zap.String("uid", users[i].UID), zap.Error(err))
+		}
+	}
+	return nil
+}
+
+// syncUser applies the directory entry to the user, ldapUser is nil if the user is removed from the directory or disabled
+func (s *LDAPSyncer) syncUser(ctx context.Context, user *model.User, ldapUser *model.LdapUser, groups []*model.LdapGroup) error {
+	if ldapUser == nil {
+		if user.Status == model.UserStatusDisabled {
+			return nil
+		}
+		err := dao.UpdateUserByID(ctx, s.dbResolver, user.UID, map[string]interface{}{"status": model.UserStatusDisabled})
+		if err != nil {
+			return err
+		}
+		if err = s.userLogout.Logout(ctx, user.UID); err != nil {
+			return err
+		}
+		return s.log(ctx, user.UID, map[string]string{
+			"status": fmt.Sprintf("status changed from %s to %s, the user is removed from or disabled in the directory", user.Status, model.UserStatusDisabled),
+		})
+	}
+
+	updated := map[string]interface{}{}
+	changes := map[string]string{}
+	if email := utils.TruncateString(ldapUser.Mail, 32); email != user.Email {
+		updated["email"] = email
+		changes["email"] = fmt.Sprintf("email changed from %s to %s", user.Email, email)
+	}
+	if tel := utils.TruncateString(ldapUser.TelephoneNumber, 32); tel != user.Tel {
+		updated["tel"] = tel
+		changes["tel"] = fmt.Sprintf("tel changed from %s to %s", user.Tel, tel)
+	}
+
+	names := groupsOf(ldapUser, groups)
+	role := user.Role
+	if s.mappings.MapsRole() {
+		role = s.mappings.Role(names)
+	}
+	if role != user.Role {
+		updated["role"] = role
+		changes["role"] = fmt.Sprintf("role changed from %s to %s", user.Role, role)
+	}
+	if len(updated) != 0 {
+		if err := dao.UpdateUserByID(ctx, s.dbResolver, user.UID, updated); err != nil {
+			return err
+		}
+	}
+	// casbin 角色跟随用户表, 角色未变时是空操作, 上次失败的绑定在这里重试
+	if err := s.enforcer.SetUserRole(user.UID, string(role)); err != nil {
+		return err
+	}
+	if role != user.Role {
+		// token 中带有旧角色, 重新登录后才使用新角色
+		if err := s.userLogout.Logout(ctx, user.UID); err != nil {
+			return err
+		}
+	}
+
+	if s.mappings.MapsProjects() {
+		projectChanges, err := SyncProjectMembers(ctx, s.dbResolver, user.UID, s.mappings.Projects(names))
+		if err != nil {
+			return err
+		}
+		if len(projectChanges) != 0 {
+			changes["projects"] = fmt.Sprint(projectChanges)
+		}
+	}
+
+	if len(changes) == 0 {
+		return nil
+	}
+	return s.log(ctx, user.UID, changes)
+}
+
+func (s *LDAPSyncer) log(ctx context.Context, uid string, changes map[string]string) error {
+	operation, err := json.Marshal(changes)
+	if err != nil {
+		return err
+	}
+	return dao.InsertUserOperatorLogByModel(ctx, s.dbResolver, &model.UserOperatorLog{
+		UID:       uid,
+		Operator:  model.UserOperatorSync,
+		Operation: utils.TruncateString(string(operation), 255),
+		CreatedAt: time.Now().UnixMilli(),
+		Creator:   LDAPSyncOperator,
+	})
+}
+
+// SyncProjectMembers makes the user a member of the mapped projects with the mapped roles, and removes the memberships
+// created by the sync that are no longer mapped. Memberships added by the project admins are kept.
+// It returns the changes made, e.g. "+demo:member".
+func SyncProjectMembers(ctx context.Context, dbResolver *dbresolver.DBResolver, uid string, projects map[string]model.ProjectRole) ([]string, error) {
+	ctx = token.WithPayload(ctx, token.Info{UID: LDAPSyncOperator})
+
+	members, err := dao.ListProjectMembersByUID(ctx, dbResolver, uid)
+	if err != nil {
+		return nil, err
+	}
+	byProject := make(map[int64]model.ProjectMember, len(members))
+	for _, m := range members {
+		byProject[m.ProjectID] = m
+	}
+
+	// 按项目名排序, 使变更记录稳定
+	names := make([]string, 0, len(projects))
+	for name := range projects {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var changes []string
+	mapped := map[int64]bool{}
+	for _, name := range names {
+		found, project, err := dao.GetProjectByName(ctx, dbResolver, name)
+		if err != nil {
+			return changes, err
+		}
+		if !found {
+			zap.L().Warn("the project of the group mapping is not found", zap.String("project", name))
+			continue
+		}
+		mapped[project.ID] = true
+
+		role := projects[name]
+		m, ok := byProject[project.ID]
+		switch {
+		case !ok:
+			if _, err = dao.InsertProjectMember(ctx, dbResolver, project.ID, uid, role); err != nil {
+				return changes, err
+			}
+			changes = append(changes, fmt.Sprintf("+%s:%s", name, role))
+		case m.Creator == LDAPSyncOperator && m.Role != role:
+			if err = dao.UpdateProjectMemberRole(ctx, dbResolver, project.ID, uid, role); err != nil {
+				return changes, err
+			}
+			changes = append(changes, fmt.Sprintf("~%s:%s", name, role))
+		}
+	}
+
+	for _, m := range members {
+		if m.Creator != LDAPSyncOperator || mapped[m.ProjectID] {
+			continue
+		}
+		if err = dao.DeleteProjectMember(ctx, dbResolver, m.ProjectID, uid); err != nil {
+			return changes, err
+		}
+		changes = append(changes, fmt.Sprintf("-%d:%s", m.ProjectID, m.Role))
+	}
+	return changes, nil
+}
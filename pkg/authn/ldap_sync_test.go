@@ -0,0 +1,143 @@
+package authn
+
+import (
+	"asyncKubeManager/pkg/auth"
+	"asyncKubeManager/pkg/client/cache"
+	"asyncKubeManager/pkg/dao"
+	"asyncKubeManager/pkg/model"
+	"asyncKubeManager/pkg/testutil"
+	"asyncKubeManager/pkg/token"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeDirectory struct {
+	users  []*model.LdapUser
+	groups []*model.LdapGroup
+}
+
+func (d *fakeDirectory) ListUsers() ([]*model.LdapUser, error)   { return d.users, nil }
+func (d *fakeDirectory) ListGroups() ([]*model.LdapGroup, error) { return d.groups, nil }
+
+func TestParseGroupMapping(t *testing.T) {
+	m, err := ParseGroupMapping("console-admins=admin")
+	require.NoError(t, err)
+	assert.Equal(t, GroupMapping{Group: "console-admins", Role: model.UserRoleAdmin}, m)
+
+	m, err = ParseGroupMapping(" team-a = demo:member ")
+	require.NoError(t, err)
+	assert.Equal(t, GroupMapping{Group: "team-a", Project: "demo", ProjectRole: model.ProjectRoleMember}, m)
+
+	for _, s := range []string{"team-a", "=admin", "team-a=root", "team-a=demo:owner", "team-a=:member"} {
+		_, err = ParseGroupMapping(s)
+		assert.Error(t, err, s)
+	}
+}
+
+func TestLDAPSyncer_Sync(t *testing.T) {
+	ctx := context.Background()
+	dr := testutil.NewDBResolver(t)
+	enforcer, err := auth.NewEnforcer(dr.GetDB(), "../../"+auth.DefaultModelPath)
+	require.NoError(t, err)
+	tm := token.NewJWTTokenManager([]byte("fake"), jwt.SigningMethodHS256, token.SetDenylist(cache.NewMemoryClient(), time.Hour))
+
+	db := dr.GetDB()
+	demo, err := dao.InsertProjectWithDB(ctx, db, "p1", "demo", "demo", "")
+	require.NoError(t, err)
+	other, err := dao.InsertProjectWithDB(ctx, db, "p2", "other", "other", "")
+	require.NoError(t, err)
+	alice, err := dao.InsertUserWithDB(ctx, db, "alice", "alice", "", "old@example.com", "", model.UserRoleNormal)
+	require.NoError(t, err)
+	bob, err := dao.InsertUserWithDB(ctx, db, "bob", "bob", "", "", "", model.UserRoleAdmin)
+	require.NoError(t, err)
+	carol, err := dao.InsertUserWithDB(ctx, db, "carol", "carol", "", "", "", model.UserRoleNormal)
+	require.NoError(t, err)
+	// 项目管理员手动添加的成员不受同步影响
+	_, err = dao.InsertProjectMember(ctx, dr, other.ID, alice.UID, model.ProjectRoleViewer)
+	require.NoError(t, err)
+
+	directory := &fakeDirectory{
+		users: []*model.LdapUser{
+			{UID: "alice", Mail: "alice@example.com", TelephoneNumber: "123",
+				MemberOf: []string{"cn=console-admins,ou=groups,dc=example,dc=com"}},
+			{UID: "carol", ShadowExpire: "1"},
+		},
+		groups: []*model.LdapGroup{
+			{CN: "team-a", MemberUIDs: []string{"alice"}},
+		},
+	}
+	mappings := GroupMappings{
+		{Group: "console-admins", Role: model.UserRoleAdmin},
+		{Group: "team-a", Project: "demo", ProjectRole: model.ProjectRoleMember},
+	}
+	aliceToken, err := tm.IssueTo(token.Info{UID: alice.UID, RoleID: alice.Role}, time.Hour)
+	require.NoError(t, err)
+	time.Sleep(2 * time.Millisecond)
+	s := NewLDAPSyncer(directory, dr, enforcer, tm, mappings)
+	require.NoError(t, s.Sync(ctx))
+
+	// 角色变化后旧 token 失效
+	_, err = tm.Verify(aliceToken)
+	assert.ErrorIs(t, err, token.ErrTokenRevoked)
+
+	_, user, err := dao.GetUserByUID(ctx, dr, alice.UID)
+	require.NoError(t, err)
+	assert.Equal(t, model.UserRoleAdmin, user.Role)
+	assert.Equal(t, "alice@example.com", user.Email)
+	assert.Equal(t, "123", user.Tel)
+	roles, err := enforcer.GetUserRoles(alice.UID)
+	require.NoError(t, err)
+	assert.Equal(t, []string{string(model.UserRoleAdmin)}, roles)
+
+	found, member, err := dao.GetProjectMember(ctx, dr, demo.ID, alice.UID)
+	require.NoError(t, err)
+	require.True(t, found)
+	assert.Equal(t, model.ProjectRoleMember, member.Role)
+	assert.Equal(t, LDAPSyncOperator, member.Creator)
+
+	// bob 已从目录中删除, carol 在目录中被禁用
+	_, user, err = dao.GetUserByUID(ctx, dr, bob.UID)
+	require.NoError(t, err)
+	assert.Equal(t, model.UserStatusDisabled, user.Status)
+	_, user, err = dao.GetUserByUID(ctx, dr, carol.UID)
+	require.NoError(t, err)
+	assert.Equal(t, model.UserStatusDisabled, user.Status)
+
+	// alice 离开组后失去管理员和同步添加的项目, 手动添加的项目保留
+	directory.users[0].MemberOf = nil
+	directory.groups[0].MemberUIDs = nil
+	require.NoError(t, s.Sync(ctx))
+
+	_, user, err = dao.GetUserByUID(ctx, dr, alice.UID)
+	require.NoError(t, err)
+	assert.Equal(t, model.UserRoleNormal, user.Role)
+	found, _, err = dao.GetProjectMember(ctx, dr, demo.ID, alice.UID)
+	require.NoError(t, err)
+	assert.False(t, found)
+	found, _, err = dao.GetProjectMember(ctx, dr, other.ID, alice.UID)
+	require.NoError(t, err)
+	assert.True(t, found)
+
+	// 目录为空时不禁用用户
+	directory.users = nil
+	assert.Error(t, s.Sync(ctx))
+	_, user, err = dao.GetUserByUID(ctx, dr, alice.UID)
+	require.NoError(t, err)
+	assert.Equal(t, model.UserStatusEnabled, user.Status)
+}
+
+func TestLDAPSyncer_Lock(t *testing.T) {
+	lockCache := cache.NewMemoryClient()
+	first, second := &LDAPSyncer{}, &LDAPSyncer{}
+	first.SetLockCache(lockCache)
+	second.SetLockCache(lockCache)
+
+	// 每轮只有一个副本同步
+	assert.True(t, first.lock(context.Background(), time.Minute))
+	assert.False(t, second.lock(context.Background(), time.Minute))
+}
@@ -0,0 +1,48 @@
+package authn
+
+import (
+	"asyncKubeManager/pkg/dao"
+	"asyncKubeManager/pkg/dbresolver"
+	"asyncKubeManager/pkg/model"
+	"asyncKubeManager/pkg/utils/pwdutil"
+	"context"
+)
+
+// localAuthenticator verifies the bcrypt passwords of the local accounts
+type localAuthenticator struct {
+	dbResolver *dbresolver.DBResolver
+}
+
+func NewLocalAuthenticator(dbResolver *dbresolver.DBResolver) PasswordAuthenticator {
+	return &localAuthenticator{dbResolver: dbResolver}
+}
+
+func (a *localAuthenticator) Name() string {
+	return string(model.AuthSourceLocal)
+}
+
+func (a *localAuthenticator) Type() string {
+	return TypeLocal
+}
+
+func (a *localAuthenticator) Authenticate(ctx context.Context, username, password string) (*Identity, error) {
+	found, user, err := dao.GetLocalUserByUserName(ctx, a.dbResolver, username)
+	if err != nil {
+		return nil, err
+	}
+	if !found {
+		return nil, ErrUserNotFound
+	}
+	identity := &Identity{
+		Provider:   a.Name(),
+		ExternalID: user.ExternalID,
+		Username:   user.Username,
+		Email:      user.Email,
+		Tel:        user.Tel,
+		Role:       user.Role,
+	}
+	if !pwdutil.PasswordVerify(password, user.PasswordHash) {
+		return identity, ErrInvalidCredentials
+	}
+	return identity, nil
+}
@@ -0,0 +1,38 @@
+package authn
+
+import (
+	"asyncKubeManager/pkg/dbresolver"
+	"asyncKubeManager/pkg/token"
+	"asyncKubeManager/pkg/token/pat"
+	"asyncKubeManager/pkg/token/refresh"
+	"context"
+)
+
+// UserLogout logs a user out everywhere: the refresh tokens and personal access tokens of the user are revoked,
+// then the access tokens issued before now. It is used whenever the tokens of a user must not outlive a change,
+// e.g. a password reset, a role change or a user removed from the directory.
+type UserLogout struct {
+	tokenManager   token.Manager
+	refreshManager *refresh.Manager
+	patManager     *pat.Manager
+}
+
+func NewUserLogout(tokenManager token.Manager, dbResolver *dbresolver.DBResolver) *UserLogout {
+	return &UserLogout{
+		tokenManager:   tokenManager,
+		refreshManager: refresh.NewManager(dbResolver, refresh.DefaultDuration),
+		patManager:     pat.NewManager(dbResolver),
+	}
+}
+
+// Logout revokes every token of the user. The refresh and personal access tokens are revoked first,
+// so that no new access token can be issued after the access tokens are revoked.
+func (l *UserLogout) Logout(ctx context.Context, uid string) error {
+	if err := l.refreshManager.RevokeUser(ctx, uid); err != nil {
+		return err
+	}
+	if err := l.patManager.RevokeUser(ctx, uid); err != nil {
+		return err
+	}
+	return l.tokenManager.RevokeUser(uid)
+}
@@ -0,0 +1,48 @@
+package authn
+
+import (
+	"asyncKubeManager/pkg/client/cache"
+	"asyncKubeManager/pkg/dao"
+	"asyncKubeManager/pkg/model"
+	"asyncKubeManager/pkg/testutil"
+	"asyncKubeManager/pkg/token"
+	"asyncKubeManager/pkg/token/pat"
+	"asyncKubeManager/pkg/token/refresh"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUserLogout(t *testing.T) {
+	ctx := context.Background()
+	dr := testutil.NewDBResolver(t)
+	tm := token.NewJWTTokenManager([]byte("fake"), jwt.SigningMethodHS256, token.SetDenylist(cache.NewMemoryClient(), time.Hour))
+	refreshManager := refresh.NewManager(dr, time.Hour)
+	patManager := pat.NewManager(dr)
+
+	user, err := dao.InsertUser(ctx, dr, "alice", "alice", "", "", "", model.UserRoleNormal)
+	require.NoError(t, err)
+	accessToken, err := tm.IssueTo(token.Info{UID: user.UID, RoleID: user.Role}, time.Hour)
+	require.NoError(t, err)
+	refreshToken, err := refreshManager.Issue(ctx, user.UID, token.SessionID(accessToken))
+	require.NoError(t, err)
+	patToken, _, err := patManager.Issue(ctx, user.UID, "ci", []string{"vm"}, time.Hour)
+	require.NoError(t, err)
+
+	// iat_ms 精度为毫秒, 同一毫秒内签发的token不会被吊销
+	time.Sleep(2 * time.Millisecond)
+	require.NoError(t, NewUserLogout(tm, dr).Logout(ctx, user.UID))
+
+	_, err = tm.Verify(accessToken)
+	assert.ErrorIs(t, err, token.ErrTokenRevoked)
+	_, _, err = refreshManager.Rotate(ctx, refreshToken, "session-2", func(old *model.RefreshToken) error {
+		return nil
+	})
+	assert.ErrorIs(t, err, refresh.ErrTokenReused)
+	_, err = patManager.VerifyPersonalAccessToken(ctx, patToken)
+	assert.ErrorIs(t, err, pat.ErrInvalidToken)
+}
@@ -0,0 +1,210 @@
+package authn
+
+import (
+	"asyncKubeManager/pkg/dao"
+	"asyncKubeManager/pkg/dbresolver"
+	"asyncKubeManager/pkg/model"
+	"asyncKubeManager/pkg/utils"
+	"asyncKubeManager/pkg/utils/totp"
+	"context"
+	"crypto/rand"
+	"encoding/base32"
+	"errors"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// DefaultMFAIssuer is the account issuer shown by the authenticator apps
+const DefaultMFAIssuer = "AsyncKubeManager"
+
+// recoveryCodeCount is the number of recovery codes given on enrollment
+const recoveryCodeCount = 10
+
+var (
+	ErrMFANotEnrolled = errors.New("mfa is not enrolled")
+	ErrMFAEnrolled    = errors.New("mfa is enrolled already")
+	ErrInvalidOTP     = errors.New("invalid one-time password")
+)
+
+// MFA manages the TOTP factors and recovery codes of the users and the roles MFA is enforced for
+type MFA struct {
+	dbResolver *dbresolver.DBResolver
+	issuer     string
+	now        func() time.Time
+}
+
+func NewMFA(dbResolver *dbresolver.DBResolver, issuer string) *MFA {
+	return &MFA{
+		dbResolver: dbResolver,
+		issuer:     issuer,
+		now:        time.Now,
+	}
+}
+
+// Enrolled reports whether the user has a confirmed factor
+func (m *MFA) Enrolled(ctx context.Context, uid string) (bool, error) {
+	found, mfa, err := dao.GetUserMFA(ctx, m.dbResolver, uid)
+	if err != nil {
+		return false, err
+	}
+	return found && mfa.ConfirmedAt != 0, nil
+}
+
+// Required reports whether the user has to pass a second factor to log in, because it has enrolled
+// or MFA is enforced for its role. enrolled is false if the user has to enroll first.
+func (m *MFA) Required(ctx context.Context, user *model.User) (required, enrolled bool, err error) {
+	if enrolled, err = m.Enrolled(ctx, user.UID); err != nil || enrolled {
+		return enrolled, enrolled, err
+	}
+	required, err = dao.IsMFAEnforcedForRole(ctx, m.dbResolver, user.Role)
+	return required, false, err
+}
+
+// Enroll generates a new secret for the user and returns it with its provisioning URI, the factor is
+// used for login after Confirm. A pending enrollment is replaced.
+func (m *MFA) Enroll(ctx context.Context, user *model.User) (secret, uri string, err error) {
+	enrolled, err := m.Enrolled(ctx, user.UID)
+	if err != nil {
+		return "", "", err
+	}
+	if enrolled {
+		return "", "", ErrMFAEnrolled
+	}
+
+	if secret, err = totp.GenerateSecret(); err != nil {
+		return "", "", err
+	}
+	if err = dao.SaveUnconfirmedUserMFA(ctx, m.dbResolver, user.UID, secret); err != nil {
+		return "", "", err
+	}
+	return secret, totp.ProvisioningURI(m.issuer, user.Username, secret), nil
+}
+
+// Confirm verifies the first code of the pending enrollment and returns the recovery codes, they are shown only once
+func (m *MFA) Confirm(ctx context.Context, uid, code string) ([]string, error) {
+	found, mfa, err := dao.GetUserMFA(ctx, m.dbResolver, uid)
+	if err != nil {
+		return nil, err
+	}
+	if !found {
+		return nil, ErrMFANotEnrolled
+	}
+	if mfa.ConfirmedAt != 0 {
+		return nil, ErrMFAEnrolled
+	}
+	step, ok := totp.Validate(mfa.Secret, normalizeCode(code), m.now())
+	if !ok {
+		return nil, ErrInvalidOTP
+	}
+
+	codes, hashes, err := generateRecoveryCodes()
+	if err != nil {
+		return nil, err
+	}
+	err = m.dbResolver.GetDB().Transaction(func(tx *gorm.DB) error {
+		accepted, err := dao.AcceptUserMFAStepWithDB(ctx, tx, uid, step)
+		if err != nil {
+			return err
+		}
+		if !accepted {
+			return ErrInvalidOTP
+		}
+		if err = dao.ConfirmUserMFAWithDB(ctx, tx, uid); err != nil {
+			return err
+		}
+		return dao.ReplaceMFARecoveryCodesWithDB(ctx, tx, uid, hashes)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+// Verify accepts a TOTP code of the confirmed factor, or an unused recovery code which is used up
+func (m *MFA) Verify(ctx context.Context, uid, code string) error {
+	found, mfa, err := dao.GetUserMFA(ctx, m.dbResolver, uid)
+	if err != nil {
+		return err
+	}
+	if !found || mfa.ConfirmedAt == 0 {
+		return ErrMFANotEnrolled
+	}
+
+	code = normalizeCode(code)
+	if len(code) == totp.Digits {
+		step, ok := totp.Validate(mfa.Secret, code, m.now())
+		// 同一周期的验证码只能使用一次
+		if !ok || step <= mfa.LastStep {
+			return ErrInvalidOTP
+		}
+		accepted, err := dao.AcceptUserMFAStep(ctx, m.dbResolver, uid, step)
+		if err != nil {
+			return err
+		}
+		if !accepted {
+			return ErrInvalidOTP
+		}
+		return nil
+	}
+
+	used, err := dao.UseMFARecoveryCode(ctx, m.dbResolver, uid, utils.SHA256Hex(code))
+	if err != nil {
+		return err
+	}
+	if !used {
+		return ErrInvalidOTP
+	}
+	return nil
+}
+
+// RegenerateRecoveryCodes replaces the recovery codes of the confirmed factor
+func (m *MFA) RegenerateRecoveryCodes(ctx context.Context, uid string) ([]string, error) {
+	enrolled, err := m.Enrolled(ctx, uid)
+	if err != nil {
+		return nil, err
+	}
+	if !enrolled {
+		return nil, ErrMFANotEnrolled
+	}
+
+	codes, hashes, err := generateRecoveryCodes()
+	if err != nil {
+		return nil, err
+	}
+	err = m.dbResolver.GetDB().Transaction(func(tx *gorm.DB) error {
+		return dao.ReplaceMFARecoveryCodesWithDB(ctx, tx, uid, hashes)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+// Disable removes the factor and the recovery codes of the user
+func (m *MFA) Disable(ctx context.Context, uid string) error {
+	return dao.DeleteUserMFA(ctx, m.dbResolver, uid)
+}
+
+var recoveryEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// generateRecoveryCodes returns codes like "k3x9q-2mfzw" of 50 random bits and their hashes
+func generateRecoveryCodes() (codes, hashes []string, err error) {
+	for i := 0; i < recoveryCodeCount; i++ {
+		b := make([]byte, 7)
+		if _, err = rand.Read(b); err != nil {
+			return nil, nil, err
+		}
+		code := strings.ToLower(recoveryEncoding.EncodeToString(b))[:10]
+		codes = append(codes, code[:5]+"-"+code[5:])
+		hashes = append(hashes, utils.SHA256Hex(code))
+	}
+	return codes, hashes, nil
+}
+
+// normalizeCode removes the separators users may type or paste
+func normalizeCode(code string) string {
+	code = strings.ToLower(strings.TrimSpace(code))
+	return strings.NewReplacer("-", "", " ", "").Replace(code)
+}
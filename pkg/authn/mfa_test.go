@@ -0,0 +1,78 @@
+package authn
+
+import (
+	"asyncKubeManager/pkg/dao"
+	"asyncKubeManager/pkg/model"
+	"asyncKubeManager/pkg/testutil"
+	"asyncKubeManager/pkg/utils/totp"
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMFA(t *testing.T) {
+	ctx := context.Background()
+	dr := testutil.NewDBResolver(t)
+	user, err := dao.InsertUserWithDB(ctx, dr.GetDB(), "alice", "alice", "", "", "", model.UserRoleAdmin)
+	require.NoError(t, err)
+
+	now := time.Unix(1700000000, 0)
+	m := NewMFA(dr, DefaultMFAIssuer)
+	m.now = func() time.Time { return now }
+
+	required, _, err := m.Required(ctx, user)
+	require.NoError(t, err)
+	assert.False(t, required)
+
+	// 管理员角色强制 MFA 后需要先绑定
+	require.NoError(t, dao.SetMFARolePolicy(ctx, dr, model.UserRoleAdmin, true))
+	required, enrolled, err := m.Required(ctx, user)
+	require.NoError(t, err)
+	assert.True(t, required)
+	assert.False(t, enrolled)
+
+	secret, uri, err := m.Enroll(ctx, user)
+	require.NoError(t, err)
+	assert.Contains(t, uri, "secret="+secret)
+	assert.ErrorIs(t, m.Verify(ctx, user.UID, "000000"), ErrMFANotEnrolled)
+
+	_, err = m.Confirm(ctx, user.UID, "000000")
+	assert.ErrorIs(t, err, ErrInvalidOTP)
+	code, err := totp.Code(secret, now)
+	require.NoError(t, err)
+	recoveryCodes, err := m.Confirm(ctx, user.UID, code)
+	require.NoError(t, err)
+	assert.Len(t, recoveryCodes, recoveryCodeCount)
+	_, _, err = m.Enroll(ctx, user)
+	assert.ErrorIs(t, err, ErrMFAEnrolled)
+
+	// 绑定时使用过的验证码不能再用于登录
+	assert.ErrorIs(t, m.Verify(ctx, user.UID, code), ErrInvalidOTP)
+	now = now.Add(totp.Period)
+	code, err = totp.Code(secret, now)
+	require.NoError(t, err)
+	require.NoError(t, m.Verify(ctx, user.UID, code))
+	assert.ErrorIs(t, m.Verify(ctx, user.UID, code), ErrInvalidOTP)
+
+	// 恢复码只能使用一次, 大小写和分隔符不影响
+	require.NoError(t, m.Verify(ctx, user.UID, " "+recoveryCodes[0]+" "))
+	assert.ErrorIs(t, m.Verify(ctx, user.UID, recoveryCodes[0]), ErrInvalidOTP)
+	require.NoError(t, m.Verify(ctx, user.UID, strings.ToUpper(strings.ReplaceAll(recoveryCodes[1], "-", ""))))
+	count, err := dao.CountUnusedMFARecoveryCodes(ctx, dr, user.UID)
+	require.NoError(t, err)
+	assert.Equal(t, int64(recoveryCodeCount-2), count)
+
+	regenerated, err := m.RegenerateRecoveryCodes(ctx, user.UID)
+	require.NoError(t, err)
+	assert.ErrorIs(t, m.Verify(ctx, user.UID, recoveryCodes[2]), ErrInvalidOTP)
+	require.NoError(t, m.Verify(ctx, user.UID, regenerated[0]))
+
+	require.NoError(t, m.Disable(ctx, user.UID))
+	enrolled, err = m.Enrolled(ctx, user.UID)
+	require.NoError(t, err)
+	assert.False(t, enrolled)
+}
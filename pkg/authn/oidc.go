@@ -0,0 +1,257 @@
+package authn
+
+import (
+	"asyncKubeManager/pkg/model"
+	"asyncKubeManager/pkg/token"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"go.uber.org/zap"
+	"golang.org/x/oauth2"
+)
+
+const (
+	// oidcHTTPTimeout bounds the requests to the provider
+	oidcHTTPTimeout = 10 * time.Second
+	// jwksRefreshInterval limits the refetch of the provider keys when an unknown kid is seen
+	jwksRefreshInterval = time.Minute
+)
+
+// ErrInvalidIDToken is returned when the ID token of the provider can't be verified
+var ErrInvalidIDToken = errors.New("invalid id token")
+
+// oidcDiscovery is the part of the provider metadata used by the authorization code flow
+type oidcDiscovery struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+type idTokenClaims struct {
+	jwt.RegisteredClaims
+	Nonce             string `json:"nonce"`
+	PreferredUsername string `json:"preferred_username"`
+	Email             string `json:"email"`
+	PhoneNumber       string `json:"phone_number"`
+}
+
+// oidcAuthenticator logs in with the OpenID Connect authorization code flow protected by PKCE.
+// The provider metadata is discovered on first use, the ID token is verified with the keys of the provider.
+type oidcAuthenticator struct {
+	opts   *OIDCOptions
+	client *http.Client
+
+	mu            sync.Mutex
+	discovery     *oidcDiscovery
+	keys          map[string]*token.Key
+	keysFetchedAt time.Time
+}
+
+func NewOIDCAuthenticator(opts *OIDCOptions) RedirectAuthenticator {
+	return &oidcAuthenticator{
+		opts:   opts,
+		client: &http.Client{Timeout: oidcHTTPTimeout},
+		keys:   map[string]*token.Key{},
+	}
+}
+
+func (a *oidcAuthenticator) Name() string {
+	return a.opts.Name
+}
+
+func (a *oidcAuthenticator) Type() string {
+	return TypeOIDC
+}
+
+func (a *oidcAuthenticator) AuthCodeURL(ctx context.Context, state, nonce, codeVerifier string) (string, error) {
+	cfg, err := a.config(ctx)
+	if err != nil {
+		return "", err
+	}
+	return cfg.AuthCodeURL(state, oauth2.SetAuthURLParam("nonce", nonce), oauth2.S256ChallengeOption(codeVerifier)), nil
+}
+
+func (a *oidcAuthenticator) Exchange(ctx context.Context, code, nonce, codeVerifier string) (*Identity, error) {
+	cfg, err := a.config(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	t, err := cfg.Exchange(context.WithValue(ctx, oauth2.HTTPClient, a.client), code, oauth2.VerifierOption(codeVerifier))
+	if err != nil {
+		return nil, fmt.Errorf("exchange authorization code: %w", err)
+	}
+	rawIDToken, _ := t.Extra("id_token").(string)
+	if rawIDToken == "" {
+		return nil, fmt.Errorf("%w: no id_token in the token response", ErrInvalidIDToken)
+	}
+
+	claims, err := a.verify(ctx, rawIDToken, nonce)
+	if err != nil {
+		return nil, err
+	}
+
+	username := claims.PreferredUsername
+	if username == "" {
+		username = claims.Email
+	}
+	if username == "" {
+		username = claims.Subject
+	}
+	return &Identity{
+		Provider:   a.Name(),
+		ExternalID: claims.Subject,
+		Username:   username,
+		Email:      claims.Email,
+		Tel:        claims.PhoneNumber,
+		Role:       model.UserRoleNormal,
+	}, nil
+}
+
+// verify checks the signature, issuer, audience, expiry and nonce of the ID token
+func (a *oidcAuthenticator) verify(ctx context.Context, rawIDToken, nonce string) (*idTokenClaims, error) {
+	d, err := a.discover(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	claims := &idTokenClaims{}
+	_, err = jwt.ParseWithClaims(rawIDToken, claims, func(t *jwt.Token) (interface{}, error) {
+		kid, _ := t.Header["kid"].(string)
+		key, err := a.key(ctx, kid)
+		if err != nil {
+			return nil, err
+		}
+		if key.Method.Alg() != t.Method.Alg() {
+			return nil, fmt.Errorf("alg %s doesn't match the key %s", t.Method.Alg(), kid)
+		}
+		return key.Public, nil
+	},
+		jwt.WithIssuer(d.Issuer),
+		jwt.WithAudience(a.opts.ClientID),
+		jwt.WithExpirationRequired(),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidIDToken, err)
+	}
+	if claims.Subject == "" {
+		return nil, fmt.Errorf("%w: no sub claim", ErrInvalidIDToken)
+	}
+	if claims.Nonce != nonce {
+		return nil, fmt.Errorf("%w: nonce mismatch", ErrInvalidIDToken)
+	}
+	return claims, nil
+}
+
+func (a *oidcAuthenticator) config(ctx context.Context) (*oauth2.Config, error) {
+	d, err := a.discover(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &oauth2.Config{
+		ClientID:     a.opts.ClientID,
+		ClientSecret: a.opts.ClientSecret,
+		Endpoint: oauth2.Endpoint{
+			AuthURL:  d.AuthorizationEndpoint,
+			TokenURL: d.TokenEndpoint,
+		},
+		RedirectURL: a.opts.RedirectURL,
+		Scopes:      a.opts.Scopes,
+	}, nil
+}
+
+// discover fetches the provider metadata once, a failure is retried by the next login
+func (a *oidcAuthenticator) discover(ctx context.Context) (*oidcDiscovery, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.discovery != nil {
+		return a.discovery, nil
+	}
+
+	d := &oidcDiscovery{}
+	if err := a.getJSON(ctx, strings.TrimSuffix(a.opts.Issuer, "/")+"/.well-known/openid-configuration", d); err != nil {
+		return nil, fmt.Errorf("discover oidc provider: %w", err)
+	}
+	// 元数据中的 issuer 必须与配置一致, 防止被替换为其他 provider
+	if d.Issuer != a.opts.Issuer {
+		return nil, fmt.Errorf("oidc issuer %q doesn't match the configured %q", d.Issuer, a.opts.Issuer)
+	}
+	if d.AuthorizationEndpoint == "" || d.TokenEndpoint == "" || d.JWKSURI == "" {
+		return nil, errors.New("incomplete oidc provider metadata")
+	}
+	a.discovery = d
+	return d, nil
+}
+
+// key returns the provider key of the kid, the keys are refetched for an unknown kid so that
+// a key rotation of the provider is picked up.
+func (a *oidcAuthenticator) key(ctx context.Context, kid string) (*token.Key, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if key := a.findKey(kid); key != nil {
+		return key, nil
+	}
+	if time.Since(a.keysFetchedAt) < jwksRefreshInterval {
+		return nil, fmt.Errorf("unknown key %q", kid)
+	}
+
+	set := token.JWKSet{}
+	if err := a.getJSON(ctx, a.discovery.JWKSURI, &set); err != nil {
+		return nil, fmt.Errorf("fetch oidc keys: %w", err)
+	}
+	keys := map[string]*token.Key{}
+	for _, jwk := range set.Keys {
+		if jwk.Use != "" && jwk.Use != "sig" {
+			continue
+		}
+		key, err := token.ParseJWK(jwk)
+		if err != nil {
+			zap.L().Warn("skip oidc key", zap.String("kid", jwk.Kid), zap.Error(err))
+			continue
+		}
+		keys[key.ID] = key
+	}
+	a.keys = keys
+	a.keysFetchedAt = time.Now()
+
+	if key := a.findKey(kid); key != nil {
+		return key, nil
+	}
+	return nil, fmt.Errorf("unknown key %q", kid)
+}
+
+// findKey returns the key of the kid, or the only key if the token has no kid
+func (a *oidcAuthenticator) findKey(kid string) *token.Key {
+	if kid == "" && len(a.keys) == 1 {
+		for _, key := range a.keys {
+			return key
+		}
+	}
+	return a.keys[kid]
+}
+
+func (a *oidcAuthenticator) getJSON(ctx context.Context, url string, v interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := a.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("GET %s: %s", url, resp.Status)
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
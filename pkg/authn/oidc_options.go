@@ -0,0 +1,60 @@
+package authn
+
+import (
+	"fmt"
+	"net/url"
+
+	"github.com/spf13/pflag"
+)
+
+// maxProviderName is the length of model.User.AuthSource
+const maxProviderName = 16
+
+// OIDCOptions configures an OpenID Connect provider, it is disabled if Issuer is empty
+type OIDCOptions struct {
+	// Name is the provider name shown on the login page and stored as the auth source of its users
+	Name         string
+	Issuer       string
+	ClientID     string
+	ClientSecret string
+	// RedirectURL is the console page receiving the authorization code, it posts the code to the callback API
+	RedirectURL string
+	Scopes      []string
+}
+
+func NewOIDCOptions() *OIDCOptions {
+	return &OIDCOptions{
+		Name:   TypeOIDC,
+		Scopes: []string{"openid", "profile", "email"},
+	}
+}
+
+func (o *OIDCOptions) Validate() []error {
+	var errs []error
+	if o.Issuer == "" {
+		return errs
+	}
+	if o.Name == "" || len(o.Name) > maxProviderName {
+		errs = append(errs, fmt.Errorf("oidc name must have 1 to %d characters", maxProviderName))
+	}
+	if _, err := url.ParseRequestURI(o.Issuer); err != nil {
+		errs = append(errs, fmt.Errorf("invalid oidc issuer: %w", err))
+	}
+	if o.ClientID == "" {
+		errs = append(errs, fmt.Errorf("oidc client id is empty"))
+	}
+	if _, err := url.ParseRequestURI(o.RedirectURL); err != nil {
+		errs = append(errs, fmt.Errorf("invalid oidc redirect url: %w", err))
+	}
+	return errs
+}
+
+// AddFlags add option flags to command line flags
+func (o *OIDCOptions) AddFlags(fs *pflag.FlagSet) {
+	fs.StringVar(&o.Name, "oidc-name", o.Name, "The name of the OpenID Connect provider, shown on the login page.")
+	fs.StringVar(&o.Issuer, "oidc-issuer", o.Issuer, "The issuer URL of the OpenID Connect provider. If left blank, OpenID Connect login is disabled.")
+	fs.StringVar(&o.ClientID, "oidc-client-id", o.ClientID, "The client ID registered at the OpenID Connect provider.")
+	fs.StringVar(&o.ClientSecret, "oidc-client-secret", o.ClientSecret, "The client secret, leave it blank for a public client.")
+	fs.StringVar(&o.RedirectURL, "oidc-redirect-url", o.RedirectURL, "The console page the provider redirects to after login.")
+	fs.StringSliceVar(&o.Scopes, "oidc-scopes", o.Scopes, "The scopes requested from the OpenID Connect provider.")
+}
@@ -0,0 +1,186 @@
+package authn
+
+import (
+	"asyncKubeManager/pkg/model"
+	"asyncKubeManager/pkg/token"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/oauth2"
+)
+
+// fakeProvider is an OpenID provider issuing an ID token for the code "good-code"
+type fakeProvider struct {
+	*httptest.Server
+	key       *token.Key
+	challenge string
+	nonce     string
+	audience  string
+}
+
+func newFakeProvider(t *testing.T) *fakeProvider {
+	private, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	der, err := x509.MarshalPKCS8PrivateKey(private)
+	require.NoError(t, err)
+	key, err := token.ParsePrivateKeyPEM(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}))
+	require.NoError(t, err)
+
+	p := &fakeProvider{key: key, audience: "console"}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(oidcDiscovery{
+			Issuer:                p.URL,
+			AuthorizationEndpoint: p.URL + "/authorize",
+			TokenEndpoint:         p.URL + "/token",
+			JWKSURI:               p.URL + "/jwks",
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		jwk, _ := p.key.JWK()
+		_ = json.NewEncoder(w).Encode(token.JWKSet{Keys: []token.JWK{jwk}})
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		sum := sha256.Sum256([]byte(r.FormValue("code_verifier")))
+		if r.FormValue("code") != "good-code" || base64.RawURLEncoding.EncodeToString(sum[:]) != p.challenge {
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = w.Write([]byte(`{"error":"invalid_grant"}`))
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{
+			"access_token": "access",
+			"token_type":   "Bearer",
+			"id_token":     p.idToken(t),
+		})
+	})
+	p.Server = httptest.NewServer(mux)
+	t.Cleanup(p.Close)
+	return p
+}
+
+func (p *fakeProvider) idToken(t *testing.T) string {
+	t.Helper()
+	tk := jwt.NewWithClaims(p.key.Method, idTokenClaims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    p.URL,
+			Subject:   "00u1a2b3",
+			Audience:  jwt.ClaimStrings{p.audience},
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Minute)),
+		},
+		Nonce:             p.nonce,
+		PreferredUsername: "alice",
+		Email:             "alice@example.com",
+	})
+	tk.Header["kid"] = p.key.ID
+	s, err := tk.SignedString(p.key.Private)
+	require.NoError(t, err)
+	return s
+}
+
+func TestOIDCAuthenticator(t *testing.T) {
+	p := newFakeProvider(t)
+	a := NewOIDCAuthenticator(&OIDCOptions{
+		Name:        "sso",
+		Issuer:      p.URL,
+		ClientID:    "console",
+		RedirectURL: "https://console.example.com/login/callback",
+		Scopes:      []string{"openid"},
+	})
+	ctx := context.Background()
+
+	verifier := oauth2.GenerateVerifier()
+	authURL, err := a.AuthCodeURL(ctx, "state-1", "nonce-1", verifier)
+	require.NoError(t, err)
+	u, err := url.Parse(authURL)
+	require.NoError(t, err)
+	assert.Equal(t, p.URL+"/authorize", u.Scheme+"://"+u.Host+u.Path)
+	assert.Equal(t, "state-1", u.Query().Get("state"))
+	assert.Equal(t, "S256", u.Query().Get("code_challenge_method"))
+	p.challenge, p.nonce = u.Query().Get("code_challenge"), u.Query().Get("nonce")
+
+	identity, err := a.Exchange(ctx, "good-code", "nonce-1", verifier)
+	require.NoError(t, err)
+	assert.Equal(t, &Identity{
+		Provider:   "sso",
+		ExternalID: "00u1a2b3",
+		Username:   "alice",
+		Email:      "alice@example.com",
+		Role:       model.UserRoleNormal,
+	}, identity)
+
+	// 错误的 PKCE verifier 被 provider 拒绝
+	_, err = a.Exchange(ctx, "good-code", "nonce-1", oauth2.GenerateVerifier())
+	assert.Error(t, err)
+
+	// 重放其他登录的 ID token 时 nonce 不匹配
+	_, err = a.Exchange(ctx, "good-code", "nonce-2", verifier)
+	assert.ErrorIs(t, err, ErrInvalidIDToken)
+
+	// 签发给其他 client 的 ID token
+	p.audience = "other"
+	_, err = a.Exchange(ctx, "good-code", "nonce-1", verifier)
+	assert.ErrorIs(t, err, ErrInvalidIDToken)
+}
+
+type fakePasswordAuthenticator struct {
+	name  string
+	users map[string]string
+}
+
+func (a *fakePasswordAuthenticator) Name() string { return a.name }
+func (a *fakePasswordAuthenticator) Type() string { return TypeLocal }
+
+func (a *fakePasswordAuthenticator) Authenticate(ctx context.Context, username, password string) (*Identity, error) {
+	pwd, ok := a.users[username]
+	if !ok {
+		return nil, ErrUserNotFound
+	}
+	if pwd != password {
+		return nil, ErrInvalidCredentials
+	}
+	return &Identity{Provider: a.name, ExternalID: username, Username: username}, nil
+}
+
+func TestRegistry_Authenticate(t *testing.T) {
+	first := &fakePasswordAuthenticator{name: "first", users: map[string]string{"bob": "1"}}
+	second := &fakePasswordAuthenticator{name: "second", users: map[string]string{"bob": "2", "carol": "3"}}
+	r, err := NewRegistry(first, second, NewOIDCAuthenticator(NewOIDCOptions()))
+	require.NoError(t, err)
+
+	identity, err := r.Authenticate(context.Background(), "", "carol", "3")
+	require.NoError(t, err)
+	assert.Equal(t, "second", identity.Provider)
+
+	// 第一个认证方式认识该用户时不再尝试后面的认证方式
+	_, err = r.Authenticate(context.Background(), "", "bob", "2")
+	assert.ErrorIs(t, err, ErrInvalidCredentials)
+	identity, err = r.Authenticate(context.Background(), "second", "bob", "2")
+	require.NoError(t, err)
+	assert.Equal(t, "second", identity.Provider)
+
+	_, err = r.Authenticate(context.Background(), "", "dave", "4")
+	assert.ErrorIs(t, err, ErrUserNotFound)
+	_, err = r.Authenticate(context.Background(), "oidc", "bob", "1")
+	assert.ErrorIs(t, err, ErrUnknownProvider)
+	_, err = r.Authenticate(context.Background(), "unknown", "bob", "1")
+	assert.ErrorIs(t, err, ErrUnknownProvider)
+
+	_, err = NewRegistry(first, first)
+	assert.Error(t, err)
+}
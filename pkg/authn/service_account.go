@@ -0,0 +1,127 @@
+package authn
+
+import (
+	"asyncKubeManager/pkg/dao"
+	"asyncKubeManager/pkg/dbresolver"
+	"asyncKubeManager/pkg/model"
+	"asyncKubeManager/pkg/utils"
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"time"
+
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+// ServiceAccountSecretPrefix starts the client secrets, so that secret scanners can recognize leaked ones
+const ServiceAccountSecretPrefix = "akm_sa_"
+
+// serviceAccountSecretBytes is the random length of a client secret
+const serviceAccountSecretBytes = 32
+
+// ErrInvalidClient is returned for unknown or disabled service accounts and wrong secrets
+var ErrInvalidClient = errors.New("invalid client credentials")
+
+// ServiceAccounts creates the service accounts and authenticates their client credentials
+type ServiceAccounts struct {
+	dbResolver *dbresolver.DBResolver
+	now        func() time.Time
+}
+
+func NewServiceAccounts(dbResolver *dbresolver.DBResolver) *ServiceAccounts {
+	return &ServiceAccounts{
+		dbResolver: dbResolver,
+		now:        time.Now,
+	}
+}
+
+// Create inserts the service account and returns its client secret, which is shown only once.
+// An account of a project is added to the project as a member with its ProjectRole.
+func (s *ServiceAccounts) Create(ctx context.Context, sa *model.ServiceAccount) (string, error) {
+	secret, err := generateServiceAccountSecret()
+	if err != nil {
+		return "", err
+	}
+	sa.UID = utils.NextID()
+	sa.SecretHash = utils.SHA256Hex(secret)
+	sa.Status = model.UserStatusEnabled
+
+	err = s.dbResolver.GetDB().Transaction(func(tx *gorm.DB) error {
+		if err := dao.InsertServiceAccountWithDB(ctx, tx, sa); err != nil {
+			return err
+		}
+		if sa.ProjectID == 0 {
+			return nil
+		}
+		_, err := dao.InsertProjectMemberWithDB(ctx, tx, sa.ProjectID, sa.UID, sa.ProjectRole)
+		return err
+	})
+	if err != nil {
+		return "", err
+	}
+	return secret, nil
+}
+
+// RotateSecret replaces the client secret of the service account, the old secret stops working at once
+func (s *ServiceAccounts) RotateSecret(ctx context.Context, uid string) (string, error) {
+	secret, err := generateServiceAccountSecret()
+	if err != nil {
+		return "", err
+	}
+	if err = dao.UpdateServiceAccountByUID(ctx, s.dbResolver, uid, map[string]interface{}{
+		"secret_hash": utils.SHA256Hex(secret),
+	}); err != nil {
+		return "", err
+	}
+	return secret, nil
+}
+
+// SetProjectRole changes the role of a project service account in its project
+func (s *ServiceAccounts) SetProjectRole(ctx context.Context, sa *model.ServiceAccount, role model.ProjectRole) error {
+	return s.dbResolver.GetDB().Transaction(func(tx *gorm.DB) error {
+		if err := dao.UpdateServiceAccountByUIDWithDB(ctx, tx, sa.UID, map[string]interface{}{"project_role": role}); err != nil {
+			return err
+		}
+		return tx.WithContext(ctx).Model(&model.ProjectMember{}).
+			Where("project_id = ? AND uid = ?", sa.ProjectID, sa.UID).
+			Update("role", role).Error
+	})
+}
+
+// Delete deletes the service account together with its project membership
+func (s *ServiceAccounts) Delete(ctx context.Context, sa *model.ServiceAccount) error {
+	return s.dbResolver.GetDB().Transaction(func(tx *gorm.DB) error {
+		return dao.DeleteServiceAccountWithDB(ctx, tx, sa)
+	})
+}
+
+// Authenticate verifies the client credentials of an enabled service account
+func (s *ServiceAccounts) Authenticate(ctx context.Context, clientID, clientSecret string) (*model.ServiceAccount, error) {
+	found, sa, err := dao.GetServiceAccountByUID(ctx, s.dbResolver, clientID)
+	if err != nil {
+		return nil, err
+	}
+	if !found || sa.Status != model.UserStatusEnabled {
+		return nil, ErrInvalidClient
+	}
+	if subtle.ConstantTimeCompare([]byte(utils.SHA256Hex(clientSecret)), []byte(sa.SecretHash)) != 1 {
+		return nil, ErrInvalidClient
+	}
+
+	if err = dao.UpdateServiceAccountLastUsed(ctx, s.dbResolver, sa.UID, s.now()); err != nil {
+		zap.L().Warn("UpdateServiceAccountLastUsed", zap.String("uid", sa.UID), zap.Error(err))
+	}
+	return sa, nil
+}
+
+func generateServiceAccountSecret() (string, error) {
+	b := make([]byte, serviceAccountSecretBytes)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("generate client secret error %w", err)
+	}
+	return ServiceAccountSecretPrefix + base64.RawURLEncoding.EncodeToString(b), nil
+}
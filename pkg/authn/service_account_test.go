@@ -0,0 +1,72 @@
+package authn
+
+import (
+	"asyncKubeManager/pkg/dao"
+	"asyncKubeManager/pkg/model"
+	"asyncKubeManager/pkg/testutil"
+	"asyncKubeManager/pkg/token"
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+func TestServiceAccounts(t *testing.T) {
+	ctx := token.WithPayload(context.Background(), token.Info{UID: "alice"})
+	dr := testutil.NewDBResolver(t)
+	project, err := dao.InsertProjectWithDB(ctx, dr.GetDB(), "p1", "ci", "ci", "")
+	require.NoError(t, err)
+	s := NewServiceAccounts(dr)
+
+	sa := &model.ServiceAccount{
+		Name:        "pipeline",
+		ProjectID:   project.ID,
+		ProjectRole: model.ProjectRoleMember,
+		Role:        model.UserRoleServiceAccount,
+	}
+	secret, err := s.Create(ctx, sa)
+	require.NoError(t, err)
+	assert.Equal(t, "alice", sa.Creator)
+
+	// service account 是项目成员
+	found, member, err := dao.GetProjectMember(ctx, dr, project.ID, sa.UID)
+	require.NoError(t, err)
+	require.True(t, found)
+	assert.Equal(t, model.ProjectRoleMember, member.Role)
+
+	got, err := s.Authenticate(ctx, sa.UID, secret)
+	require.NoError(t, err)
+	assert.Equal(t, "pipeline", got.Name)
+	_, err = s.Authenticate(ctx, sa.UID, "wrong")
+	assert.ErrorIs(t, err, ErrInvalidClient)
+
+	rotated, err := s.RotateSecret(ctx, sa.UID)
+	require.NoError(t, err)
+	_, err = s.Authenticate(ctx, sa.UID, secret)
+	assert.ErrorIs(t, err, ErrInvalidClient)
+	_, err = s.Authenticate(ctx, sa.UID, rotated)
+	require.NoError(t, err)
+
+	require.NoError(t, dao.UpdateServiceAccountByUID(ctx, dr, sa.UID, map[string]interface{}{"status": model.UserStatusDisabled}))
+	_, err = s.Authenticate(ctx, sa.UID, rotated)
+	assert.ErrorIs(t, err, ErrInvalidClient)
+
+	// 同一项目内的名字由唯一索引保证不重复
+	_, err = s.Create(ctx, &model.ServiceAccount{Name: "pipeline", ProjectID: project.ID, Role: model.UserRoleServiceAccount})
+	assert.ErrorIs(t, err, gorm.ErrDuplicatedKey)
+
+	// 删除后项目成员关系一并删除, 审计日志仍能查到
+	require.NoError(t, s.Delete(ctx, sa))
+	found, _, err = dao.GetProjectMember(ctx, dr, project.ID, sa.UID)
+	require.NoError(t, err)
+	assert.False(t, found)
+	sas, err := dao.ListServiceAccountsByUIDs(ctx, dr, []string{sa.UID})
+	require.NoError(t, err)
+	assert.Len(t, sas, 1)
+
+	// 删除的 service account 不再占用名字
+	_, err = s.Create(ctx, &model.ServiceAccount{Name: "pipeline", ProjectID: project.ID, Role: model.UserRoleServiceAccount})
+	assert.NoError(t, err)
+}
@@ -0,0 +1,64 @@
+package captcha
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/spf13/pflag"
+)
+
+const (
+	DriverMath   = "math"
+	DriverString = "string"
+	DriverAudio  = "audio"
+)
+
+// Options chooses the captcha driver and its difficulty
+type Options struct {
+	// Driver is one of math, string and audio
+	Driver string
+	// Length is the characters of a string captcha or the digits of an audio captcha, ignored by math
+	Length int
+	// Noise is the noise characters drawn on a string or math captcha, ignored by audio
+	Noise int
+	// TTL is how long a captcha can be verified
+	TTL time.Duration
+	// AudioLanguage is the language of an audio captcha, one of en, ja, ru and zh
+	AudioLanguage string
+}
+
+// NewDefaultOptions returns the options of a math captcha, which is the default since the beginning
+func NewDefaultOptions() *Options {
+	return &Options{
+		Driver:        DriverMath,
+		Length:        4,
+		Noise:         0,
+		TTL:           time.Minute,
+		AudioLanguage: "zh",
+	}
+}
+
+func (o *Options) Validate() []error {
+	var errs []error
+	switch o.Driver {
+	case DriverMath, DriverString, DriverAudio:
+	default:
+		errs = append(errs, fmt.Errorf("invalid captcha driver %q", o.Driver))
+	}
+	if o.Length <= 0 || o.Noise < 0 {
+		errs = append(errs, fmt.Errorf("invalid captcha length or noise"))
+	}
+	if o.TTL <= 0 {
+		errs = append(errs, fmt.Errorf("invalid captcha ttl"))
+	}
+	return errs
+}
+
+// AddFlags add option flags to command line flags
+func (o *Options) AddFlags(fs *pflag.FlagSet) {
+	fs.StringVar(&o.Driver, "captcha-driver", o.Driver, "The captcha driver, one of math, string and audio.")
+	fs.IntVar(&o.Length, "captcha-length", o.Length, "The characters of a string captcha or the digits of an audio captcha.")
+	fs.IntVar(&o.Noise, "captcha-noise", o.Noise, "The noise characters drawn on a math or string captcha, more is harder to read.")
+	fs.DurationVar(&o.TTL, "captcha-ttl", o.TTL, "How long a captcha can be verified.")
+	fs.StringVar(&o.AudioLanguage, "captcha-audio-language", o.AudioLanguage, "The language of an audio captcha, one of en, ja, ru and zh.")
+}
@@ -1,46 +1,73 @@
 package captcha
 
 import (
-	"github.com/mojocn/base64Captcha"
+	"asyncKubeManager/pkg/client/cache"
+	"fmt"
 	"image/color"
 	"strings"
 	"time"
+
+	"github.com/mojocn/base64Captcha"
 )
 
+// NewDriver returns the driver chosen by the options
+func NewDriver(o *Options) (base64Captcha.Driver, error) {
+	bgColor := &color.RGBA{
+		R: 255,
+		G: 255,
+		B: 255,
+		A: 255,
+	}
+	switch o.Driver {
+	case DriverMath:
+		return base64Captcha.NewDriverMath(100, 200, o.Noise, 0, bgColor, nil, nil), nil
+	case DriverString:
+		return base64Captcha.NewDriverString(
+			100, 200, o.Noise,
+			base64Captcha.OptionShowHollowLine,
+			o.Length,
+			base64Captcha.TxtAlphabet+base64Captcha.TxtNumbers,
+			bgColor, nil, nil), nil
+	case DriverAudio:
+		return base64Captcha.NewDriverAudio(o.Length, o.AudioLanguage), nil
+	default:
+		return nil, fmt.Errorf("invalid captcha driver %q", o.Driver)
+	}
+}
+
 type store struct {
 	base64Captcha.Store
 }
 
 func (s *store) Verify(id, answer string, clear bool) bool {
 	v := s.Get(id, clear)
-	return strings.ToLower(v) == strings.ToLower(answer)
+	return v != "" && strings.ToLower(v) == strings.ToLower(answer)
 }
 
 var (
-	defaultDriver base64Captcha.Driver = base64Captcha.NewDriverMath(
-		100, 200, 0,
-		0,
-		&color.RGBA{
-			R: 255,
-			G: 255,
-			B: 255,
-			A: 255,
-		}, nil, nil)
-	// defaultDriver base64Captcha.Driver = base64Captcha.NewDriverString(
-	// 	100, 200, 3,
-	// 	base64Captcha.OptionShowHollowLine,
-	// 	4,
-	// 	base64Captcha.TxtAlphabet+base64Captcha.TxtNumbers,
-	// 	&color.RGBA{
-	// 		R: 40,
-	// 		G: 30,
-	// 		B: 89,
-	// 		A: 29,
-	// 	}, nil, nil)
-
-	defaultStore = &store{Store: base64Captcha.NewMemoryStore(base64Captcha.GCLimitNumber, 1*time.Minute)}
+	defaultDriver, _ = NewDriver(NewDefaultOptions())
+
+	defaultStore base64Captcha.Store = &store{Store: base64Captcha.NewMemoryStore(base64Captcha.GCLimitNumber, 1*time.Minute)}
 )
 
+// Init sets the driver and the store of the captcha. The answers are kept in cacheClient
+// if it is not nil, so that the replicas sharing a redis can verify each other's captcha,
+// otherwise they are kept in memory.
+func Init(o *Options, cacheClient cache.Interface) error {
+	driver, err := NewDriver(o)
+	if err != nil {
+		return err
+	}
+	defaultDriver = driver
+
+	if cacheClient != nil {
+		defaultStore = NewCacheStore(cacheClient, o.TTL)
+	} else {
+		defaultStore = &store{Store: base64Captcha.NewMemoryStore(base64Captcha.GCLimitNumber, o.TTL)}
+	}
+	return nil
+}
+
 func ReplaceDriver(driver base64Captcha.Driver) {
 	defaultDriver = driver
 }
@@ -0,0 +1,71 @@
+package captcha
+
+import (
+	"asyncKubeManager/pkg/client/cache"
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/mojocn/base64Captcha"
+	"go.uber.org/zap"
+)
+
+const captchaKeyPrefix = "captcha:"
+
+// getDelScript returns the value of KEYS[1] and deletes it atomically, an empty string if it doesn't exist
+const getDelScript = `
+local val = redis.call('GET', KEYS[1])
+if not val then
+	return ''
+end
+redis.call('DEL', KEYS[1])
+return val
+`
+
+// cacheStore keeps the captcha answers in a cache.Interface, so that a captcha created by
+// one replica can be verified by another. An answer expires after ttl and is deleted
+// when it is verified, whether the answer is correct or not.
+type cacheStore struct {
+	cache cache.Interface
+	ttl   time.Duration
+}
+
+// NewCacheStore returns a base64Captcha.Store keeping the answers in cacheClient for ttl
+func NewCacheStore(cacheClient cache.Interface, ttl time.Duration) base64Captcha.Store {
+	return &cacheStore{
+		cache: cacheClient,
+		ttl:   ttl,
+	}
+}
+
+func (s *cacheStore) Set(id string, value string) error {
+	return s.cache.Set(context.Background(), captchaKeyPrefix+id, value, s.ttl)
+}
+
+func (s *cacheStore) Get(id string, clear bool) string {
+	ctx := context.Background()
+	key := captchaKeyPrefix + id
+	if !clear {
+		val, _ := s.cache.Get(ctx, key)
+		return val
+	}
+
+	val, err := s.cache.Eval(ctx, getDelScript, []string{key})
+	if errors.Is(err, cache.ErrScriptNotSupported) {
+		// 内存缓存只在本进程内使用, 先读后删即可
+		val, _ = s.cache.Get(ctx, key)
+		err = s.cache.Del(ctx, key)
+	}
+	if err != nil {
+		zap.L().Error("captcha store get failed", zap.String("id", id), zap.Error(err))
+		return ""
+	}
+	answer, _ := val.(string)
+	return answer
+}
+
+func (s *cacheStore) Verify(id, answer string, clear bool) bool {
+	v := s.Get(id, clear)
+	return v != "" && strings.ToLower(v) == strings.ToLower(answer)
+}
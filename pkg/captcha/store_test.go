@@ -0,0 +1,69 @@
+package captcha
+
+import (
+	"testing"
+	"time"
+
+	"asyncKubeManager/pkg/client/cache"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCacheStore(t *testing.T) {
+	mr := miniredis.RunT(t)
+	stopCh := make(chan struct{})
+	t.Cleanup(func() { close(stopCh) })
+	cacheClient, err := cache.NewRedisClient(&cache.Options{Host: mr.Addr()}, stopCh)
+	require.NoError(t, err)
+
+	// 两个副本共用同一个 redis
+	s1 := NewCacheStore(cacheClient, time.Minute)
+	s2 := NewCacheStore(cacheClient, time.Minute)
+
+	require.NoError(t, s1.Set("id1", "AbC1"))
+	assert.Equal(t, "AbC1", s2.Get("id1", false))
+	assert.True(t, s2.Verify("id1", "abc1", true))
+	// 只能校验一次
+	assert.False(t, s1.Verify("id1", "abc1", true))
+
+	// 答错也会删除
+	require.NoError(t, s1.Set("id2", "42"))
+	assert.False(t, s2.Verify("id2", "41", true))
+	assert.False(t, s2.Verify("id2", "42", true))
+
+	require.NoError(t, s1.Set("id3", "42"))
+	mr.FastForward(time.Minute)
+	assert.False(t, s2.Verify("id3", "42", true))
+
+	assert.False(t, s2.Verify("missing", "", true))
+}
+
+func TestCacheStore_Memory(t *testing.T) {
+	s := NewCacheStore(cache.NewMemoryClient(), time.Minute)
+
+	require.NoError(t, s.Set("id1", "42"))
+	assert.True(t, s.Verify("id1", "42", true))
+	assert.False(t, s.Verify("id1", "42", true))
+}
+
+func TestNewDriver(t *testing.T) {
+	for _, driver := range []string{DriverMath, DriverString, DriverAudio} {
+		o := NewDefaultOptions()
+		o.Driver = driver
+		assert.Empty(t, o.Validate())
+
+		d, err := NewDriver(o)
+		require.NoError(t, err)
+		_, q, a := d.GenerateIdQuestionAnswer()
+		assert.NotEmpty(t, q)
+		assert.NotEmpty(t, a)
+	}
+
+	o := NewDefaultOptions()
+	o.Driver = "image"
+	assert.NotEmpty(t, o.Validate())
+	_, err := NewDriver(o)
+	assert.Error(t, err)
+}
@@ -2,12 +2,16 @@ package cache
 
 import (
 	"context"
+	"errors"
 	"time"
 )
 
 // NeverExpire represents a never expired time
 var NeverExpire = time.Duration(0)
 
+// ErrScriptNotSupported is returned by Eval of the clients that can't run lua scripts
+var ErrScriptNotSupported = errors.New("lua scripts are not supported by the cache client")
+
 type Interface interface {
 	// Keys retrieves all keys match the given pattern
 	Keys(ctx context.Context, pattern string) ([]string, error)
@@ -15,9 +19,18 @@ type Interface interface {
 	// Get retrieves the value of the given key, return error if key doesn't exist
 	Get(ctx context.Context, key string) (string, error)
 
+	// GetDel retrieves the value of the given key and deletes the key atomically, return error if key doesn't exist
+	GetDel(ctx context.Context, key string) (string, error)
+
 	// Set sets the value and living duration of the given key, zero duration means never expire
 	Set(ctx context.Context, key string, value string, duration time.Duration) error
 
+	// SetNX sets the value of the given key only if it doesn't exist yet, returns whether the key was set
+	SetNX(ctx context.Context, key string, value string, duration time.Duration) (bool, error)
+
+	// SetXX sets the value of the given key only if it already exists, returns whether the key was set
+	SetXX(ctx context.Context, key string, value string, duration time.Duration) (bool, error)
+
 	// Del deletes the given key, no error returned if the key doesn't exists
 	Del(ctx context.Context, keys ...string) error
 
@@ -26,4 +39,20 @@ type Interface interface {
 
 	// Expire updates object's expiration time, return err if key doesn't exist
 	Expire(ctx context.Context, key string, duration time.Duration) error
+
+	// Incr increments the integer value of the given key by one and returns the new value,
+	// a missing key is set to 1 and never expires, the expiration time of an existing key is kept
+	Incr(ctx context.Context, key string) (int64, error)
+
+	// SAdd adds the members to the set of the given key, a missing key is created and never expires
+	SAdd(ctx context.Context, key string, members ...string) error
+
+	// SRem removes the members from the set of the given key
+	SRem(ctx context.Context, key string, members ...string) error
+
+	// SMembers retrieves the members of the set of the given key, empty if the key doesn't exist
+	SMembers(ctx context.Context, key string) ([]string, error)
+
+	// Eval runs a lua script atomically, integers are returned as int64 and arrays as []interface{}
+	Eval(ctx context.Context, script string, keys []string, args ...interface{}) (interface{}, error)
 }
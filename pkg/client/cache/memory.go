@@ -0,0 +1,254 @@
+package cache
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"strconv"
+	"sync"
+	"time"
+)
+
+type cacheItem struct {
+	value string
+	// members is the set of SAdd, nil for the keys set by Set
+	members  map[string]struct{}
+	expireAt time.Time
+}
+
+func (i cacheItem) expired(now time.Time) bool {
+	return !i.expireAt.IsZero() && !now.Before(i.expireAt)
+}
+
+// sweepInterval is how often Set removes the expired keys that were never read again
+const sweepInterval = time.Minute
+
+// MemoryClient is an in-memory Interface, keys expire like they do in redis.
+// It is used when redis is disabled, the data isn't shared between replicas.
+type MemoryClient struct {
+	mu        sync.Mutex
+	items     map[string]cacheItem
+	lastSweep time.Time
+	// Now returns the current time, tests may replace it to control expiration
+	Now func() time.Time
+}
+
+var _ Interface = &MemoryClient{}
+
+func NewMemoryClient() *MemoryClient {
+	return &MemoryClient{
+		items: map[string]cacheItem{},
+		Now:   time.Now,
+	}
+}
+
+// get returns the item of the key, expired items are removed. The caller must hold the lock.
+func (c *MemoryClient) get(key string) (cacheItem, bool) {
+	item, ok := c.items[key]
+	if ok && item.expired(c.Now()) {
+		delete(c.items, key)
+		return cacheItem{}, false
+	}
+	return item, ok
+}
+
+// sweep removes the expired items at most once per sweepInterval. The caller must hold the lock.
+func (c *MemoryClient) sweep() {
+	now := c.Now()
+	if now.Sub(c.lastSweep) < sweepInterval {
+		return
+	}
+	c.lastSweep = now
+	for key, item := range c.items {
+		if item.expired(now) {
+			delete(c.items, key)
+		}
+	}
+}
+
+func (c *MemoryClient) expireAt(duration time.Duration) time.Time {
+	if duration == NeverExpire {
+		return time.Time{}
+	}
+	return c.Now().Add(duration)
+}
+
+func (c *MemoryClient) Keys(ctx context.Context, pattern string) ([]string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var keys []string
+	for key := range c.items {
+		if _, ok := c.get(key); !ok {
+			continue
+		}
+		matched, err := path.Match(pattern, key)
+		if err != nil {
+			return nil, err
+		}
+		if matched {
+			keys = append(keys, key)
+		}
+	}
+	return keys, nil
+}
+
+func (c *MemoryClient) Get(ctx context.Context, key string) (string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	item, ok := c.get(key)
+	if !ok {
+		return "", fmt.Errorf("key %s not found", key)
+	}
+	return item.value, nil
+}
+
+func (c *MemoryClient) GetDel(ctx context.Context, key string) (string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	item, ok := c.get(key)
+	if !ok {
+		return "", fmt.Errorf("key %s not found", key)
+	}
+	delete(c.items, key)
+	return item.value, nil
+}
+
+func (c *MemoryClient) Set(ctx context.Context, key string, value string, duration time.Duration) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.sweep()
+	c.items[key] = cacheItem{value: value, expireAt: c.expireAt(duration)}
+	return nil
+}
+
+func (c *MemoryClient) SetNX(ctx context.Context, key string, value string, duration time.Duration) (bool, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if _, ok := c.get(key); ok {
+		return false, nil
+	}
+	c.items[key] = cacheItem{value: value, expireAt: c.expireAt(duration)}
+	return true, nil
+}
+
+func (c *MemoryClient) SetXX(ctx context.Context, key string, value string, duration time.Duration) (bool, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if _, ok := c.get(key); !ok {
+		return false, nil
+	}
+	c.items[key] = cacheItem{value: value, expireAt: c.expireAt(duration)}
+	return true, nil
+}
+
+func (c *MemoryClient) Del(ctx context.Context, keys ...string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for _, key := range keys {
+		delete(c.items, key)
+	}
+	return nil
+}
+
+func (c *MemoryClient) Exists(ctx context.Context, keys ...string) (bool, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for _, key := range keys {
+		if _, ok := c.get(key); !ok {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+func (c *MemoryClient) Expire(ctx context.Context, key string, duration time.Duration) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	item, ok := c.get(key)
+	if !ok {
+		return fmt.Errorf("key %s not found", key)
+	}
+	item.expireAt = c.expireAt(duration)
+	c.items[key] = item
+	return nil
+}
+
+func (c *MemoryClient) Incr(ctx context.Context, key string) (int64, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	item, ok := c.get(key)
+	if !ok {
+		item = cacheItem{value: "0"}
+	}
+	n, err := strconv.ParseInt(item.value, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("value of key %s is not an integer", key)
+	}
+	n++
+	item.value = strconv.FormatInt(n, 10)
+	c.items[key] = item
+	return n, nil
+}
+
+func (c *MemoryClient) SAdd(ctx context.Context, key string, members ...string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	item, ok := c.get(key)
+	if !ok {
+		item = cacheItem{}
+	}
+	if item.members == nil {
+		item.members = map[string]struct{}{}
+	}
+	for _, m := range members {
+		item.members[m] = struct{}{}
+	}
+	c.items[key] = item
+	return nil
+}
+
+func (c *MemoryClient) SRem(ctx context.Context, key string, members ...string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	item, ok := c.get(key)
+	if !ok {
+		return nil
+	}
+	for _, m := range members {
+		delete(item.members, m)
+	}
+	// like redis, an empty set is removed
+	if len(item.members) == 0 {
+		delete(c.items, key)
+	}
+	return nil
+}
+
+func (c *MemoryClient) SMembers(ctx context.Context, key string) ([]string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	item, _ := c.get(key)
+	members := make([]string, 0, len(item.members))
+	for m := range item.members {
+		members = append(members, m)
+	}
+	return members, nil
+}
+
+// Eval isn't supported, the callers keep an in-memory implementation for the case redis is disabled
+func (c *MemoryClient) Eval(ctx context.Context, script string, keys []string, args ...interface{}) (interface{}, error) {
+	return nil, ErrScriptNotSupported
+}
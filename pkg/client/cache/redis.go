@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/go-redis/redis/v8"
@@ -12,13 +13,15 @@ import (
 
 type Client struct {
 	client *redis.Client
+	// scripts caches the parsed scripts by source, so that they are run by EVALSHA
+	scripts sync.Map
 }
 
 func NewRedisClient(option *Options, stopCh <-chan struct{}) (Interface, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
-	var r *Client
+	r := &Client{}
 	redisOptions := &redis.Options{
 		Addr:     option.Host,
 		Password: option.Password,
@@ -83,6 +86,10 @@ func (r *Client) Get(ctx context.Context, key string) (string, error) {
 	return r.client.Get(ctx, key).Result()
 }
 
+func (r *Client) GetDel(ctx context.Context, key string) (string, error) {
+	return r.client.GetDel(ctx, key).Result()
+}
+
 func (r *Client) Keys(ctx context.Context, pattern string) ([]string, error) {
 	return r.client.Keys(ctx, pattern).Result()
 }
@@ -91,6 +98,14 @@ func (r *Client) Set(ctx context.Context, key string, value string, duration tim
 	return r.client.Set(ctx, key, value, duration).Err()
 }
 
+func (r *Client) SetNX(ctx context.Context, key string, value string, duration time.Duration) (bool, error) {
+	return r.client.SetNX(ctx, key, value, duration).Result()
+}
+
+func (r *Client) SetXX(ctx context.Context, key string, value string, duration time.Duration) (bool, error) {
+	return r.client.SetXX(ctx, key, value, duration).Result()
+}
+
 func (r *Client) Del(ctx context.Context, keys ...string) error {
 	return r.client.Del(ctx, keys...).Err()
 }
@@ -107,3 +122,35 @@ func (r *Client) Exists(ctx context.Context, keys ...string) (bool, error) {
 func (r *Client) Expire(ctx context.Context, key string, duration time.Duration) error {
 	return r.client.Expire(ctx, key, duration).Err()
 }
+
+func (r *Client) SAdd(ctx context.Context, key string, members ...string) error {
+	return r.client.SAdd(ctx, key, toInterfaces(members)...).Err()
+}
+
+func (r *Client) SRem(ctx context.Context, key string, members ...string) error {
+	return r.client.SRem(ctx, key, toInterfaces(members)...).Err()
+}
+
+func (r *Client) SMembers(ctx context.Context, key string) ([]string, error) {
+	return r.client.SMembers(ctx, key).Result()
+}
+
+func (r *Client) Eval(ctx context.Context, script string, keys []string, args ...interface{}) (interface{}, error) {
+	s, ok := r.scripts.Load(script)
+	if !ok {
+		s, _ = r.scripts.LoadOrStore(script, redis.NewScript(script))
+	}
+	return s.(*redis.Script).Run(ctx, r.client, keys, args...).Result()
+}
+
+func (r *Client) Incr(ctx context.Context, key string) (int64, error) {
+	return r.client.Incr(ctx, key).Result()
+}
+
+func toInterfaces(values []string) []interface{} {
+	result := make([]interface{}, 0, len(values))
+	for _, v := range values {
+		result = append(result, v)
+	}
+	return result
+}
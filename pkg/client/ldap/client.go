@@ -3,51 +3,157 @@ package ldap
 import (
 	"asyncKubeManager/pkg/model"
 	"crypto/tls"
+	"crypto/x509"
+	"errors"
 	"fmt"
 	"github.com/go-ldap/ldap/v3"
-	"log"
+	"net"
+	"os"
+	"strconv"
 	"time"
 )
 
-// LDAPClient holds the connection and configuration to interact with the LDAP server
+// ErrUserNotFound is returned by FindUserByUID when no entry has the uid
+var ErrUserNotFound = errors.New("user not found")
+
+// LDAPClient holds the pooled connections and configuration to interact with the LDAP server.
+// Searches and changes use the pooled connections bound as the service account, Bind dials a connection
+// of its own so that the binds of the users never change the identity of the pooled connections.
 type LDAPClient struct {
-	conn *ldap.Conn
-	opts *Options
+	pool      *connPool
+	opts      *Options
+	tlsConfig *tls.Config
+	stopCh    chan struct{}
 }
 
-// NewLDAPClient creates and returns a new LDAPClient, establishing the connection
+// NewLDAPClient creates and returns a new LDAPClient, establishing the first connection to check the configuration
 func NewLDAPClient(opts *Options) (*LDAPClient, error) {
-	// Attempt to establish a connection with the LDAP server
-	ldapURL := fmt.Sprintf("ldaps://%s:%d", opts.Host, opts.Port)
-	conn, err := ldap.DialURL(ldapURL, ldap.DialWithTLSConfig(&tls.Config{InsecureSkipVerify: true}))
+	tlsConfig, err := newTLSConfig(opts)
 	if err != nil {
-		return nil, fmt.Errorf("failed to connect to LDAP server: %v", err)
+		return nil, err
 	}
 
-	// Set the timeout for any LDAP operations
-	conn.SetTimeout(30 * time.Second)
+	c := &LDAPClient{
+		opts:      opts,
+		tlsConfig: tlsConfig,
+		stopCh:    make(chan struct{}),
+	}
+	c.pool = newConnPool(opts.PoolSize, c.dialService)
 
 	// Try to bind using the provided credentials (assuming simple authentication)
-	err = conn.Bind(opts.LDAPUserName, opts.LDAPPassword)
-	if err != nil {
-		return nil, fmt.Errorf("failed to bind to LDAP server: %v", err)
+	if err = c.pool.do(func(conn *ldap.Conn) error { return nil }); err != nil {
+		return nil, err
 	}
 
-	// Return the new LDAP client
-	return &LDAPClient{
-		conn: conn,
-		opts: opts,
-	}, nil
+	if opts.HealthCheckInterval > 0 {
+		go c.healthCheck(opts.HealthCheckInterval)
+	}
+	return c, nil
 }
 
-// Close closes the LDAP connection
-func (c *LDAPClient) Close() {
-	if c.conn != nil {
-		err := c.conn.Close()
+// newTLSConfig returns the TLS configuration of ldaps and StartTLS, the server certificate is verified
+// with the CA bundle if configured, otherwise with the system CAs
+func newTLSConfig(opts *Options) (*tls.Config, error) {
+	serverName := opts.ServerName
+	if serverName == "" {
+		serverName = opts.Host
+	}
+	config := &tls.Config{
+		ServerName:         serverName,
+		InsecureSkipVerify: opts.InsecureSkipVerify,
+		MinVersion:         tls.VersionTLS12,
+	}
+	if opts.CAFile != "" {
+		data, err := os.ReadFile(opts.CAFile)
 		if err != nil {
-			log.Printf("failed to close LDAP connection: %v", err)
+			return nil, fmt.Errorf("failed to read ldap ca file: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(data) {
+			return nil, fmt.Errorf("no certificate found in ldap ca file %s", opts.CAFile)
+		}
+		config.RootCAs = pool
+	}
+	return config, nil
+}
+
+// dial connects to the server with the configured TLS mode
+func (c *LDAPClient) dial() (*ldap.Conn, error) {
+	addr := net.JoinHostPort(c.opts.Host, strconv.Itoa(c.opts.Port))
+	dialer := &net.Dialer{Timeout: c.opts.Timeout}
+
+	var (
+		conn *ldap.Conn
+		err  error
+	)
+	if c.opts.TLSMode == TLSModeLDAPS {
+		conn, err = ldap.DialURL("ldaps://"+addr, ldap.DialWithTLSDialer(c.tlsConfig, dialer))
+	} else {
+		conn, err = ldap.DialURL("ldap://"+addr, ldap.DialWithDialer(dialer))
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to LDAP server: %w", err)
+	}
+
+	if c.opts.TLSMode == TLSModeStartTLS {
+		if err = conn.StartTLS(c.tlsConfig); err != nil {
+			_ = conn.Close()
+			return nil, fmt.Errorf("failed to start tls with LDAP server: %w", err)
 		}
 	}
+
+	// Set the timeout for any LDAP operations
+	conn.SetTimeout(c.opts.Timeout)
+	return conn, nil
+}
+
+// dialService returns a connection bound as the service account
+func (c *LDAPClient) dialService() (*ldap.Conn, error) {
+	conn, err := c.dial()
+	if err != nil {
+		return nil, err
+	}
+	if err = conn.Bind(c.opts.LDAPUserName, c.opts.LDAPPassword); err != nil {
+		_ = conn.Close()
+		return nil, fmt.Errorf("failed to bind to LDAP server: %w", err)
+	}
+	return conn, nil
+}
+
+// healthCheck probes the idle connections with a read of the root DSE until Close
+func (c *LDAPClient) healthCheck(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			c.pool.check(ping)
+		case <-c.stopCh:
+			return
+		}
+	}
+}
+
+// Ping checks that a pooled connection can read the root DSE, it redials the connection if needed
+func (c *LDAPClient) Ping() error {
+	return c.pool.do(ping)
+}
+
+func ping(conn *ldap.Conn) error {
+	_, err := conn.Search(ldap.NewSearchRequest("", ldap.ScopeBaseObject, ldap.NeverDerefAliases, 1, 0, false,
+		"(objectClass=*)", []string{"1.1"}, nil))
+	return err
+}
+
+// Close stops the health check and closes the LDAP connections
+func (c *LDAPClient) Close() {
+	select {
+	case <-c.stopCh:
+	default:
+		close(c.stopCh)
+	}
+	c.pool.close()
 }
 
 // Search performs an LDAP search query
@@ -65,9 +171,13 @@ func (c *LDAPClient) Search(filter string, attributes []string) ([]*ldap.Entry,
 	)
 
 	// Execute the search
-	searchResult, err := c.conn.Search(searchRequest)
+	var searchResult *ldap.SearchResult
+	err := c.pool.do(func(conn *ldap.Conn) (err error) {
+		searchResult, err = conn.Search(searchRequest)
+		return err
+	})
 	if err != nil {
-		return nil, fmt.Errorf("LDAP search failed: %v", err)
+		return nil, fmt.Errorf("LDAP search failed: %w", err)
 	}
 
 	return searchResult.Entries, nil
@@ -76,9 +186,11 @@ func (c *LDAPClient) Search(filter string, attributes []string) ([]*ldap.Entry,
 // Modify performs an LDAP modify operation
 func (c *LDAPClient) Modify(dn string, modifyRequest *ldap.ModifyRequest) error {
 	// Perform the modify operation
-	err := c.conn.Modify(modifyRequest)
+	err := c.pool.do(func(conn *ldap.Conn) error {
+		return conn.Modify(modifyRequest)
+	})
 	if err != nil {
-		return fmt.Errorf("LDAP modify failed: %v", err)
+		return fmt.Errorf("LDAP modify failed: %w", err)
 	}
 	return nil
 }
@@ -86,9 +198,11 @@ func (c *LDAPClient) Modify(dn string, modifyRequest *ldap.ModifyRequest) error
 // Add performs an LDAP add operation
 func (c *LDAPClient) Add(entry *ldap.AddRequest) error {
 	// Perform the add operation
-	err := c.conn.Add(entry)
+	err := c.pool.do(func(conn *ldap.Conn) error {
+		return conn.Add(entry)
+	})
 	if err != nil {
-		return fmt.Errorf("LDAP add failed: %v", err)
+		return fmt.Errorf("LDAP add failed: %w", err)
 	}
 	return nil
 }
@@ -97,37 +211,118 @@ func (c *LDAPClient) Add(entry *ldap.AddRequest) error {
 func (c *LDAPClient) Delete(dn string) error {
 	// Perform the delete operation
 	delRequest := ldap.NewDelRequest(dn, nil)
-	err := c.conn.Del(delRequest)
+	err := c.pool.do(func(conn *ldap.Conn) error {
+		return conn.Del(delRequest)
+	})
 	if err != nil {
-		return fmt.Errorf("LDAP delete failed: %v", err)
+		return fmt.Errorf("LDAP delete failed: %w", err)
 	}
 	return nil
 }
 
+// userAttributes are the attributes of a user entry read into model.LdapUser
+var userAttributes = []string{"dn", "cn", "ou", "uid", "sn", "givenName", "telephoneNumber", "mail", "gidNumber", "uidNumber", "homeDirectory", "userPassword", "memberOf", "shadowExpire"}
+
+// searchPageSize is the page size of the searches listing the whole directory
+const searchPageSize = 500
+
 func (c *LDAPClient) FindUserByUID(uid string) (*model.LdapUser, error) {
 	// 构造 LDAP 搜索请求
 	searchRequest := ldap.NewSearchRequest(
 		c.opts.BaseDN, // 基础 DN
 		ldap.ScopeWholeSubtree, ldap.NeverDerefAliases, 0, 0, false,
 		fmt.Sprintf("(uid=%s)", ldap.EscapeFilter(uid)),
-		[]string{"dn", "cn", "ou", "uid", "sn", "givenName", "telephoneNumber", "mail", "gidNumber", "uidNumber", "homeDirectory", "userPassword"},
+		userAttributes,
 		nil,
 	)
 
 	// 执行搜索
-	sr, err := c.conn.Search(searchRequest)
+	var sr *ldap.SearchResult
+	err := c.pool.do(func(conn *ldap.Conn) (err error) {
+		sr, err = conn.Search(searchRequest)
+		return err
+	})
 	if err != nil {
 		return nil, fmt.Errorf("LDAP search failed: %w", err)
 	}
 
 	if len(sr.Entries) == 0 {
-		return nil, fmt.Errorf("user not found")
+		return nil, ErrUserNotFound
+	}
+
+	return entryToUser(sr.Entries[0]), nil
+}
+
+// ListUsers returns every entry with a uid under the base DN
+func (c *LDAPClient) ListUsers() ([]*model.LdapUser, error) {
+	searchRequest := ldap.NewSearchRequest(
+		c.opts.BaseDN,
+		ldap.ScopeWholeSubtree, ldap.NeverDerefAliases, 0, 0, false,
+		"(uid=*)",
+		userAttributes,
+		nil,
+	)
+
+	var sr *ldap.SearchResult
+	err := c.pool.do(func(conn *ldap.Conn) (err error) {
+		sr, err = conn.SearchWithPaging(searchRequest, searchPageSize)
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("LDAP search failed: %w", err)
+	}
+
+	users := make([]*model.LdapUser, 0, len(sr.Entries))
+	for _, entry := range sr.Entries {
+		users = append(users, entryToUser(entry))
+	}
+	return users, nil
+}
+
+// ListGroups returns the posixGroup entries under the base DN
+func (c *LDAPClient) ListGroups() ([]*model.LdapGroup, error) {
+	return c.searchGroups("(objectClass=posixGroup)")
+}
+
+// FindGroupsByMemberUID returns the posixGroup entries listing the uid in memberUid
+func (c *LDAPClient) FindGroupsByMemberUID(uid string) ([]*model.LdapGroup, error) {
+	return c.searchGroups(fmt.Sprintf("(&(objectClass=posixGroup)(memberUid=%s))", ldap.EscapeFilter(uid)))
+}
+
+func (c *LDAPClient) searchGroups(filter string) ([]*model.LdapGroup, error) {
+	searchRequest := ldap.NewSearchRequest(
+		c.opts.BaseDN,
+		ldap.ScopeWholeSubtree, ldap.NeverDerefAliases, 0, 0, false,
+		filter,
+		[]string{"dn", "cn", "ou", "gidNumber", "memberUid"},
+		nil,
+	)
+
+	var sr *ldap.SearchResult
+	err := c.pool.do(func(conn *ldap.Conn) (err error) {
+		sr, err = conn.SearchWithPaging(searchRequest, searchPageSize)
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("LDAP search failed: %w", err)
 	}
 
-	entry := sr.Entries[0]
+	groups := make([]*model.LdapGroup, 0, len(sr.Entries))
+	for _, entry := range sr.Entries {
+		groups = append(groups, &model.LdapGroup{
+			DN:         entry.DN,
+			CN:         entry.GetAttributeValue("cn"),
+			OU:         entry.GetAttributeValue("ou"),
+			GIDNumber:  entry.GetAttributeValue("gidNumber"),
+			MemberUIDs: entry.GetAttributeValues("memberUid"),
+		})
+	}
+	return groups, nil
+}
 
-	// 构造 LdapUser 实例
-	user := &model.LdapUser{
+// entryToUser 构造 LdapUser 实例
+func entryToUser(entry *ldap.Entry) *model.LdapUser {
+	return &model.LdapUser{
 		DN:              entry.DN,
 		CN:              entry.GetAttributeValue("cn"),
 		OU:              entry.GetAttributeValue("ou"),
@@ -140,13 +335,20 @@ func (c *LDAPClient) FindUserByUID(uid string) (*model.LdapUser, error) {
 		UIDNumber:       entry.GetAttributeValue("uidNumber"),
 		HomeDirectory:   entry.GetAttributeValue("homeDirectory"),
 		UserPassword:    []byte(entry.GetRawAttributeValue("userPassword")),
+		MemberOf:        entry.GetAttributeValues("memberOf"),
+		ShadowExpire:    entry.GetAttributeValue("shadowExpire"),
 	}
-
-	return user, nil
 }
 
+// Bind verifies the password of dn on a connection of its own, which is closed afterwards
 func (c *LDAPClient) Bind(dn, password string) error {
-	err := c.conn.Bind(dn, password)
+	conn, err := c.dial()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	err = conn.Bind(dn, password)
 	if err != nil {
 		return fmt.Errorf("LDAP bind failed: %w", err)
 	}
@@ -0,0 +1,227 @@
+package ldap
+
+import (
+	"asyncKubeManager/pkg/model"
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/go-ldap/ldap/v3"
+)
+
+var (
+	// ErrGroupNotFound is returned by FindGroupByCN when no posixGroup has the cn
+	ErrGroupNotFound = errors.New("group not found")
+	// ErrEntryExists is returned when creating a user or group whose uid, cn or DN is taken
+	ErrEntryExists = errors.New("entry already exists")
+)
+
+// object classes of the entries created by the console
+var (
+	userObjectClasses  = []string{"inetOrgPerson", "posixAccount", "shadowAccount"}
+	groupObjectClasses = []string{"posixGroup"}
+)
+
+// disabledShadowExpire expires the account on 1970-01-02
+const disabledShadowExpire = "1"
+
+// UserDN returns the DN of a user created under ou of the base DN
+func (c *LDAPClient) UserDN(cn, ou string) string {
+	return fmt.Sprintf("cn=%s,ou=%s,%s", ldap.EscapeDN(cn), ldap.EscapeDN(ou), c.opts.BaseDN)
+}
+
+// GroupDN returns the DN of a group created under ou of the base DN
+func (c *LDAPClient) GroupDN(cn, ou string) string {
+	return c.UserDN(cn, ou)
+}
+
+// CreateUser adds the user entry and sets its password with the password modify extended operation,
+// so that the server hashes the password with its own scheme. The entry is removed if the password can't be set.
+func (c *LDAPClient) CreateUser(user *model.LdapUser, password string) error {
+	if err := user.Validate(); err != nil {
+		return err
+	}
+	if _, err := c.FindUserByUID(user.UID); err == nil {
+		return ErrEntryExists
+	} else if !errors.Is(err, ErrUserNotFound) {
+		return err
+	}
+
+	if err := c.Add(newAddRequest(user.DN, userObjectClasses, user.ToLDAPEntry())); err != nil {
+		return mapEntryError(err)
+	}
+	if password == "" {
+		return nil
+	}
+	if err := c.ResetPassword(user.DN, password); err != nil {
+		if delErr := c.Delete(user.DN); delErr != nil {
+			return errors.Join(err, delErr)
+		}
+		return err
+	}
+	return nil
+}
+
+// UpdateUser replaces the attributes of the user entry that are not part of its DN, empty values are removed
+func (c *LDAPClient) UpdateUser(user *model.LdapUser) error {
+	if err := user.Validate(); err != nil {
+		return err
+	}
+
+	req := ldap.NewModifyRequest(user.DN, nil)
+	entry := user.ToLDAPEntry()
+	for _, attr := range []string{"sn", "givenName", "telephoneNumber", "mail", "gidNumber", "homeDirectory"} {
+		req.Replace(attr, nonEmpty(entry[attr]))
+	}
+	return c.Modify(user.DN, req)
+}
+
+// SetUserDisabled expires the account with shadowExpire, or removes the expiry. The shadowAccount object class
+// is added to the entries created without it.
+func (c *LDAPClient) SetUserDisabled(dn string, disabled bool) error {
+	req := ldap.NewModifyRequest(dn, nil)
+	if !disabled {
+		req.Replace("shadowExpire", nil)
+		return c.Modify(dn, req)
+	}
+
+	shadow, err := c.hasObjectClass(dn, "shadowAccount")
+	if err != nil {
+		return err
+	}
+	if !shadow {
+		req.Add("objectClass", []string{"shadowAccount"})
+	}
+	req.Replace("shadowExpire", []string{disabledShadowExpire})
+	return c.Modify(dn, req)
+}
+
+// ResetPassword sets the password of dn as the service account with the password modify extended operation (RFC 3062)
+func (c *LDAPClient) ResetPassword(dn, password string) error {
+	req := ldap.NewPasswordModifyRequest(dn, "", password)
+	err := c.pool.do(func(conn *ldap.Conn) error {
+		_, err := conn.PasswordModify(req)
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("LDAP password modify failed: %w", err)
+	}
+	return nil
+}
+
+// FindGroupByCN returns the posixGroup with the cn
+func (c *LDAPClient) FindGroupByCN(cn string) (*model.LdapGroup, error) {
+	groups, err := c.searchGroups(fmt.Sprintf("(&(objectClass=posixGroup)(cn=%s))", ldap.EscapeFilter(cn)))
+	if err != nil {
+		return nil, err
+	}
+	if len(groups) == 0 {
+		return nil, ErrGroupNotFound
+	}
+	return groups[0], nil
+}
+
+// CreateGroup adds the posixGroup entry with its members
+func (c *LDAPClient) CreateGroup(group *model.LdapGroup) error {
+	if err := group.Validate(); err != nil {
+		return err
+	}
+	if _, err := c.FindGroupByCN(group.CN); err == nil {
+		return ErrEntryExists
+	} else if !errors.Is(err, ErrGroupNotFound) {
+		return err
+	}
+
+	entry := group.ToLDAPEntry()
+	// posixGroup 不允许 ou 属性, ou 只是 DN 的一部分
+	delete(entry, "ou")
+	if err := c.Add(newAddRequest(group.DN, groupObjectClasses, entry)); err != nil {
+		return mapEntryError(err)
+	}
+	return nil
+}
+
+// UpdateGroup replaces the gidNumber of the group, the members are changed by AddGroupMember and RemoveGroupMember
+func (c *LDAPClient) UpdateGroup(group *model.LdapGroup) error {
+	if err := group.Validate(); err != nil {
+		return err
+	}
+
+	req := ldap.NewModifyRequest(group.DN, nil)
+	req.Replace("gidNumber", []string{group.GIDNumber})
+	return c.Modify(group.DN, req)
+}
+
+// AddGroupMember adds uid to the memberUid of the group, adding an existing member succeeds
+func (c *LDAPClient) AddGroupMember(dn, uid string) error {
+	req := ldap.NewModifyRequest(dn, nil)
+	req.Add("memberUid", []string{uid})
+	err := c.Modify(dn, req)
+	if ldap.IsErrorWithCode(err, ldap.LDAPResultAttributeOrValueExists) {
+		return nil
+	}
+	return err
+}
+
+// RemoveGroupMember removes uid from the memberUid of the group, removing a missing member succeeds
+func (c *LDAPClient) RemoveGroupMember(dn, uid string) error {
+	req := ldap.NewModifyRequest(dn, nil)
+	req.Delete("memberUid", []string{uid})
+	err := c.Modify(dn, req)
+	if ldap.IsErrorWithCode(err, ldap.LDAPResultNoSuchAttribute) {
+		return nil
+	}
+	return err
+}
+
+func (c *LDAPClient) hasObjectClass(dn, class string) (bool, error) {
+	req := ldap.NewSearchRequest(dn, ldap.ScopeBaseObject, ldap.NeverDerefAliases, 1, 0, false,
+		fmt.Sprintf("(objectClass=%s)", ldap.EscapeFilter(class)), []string{"1.1"}, nil)
+
+	var sr *ldap.SearchResult
+	err := c.pool.do(func(conn *ldap.Conn) (err error) {
+		sr, err = conn.Search(req)
+		return err
+	})
+	if err != nil {
+		return false, fmt.Errorf("LDAP search failed: %w", err)
+	}
+	return len(sr.Entries) != 0, nil
+}
+
+// newAddRequest builds the add request of entry, dn, userPassword and empty values are skipped
+func newAddRequest(dn string, objectClasses []string, entry map[string][]string) *ldap.AddRequest {
+	req := ldap.NewAddRequest(dn, nil)
+	req.Attribute("objectClass", objectClasses)
+
+	attrs := make([]string, 0, len(entry))
+	for attr := range entry {
+		if attr != "dn" && attr != "userPassword" {
+			attrs = append(attrs, attr)
+		}
+	}
+	sort.Strings(attrs)
+	for _, attr := range attrs {
+		if values := nonEmpty(entry[attr]); len(values) != 0 {
+			req.Attribute(attr, values)
+		}
+	}
+	return req
+}
+
+func nonEmpty(values []string) []string {
+	var res []string
+	for _, v := range values {
+		if v != "" {
+			res = append(res, v)
+		}
+	}
+	return res
+}
+
+func mapEntryError(err error) error {
+	if ldap.IsErrorWithCode(err, ldap.LDAPResultEntryAlreadyExists) {
+		return ErrEntryExists
+	}
+	return err
+}
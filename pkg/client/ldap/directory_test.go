@@ -0,0 +1,48 @@
+package ldap
+
+import (
+	"asyncKubeManager/pkg/model"
+	"testing"
+
+	"github.com/go-ldap/ldap/v3"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewAddRequest(t *testing.T) {
+	user := &model.LdapUser{
+		DN:            "cn=Alice,ou=people,dc=example,dc=com",
+		CN:            "Alice",
+		OU:            "people",
+		UID:           "alice",
+		SN:            "Liddell",
+		GIDNumber:     "1000",
+		UIDNumber:     "1001",
+		HomeDirectory: "/home/alice",
+		UserPassword:  []byte("secret"),
+	}
+	req := newAddRequest(user.DN, userObjectClasses, user.ToLDAPEntry())
+
+	assert.Equal(t, user.DN, req.DN)
+	assert.Equal(t, []ldap.Attribute{
+		{Type: "objectClass", Vals: userObjectClasses},
+		{Type: "cn", Vals: []string{"Alice"}},
+		{Type: "gidNumber", Vals: []string{"1000"}},
+		{Type: "homeDirectory", Vals: []string{"/home/alice"}},
+		{Type: "ou", Vals: []string{"people"}},
+		{Type: "sn", Vals: []string{"Liddell"}},
+		{Type: "uid", Vals: []string{"alice"}},
+		{Type: "uidNumber", Vals: []string{"1001"}},
+	}, req.Attributes)
+}
+
+func TestLDAPClient_UserDN(t *testing.T) {
+	c := &LDAPClient{opts: NewLDAPOptions()}
+	assert.Equal(t, "cn=Smith\\, John,ou=people,dc=example,dc=com", c.UserDN("Smith, John", "people"))
+}
+
+func TestLdapUser_Disabled(t *testing.T) {
+	for expire, disabled := range map[string]bool{"": false, "-1": false, disabledShadowExpire: true, "999999": false} {
+		u := &model.LdapUser{ShadowExpire: expire}
+		assert.Equal(t, disabled, u.Disabled(), expire)
+	}
+}
@@ -4,8 +4,10 @@ import (
 	"fmt"
 	"github.com/spf13/pflag"
 	"github.com/spf13/viper"
+	"os"
 	"regexp"
 	"strings"
+	"time"
 )
 
 // Define default configuration item names
@@ -15,6 +17,24 @@ const (
 	ldapUserName = "ldap-user-name"
 	ldapPassword = "ldap-password"
 	ldapBaseDN   = "ldap-base-dn"
+
+	ldapTLSMode             = "ldap-tls-mode"
+	ldapCAFile              = "ldap-ca-file"
+	ldapServerName          = "ldap-server-name"
+	ldapInsecureSkipVerify  = "ldap-insecure-skip-verify"
+	ldapPoolSize            = "ldap-pool-size"
+	ldapTimeout             = "ldap-timeout"
+	ldapHealthCheckInterval = "ldap-health-check-interval"
+)
+
+// TLS modes of the connections
+const (
+	// TLSModeLDAPS connects with TLS, usually to port 636
+	TLSModeLDAPS = "ldaps"
+	// TLSModeStartTLS connects in plain text and upgrades with the StartTLS extended operation, usually on port 389
+	TLSModeStartTLS = "starttls"
+	// TLSModeNone never uses TLS, the passwords are sent in plain text
+	TLSModeNone = "none"
 )
 
 type DefaultOption func(o *Options)
@@ -51,7 +71,20 @@ type Options struct {
 	LDAPUserName string `json:"ldap_user_name"`
 	LDAPPassword string `json:"ldap_password"`
 	BaseDN       string `json:"base_dn"`
-	v            *viper.Viper
+	// TLSMode is one of ldaps, starttls and none
+	TLSMode string `json:"tls_mode"`
+	// CAFile is a PEM bundle of the CAs verifying the server certificate, the system CAs are used if empty
+	CAFile string `json:"ca_file"`
+	// ServerName is verified against the server certificate, Host is used if empty
+	ServerName         string `json:"server_name"`
+	InsecureSkipVerify bool   `json:"insecure_skip_verify"`
+	// PoolSize is the number of connections bound as LDAPUserName for searches and changes,
+	// the binds of the users verifying their passwords use their own short-lived connections
+	PoolSize int           `json:"pool_size"`
+	Timeout  time.Duration `json:"timeout"`
+	// HealthCheckInterval is the interval of checking the idle pooled connections, 0 disables it
+	HealthCheckInterval time.Duration `json:"health_check_interval"`
+	v                   *viper.Viper
 }
 
 // NewLDAPOptions returns a new Options object with default LDAP configurations
@@ -63,6 +96,11 @@ func NewLDAPOptions(opts ...DefaultOption) *Options {
 		LDAPPassword: "",                           // Default no password
 		BaseDN:       "dc=example,dc=com",
 		v:            viper.NewWithOptions(viper.EnvKeyReplacer(strings.NewReplacer("-", "_"))),
+
+		TLSMode:             TLSModeLDAPS,
+		PoolSize:            4,
+		Timeout:             30 * time.Second,
+		HealthCheckInterval: 30 * time.Second,
 	}
 
 	// Modify the configuration using DefaultOption
@@ -82,6 +120,13 @@ func (o *Options) loadEnv() {
 	o.LDAPUserName = o.v.GetString(ldapUserName) // Get LDAP username configuration
 	o.LDAPPassword = o.v.GetString(ldapPassword) // Get LDAP password configuration
 	o.BaseDN = o.v.GetString(ldapBaseDN)
+	o.TLSMode = o.v.GetString(ldapTLSMode)
+	o.CAFile = o.v.GetString(ldapCAFile)
+	o.ServerName = o.v.GetString(ldapServerName)
+	o.InsecureSkipVerify = o.v.GetBool(ldapInsecureSkipVerify)
+	o.PoolSize = o.v.GetInt(ldapPoolSize)
+	o.Timeout = o.v.GetDuration(ldapTimeout)
+	o.HealthCheckInterval = o.v.GetDuration(ldapHealthCheckInterval)
 }
 
 // Validate checks the validity of configuration items
@@ -102,10 +147,32 @@ func (o *Options) Validate() []error {
 		errors = append(errors, fmt.Errorf("invalid ldap user name"))
 	}
 
+	// Validate LDAP password
+	if o.LDAPPassword == "" {
+		errors = append(errors, fmt.Errorf("ldap password is empty"))
+	}
+
 	if o.BaseDN == "" {
 		errors = append(errors, fmt.Errorf("ldap base dn is empty"))
 	}
 
+	switch o.TLSMode {
+	case TLSModeLDAPS, TLSModeStartTLS, TLSModeNone:
+	default:
+		errors = append(errors, fmt.Errorf("invalid ldap tls mode %q", o.TLSMode))
+	}
+	if o.CAFile != "" {
+		if _, err := os.Stat(o.CAFile); err != nil {
+			errors = append(errors, fmt.Errorf("invalid ldap ca file: %w", err))
+		}
+	}
+	if o.PoolSize <= 0 {
+		errors = append(errors, fmt.Errorf("invalid ldap pool size"))
+	}
+	if o.Timeout <= 0 || o.HealthCheckInterval < 0 {
+		errors = append(errors, fmt.Errorf("invalid ldap timeout or health check interval"))
+	}
+
 	return errors
 }
 
@@ -116,6 +183,13 @@ func (o *Options) AddFlags(fs *pflag.FlagSet) {
 	fs.StringVar(&o.LDAPUserName, ldapUserName, o.LDAPUserName, "ldap user name")
 	fs.StringVar(&o.LDAPPassword, ldapPassword, o.LDAPPassword, "ldap password")
 	fs.StringVar(&o.BaseDN, ldapBaseDN, o.BaseDN, "ldap base dn")
+	fs.StringVar(&o.TLSMode, ldapTLSMode, o.TLSMode, "ldap tls mode, one of ldaps, starttls and none")
+	fs.StringVar(&o.CAFile, ldapCAFile, o.CAFile, "PEM bundle of the CAs verifying the ldap server certificate, the system CAs are used if empty")
+	fs.StringVar(&o.ServerName, ldapServerName, o.ServerName, "server name verified against the ldap server certificate, ldap-host is used if empty")
+	fs.BoolVar(&o.InsecureSkipVerify, ldapInsecureSkipVerify, o.InsecureSkipVerify, "skip verifying the ldap server certificate, only for testing")
+	fs.IntVar(&o.PoolSize, ldapPoolSize, o.PoolSize, "number of pooled ldap connections bound as ldap-user-name")
+	fs.DurationVar(&o.Timeout, ldapTimeout, o.Timeout, "timeout of dialing and of each ldap operation")
+	fs.DurationVar(&o.HealthCheckInterval, ldapHealthCheckInterval, o.HealthCheckInterval, "interval of checking the idle pooled ldap connections, 0 disables it")
 
 	// Bind command-line flags
 	_ = o.v.BindPFlags(fs)
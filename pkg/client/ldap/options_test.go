@@ -111,3 +111,14 @@ func TestOptions_LoadEnv(t *testing.T) {
 	assert.Equal(t, "cn=admin,dc=test,dc=com", opts.LDAPUserName)
 	assert.Equal(t, "admin_password", opts.LDAPPassword)
 }
+
+func TestOptions_ValidateTLS(t *testing.T) {
+	opts := NewLDAPOptions(SetDefaultLDAPPassword("admin_password"))
+	opts.TLSMode = TLSModeStartTLS
+	assert.Empty(t, opts.Validate())
+
+	opts.TLSMode = "tls"
+	opts.CAFile = "/nonexistent/ca.pem"
+	opts.PoolSize = 0
+	assert.Len(t, opts.Validate(), 3)
+}
@@ -0,0 +1,137 @@
+package ldap
+
+import (
+	"errors"
+	"sync"
+
+	"github.com/go-ldap/ldap/v3"
+	"go.uber.org/zap"
+)
+
+// errPoolClosed is returned by the operations after Close
+var errPoolClosed = errors.New("ldap client is closed")
+
+// connPool holds the connections bound as the service account. An operation takes a slot, a nil slot or a
+// closed connection is redialed on the next use, so the pool reconnects after a restart of the server.
+type connPool struct {
+	slots chan *ldap.Conn
+	dial  func() (*ldap.Conn, error)
+
+	closeOnce sync.Once
+	closed    chan struct{}
+}
+
+func newConnPool(size int, dial func() (*ldap.Conn, error)) *connPool {
+	p := &connPool{
+		slots:  make(chan *ldap.Conn, size),
+		dial:   dial,
+		closed: make(chan struct{}),
+	}
+	for i := 0; i < size; i++ {
+		p.slots <- nil
+	}
+	return p
+}
+
+// get waits for a free slot and returns its connection, redialing it if it is closed
+func (p *connPool) get() (*ldap.Conn, error) {
+	select {
+	case <-p.closed:
+		return nil, errPoolClosed
+	default:
+	}
+
+	select {
+	case conn := <-p.slots:
+		if conn != nil && !conn.IsClosing() {
+			return conn, nil
+		}
+		if conn != nil {
+			_ = conn.Close()
+		}
+		conn, err := p.dial()
+		if err != nil {
+			p.slots <- nil
+			return nil, err
+		}
+		return conn, nil
+	case <-p.closed:
+		return nil, errPoolClosed
+	}
+}
+
+// put returns the connection to its slot, it is closed if the operation failed on the connection
+func (p *connPool) put(conn *ldap.Conn, err error) {
+	if isConnError(err) {
+		_ = conn.Close()
+		conn = nil
+	}
+	select {
+	case <-p.closed:
+		if conn != nil {
+			_ = conn.Close()
+		}
+	default:
+	}
+	p.slots <- conn
+}
+
+// do runs fn on a pooled connection, it is retried once on a new connection if the connection is broken,
+// e.g. closed by the server after an idle timeout.
+func (p *connPool) do(fn func(conn *ldap.Conn) error) error {
+	var err error
+	for i := 0; i < 2; i++ {
+		var conn *ldap.Conn
+		if conn, err = p.get(); err != nil {
+			return err
+		}
+		err = fn(conn)
+		p.put(conn, err)
+		if !isConnError(err) {
+			return err
+		}
+	}
+	return err
+}
+
+// check probes the idle connections and closes the broken ones, busy connections are skipped
+func (p *connPool) check(probe func(conn *ldap.Conn) error) {
+	for i := 0; i < cap(p.slots); i++ {
+		var conn *ldap.Conn
+		select {
+		case conn = <-p.slots:
+		default:
+			return
+		}
+		if conn != nil {
+			if err := probe(conn); err != nil {
+				zap.L().Warn("ldap connection is broken, it is redialed on the next use", zap.Error(err))
+				_ = conn.Close()
+				conn = nil
+			}
+		}
+		p.slots <- conn
+	}
+}
+
+// close closes the idle connections, the busy ones are closed when they are put back
+func (p *connPool) close() {
+	p.closeOnce.Do(func() {
+		close(p.closed)
+		for i := 0; i < cap(p.slots); i++ {
+			select {
+			case conn := <-p.slots:
+				if conn != nil {
+					_ = conn.Close()
+				}
+				p.slots <- nil
+			default:
+			}
+		}
+	})
+}
+
+// isConnError reports whether err is a failure of the connection rather than of the request
+func isConnError(err error) bool {
+	return err != nil && (ldap.IsErrorWithCode(err, ldap.ErrorNetwork) || errors.Is(err, ldap.ErrNilConnection))
+}
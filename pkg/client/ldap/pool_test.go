@@ -0,0 +1,115 @@
+package ldap
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/go-ldap/ldap/v3"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// pipeConn returns a started connection to nowhere, it only needs to be open or closed for the pool
+func pipeConn(t *testing.T) *ldap.Conn {
+	client, server := net.Pipe()
+	t.Cleanup(func() { _ = server.Close() })
+	conn := ldap.NewConn(client, false)
+	conn.Start()
+	return conn
+}
+
+func TestConnPool(t *testing.T) {
+	dials := 0
+	p := newConnPool(1, func() (*ldap.Conn, error) {
+		dials++
+		return pipeConn(t), nil
+	})
+
+	var first *ldap.Conn
+	require.NoError(t, p.do(func(conn *ldap.Conn) error {
+		first = conn
+		return nil
+	}))
+	require.NoError(t, p.do(func(conn *ldap.Conn) error {
+		assert.Same(t, first, conn)
+		return nil
+	}))
+	assert.Equal(t, 1, dials)
+
+	// 服务端断开的连接在下次使用时重连
+	first.Close()
+	require.NoError(t, p.do(func(conn *ldap.Conn) error {
+		assert.NotSame(t, first, conn)
+		return nil
+	}))
+	assert.Equal(t, 2, dials)
+
+	// 网络错误时换一个连接重试一次
+	calls := 0
+	require.NoError(t, p.do(func(conn *ldap.Conn) error {
+		if calls++; calls == 1 {
+			return ldap.NewError(ldap.ErrorNetwork, net.ErrClosed)
+		}
+		return nil
+	}))
+	assert.Equal(t, 3, dials)
+
+	// 请求本身的错误不重试, 连接保留
+	err := p.do(func(conn *ldap.Conn) error {
+		return ldap.NewError(ldap.LDAPResultNoSuchObject, nil)
+	})
+	assert.True(t, ldap.IsErrorWithCode(err, ldap.LDAPResultNoSuchObject))
+	assert.Equal(t, 3, dials)
+
+	// 健康检查关闭探测失败的空闲连接
+	p.check(func(conn *ldap.Conn) error { return ldap.NewError(ldap.ErrorNetwork, net.ErrClosed) })
+	require.NoError(t, p.do(func(conn *ldap.Conn) error { return nil }))
+	assert.Equal(t, 4, dials)
+
+	p.close()
+	assert.ErrorIs(t, p.do(func(conn *ldap.Conn) error { return nil }), errPoolClosed)
+}
+
+func TestNewTLSConfig(t *testing.T) {
+	opts := NewLDAPOptions(SetDefaultLDAPHost("ldap.example.com"))
+	config, err := newTLSConfig(opts)
+	require.NoError(t, err)
+	assert.Equal(t, "ldap.example.com", config.ServerName)
+	assert.False(t, config.InsecureSkipVerify)
+	assert.Nil(t, config.RootCAs)
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test ca"},
+		NotBefore:             time.Now(),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err)
+	opts.CAFile = filepath.Join(t.TempDir(), "ca.pem")
+	require.NoError(t, os.WriteFile(opts.CAFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600))
+	opts.ServerName = "ldap.internal"
+
+	config, err = newTLSConfig(opts)
+	require.NoError(t, err)
+	assert.Equal(t, "ldap.internal", config.ServerName)
+	assert.NotNil(t, config.RootCAs)
+
+	require.NoError(t, os.WriteFile(opts.CAFile, []byte("not a certificate"), 0600))
+	_, err = newTLSConfig(opts)
+	assert.Error(t, err)
+}
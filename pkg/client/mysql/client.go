@@ -4,20 +4,42 @@ import (
 	"fmt"
 
 	"gorm.io/driver/mysql"
+	"gorm.io/driver/postgres"
+	"gorm.io/driver/sqlite"
 	"gorm.io/gorm"
 	"gorm.io/gorm/logger"
 )
 
-// NewMysqlClient create a gorm mysql client
-func NewMysqlClient(options *Options) (*gorm.DB, error) {
-	dsn := fmt.Sprintf("%s:%s@tcp(%s:%d)/%s?charset=utf8mb4&parseTime=True&loc=Local",
-		options.RdbUser, options.RdbPassword, options.RdbHost, options.RdbPort, options.RdbDbname)
+// NewRDBClient create a gorm client of the configured driver
+func NewRDBClient(options *Options) (*gorm.DB, error) {
+	dialector, err := newDialector(options)
+	if err != nil {
+		return nil, err
+	}
 
-	db, err := gorm.Open(mysql.Open(dsn))
+	// TranslateError maps the unique key violations of every driver to gorm.ErrDuplicatedKey
+	db, err := gorm.Open(dialector, &gorm.Config{TranslateError: true})
 	if err != nil {
 		return nil, err
 	}
-	db.Logger = db.Logger.LogMode(logger.LogLevel(options.RdbLogLevel))
 
+	db.Logger = db.Logger.LogMode(logger.LogLevel(options.RdbLogLevel))
 	return db, nil
 }
+
+func newDialector(options *Options) (gorm.Dialector, error) {
+	switch options.RdbDriver {
+	case DriverMySQL, "":
+		dsn := fmt.Sprintf("%s:%s@tcp(%s:%d)/%s?charset=utf8mb4&parseTime=True&loc=Local",
+			options.RdbUser, options.RdbPassword, options.RdbHost, options.RdbPort, options.RdbDbname)
+		return mysql.Open(dsn), nil
+	case DriverPostgres:
+		dsn := fmt.Sprintf("host=%s port=%d user=%s password=%s dbname=%s sslmode=prefer",
+			options.RdbHost, options.RdbPort, options.RdbUser, options.RdbPassword, options.RdbDbname)
+		return postgres.Open(dsn), nil
+	case DriverSQLite:
+		return sqlite.Open(options.RdbDbname), nil
+	default:
+		return nil, fmt.Errorf("rdb driver %q is not supported", options.RdbDriver)
+	}
+}
@@ -2,7 +2,10 @@ package mysql
 
 import (
 	"fmt"
+	"net"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/spf13/pflag"
 	"github.com/spf13/viper"
@@ -10,16 +13,35 @@ import (
 )
 
 const (
+	rdbDriver   = "rdb-driver"
 	rdbUser     = "rdb-user"
 	rdbPassword = "rdb-password"
 	rdbHost     = "rdb-host"
 	rdbPort     = "rdb-port"
 	rdbDbname   = "rdb-dbname"
 	rdbLogLevel = "rdb-log-level"
+
+	rdbReplicas          = "rdb-replicas"
+	rdbReadYourWritesTTL = "rdb-read-your-writes-ttl"
+)
+
+// Supported database drivers
+const (
+	DriverMySQL    = "mysql"
+	DriverPostgres = "postgres"
+	// DriverSQLite uses RdbDbname as the database file, it is meant for local development and tests
+	DriverSQLite = "sqlite"
 )
 
 type DefaultOption func(o *Options)
 
+// SetDefaultRdbDriver returns a DefaultOption that specifies default RdbDriver parameters
+func SetDefaultRdbDriver(s string) DefaultOption {
+	return func(o *Options) {
+		o.RdbDriver = s
+	}
+}
+
 // SetDefaultRdbUser returns a DefaultOption that specifies default RdbUser parameters
 func SetDefaultRdbUser(s string) DefaultOption {
 	return func(o *Options) {
@@ -55,6 +77,20 @@ func SetDefaultRdbDbname(s string) DefaultOption {
 	}
 }
 
+// SetDefaultRdbReplicas returns a DefaultOption that specifies default RdbReplicas parameters
+func SetDefaultRdbReplicas(replicas ...string) DefaultOption {
+	return func(o *Options) {
+		o.RdbReplicas = replicas
+	}
+}
+
+// SetDefaultRdbReadYourWritesTTL returns a DefaultOption that specifies default RdbReadYourWritesTTL parameters
+func SetDefaultRdbReadYourWritesTTL(d time.Duration) DefaultOption {
+	return func(o *Options) {
+		o.RdbReadYourWritesTTL = d
+	}
+}
+
 // SetDefaultRdbLogLevel returns a DefaultOption that specifies default RdbLogLevel parameters
 func SetDefaultRdbLogLevel(n logger.LogLevel) DefaultOption {
 	return func(o *Options) {
@@ -63,24 +99,32 @@ func SetDefaultRdbLogLevel(n logger.LogLevel) DefaultOption {
 }
 
 type Options struct {
+	RdbDriver   string
 	RdbUser     string
 	RdbPassword string
 	RdbHost     string
 	RdbPort     int
 	RdbDbname   string
 	RdbLogLevel int
-	v           *viper.Viper
+	// RdbReplicas are the host:port of the read replicas, they share user, password and dbname with the primary
+	RdbReplicas []string
+	// RdbReadYourWritesTTL is how long a user reads from the primary after a write, 0 disables it
+	RdbReadYourWritesTTL time.Duration
+	v                    *viper.Viper
 }
 
 func NewMysqlOptions(opts ...DefaultOption) *Options {
 	o := &Options{
+		RdbDriver:   DriverMySQL,
 		RdbUser:     "root",
 		RdbPassword: "123456",
 		RdbHost:     "localhost",
 		RdbPort:     3306,
 		RdbDbname:   "async_km",
 		RdbLogLevel: int(logger.Info),
-		v:           viper.NewWithOptions(viper.EnvKeyReplacer(strings.NewReplacer("-", "_"))),
+
+		RdbReadYourWritesTTL: time.Second * 5,
+		v:                    viper.NewWithOptions(viper.EnvKeyReplacer(strings.NewReplacer("-", "_"))),
 	}
 
 	for _, opt := range opts {
@@ -92,18 +136,67 @@ func NewMysqlOptions(opts ...DefaultOption) *Options {
 }
 
 func (o *Options) loadEnv() {
+	o.RdbDriver = o.v.GetString(rdbDriver)
 	o.RdbUser = o.v.GetString(rdbUser)
 	o.RdbPassword = o.v.GetString(rdbPassword)
 	o.RdbHost = o.v.GetString(rdbHost)
 	o.RdbPort = o.v.GetInt(rdbPort)
 	o.RdbDbname = o.v.GetString(rdbDbname)
 	o.RdbLogLevel = o.v.GetInt(rdbLogLevel)
+	// 环境变量中的副本以逗号分隔
+	var replicas []string
+	for _, replica := range o.v.GetStringSlice(rdbReplicas) {
+		for _, addr := range strings.Split(replica, ",") {
+			if addr = strings.TrimSpace(addr); addr != "" {
+				replicas = append(replicas, addr)
+			}
+		}
+	}
+	o.RdbReplicas = replicas
+	o.RdbReadYourWritesTTL = o.v.GetDuration(rdbReadYourWritesTTL)
+}
+
+// ReplicaOptions returns the connection options of every read replica.
+func (o *Options) ReplicaOptions() ([]*Options, error) {
+	replicas := make([]*Options, 0, len(o.RdbReplicas))
+	for _, addr := range o.RdbReplicas {
+		host, port, err := net.SplitHostPort(addr)
+		if err != nil {
+			return nil, fmt.Errorf("rdb replica %q is invalid: %w", addr, err)
+		}
+		p, err := strconv.Atoi(port)
+		if err != nil || p <= 0 || p > 65535 {
+			return nil, fmt.Errorf("rdb replica %q has an invalid port", addr)
+		}
+
+		replica := *o
+		replica.RdbHost = host
+		replica.RdbPort = p
+		replica.RdbReplicas = nil
+		replicas = append(replicas, &replica)
+	}
+	return replicas, nil
 }
 
 // Validate check options
 func (o *Options) Validate() []error {
 	errors := make([]error, 0)
 
+	switch o.RdbDriver {
+	case DriverMySQL, DriverPostgres:
+	case DriverSQLite:
+		// sqlite only needs the database file
+		if o.RdbDbname == "" {
+			errors = append(errors, fmt.Errorf("rdb dbname is empty"))
+		}
+		if len(o.RdbReplicas) != 0 {
+			errors = append(errors, fmt.Errorf("rdb replicas are not supported by sqlite"))
+		}
+		return errors
+	default:
+		errors = append(errors, fmt.Errorf("rdb driver %q is not supported", o.RdbDriver))
+	}
+
 	if o.RdbUser == "" {
 		errors = append(errors, fmt.Errorf("rdb user is empty"))
 	}
@@ -119,18 +212,27 @@ func (o *Options) Validate() []error {
 	if o.RdbDbname == "" {
 		errors = append(errors, fmt.Errorf("rdb dbname is empty"))
 	}
+	if _, err := o.ReplicaOptions(); err != nil {
+		errors = append(errors, err)
+	}
+	if o.RdbReadYourWritesTTL < 0 {
+		errors = append(errors, fmt.Errorf("rdb read your writes ttl is negative"))
+	}
 
 	return errors
 }
 
 // AddFlags add option flags to command line flags,
 func (o *Options) AddFlags(fs *pflag.FlagSet) {
+	fs.StringVar(&o.RdbDriver, rdbDriver, o.RdbDriver, "database driver, one of mysql, postgres and sqlite. env RDB_DRIVER")
 	fs.StringVar(&o.RdbUser, rdbUser, o.RdbUser, "env RDB_USER")
 	fs.StringVar(&o.RdbPassword, rdbPassword, o.RdbPassword, "env RDB_PASSWORD")
 	fs.StringVar(&o.RdbHost, rdbHost, o.RdbHost, "env RDB_HOST")
 	fs.IntVar(&o.RdbPort, rdbPort, o.RdbPort, "env RDB_PORT")
 	fs.StringVar(&o.RdbDbname, rdbDbname, o.RdbDbname, "env RDB_DBNAME")
 	fs.IntVar(&o.RdbLogLevel, rdbLogLevel, o.RdbLogLevel, "logs level. env RDB_LOG_LEVEL")
+	fs.StringSliceVar(&o.RdbReplicas, rdbReplicas, o.RdbReplicas, "host:port of the read replicas, reads of list and detail queries are spread over the healthy ones. env RDB_REPLICAS")
+	fs.DurationVar(&o.RdbReadYourWritesTTL, rdbReadYourWritesTTL, o.RdbReadYourWritesTTL, "how long a user reads from the primary after a write, 0 disables it. env RDB_READ_YOUR_WRITES_TTL")
 
 	_ = o.v.BindPFlags(fs)
 	o.loadEnv()
@@ -56,3 +56,35 @@ func TestNewRDBOptions(t *testing.T) {
 	assert.Equal(t, "fake1", options.RdbDbname)
 	assert.Equal(t, 2, options.RdbLogLevel)
 }
+
+func TestOptions_ValidateDriver(t *testing.T) {
+	options := NewMysqlOptions(SetDefaultRdbDriver(DriverSQLite), SetDefaultRdbUser(""), SetDefaultRdbPassword(""), SetDefaultRdbHost(""))
+	assert.Empty(t, options.Validate())
+
+	options = NewMysqlOptions(SetDefaultRdbDriver(DriverPostgres), SetDefaultRdbHost(""))
+	assert.Len(t, options.Validate(), 1)
+
+	options = NewMysqlOptions(SetDefaultRdbDriver("oracle"))
+	assert.Len(t, options.Validate(), 1)
+
+	options = NewMysqlOptions(SetDefaultRdbDriver(DriverSQLite), SetDefaultRdbReplicas("replica:3306"))
+	assert.Len(t, options.Validate(), 1)
+}
+
+func TestOptions_ReplicaOptions(t *testing.T) {
+	t.Setenv("RDB_REPLICAS", "replica-0:3306,replica-1:3307")
+	options := NewMysqlOptions()
+	options.AddFlags(pflag.NewFlagSet("fake", pflag.ExitOnError))
+	assert.Empty(t, options.Validate())
+
+	replicas, err := options.ReplicaOptions()
+	assert.NoError(t, err)
+	if assert.Len(t, replicas, 2) {
+		assert.Equal(t, "replica-1", replicas[1].RdbHost)
+		assert.Equal(t, 3307, replicas[1].RdbPort)
+		assert.Equal(t, options.RdbDbname, replicas[1].RdbDbname)
+	}
+
+	options.RdbReplicas = []string{"replica-0"}
+	assert.Len(t, options.Validate(), 1)
+}
@@ -0,0 +1,71 @@
+package dao
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"asyncKubeManager/pkg/dbresolver"
+	"asyncKubeManager/pkg/model"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// InsertIdempotencyRecordIfAbsent inserts the record unless one with the same uid and key exists,
+// it returns whether the record was inserted.
+func InsertIdempotencyRecordIfAbsent(ctx context.Context, dbResolver *dbresolver.DBResolver, record *model.IdempotencyRecord) (bool, error) {
+	db := dbResolver.GetDB()
+	res := db.WithContext(ctx).Clauses(clause.OnConflict{DoNothing: true}).Create(record)
+	if res.Error != nil {
+		return false, res.Error
+	}
+	return res.RowsAffected > 0, nil
+}
+
+// GetIdempotencyRecord retrieves the record of the given uid and key.
+func GetIdempotencyRecord(ctx context.Context, dbResolver *dbresolver.DBResolver, uid, key string) (bool, *model.IdempotencyRecord, error) {
+	db := dbResolver.GetDB()
+	record := model.IdempotencyRecord{}
+	err := db.WithContext(ctx).Where("uid = ? AND idempotency_key = ?", uid, key).First(&record).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return false, nil, nil
+		}
+		return false, nil, err
+	}
+	return true, &record, nil
+}
+
+// UpdateIdempotencyRecord updates the record of the given uid and key.
+func UpdateIdempotencyRecord(ctx context.Context, dbResolver *dbresolver.DBResolver, uid, key string, updates map[string]interface{}) error {
+	db := dbResolver.GetDB()
+	return db.WithContext(ctx).Model(&model.IdempotencyRecord{}).Where("uid = ? AND idempotency_key = ?", uid, key).Updates(updates).Error
+}
+
+// RefreshIdempotencyRecord moves the expiration of the record of the given uid and key to expiresAt
+// while it is still processing.
+func RefreshIdempotencyRecord(ctx context.Context, dbResolver *dbresolver.DBResolver, uid, key string, expiresAt time.Time) error {
+	db := dbResolver.GetDB()
+	return db.WithContext(ctx).Model(&model.IdempotencyRecord{}).
+		Where("uid = ? AND idempotency_key = ? AND status = ?", uid, key, model.IdempotencyStatusProcessing).
+		Update("expires_at", expiresAt.UnixMilli()).Error
+}
+
+// DeleteIdempotencyRecord deletes the record of the given uid and key.
+func DeleteIdempotencyRecord(ctx context.Context, dbResolver *dbresolver.DBResolver, uid, key string) error {
+	db := dbResolver.GetDB()
+	return db.WithContext(ctx).Where("uid = ? AND idempotency_key = ?", uid, key).Delete(&model.IdempotencyRecord{}).Error
+}
+
+// DeleteExpiredIdempotencyRecord deletes the record of the given uid and key if it expired before the given time.
+func DeleteExpiredIdempotencyRecord(ctx context.Context, dbResolver *dbresolver.DBResolver, uid, key string, before time.Time) error {
+	db := dbResolver.GetDB()
+	return db.WithContext(ctx).Where("uid = ? AND idempotency_key = ? AND expires_at < ?", uid, key, before.UnixMilli()).
+		Delete(&model.IdempotencyRecord{}).Error
+}
+
+// DeleteExpiredIdempotencyRecords deletes all records expired before the given time.
+func DeleteExpiredIdempotencyRecords(ctx context.Context, dbResolver *dbresolver.DBResolver, before time.Time) error {
+	db := dbResolver.GetDB()
+	return db.WithContext(ctx).Where("expires_at < ?", before.UnixMilli()).Delete(&model.IdempotencyRecord{}).Error
+}
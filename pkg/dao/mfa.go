@@ -0,0 +1,138 @@
+package dao
+
+import (
+	"asyncKubeManager/pkg/dbresolver"
+	"asyncKubeManager/pkg/model"
+	"asyncKubeManager/pkg/token"
+	"context"
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// GetUserMFA returns the TOTP factor of the user, confirmed or not.
+// It reads from the primary, a disabled enrollment must not be enforced by a lagging replica.
+func GetUserMFA(ctx context.Context, dbResolver *dbresolver.DBResolver, uid string) (bool, *model.UserMFA, error) {
+	db := dbResolver.GetDB()
+	mfa := model.UserMFA{}
+	err := db.WithContext(ctx).Where("uid = ?", uid).First(&mfa).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return false, nil, nil
+		}
+		return false, nil, err
+	}
+	return true, &mfa, nil
+}
+
+// SaveUnconfirmedUserMFA replaces the factor of the user by an unconfirmed one with the secret
+func SaveUnconfirmedUserMFA(ctx context.Context, dbResolver *dbresolver.DBResolver, uid, secret string) error {
+	db := dbResolver.GetDB()
+	mfa := model.UserMFA{UID: uid, Secret: secret}
+	return db.WithContext(ctx).Clauses(clause.OnConflict{
+		Columns: []clause.Column{{Name: "uid"}},
+		DoUpdates: clause.Assignments(map[string]interface{}{
+			"secret":       secret,
+			"confirmed_at": 0,
+			"last_step":    0,
+			"updated_at":   time.Now().UnixMilli(),
+		}),
+	}).Create(&mfa).Error
+}
+
+// AcceptUserMFAStep records step as the last accepted code, it returns false if a code of the
+// same or a later step has been accepted already, e.g. by a concurrent login replaying the code.
+func AcceptUserMFAStep(ctx context.Context, dbResolver *dbresolver.DBResolver, uid string, step int64) (bool, error) {
+	return AcceptUserMFAStepWithDB(ctx, dbResolver.GetDB(), uid, step)
+}
+
+func AcceptUserMFAStepWithDB(ctx context.Context, db *gorm.DB, uid string, step int64) (bool, error) {
+	res := db.WithContext(ctx).Model(&model.UserMFA{}).
+		Where("uid = ? AND last_step < ?", uid, step).
+		Updates(map[string]interface{}{"last_step": step, "updated_at": time.Now().UnixMilli()})
+	if res.Error != nil {
+		return false, res.Error
+	}
+	return res.RowsAffected > 0, nil
+}
+
+func ConfirmUserMFAWithDB(ctx context.Context, db *gorm.DB, uid string) error {
+	return db.WithContext(ctx).Model(&model.UserMFA{}).
+		Where("uid = ?", uid).
+		Update("confirmed_at", time.Now().UnixMilli()).Error
+}
+
+// DeleteUserMFA removes the factor and the recovery codes of the user
+func DeleteUserMFA(ctx context.Context, dbResolver *dbresolver.DBResolver, uid string) error {
+	return dbResolver.GetDB().Transaction(func(tx *gorm.DB) error {
+		if err := tx.WithContext(ctx).Where("uid = ?", uid).Delete(&model.MFARecoveryCode{}).Error; err != nil {
+			return err
+		}
+		return tx.WithContext(ctx).Where("uid = ?", uid).Delete(&model.UserMFA{}).Error
+	})
+}
+
+// ReplaceMFARecoveryCodesWithDB replaces the recovery codes of the user by the hashes
+func ReplaceMFARecoveryCodesWithDB(ctx context.Context, db *gorm.DB, uid string, hashes []string) error {
+	if err := db.WithContext(ctx).Where("uid = ?", uid).Delete(&model.MFARecoveryCode{}).Error; err != nil {
+		return err
+	}
+	codes := make([]model.MFARecoveryCode, 0, len(hashes))
+	for _, hash := range hashes {
+		codes = append(codes, model.MFARecoveryCode{UID: uid, CodeHash: hash})
+	}
+	return db.WithContext(ctx).Create(&codes).Error
+}
+
+// UseMFARecoveryCode marks the unused recovery code of the user as used, it returns false if there is none
+func UseMFARecoveryCode(ctx context.Context, dbResolver *dbresolver.DBResolver, uid, codeHash string) (bool, error) {
+	db := dbResolver.GetDB()
+	res := db.WithContext(ctx).Model(&model.MFARecoveryCode{}).
+		Where("uid = ? AND code_hash = ? AND used_at = 0", uid, codeHash).
+		Update("used_at", time.Now().UnixMilli())
+	if res.Error != nil {
+		return false, res.Error
+	}
+	return res.RowsAffected > 0, nil
+}
+
+// CountUnusedMFARecoveryCodes returns the number of recovery codes the user can still use
+func CountUnusedMFARecoveryCodes(ctx context.Context, dbResolver *dbresolver.DBResolver, uid string) (int64, error) {
+	db := dbResolver.GetReadDB(ctx)
+	var count int64
+	err := db.WithContext(ctx).Model(&model.MFARecoveryCode{}).Where("uid = ? AND used_at = 0", uid).Count(&count).Error
+	return count, err
+}
+
+func ListMFARolePolicies(ctx context.Context, dbResolver *dbresolver.DBResolver) ([]model.MFARolePolicy, error) {
+	db := dbResolver.GetReadDB(ctx)
+	var policies []model.MFARolePolicy
+	err := db.WithContext(ctx).Order("role").Find(&policies).Error
+	return policies, err
+}
+
+// IsMFAEnforcedForRole reports whether MFA is enforced for the users of the role.
+// It reads from the primary since it guards the login of the role.
+func IsMFAEnforcedForRole(ctx context.Context, dbResolver *dbresolver.DBResolver, role model.UserRole) (bool, error) {
+	db := dbResolver.GetDB()
+	var count int64
+	err := db.WithContext(ctx).Model(&model.MFARolePolicy{}).Where("role = ? AND enforced = ?", role, true).Count(&count).Error
+	return count > 0, err
+}
+
+// SetMFARolePolicy enforces MFA for the role or stops enforcing it
+func SetMFARolePolicy(ctx context.Context, dbResolver *dbresolver.DBResolver, role model.UserRole, enforced bool) error {
+	db := dbResolver.GetDB()
+	updater := token.GetUIDFromCtx(ctx)
+	policy := model.MFARolePolicy{Role: role, Enforced: enforced, Updater: updater}
+	return db.WithContext(ctx).Clauses(clause.OnConflict{
+		Columns: []clause.Column{{Name: "role"}},
+		DoUpdates: clause.Assignments(map[string]interface{}{
+			"enforced":   enforced,
+			"updater":    updater,
+			"updated_at": time.Now().UnixMilli(),
+		}),
+	}).Create(&policy).Error
+}
@@ -0,0 +1,87 @@
+package dao
+
+import (
+	"asyncKubeManager/pkg/dbresolver"
+	"asyncKubeManager/pkg/model"
+	"context"
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// InsertPersonalAccessTokenWithDB inserts the token, it returns gorm.ErrDuplicatedKey if the user has a valid token of the name
+func InsertPersonalAccessTokenWithDB(ctx context.Context, db *gorm.DB, pat *model.PersonalAccessToken) error {
+	return db.WithContext(ctx).Create(pat).Error
+}
+
+// GetPersonalAccessTokenByHash retrieves the token by its hash, revoked and expired tokens are returned as well.
+// It reads the primary, a token is used right after it is created or revoked.
+func GetPersonalAccessTokenByHash(ctx context.Context, dbResolver *dbresolver.DBResolver, tokenHash string) (bool, *model.PersonalAccessToken, error) {
+	db := dbResolver.GetDB()
+	pat := model.PersonalAccessToken{}
+	err := db.WithContext(ctx).Where("token_hash = ?", tokenHash).First(&pat).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return false, nil, nil
+		}
+		return false, nil, err
+	}
+	return true, &pat, nil
+}
+
+// CountActivePersonalAccessTokensWithDB returns the number of unrevoked and unexpired tokens of the user.
+// It is called with the primary, the limit is checked right before a token is issued.
+func CountActivePersonalAccessTokensWithDB(ctx context.Context, db *gorm.DB, uid string, now time.Time) (int64, error) {
+	var count int64
+	err := db.WithContext(ctx).Model(&model.PersonalAccessToken{}).
+		Where("uid = ? AND revoked_at = 0 AND expires_at > ?", uid, now.UnixMilli()).
+		Count(&count).Error
+	return count, err
+}
+
+// RevokeExpiredPersonalAccessTokenNameWithDB marks the expired tokens of the name as revoked when they expired,
+// so that idx_personal_access_token_name lets a new token take the name
+func RevokeExpiredPersonalAccessTokenNameWithDB(ctx context.Context, db *gorm.DB, uid, name string, now time.Time) error {
+	return db.WithContext(ctx).Model(&model.PersonalAccessToken{}).
+		Where("uid = ? AND name = ? AND revoked_at = 0 AND expires_at <= ?", uid, name, now.UnixMilli()).
+		Update("revoked_at", gorm.Expr("expires_at")).Error
+}
+
+// ListPersonalAccessTokens returns the tokens of the user the newest first, uid "" lists the tokens of all users
+func ListPersonalAccessTokens(ctx context.Context, dbResolver *dbresolver.DBResolver, uid string) ([]model.PersonalAccessToken, error) {
+	db := dbResolver.GetReadDB(ctx).WithContext(ctx)
+	if uid != "" {
+		db = db.Where("uid = ?", uid)
+	}
+	var pats []model.PersonalAccessToken
+	err := db.Order("id DESC").Find(&pats).Error
+	return pats, err
+}
+
+// RevokePersonalAccessToken revokes the token of the user, uid "" revokes the token of any user.
+// It returns false if there is no such valid token.
+func RevokePersonalAccessToken(ctx context.Context, dbResolver *dbresolver.DBResolver, id int64, uid string, now time.Time) (bool, error) {
+	db := dbResolver.GetDB().WithContext(ctx).Model(&model.PersonalAccessToken{}).Where("id = ? AND revoked_at = 0", id)
+	if uid != "" {
+		db = db.Where("uid = ?", uid)
+	}
+	res := db.Update("revoked_at", now.UnixMilli())
+	if res.Error != nil {
+		return false, res.Error
+	}
+	return res.RowsAffected > 0, nil
+}
+
+// RevokePersonalAccessTokensByUID revokes all tokens of the user
+func RevokePersonalAccessTokensByUID(ctx context.Context, dbResolver *dbresolver.DBResolver, uid string, now time.Time) error {
+	return dbResolver.GetDB().WithContext(ctx).Model(&model.PersonalAccessToken{}).
+		Where("uid = ? AND revoked_at = 0", uid).
+		Update("revoked_at", now.UnixMilli()).Error
+}
+
+func UpdatePersonalAccessTokenLastUsed(ctx context.Context, dbResolver *dbresolver.DBResolver, id int64, now time.Time) error {
+	return dbResolver.GetDB().WithContext(ctx).Model(&model.PersonalAccessToken{}).
+		Where("id = ?", id).
+		Update("last_used_at", now.UnixMilli()).Error
+}
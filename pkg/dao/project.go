@@ -0,0 +1,262 @@
+package dao
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"asyncKubeManager/pkg/dbresolver"
+	"asyncKubeManager/pkg/model"
+	"asyncKubeManager/pkg/token"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+func InsertProjectWithDB(ctx context.Context, db *gorm.DB, uid, name, namespace, desc string) (*model.Project, error) {
+	creator := token.GetUIDFromCtx(ctx)
+	project := model.Project{
+		UID:       uid,
+		Name:      name,
+		Namespace: namespace,
+		Desc:      desc,
+		Creator:   creator,
+		Updater:   creator,
+	}
+
+	err := db.WithContext(ctx).Create(&project).Error
+	return &project, err
+}
+
+// GetProjectByUID retrieves the project of the given uid.
+// It reads from the primary since it resolves the project of every scoped request.
+func GetProjectByUID(ctx context.Context, dbResolver *dbresolver.DBResolver, uid string) (bool, *model.Project, error) {
+	db := dbResolver.GetDB()
+	return getProjectWithDB(ctx, db, "uid = ?", uid)
+}
+
+// GetProjectByName retrieves the project of the given name.
+// It reads from the primary, like GetProjectByUID.
+func GetProjectByName(ctx context.Context, dbResolver *dbresolver.DBResolver, name string) (bool, *model.Project, error) {
+	db := dbResolver.GetDB()
+	return getProjectWithDB(ctx, db, "name = ?", name)
+}
+
+// GetProjectByID retrieves the project of the given id.
+// It reads from the primary, like GetProjectByUID.
+func GetProjectByID(ctx context.Context, dbResolver *dbresolver.DBResolver, id int64) (bool, *model.Project, error) {
+	db := dbResolver.GetDB()
+	return getProjectWithDB(ctx, db, "id = ?", id)
+}
+
+func getProjectWithDB(ctx context.Context, db *gorm.DB, query string, args ...interface{}) (bool, *model.Project, error) {
+	p := model.Project{}
+	err := db.WithContext(ctx).Where(query, args...).First(&p).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return false, nil, nil
+		}
+		return false, nil, err
+	}
+	return true, &p, nil
+}
+
+func UpdateProjectByID(ctx context.Context, dbResolver *dbresolver.DBResolver, id int64, updates map[string]interface{}) error {
+	db := dbResolver.GetDB()
+	updates["updater"] = token.GetUIDFromCtx(ctx)
+	updates["updated_at"] = time.Now().UnixMilli()
+
+	return db.WithContext(ctx).Model(&model.Project{}).Where("id = ?", id).Updates(updates).Error
+}
+
+// DeleteProjectByIDWithDB deletes the project together with its members, service accounts and quota.
+func DeleteProjectByIDWithDB(ctx context.Context, db *gorm.DB, id int64) error {
+	if err := db.WithContext(ctx).Where("project_id = ?", id).Delete(&model.ProjectMember{}).Error; err != nil {
+		return err
+	}
+	if err := db.WithContext(ctx).Where("project_id = ?", id).Delete(&model.ServiceAccount{}).Error; err != nil {
+		return err
+	}
+	if err := db.WithContext(ctx).Where("project_id = ?", id).Delete(&model.ProjectQuota{}).Error; err != nil {
+		return err
+	}
+	return db.WithContext(ctx).Where("id = ?", id).Delete(&model.Project{}).Error
+}
+
+// PurgeProjectByIDWithDB permanently deletes the project together with its members and quota.
+// It undoes a project whose namespace could not be created and finishes the deletion of a project
+// whose namespace is gone, so that its name and namespace can be used again.
+// The service accounts stay soft-deleted, the audit logs still resolve the names of their actions.
+func PurgeProjectByIDWithDB(ctx context.Context, db *gorm.DB, id int64) error {
+	if err := db.WithContext(ctx).Where("project_id = ?", id).Delete(&model.ProjectMember{}).Error; err != nil {
+		return err
+	}
+	// deleted_id 释放名字, 包括删除项目时已经软删除的 service account
+	if err := db.WithContext(ctx).Unscoped().Model(&model.ServiceAccount{}).Where("project_id = ?", id).
+		UpdateColumn("deleted_id", gorm.Expr("id")).Error; err != nil {
+		return err
+	}
+	if err := db.WithContext(ctx).Where("project_id = ?", id).Delete(&model.ServiceAccount{}).Error; err != nil {
+		return err
+	}
+	if err := db.WithContext(ctx).Where("project_id = ?", id).Delete(&model.ProjectQuota{}).Error; err != nil {
+		return err
+	}
+	return db.WithContext(ctx).Unscoped().Where("id = ?", id).Delete(&model.Project{}).Error
+}
+
+// RestoreProjectWithDB undoes DeleteProjectByIDWithDB, the members and quota are the ones read before the deletion.
+// Service accounts deleted since the given time are restored as well.
+func RestoreProjectWithDB(ctx context.Context, db *gorm.DB, id int64, members []model.ProjectMember, quota *model.ProjectQuota, deletedSince time.Time) error {
+	if err := db.WithContext(ctx).Unscoped().Model(&model.Project{}).Where("id = ?", id).Update("deleted_at", nil).Error; err != nil {
+		return err
+	}
+	if err := db.WithContext(ctx).Unscoped().Model(&model.ServiceAccount{}).
+		Where("project_id = ? AND deleted_at >= ?", id, deletedSince).Update("deleted_at", nil).Error; err != nil {
+		return err
+	}
+	if len(members) > 0 {
+		if err := db.WithContext(ctx).Create(&members).Error; err != nil {
+			return err
+		}
+	}
+	if quota != nil {
+		return db.WithContext(ctx).Create(quota).Error
+	}
+	return nil
+}
+
+// ListProjects retrieves all projects.
+func ListProjects(ctx context.Context, dbResolver *dbresolver.DBResolver) ([]model.Project, error) {
+	db := dbResolver.GetReadDB(ctx)
+	var projects []model.Project
+	err := db.WithContext(ctx).Find(&projects).Error
+	return projects, err
+}
+
+// ListProjectsByMember retrieves the projects the user is a member of.
+// It reads from the primary so that a removed member doesn't see the project any more.
+func ListProjectsByMember(ctx context.Context, dbResolver *dbresolver.DBResolver, uid string) ([]model.Project, error) {
+	db := dbResolver.GetDB()
+	var projects []model.Project
+	err := db.WithContext(ctx).
+		Where("id IN (?)", db.Model(&model.ProjectMember{}).Select("project_id").Where("uid = ?", uid)).
+		Find(&projects).Error
+	return projects, err
+}
+
+func InsertProjectMemberWithDB(ctx context.Context, db *gorm.DB, projectID int64, uid string, role model.ProjectRole) (*model.ProjectMember, error) {
+	member := model.ProjectMember{
+		ProjectID: projectID,
+		UID:       uid,
+		Role:      role,
+		Creator:   token.GetUIDFromCtx(ctx),
+	}
+
+	err := db.WithContext(ctx).Create(&member).Error
+	return &member, err
+}
+
+func InsertProjectMember(ctx context.Context, dbResolver *dbresolver.DBResolver, projectID int64, uid string, role model.ProjectRole) (*model.ProjectMember, error) {
+	db := dbResolver.GetDB()
+	return InsertProjectMemberWithDB(ctx, db, projectID, uid, role)
+}
+
+// GetProjectMember retrieves the membership of the user in the project.
+// It reads from the primary since the membership decides the access to the project.
+func GetProjectMember(ctx context.Context, dbResolver *dbresolver.DBResolver, projectID int64, uid string) (bool, *model.ProjectMember, error) {
+	db := dbResolver.GetDB()
+	m := model.ProjectMember{}
+	err := db.WithContext(ctx).Where("project_id = ? AND uid = ?", projectID, uid).First(&m).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return false, nil, nil
+		}
+		return false, nil, err
+	}
+	return true, &m, nil
+}
+
+func UpdateProjectMemberRole(ctx context.Context, dbResolver *dbresolver.DBResolver, projectID int64, uid string, role model.ProjectRole) error {
+	db := dbResolver.GetDB()
+	return db.WithContext(ctx).Model(&model.ProjectMember{}).Where("project_id = ? AND uid = ?", projectID, uid).Update("role", role).Error
+}
+
+func DeleteProjectMember(ctx context.Context, dbResolver *dbresolver.DBResolver, projectID int64, uid string) error {
+	db := dbResolver.GetDB()
+	return db.WithContext(ctx).Where("project_id = ? AND uid = ?", projectID, uid).Delete(&model.ProjectMember{}).Error
+}
+
+// CountProjectAdminsWithDB counts the admins of the project. The rows of the admins are locked until
+// the transaction of db ends, so that concurrent demotions can't both see another admin.
+func CountProjectAdminsWithDB(ctx context.Context, db *gorm.DB, projectID int64) (int64, error) {
+	var ids []int64
+	err := db.WithContext(ctx).Model(&model.ProjectMember{}).Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("project_id = ? AND role = ?", projectID, model.ProjectRoleAdmin).Pluck("id", &ids).Error
+	return int64(len(ids)), err
+}
+
+func ListProjectMembers(ctx context.Context, dbResolver *dbresolver.DBResolver, projectID int64) ([]model.ProjectMember, error) {
+	db := dbResolver.GetReadDB(ctx)
+	var members []model.ProjectMember
+	err := db.WithContext(ctx).Where("project_id = ?", projectID).Find(&members).Error
+	return members, err
+}
+
+// ListProjectMembersByUID returns the memberships of a user.
+// It reads from the primary, like GetProjectMember.
+func ListProjectMembersByUID(ctx context.Context, dbResolver *dbresolver.DBResolver, uid string) ([]model.ProjectMember, error) {
+	db := dbResolver.GetDB()
+	var members []model.ProjectMember
+	err := db.WithContext(ctx).Where("uid = ?", uid).Find(&members).Error
+	return members, err
+}
+
+func GetProjectQuota(ctx context.Context, dbResolver *dbresolver.DBResolver, projectID int64) (bool, *model.ProjectQuota, error) {
+	db := dbResolver.GetReadDB(ctx)
+	q := model.ProjectQuota{}
+	err := db.WithContext(ctx).Where("project_id = ?", projectID).First(&q).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return false, nil, nil
+		}
+		return false, nil, err
+	}
+	return true, &q, nil
+}
+
+// DeleteProjectQuotaWithDB deletes the quota of the project.
+func DeleteProjectQuotaWithDB(ctx context.Context, db *gorm.DB, projectID int64) error {
+	return db.WithContext(ctx).Where("project_id = ?", projectID).Delete(&model.ProjectQuota{}).Error
+}
+
+// SaveProjectQuotaWithDB creates or replaces the quota of the project.
+func SaveProjectQuotaWithDB(ctx context.Context, db *gorm.DB, quota *model.ProjectQuota) error {
+	quota.Updater = token.GetUIDFromCtx(ctx)
+	existing := model.ProjectQuota{}
+	err := db.WithContext(ctx).Where("project_id = ?", quota.ProjectID).First(&existing).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return db.WithContext(ctx).Create(quota).Error
+		}
+		return err
+	}
+	quota.ID = existing.ID
+	return db.WithContext(ctx).Save(quota).Error
+}
+
+// CountVMsByProjectID counts the VMs of the project.
+// It reads from the primary since it guards the deletion of the project.
+func CountVMsByProjectID(ctx context.Context, dbResolver *dbresolver.DBResolver, projectID int64) (int64, error) {
+	db := dbResolver.GetDB()
+	var count int64
+	err := db.WithContext(ctx).Model(&model.VM{}).Where("project_id = ?", projectID).Count(&count).Error
+	return count, err
+}
+
+// ListEventLogsByProjectID retrieves the event logs of the project's resources.
+func ListEventLogsByProjectID(ctx context.Context, dbResolver *dbresolver.DBResolver, projectID int64) ([]model.EventLog, error) {
+	db := dbResolver.GetReadDB(ctx)
+	var logs []model.EventLog
+	err := db.WithContext(ctx).Where("project_id = ?", projectID).Find(&logs).Error
+	return logs, err
+}
@@ -0,0 +1,78 @@
+package dao
+
+import (
+	"asyncKubeManager/pkg/model"
+	"asyncKubeManager/pkg/testutil"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEventLogProjectID(t *testing.T) {
+	dr := testutil.NewDBResolver(t)
+	ctx := context.Background()
+
+	vm, err := InsertVM(ctx, dr, 7, "vm-1", "ubuntu", "uid-1", 2, 2048)
+	require.NoError(t, err)
+
+	// 未指定项目的虚拟机事件由虚拟机补全项目
+	require.NoError(t, dr.GetDB().Create(&model.EventLog{
+		ResourceType: model.ResourceTypeVM, ResourceUID: vm.UID, EventType: model.EventTypeCreation, Operation: "create",
+	}).Error)
+	logs, err := ListEventLogsByProjectID(ctx, dr, 7)
+	require.NoError(t, err)
+	assert.Len(t, logs, 1)
+}
+
+func TestDeleteAndRestoreProject(t *testing.T) {
+	dr := testutil.NewDBResolver(t)
+	ctx := context.Background()
+	db := dr.GetDB()
+
+	project, err := InsertProjectWithDB(ctx, db, "p-uid", "p", "ns-p", "")
+	require.NoError(t, err)
+	_, err = InsertProjectMemberWithDB(ctx, db, project.ID, "u1", model.ProjectRoleAdmin)
+	require.NoError(t, err)
+	require.NoError(t, SaveProjectQuotaWithDB(ctx, db, &model.ProjectQuota{ProjectID: project.ID, VMs: 3}))
+	require.NoError(t, InsertServiceAccountWithDB(ctx, db, &model.ServiceAccount{UID: "sa-uid", Name: "pipeline", ProjectID: project.ID,
+		Role: model.UserRoleServiceAccount, Status: model.UserStatusEnabled}))
+
+	count, err := CountProjectAdminsWithDB(ctx, db, project.ID)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), count)
+
+	members, err := ListProjectMembers(ctx, dr, project.ID)
+	require.NoError(t, err)
+	_, quota, err := GetProjectQuota(ctx, dr, project.ID)
+	require.NoError(t, err)
+
+	require.NoError(t, DeleteProjectByIDWithDB(ctx, db, project.ID))
+	found, _, err := GetProjectByID(ctx, dr, project.ID)
+	require.NoError(t, err)
+	assert.False(t, found)
+
+	require.NoError(t, RestoreProjectWithDB(ctx, db, project.ID, members, quota, time.Now().Add(-time.Minute)))
+	found, _, err = GetProjectByID(ctx, dr, project.ID)
+	require.NoError(t, err)
+	assert.True(t, found)
+	found, _, err = GetProjectMember(ctx, dr, project.ID, "u1")
+	require.NoError(t, err)
+	assert.True(t, found)
+
+	// 彻底删除后名称可以再次使用
+	require.NoError(t, PurgeProjectByIDWithDB(ctx, db, project.ID))
+	_, err = InsertProjectWithDB(ctx, db, "p-uid-2", "p", "ns-p", "")
+	assert.NoError(t, err)
+
+	// service account 保持软删除, 审计日志仍然可以显示它的名字
+	found, _, err = GetServiceAccountByUID(ctx, dr, "sa-uid")
+	require.NoError(t, err)
+	assert.False(t, found)
+	sas, err := ListServiceAccountsByUIDs(ctx, dr, []string{"sa-uid"})
+	require.NoError(t, err)
+	require.Len(t, sas, 1)
+	assert.Equal(t, "pipeline", sas[0].Name)
+}
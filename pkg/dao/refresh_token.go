@@ -0,0 +1,76 @@
+package dao
+
+import (
+	"asyncKubeManager/pkg/dbresolver"
+	"asyncKubeManager/pkg/model"
+	"context"
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+func InsertRefreshTokenWithDB(ctx context.Context, db *gorm.DB, refreshToken *model.RefreshToken) error {
+	return db.WithContext(ctx).Create(refreshToken).Error
+}
+
+// GetRefreshTokenByHashWithDB retrieves the refresh token by its hash, revoked tokens are returned as well.
+func GetRefreshTokenByHashWithDB(ctx context.Context, db *gorm.DB, tokenHash string) (bool, *model.RefreshToken, error) {
+	refreshToken := model.RefreshToken{}
+	err := db.WithContext(ctx).Where("token_hash = ?", tokenHash).First(&refreshToken).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return false, nil, nil
+		}
+		return false, nil, err
+	}
+	return true, &refreshToken, nil
+}
+
+// ListRefreshTokenSessionsOfFamilyWithDB retrieves the sessions of all refresh tokens rotated in the family.
+func ListRefreshTokenSessionsOfFamilyWithDB(ctx context.Context, db *gorm.DB, familyID string) ([]string, error) {
+	var sessionIDs []string
+	err := db.WithContext(ctx).Model(&model.RefreshToken{}).
+		Where("family_id = ?", familyID).
+		Distinct().Pluck("session_id", &sessionIDs).Error
+	return sessionIDs, err
+}
+
+// RevokeRefreshTokenWithDB revokes the refresh token if it is still valid,
+// it returns false if the token has been revoked already, e.g. by a concurrent rotation.
+func RevokeRefreshTokenWithDB(ctx context.Context, db *gorm.DB, id int64, now time.Time) (bool, error) {
+	res := db.WithContext(ctx).Model(&model.RefreshToken{}).
+		Where("id = ? AND revoked_at = 0", id).
+		Update("revoked_at", now.UnixMilli())
+	if res.Error != nil {
+		return false, res.Error
+	}
+	return res.RowsAffected > 0, nil
+}
+
+func RevokeRefreshTokenFamilyWithDB(ctx context.Context, db *gorm.DB, familyID string, now time.Time) error {
+	return db.WithContext(ctx).Model(&model.RefreshToken{}).
+		Where("family_id = ? AND revoked_at = 0", familyID).
+		Update("revoked_at", now.UnixMilli()).Error
+}
+
+// RevokeRefreshTokensBySession revokes the refresh tokens issued together with the session's access token.
+func RevokeRefreshTokensBySession(ctx context.Context, dbResolver *dbresolver.DBResolver, uid, sessionID string, now time.Time) error {
+	db := dbResolver.GetDB()
+	return db.WithContext(ctx).Model(&model.RefreshToken{}).
+		Where("uid = ? AND session_id = ? AND revoked_at = 0", uid, sessionID).
+		Update("revoked_at", now.UnixMilli()).Error
+}
+
+func RevokeRefreshTokensByUID(ctx context.Context, dbResolver *dbresolver.DBResolver, uid string, now time.Time) error {
+	db := dbResolver.GetDB()
+	return db.WithContext(ctx).Model(&model.RefreshToken{}).
+		Where("uid = ? AND revoked_at = 0", uid).
+		Update("revoked_at", now.UnixMilli()).Error
+}
+
+// DeleteExpiredRefreshTokens deletes all refresh tokens expired before the given time.
+func DeleteExpiredRefreshTokens(ctx context.Context, dbResolver *dbresolver.DBResolver, before time.Time) error {
+	db := dbResolver.GetDB()
+	return db.WithContext(ctx).Where("expires_at < ?", before.UnixMilli()).Delete(&model.RefreshToken{}).Error
+}
@@ -0,0 +1,211 @@
+package dao
+
+import (
+	"asyncKubeManager/pkg/dbresolver"
+	"asyncKubeManager/pkg/model"
+	"asyncKubeManager/pkg/server/errutil"
+	"asyncKubeManager/pkg/token"
+	"context"
+	"reflect"
+	"sort"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// disksTable is created by the disk module
+const disksTable = "disks"
+
+// RegisterResourceOwnerCallback makes the creator of every inserted disk its owner, in the transaction of the insert.
+// VMs record their owner in InsertVM, disks are inserted by the disk module, so the owner is recorded by a callback.
+func RegisterResourceOwnerCallback(db *gorm.DB) error {
+	return db.Callback().Create().After("gorm:create").Register("dao:resource_owner", func(db *gorm.DB) {
+		if db.Error != nil || db.Statement.Schema == nil || db.Statement.Schema.Table != disksTable {
+			return
+		}
+		ctx := db.Statement.Context
+		creator := token.GetUIDFromCtx(ctx)
+		field := db.Statement.Schema.PrioritizedPrimaryField
+		if creator == "" || field == nil {
+			return
+		}
+
+		values := []reflect.Value{db.Statement.ReflectValue}
+		if db.Statement.ReflectValue.Kind() == reflect.Slice || db.Statement.ReflectValue.Kind() == reflect.Array {
+			values = values[:0]
+			for i := 0; i < db.Statement.ReflectValue.Len(); i++ {
+				values = append(values, reflect.Indirect(db.Statement.ReflectValue.Index(i)))
+			}
+		}
+
+		// a new statement on the same connection, so that the grant is part of the insert transaction,
+		// Model starts the statement, otherwise the following calls clone the statement of the disk
+		tx := db.Session(&gorm.Session{NewDB: true}).Model(&model.ResourceGrant{})
+		for _, v := range values {
+			id, zero := field.ValueOf(ctx, v)
+			if zero {
+				continue
+			}
+			resourceID := reflect.ValueOf(id)
+			if !resourceID.CanInt() {
+				continue
+			}
+			if err := SetResourceOwnerWithDB(ctx, tx, model.ResourceTypeDisk, resourceID.Int(), creator); err != nil {
+				_ = db.AddError(err)
+				return
+			}
+		}
+	})
+}
+
+// SetResourceOwnerWithDB records uid as the owner of the resource, replacing the previous owner.
+func SetResourceOwnerWithDB(ctx context.Context, db *gorm.DB, resourceType model.ResourceType, resourceID int64, uid string) error {
+	err := db.WithContext(ctx).
+		Where("resource_type = ? AND resource_id = ? AND role = ?", resourceType, resourceID, model.ResourceRoleOwner).
+		Delete(&model.ResourceGrant{}).Error
+	if err != nil {
+		return err
+	}
+
+	return SaveResourceGrantWithDB(ctx, db, &model.ResourceGrant{
+		ResourceType: resourceType,
+		ResourceID:   resourceID,
+		SubjectType:  model.GrantSubjectUser,
+		Subject:      uid,
+		Role:         model.ResourceRoleOwner,
+	})
+}
+
+// SaveResourceGrant creates the grant, or updates the role if the subject already has a grant on the resource.
+func SaveResourceGrant(ctx context.Context, dbResolver *dbresolver.DBResolver, grant *model.ResourceGrant) error {
+	db := dbResolver.GetDB()
+	return SaveResourceGrantWithDB(ctx, db, grant)
+}
+
+func SaveResourceGrantWithDB(ctx context.Context, db *gorm.DB, grant *model.ResourceGrant) error {
+	grant.Creator = token.GetUIDFromCtx(ctx)
+	return db.WithContext(ctx).Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "resource_type"}, {Name: "resource_id"}, {Name: "subject_type"}, {Name: "subject"}},
+		DoUpdates: clause.AssignmentColumns([]string{"role", "creator"}),
+	}).Create(grant).Error
+}
+
+// DeleteResourceGrant removes the grant of the subject on the resource.
+func DeleteResourceGrant(ctx context.Context, dbResolver *dbresolver.DBResolver, resourceType model.ResourceType, resourceID int64,
+	subjectType model.GrantSubjectType, subject string) error {
+	db := dbResolver.GetDB()
+	return db.WithContext(ctx).
+		Where("resource_type = ? AND resource_id = ? AND subject_type = ? AND subject = ?", resourceType, resourceID, subjectType, subject).
+		Delete(&model.ResourceGrant{}).Error
+}
+
+// DeleteResourceGrantsWithDB removes all grants of the resource, it is called when the resource is deleted.
+func DeleteResourceGrantsWithDB(ctx context.Context, db *gorm.DB, resourceType model.ResourceType, resourceID int64) error {
+	return db.WithContext(ctx).
+		Where("resource_type = ? AND resource_id = ?", resourceType, resourceID).
+		Delete(&model.ResourceGrant{}).Error
+}
+
+// ListResourceGrants retrieves the grants of the resource, the owner first.
+// It reads from the primary since the owner and grants are changed right before they are listed.
+func ListResourceGrants(ctx context.Context, dbResolver *dbresolver.DBResolver, resourceType model.ResourceType, resourceID int64) ([]model.ResourceGrant, error) {
+	db := dbResolver.GetDB()
+	var grants []model.ResourceGrant
+	err := db.WithContext(ctx).
+		Where("resource_type = ? AND resource_id = ?", resourceType, resourceID).
+		Order("id").
+		Find(&grants).Error
+	sort.SliceStable(grants, func(i, j int) bool {
+		return grants[i].Role == model.ResourceRoleOwner && grants[j].Role != model.ResourceRoleOwner
+	})
+	return grants, err
+}
+
+// GetResourceRole returns the highest role the user has on the resource through its own grant or
+// the grants of its groups, an empty role means no access.
+// It reads from the primary so that a revoked grant stops working at once.
+func GetResourceRole(ctx context.Context, dbResolver *dbresolver.DBResolver, resourceType model.ResourceType, resourceID int64,
+	uid string, groups []string) (model.ResourceRole, error) {
+	db := dbResolver.GetDB()
+	var grants []model.ResourceGrant
+	err := subjectScope(db.WithContext(ctx), uid, groups).
+		Where("resource_type = ? AND resource_id = ?", resourceType, resourceID).
+		Find(&grants).Error
+	if err != nil {
+		return "", err
+	}
+
+	var role model.ResourceRole
+	for _, grant := range grants {
+		if !role.Allows(grant.Role) {
+			role = grant.Role
+		}
+	}
+	return role, nil
+}
+
+// Subject is the user accessing a resource, see access.SubjectFromCtx. Groups are the casbin roles of the user
+// except the built-in roles, admins may access every resource.
+type Subject struct {
+	UID    string
+	Groups []string
+	Admin  bool
+}
+
+// GetSubjectResourceRole returns the role of the subject on the resource, admins are owners of every resource.
+func GetSubjectResourceRole(ctx context.Context, dbResolver *dbresolver.DBResolver, subject Subject, resourceType model.ResourceType,
+	resourceID int64) (model.ResourceRole, error) {
+	if subject.Admin {
+		return model.ResourceRoleOwner, nil
+	}
+	return GetResourceRole(ctx, dbResolver, resourceType, resourceID, subject.UID, subject.Groups)
+}
+
+// CheckDisk checks that the subject has the role need on the disk. A disk the subject can't see at all
+// is reported as errutil.ErrNotFound, a role lower than need as errutil.ErrPermissionDenied.
+func CheckDisk(ctx context.Context, dbResolver *dbresolver.DBResolver, subject Subject, id int64, need model.ResourceRole) error {
+	return checkResourceRole(ctx, dbResolver, subject, model.ResourceTypeDisk, id, need)
+}
+
+func checkResourceRole(ctx context.Context, dbResolver *dbresolver.DBResolver, subject Subject, resourceType model.ResourceType,
+	resourceID int64, need model.ResourceRole) error {
+	role, err := GetSubjectResourceRole(ctx, dbResolver, subject, resourceType, resourceID)
+	if err != nil {
+		return err
+	}
+	if role == "" {
+		return errutil.ErrNotFound
+	}
+	if !role.Allows(need) {
+		return errutil.ErrPermissionDenied
+	}
+	return nil
+}
+
+// ListDiskIDs retrieves the ids of the disks of the project visible to the subject, admins see all disks of the project.
+// It reads from the primary, like GetResourceRole.
+func ListDiskIDs(ctx context.Context, dbResolver *dbresolver.DBResolver, subject Subject, projectID int64) ([]int64, error) {
+	db := dbResolver.GetDB()
+	query := db.WithContext(ctx).Table(disksTable).Where("project_id = ?", projectID)
+	if !subject.Admin {
+		query = query.Where("id IN (?)", grantedResourceIDs(db, model.ResourceTypeDisk, subject))
+	}
+	var ids []int64
+	err := query.Order("id").Pluck("id", &ids).Error
+	return ids, err
+}
+
+// grantedResourceIDs selects the ids of the resources the subject or its groups have any grant on
+func grantedResourceIDs(db *gorm.DB, resourceType model.ResourceType, subject Subject) *gorm.DB {
+	return subjectScope(db.Model(&model.ResourceGrant{}), subject.UID, subject.Groups).
+		Where("resource_type = ?", resourceType).
+		Select("resource_id")
+}
+
+func subjectScope(db *gorm.DB, uid string, groups []string) *gorm.DB {
+	cond := db.Session(&gorm.Session{NewDB: true}).Where("subject_type = ? AND subject = ?", model.GrantSubjectUser, uid)
+	if len(groups) != 0 {
+		cond = cond.Or("subject_type = ? AND subject IN ?", model.GrantSubjectGroup, groups)
+	}
+	return db.Where(cond)
+}
@@ -0,0 +1,75 @@
+package dao
+
+import (
+	"asyncKubeManager/pkg/model"
+	"asyncKubeManager/pkg/testutil"
+	"asyncKubeManager/pkg/token"
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type testDisk struct {
+	ID        int64 `gorm:"primary_key;AUTO_INCREMENT"`
+	ProjectID int64
+	Name      string
+}
+
+func (testDisk) TableName() string { return disksTable }
+
+func TestResourceOwnerCallback(t *testing.T) {
+	dr := testutil.NewDBResolver(t)
+	db := dr.GetDB()
+	require.NoError(t, db.AutoMigrate(&testDisk{}))
+	require.NoError(t, RegisterResourceOwnerCallback(db))
+
+	ctx := token.WithPayload(context.Background(), token.Info{UID: "alice"})
+	disk := testDisk{Name: "d1"}
+	require.NoError(t, db.WithContext(ctx).Create(&disk).Error)
+	disks := []testDisk{{Name: "d2"}, {Name: "d3"}}
+	require.NoError(t, db.WithContext(ctx).Create(&disks).Error)
+
+	for _, id := range []int64{disk.ID, disks[0].ID, disks[1].ID} {
+		role, err := GetResourceRole(ctx, dr, model.ResourceTypeDisk, id, "alice", nil)
+		require.NoError(t, err)
+		assert.Equal(t, model.ResourceRoleOwner, role)
+	}
+
+	// 没有用户的插入不记录所有者
+	require.NoError(t, db.Create(&testDisk{Name: "d4"}).Error)
+	grants, err := ListResourceGrants(ctx, dr, model.ResourceTypeDisk, disks[1].ID+1)
+	require.NoError(t, err)
+	assert.Empty(t, grants)
+}
+
+func TestListDiskIDs(t *testing.T) {
+	dr := testutil.NewDBResolver(t)
+	db := dr.GetDB()
+	require.NoError(t, db.AutoMigrate(&testDisk{}))
+	require.NoError(t, RegisterResourceOwnerCallback(db))
+
+	ctx := token.WithPayload(context.Background(), token.Info{UID: "alice"})
+	disks := []testDisk{{ProjectID: 1, Name: "d1"}, {ProjectID: 1, Name: "d2"}, {ProjectID: 2, Name: "d3"}}
+	require.NoError(t, db.WithContext(ctx).Create(&disks).Error)
+	require.NoError(t, db.Create(&testDisk{ProjectID: 1, Name: "d4"}).Error)
+	require.NoError(t, SaveResourceGrant(ctx, dr, &model.ResourceGrant{
+		ResourceType: model.ResourceTypeDisk, ResourceID: disks[1].ID,
+		SubjectType: model.GrantSubjectGroup, Subject: "ops", Role: model.ResourceRoleViewer,
+	}))
+
+	// 只列出请求所在项目中可见的磁盘
+	ids, err := ListDiskIDs(ctx, dr, Subject{UID: "alice"}, 1)
+	require.NoError(t, err)
+	assert.Equal(t, []int64{disks[0].ID, disks[1].ID}, ids)
+	ids, err = ListDiskIDs(ctx, dr, Subject{UID: "bob", Groups: []string{"ops"}}, 1)
+	require.NoError(t, err)
+	assert.Equal(t, []int64{disks[1].ID}, ids)
+	ids, err = ListDiskIDs(ctx, dr, Subject{UID: "root", Admin: true}, 1)
+	require.NoError(t, err)
+	assert.Len(t, ids, 3)
+	ids, err = ListDiskIDs(ctx, dr, Subject{UID: "bob", Groups: []string{"ops"}}, 2)
+	require.NoError(t, err)
+	assert.Empty(t, ids)
+}
@@ -0,0 +1,101 @@
+package dao
+
+import (
+	"asyncKubeManager/pkg/dbresolver"
+	"asyncKubeManager/pkg/model"
+	"asyncKubeManager/pkg/token"
+	"context"
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+func InsertServiceAccountWithDB(ctx context.Context, db *gorm.DB, sa *model.ServiceAccount) error {
+	sa.Creator = token.GetUIDFromCtx(ctx)
+	sa.Updater = sa.Creator
+	return db.WithContext(ctx).Create(sa).Error
+}
+
+// GetServiceAccountByUID retrieves the service account of the given uid.
+// It reads from the primary since it authenticates the client.
+func GetServiceAccountByUID(ctx context.Context, dbResolver *dbresolver.DBResolver, uid string) (bool, *model.ServiceAccount, error) {
+	db := dbResolver.GetDB()
+	sa := model.ServiceAccount{}
+	err := db.WithContext(ctx).Where("uid = ?", uid).First(&sa).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return false, nil, nil
+		}
+		return false, nil, err
+	}
+	return true, &sa, nil
+}
+
+// ExistsServiceAccountName reports whether the project has a service account of the name, project 0 are the accounts of the admins.
+// It reads the primary, the name is checked right before it is written, idx_service_account_project_name rejects the races left.
+func ExistsServiceAccountName(ctx context.Context, dbResolver *dbresolver.DBResolver, projectID int64, name string) (bool, error) {
+	db := dbResolver.GetDB()
+	var count int64
+	err := db.WithContext(ctx).Model(&model.ServiceAccount{}).Where("project_id = ? AND name = ?", projectID, name).Count(&count).Error
+	return count > 0, err
+}
+
+// ListServiceAccounts returns the service accounts of the project, projectID < 0 lists the accounts of all projects and the admins
+func ListServiceAccounts(ctx context.Context, dbResolver *dbresolver.DBResolver, projectID int64) ([]model.ServiceAccount, error) {
+	db := dbResolver.GetReadDB(ctx).WithContext(ctx)
+	if projectID >= 0 {
+		db = db.Where("project_id = ?", projectID)
+	}
+	var sas []model.ServiceAccount
+	err := db.Order("id DESC").Find(&sas).Error
+	return sas, err
+}
+
+// ListServiceAccountsByUIDs returns the service accounts of the uids, deleted accounts are included for the audit logs
+func ListServiceAccountsByUIDs(ctx context.Context, dbResolver *dbresolver.DBResolver, uids []string) ([]model.ServiceAccount, error) {
+	db := dbResolver.GetReadDB(ctx)
+	var sas []model.ServiceAccount
+	err := db.WithContext(ctx).Unscoped().Where("uid IN ?", uids).Find(&sas).Error
+	return sas, err
+}
+
+func UpdateServiceAccountByUID(ctx context.Context, dbResolver *dbresolver.DBResolver, uid string, updates map[string]interface{}) error {
+	return UpdateServiceAccountByUIDWithDB(ctx, dbResolver.GetDB(), uid, updates)
+}
+
+func UpdateServiceAccountByUIDWithDB(ctx context.Context, db *gorm.DB, uid string, updates map[string]interface{}) error {
+	updates["updater"] = token.GetUIDFromCtx(ctx)
+	updates["updated_at"] = time.Now().UnixMilli()
+
+	return db.WithContext(ctx).Model(&model.ServiceAccount{}).Where("uid = ?", uid).Updates(updates).Error
+}
+
+func UpdateServiceAccountLastUsed(ctx context.Context, dbResolver *dbresolver.DBResolver, uid string, now time.Time) error {
+	return dbResolver.GetDB().WithContext(ctx).Model(&model.ServiceAccount{}).
+		Where("uid = ?", uid).
+		UpdateColumn("last_used_at", now.UnixMilli()).Error
+}
+
+// DeleteServiceAccountWithDB deletes the service account together with its project membership
+func DeleteServiceAccountWithDB(ctx context.Context, db *gorm.DB, sa *model.ServiceAccount) error {
+	if sa.ProjectID != 0 {
+		if err := db.WithContext(ctx).Where("project_id = ? AND uid = ?", sa.ProjectID, sa.UID).Delete(&model.ProjectMember{}).Error; err != nil {
+			return err
+		}
+	}
+	// deleted_id 释放名字, 之后可以创建同名的 service account
+	if err := db.WithContext(ctx).Model(&model.ServiceAccount{}).Where("uid = ?", sa.UID).
+		UpdateColumn("deleted_id", gorm.Expr("id")).Error; err != nil {
+		return err
+	}
+	return db.WithContext(ctx).Where("uid = ?", sa.UID).Delete(&model.ServiceAccount{}).Error
+}
+
+// ListUsersByUIDs returns the users of the uids
+func ListUsersByUIDs(ctx context.Context, dbResolver *dbresolver.DBResolver, uids []string) ([]model.User, error) {
+	db := dbResolver.GetReadDB(ctx)
+	var users []model.User
+	err := db.WithContext(ctx).Unscoped().Where("uid IN ?", uids).Find(&users).Error
+	return users, err
+}
@@ -0,0 +1,54 @@
+package dao
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"asyncKubeManager/pkg/dbresolver"
+	"asyncKubeManager/pkg/model"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// SaveTokenDenylistEntry inserts the entry or replaces the value and expiration of the entry with the same key.
+func SaveTokenDenylistEntry(ctx context.Context, dbResolver *dbresolver.DBResolver, entry *model.TokenDenylistEntry) error {
+	db := dbResolver.GetDB()
+	return db.WithContext(ctx).Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "denylist_key"}},
+		DoUpdates: clause.AssignmentColumns([]string{"value", "expires_at"}),
+	}).Create(entry).Error
+}
+
+// GetTokenDenylistEntry retrieves the entry of the given key unless it expired before the given time.
+// The primary database is used so that a revocation is seen by the next request.
+func GetTokenDenylistEntry(ctx context.Context, dbResolver *dbresolver.DBResolver, key string, now time.Time) (bool, *model.TokenDenylistEntry, error) {
+	db := dbResolver.GetDB()
+	entry := model.TokenDenylistEntry{}
+	err := db.WithContext(ctx).Where("denylist_key = ? AND (expires_at = 0 OR expires_at > ?)", key, now.UnixMilli()).
+		First(&entry).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return false, nil, nil
+		}
+		return false, nil, err
+	}
+	return true, &entry, nil
+}
+
+// CountTokenDenylistEntries counts the entries of the given keys that didn't expire before the given time.
+func CountTokenDenylistEntries(ctx context.Context, dbResolver *dbresolver.DBResolver, keys []string, now time.Time) (int64, error) {
+	db := dbResolver.GetDB()
+	var count int64
+	err := db.WithContext(ctx).Model(&model.TokenDenylistEntry{}).
+		Where("denylist_key IN ? AND (expires_at = 0 OR expires_at > ?)", keys, now.UnixMilli()).
+		Count(&count).Error
+	return count, err
+}
+
+// DeleteExpiredTokenDenylistEntries deletes all entries expired before the given time.
+func DeleteExpiredTokenDenylistEntries(ctx context.Context, dbResolver *dbresolver.DBResolver, before time.Time) error {
+	db := dbResolver.GetDB()
+	return db.WithContext(ctx).Where("expires_at > 0 AND expires_at < ?", before.UnixMilli()).
+		Delete(&model.TokenDenylistEntry{}).Error
+}
@@ -3,6 +3,7 @@ package dao
 import (
 	"context"
 	"errors"
+	"fmt"
 	"gorm.io/gorm"
 	"time"
 
@@ -11,6 +12,9 @@ import (
 	"asyncKubeManager/pkg/token"
 )
 
+// ErrAmbiguousUserName is returned when several local accounts have the username a user logs in with
+var ErrAmbiguousUserName = errors.New("ambiguous username")
+
 func InsertUser(ctx context.Context, dbResolver *dbresolver.DBResolver, uid, username, tel, email, desc string, role model.UserRole) (*model.User, error) {
 	db := dbResolver.GetDB()
 	return InsertUserWithDB(ctx, db, uid, username, tel, email, desc, role)
@@ -29,12 +33,69 @@ func InsertUserWithDB(ctx context.Context, db *gorm.DB, uid, username, tel, emai
 		Status:   model.UserStatusEnabled,
 		Creator:  creator,
 		Updater:  creator,
+
+		AuthSource: model.AuthSourceLDAP,
+		ExternalID: uid,
+	}
+
+	err := db.WithContext(ctx).Create(&user).Error
+	return &user, err
+}
+
+// InsertExternalUserWithDB creates the user of an external identity on its first login
+func InsertExternalUserWithDB(ctx context.Context, db *gorm.DB, uid, username, tel, email, desc string, role model.UserRole,
+	source model.AuthSource, externalID string) (*model.User, error) {
+	creator := token.GetUIDFromCtx(ctx)
+	user := model.User{
+		UID:      uid,
+		Username: username,
+		Role:     role,
+		Tel:      tel,
+		Email:    email,
+		Desc:     desc,
+		Status:   model.UserStatusEnabled,
+		Creator:  creator,
+		Updater:  creator,
+
+		AuthSource: source,
+		ExternalID: externalID,
+	}
+
+	err := db.WithContext(ctx).Create(&user).Error
+	return &user, err
+}
+
+// InsertLocalUserWithDB creates a local account, passwordHash is the bcrypt hash of its password
+func InsertLocalUserWithDB(ctx context.Context, db *gorm.DB, uid, username, passwordHash string, role model.UserRole) (*model.User, error) {
+	creator := token.GetUIDFromCtx(ctx)
+	user := model.User{
+		UID:      uid,
+		Username: username,
+		Role:     role,
+		Status:   model.UserStatusEnabled,
+		Creator:  creator,
+		Updater:  creator,
+
+		AuthSource:        model.AuthSourceLocal,
+		ExternalID:        uid,
+		PasswordHash:      passwordHash,
+		PasswordUpdatedAt: time.Now().UnixMilli(),
 	}
 
 	err := db.WithContext(ctx).Create(&user).Error
 	return &user, err
 }
 
+// UpdateUserPassword sets the bcrypt password hash of a local account
+func UpdateUserPassword(ctx context.Context, dbResolver *dbresolver.DBResolver, uid, passwordHash string) error {
+	return UpdateUserByID(ctx, dbResolver, uid, map[string]interface{}{
+		"password_hash":       passwordHash,
+		"password_updated_at": time.Now().UnixMilli(),
+	})
+}
+
+// GetUserByUID retrieves the user of the given uid.
+// It reads from the primary since the status and role of the user decide its access.
 func GetUserByUID(ctx context.Context, dbResolver *dbresolver.DBResolver, uid string) (bool, *model.User, error) {
 	db := dbResolver.GetDB()
 	return GetUserByUIDWithDB(ctx, db, uid)
@@ -52,6 +113,8 @@ func GetUserByUIDWithDB(ctx context.Context, db *gorm.DB, uid string) (bool, *mo
 	return true, &u, err
 }
 
+// GetUserByUserName retrieves the user of the given username.
+// It reads from the primary since it is used to log in.
 func GetUserByUserName(ctx context.Context, dbResolver *dbresolver.DBResolver, username string) (bool, *model.User, error) {
 	db := dbResolver.GetDB()
 	return GetUserByUserNameWithDB(ctx, db, username)
@@ -69,9 +132,68 @@ func GetUserByUserNameWithDB(ctx context.Context, db *gorm.DB, username string)
 	return true, &u, err
 }
 
-func DeleteUserByID(ctx context.Context, dbResolver *dbresolver.DBResolver, uid string) error {
+// GetUserByIdentity returns the user of an external identity
+// It reads from the primary since it is used to log in.
+func GetUserByIdentity(ctx context.Context, dbResolver *dbresolver.DBResolver, source model.AuthSource, externalID string) (bool, *model.User, error) {
 	db := dbResolver.GetDB()
-	return db.WithContext(ctx).Where("uid = ?", uid).Delete(&model.User{}).Error
+	return GetUserByIdentityWithDB(ctx, db, source, externalID)
+}
+
+func GetUserByIdentityWithDB(ctx context.Context, db *gorm.DB, source model.AuthSource, externalID string) (bool, *model.User, error) {
+	u := model.User{}
+	err := db.WithContext(ctx).Model(&u).Where("auth_source = ? AND external_id = ?", source, externalID).First(&u).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return false, nil, nil
+		}
+		return false, nil, err
+	}
+	return true, &u, err
+}
+
+// GetLocalUserByUserName returns the local account logging in with the username. The usernames of the
+// local accounts are not backed by a unique index, an ambiguous username is an error rather than any of the accounts.
+func GetLocalUserByUserName(ctx context.Context, dbResolver *dbresolver.DBResolver, username string) (bool, *model.User, error) {
+	db := dbResolver.GetDB()
+	var users []model.User
+	err := db.WithContext(ctx).Where("auth_source = ? AND username = ?", model.AuthSourceLocal, username).
+		Limit(2).Find(&users).Error
+	if err != nil {
+		return false, nil, err
+	}
+	switch len(users) {
+	case 0:
+		return false, nil, nil
+	case 1:
+		return true, &users[0], nil
+	}
+	return false, nil, fmt.Errorf("%w: %d local accounts are named %s", ErrAmbiguousUserName, len(users), username)
+}
+
+// GetUserBySourceAndUserName returns a user of the auth source with the username
+// It reads from the primary since it checks whether a username is taken.
+func GetUserBySourceAndUserName(ctx context.Context, dbResolver *dbresolver.DBResolver, source model.AuthSource, username string) (bool, *model.User, error) {
+	db := dbResolver.GetDB()
+	u := model.User{}
+	err := db.WithContext(ctx).Model(&u).Where("auth_source = ? AND username = ?", source, username).First(&u).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return false, nil, nil
+		}
+		return false, nil, err
+	}
+	return true, &u, err
+}
+
+func DeleteUserByID(ctx context.Context, dbResolver *dbresolver.DBResolver, uid string) error {
+	return dbResolver.GetDB().Transaction(func(tx *gorm.DB) error {
+		// deleted_id 释放外部身份, 之后该身份可以作为新用户登录
+		if err := tx.WithContext(ctx).Model(&model.User{}).Where("uid = ?", uid).
+			UpdateColumn("deleted_id", gorm.Expr("id")).Error; err != nil {
+			return err
+		}
+		return tx.WithContext(ctx).Where("uid = ?", uid).Delete(&model.User{}).Error
+	})
 }
 
 func UpdateUserByID(ctx context.Context, dbResolver *dbresolver.DBResolver, uid string, updates map[string]interface{}) error {
@@ -87,19 +209,27 @@ func UpdateUserByUIDWithDB(ctx context.Context, db *gorm.DB, uid string, updates
 }
 
 func FindUserOperatorLogsByUid(ctx context.Context, dbResolver *dbresolver.DBResolver, uid string) ([]model.UserOperatorLog, error) {
-	db := dbResolver.GetDB()
+	db := dbResolver.GetReadDB(ctx)
 	var logs []model.UserOperatorLog
 	err := db.WithContext(ctx).Where("uid = ?", uid).Find(&logs).Error
 	return logs, err
 }
 
 func ListUsers(ctx context.Context, dbResolver *dbresolver.DBResolver) ([]model.User, error) {
-	db := dbResolver.GetDB()
+	db := dbResolver.GetReadDB(ctx)
 	var users []model.User
 	err := db.WithContext(ctx).Find(&users).Error
 	return users, err
 }
 
+// ListUsersBySource returns the users of an auth source
+func ListUsersBySource(ctx context.Context, dbResolver *dbresolver.DBResolver, source model.AuthSource) ([]model.User, error) {
+	db := dbResolver.GetReadDB(ctx)
+	var users []model.User
+	err := db.WithContext(ctx).Where("auth_source = ?", source).Find(&users).Error
+	return users, err
+}
+
 func ChangeUserRole(ctx context.Context, dbResolver *dbresolver.DBResolver, uid string, role model.UserRole) error {
 	return UpdateUserByID(ctx, dbResolver, uid, map[string]interface{}{
 		"role": role,
@@ -136,7 +266,7 @@ func InsertUserOperatorLogByModelWithDB(ctx context.Context, db *gorm.DB, log *m
 
 // GetUserOperatorLogsByUID retrieves all user operation logs for a specific user by UID.
 func GetUserOperatorLogsByUID(ctx context.Context, dbResolver *dbresolver.DBResolver, uid string) ([]model.UserOperatorLog, error) {
-	db := dbResolver.GetDB()
+	db := dbResolver.GetReadDB(ctx)
 	var logs []model.UserOperatorLog
 	err := db.WithContext(ctx).Where("uid = ?", uid).Find(&logs).Error
 	return logs, err
@@ -144,7 +274,7 @@ func GetUserOperatorLogsByUID(ctx context.Context, dbResolver *dbresolver.DBReso
 
 // GetUserOperatorLogByID retrieves a user operation log by its ID.
 func GetUserOperatorLogByID(ctx context.Context, dbResolver *dbresolver.DBResolver, id int64) (*model.UserOperatorLog, error) {
-	db := dbResolver.GetDB()
+	db := dbResolver.GetReadDB(ctx)
 	log := model.UserOperatorLog{}
 	err := db.WithContext(ctx).Where("id = ?", id).First(&log).Error
 	return &log, err
@@ -152,7 +282,7 @@ func GetUserOperatorLogByID(ctx context.Context, dbResolver *dbresolver.DBResolv
 
 // ListUserOperatorLogs retrieves all user operation logs.
 func ListUserOperatorLogs(ctx context.Context, dbResolver *dbresolver.DBResolver) ([]model.UserOperatorLog, error) {
-	db := dbResolver.GetDB()
+	db := dbResolver.GetReadDB(ctx)
 	var logs []model.UserOperatorLog
 	err := db.WithContext(ctx).Find(&logs).Error
 	return logs, err
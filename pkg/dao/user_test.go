@@ -0,0 +1,56 @@
+package dao
+
+import (
+	"asyncKubeManager/pkg/model"
+	"asyncKubeManager/pkg/testutil"
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDeleteUserReleasesIdentity(t *testing.T) {
+	dr := testutil.NewDBResolver(t)
+	ctx := context.Background()
+	db := dr.GetDB()
+
+	_, err := InsertExternalUserWithDB(ctx, db, "u1", "alice", "", "", "", model.UserRoleNormal, "oidc", "sub-1")
+	require.NoError(t, err)
+	require.NoError(t, DeleteUserByID(ctx, dr, "u1"))
+
+	found, _, err := GetUserByIdentity(ctx, dr, "oidc", "sub-1")
+	require.NoError(t, err)
+	assert.False(t, found)
+
+	// 删除的用户不再占用外部身份, 该身份可以作为新用户登录
+	_, err = InsertExternalUserWithDB(ctx, db, "u2", "alice", "", "", "", model.UserRoleNormal, "oidc", "sub-1")
+	require.NoError(t, err)
+	found, user, err := GetUserByIdentity(ctx, dr, "oidc", "sub-1")
+	require.NoError(t, err)
+	require.True(t, found)
+	assert.Equal(t, "u2", user.UID)
+}
+
+func TestGetLocalUserByUserName(t *testing.T) {
+	dr := testutil.NewDBResolver(t)
+	ctx := context.Background()
+	db := dr.GetDB()
+
+	_, err := InsertLocalUserWithDB(ctx, db, "u1", "alice", "hash", model.UserRoleNormal)
+	require.NoError(t, err)
+	found, user, err := GetLocalUserByUserName(ctx, dr, "alice")
+	require.NoError(t, err)
+	require.True(t, found)
+	assert.Equal(t, "u1", user.UID)
+
+	found, _, err = GetLocalUserByUserName(ctx, dr, "bob")
+	require.NoError(t, err)
+	assert.False(t, found)
+
+	// 同名的本地账号不能登录, 不会任选其中一个
+	_, err = InsertLocalUserWithDB(ctx, db, "u2", "alice", "hash", model.UserRoleNormal)
+	require.NoError(t, err)
+	_, _, err = GetLocalUserByUserName(ctx, dr, "alice")
+	assert.ErrorIs(t, err, ErrAmbiguousUserName)
+}
@@ -7,17 +7,20 @@ import (
 
 	"asyncKubeManager/pkg/dbresolver"
 	"asyncKubeManager/pkg/model"
+	"asyncKubeManager/pkg/server/errutil"
 	"asyncKubeManager/pkg/token"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
-// InsertVM inserts a new VM record into the database.
-func InsertVM(ctx context.Context, dbResolver *dbresolver.DBResolver, vmName, osMirror, uid string, cpu int64, memory int64) (*model.VM, error) {
+// InsertVM inserts a new VM record into the database, the creator becomes the owner of the VM.
+func InsertVM(ctx context.Context, dbResolver *dbresolver.DBResolver, projectID int64, vmName, osMirror, uid string, cpu int64, memory int64) (*model.VM, error) {
 	db := dbResolver.GetDB()
 
 	creator := token.GetUIDFromCtx(ctx)
 	vm := model.VM{
 		UID:       uid,
+		ProjectID: projectID,
 		VMName:    vmName,
 		CPU:       cpu,
 		Memory:    memory,
@@ -28,19 +31,44 @@ func InsertVM(ctx context.Context, dbResolver *dbresolver.DBResolver, vmName, os
 		OsMirror:  osMirror,
 	}
 
-	err := db.WithContext(ctx).Create(&vm).Error
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.WithContext(ctx).Create(&vm).Error; err != nil {
+			return err
+		}
+		if creator == "" {
+			return nil
+		}
+		return SetResourceOwnerWithDB(ctx, tx, model.ResourceTypeVM, vm.ID, creator)
+	})
 	return &vm, err
 }
 
-// GetVMByID retrieves a VM record by its ID.
-func GetVMByID(ctx context.Context, dbResolver *dbresolver.DBResolver, id int64) (bool, *model.VM, error) {
-	db := dbResolver.GetDB()
-	return GetVMByIDWithDB(ctx, db, id)
+// GetVMByID retrieves a VM record by its ID and checks that the subject has the role need on it.
+// A VM the subject can't see at all is not found, a role lower than need is errutil.ErrPermissionDenied.
+func GetVMByID(ctx context.Context, dbResolver *dbresolver.DBResolver, subject Subject, id int64, need model.ResourceRole) (bool, *model.VM, error) {
+	db := dbResolver.GetReadDB(ctx)
+	found, vm, err := getVMWithDB(ctx, db, "id = ?", id)
+	if err != nil || !found {
+		return false, nil, err
+	}
+	return checkVM(ctx, dbResolver, subject, vm, need)
 }
 
-func GetVMByIDWithDB(ctx context.Context, db *gorm.DB, id int64) (bool, *model.VM, error) {
+// GetVMByName retrieves a VM record of the project by its name, names are only unique within a project.
+// The role of the subject is checked like GetVMByID.
+func GetVMByName(ctx context.Context, dbResolver *dbresolver.DBResolver, subject Subject, projectID int64, vmName string,
+	need model.ResourceRole) (bool, *model.VM, error) {
+	db := dbResolver.GetReadDB(ctx)
+	found, vm, err := getVMWithDB(ctx, db, "project_id = ? AND vm_name = ?", projectID, vmName)
+	if err != nil || !found {
+		return false, nil, err
+	}
+	return checkVM(ctx, dbResolver, subject, vm, need)
+}
+
+func getVMWithDB(ctx context.Context, db *gorm.DB, query string, args ...interface{}) (bool, *model.VM, error) {
 	vm := model.VM{}
-	err := db.WithContext(ctx).Where("id = ?", id).First(&vm).Error
+	err := db.WithContext(ctx).Where(query, args...).First(&vm).Error
 	if err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
 			return false, nil, nil
@@ -50,78 +78,153 @@ func GetVMByIDWithDB(ctx context.Context, db *gorm.DB, id int64) (bool, *model.V
 	return true, &vm, nil
 }
 
-// GetVMByName retrieves a VM record by its name.
-func GetVMByName(ctx context.Context, dbResolver *dbresolver.DBResolver, vmName string) (bool, *model.VM, error) {
-	db := dbResolver.GetDB()
-	return GetVMByNameWithDB(ctx, db, vmName)
+func checkVM(ctx context.Context, dbResolver *dbresolver.DBResolver, subject Subject, vm *model.VM, need model.ResourceRole) (bool, *model.VM, error) {
+	err := checkResourceRole(ctx, dbResolver, subject, model.ResourceTypeVM, vm.ID, need)
+	if errors.Is(err, errutil.ErrNotFound) {
+		return false, nil, nil
+	}
+	if err != nil {
+		return false, nil, err
+	}
+	return true, vm, nil
 }
 
-func GetVMByNameWithDB(ctx context.Context, db *gorm.DB, vmName string) (bool, *model.VM, error) {
-	vm := model.VM{}
-	err := db.WithContext(ctx).Where("vm_name = ?", vmName).First(&vm).Error
+// UpdateVMByID updates the VM record with the specified ID, the subject must be an operator of the VM.
+func UpdateVMByID(ctx context.Context, dbResolver *dbresolver.DBResolver, subject Subject, id int64, updates map[string]interface{}) error {
+	if err := checkResourceRole(ctx, dbResolver, subject, model.ResourceTypeVM, id, model.ResourceRoleOperator); err != nil {
+		return err
+	}
+	return updateVMByID(ctx, dbResolver.GetDB(), id, updates)
+}
+
+// UpdateVMByUID updates the VM record with the specified UID, the subject must be an operator of the VM.
+func UpdateVMByUID(ctx context.Context, dbResolver *dbresolver.DBResolver, subject Subject, uid string, updates map[string]interface{}) error {
+	db := dbResolver.GetDB()
+	found, vm, err := getVMWithDB(ctx, db, "uid = ?", uid)
 	if err != nil {
-		if errors.Is(err, gorm.ErrRecordNotFound) {
-			return false, nil, nil
-		}
-		return false, nil, err
+		return err
 	}
-	return true, &vm, nil
+	if !found {
+		return errutil.ErrNotFound
+	}
+	if err = checkResourceRole(ctx, dbResolver, subject, model.ResourceTypeVM, vm.ID, model.ResourceRoleOperator); err != nil {
+		return err
+	}
+	return updateVMByID(ctx, db, vm.ID, updates)
 }
 
-// UpdateVMByID updates the VM record with the specified ID.
-func UpdateVMByID(ctx context.Context, dbResolver *dbresolver.DBResolver, id int64, updates map[string]interface{}) error {
+// UpdateVMByName updates the VM record of the project with the specified name, the subject must be an operator of the VM.
+func UpdateVMByName(ctx context.Context, dbResolver *dbresolver.DBResolver, subject Subject, projectID int64, vmName string,
+	updates map[string]interface{}) error {
 	db := dbResolver.GetDB()
+	found, vm, err := getVMWithDB(ctx, db, "project_id = ? AND vm_name = ?", projectID, vmName)
+	if err != nil {
+		return err
+	}
+	if !found {
+		return errutil.ErrNotFound
+	}
+	if err = checkResourceRole(ctx, dbResolver, subject, model.ResourceTypeVM, vm.ID, model.ResourceRoleOperator); err != nil {
+		return err
+	}
+	return updateVMByID(ctx, db, vm.ID, updates)
+}
+
+func updateVMByID(ctx context.Context, db *gorm.DB, id int64, updates map[string]interface{}) error {
 	updates["updater"] = token.GetUIDFromCtx(ctx)
 	updates["updated_at"] = time.Now().UnixMilli()
 
 	return db.WithContext(ctx).Model(&model.VM{}).Where("id = ?", id).Updates(updates).Error
 }
 
-func UpdateVMByUID(ctx context.Context, dbResolver *dbresolver.DBResolver, uid string, updates map[string]interface{}) error {
-	db := dbResolver.GetDB()
-	updates["updater"] = token.GetUIDFromCtx(ctx)
-	updates["updated_at"] = time.Now().UnixMilli()
+// DeleteVMByID deletes a VM record by its ID, the subject must be the owner of the VM.
+// The disks attached to the VM are detached and the grants of the VM are removed.
+func DeleteVMByID(ctx context.Context, dbResolver *dbresolver.DBResolver, subject Subject, id int64) error {
+	if err := checkResourceRole(ctx, dbResolver, subject, model.ResourceTypeVM, id, model.ResourceRoleOwner); err != nil {
+		return err
+	}
 
-	return db.WithContext(ctx).Model(&model.VM{}).Where("uid = ?", uid).Updates(updates).Error
+	db := dbResolver.GetDB()
+	return db.Transaction(func(tx *gorm.DB) error {
+		if err := deleteVMDisksByVMIDWithDB(ctx, tx, id); err != nil {
+			return err
+		}
+		if err := DeleteResourceGrantsWithDB(ctx, tx, model.ResourceTypeVM, id); err != nil {
+			return err
+		}
+		return tx.WithContext(ctx).Where("id = ?", id).Delete(&model.VM{}).Error
+	})
 }
 
-func UpdateVMByName(ctx context.Context, dbResolver *dbresolver.DBResolver, vmName string, updates map[string]interface{}) error {
-	db := dbResolver.GetDB()
-	updates["updater"] = token.GetUIDFromCtx(ctx)
-	updates["updated_at"] = time.Now().UnixMilli()
+// AddDiskToVM associates a disk with a VM, the subject must be an operator of both.
+func AddDiskToVM(ctx context.Context, dbResolver *dbresolver.DBResolver, subject Subject, vmID int64, diskID int64) error {
+	if err := checkVMDisk(ctx, dbResolver, subject, vmID, diskID); err != nil {
+		return err
+	}
 
-	return db.WithContext(ctx).Model(&model.VM{}).Where("vm_name = ?", vmName).Updates(updates).Error
+	db := dbResolver.GetDB()
+	vmDisk := model.VMDisk{
+		VMID:    vmID,
+		DiskID:  diskID,
+		Creator: token.GetUIDFromCtx(ctx),
+	}
+	return db.WithContext(ctx).Clauses(clause.OnConflict{DoNothing: true}).Create(&vmDisk).Error
 }
 
-// DeleteVMByID deletes a VM record by its ID.
-func DeleteVMByID(ctx context.Context, dbResolver *dbresolver.DBResolver, id int64) error {
+// RemoveDiskFromVM removes a disk association from a VM, the subject must be an operator of both.
+func RemoveDiskFromVM(ctx context.Context, dbResolver *dbresolver.DBResolver, subject Subject, vmID int64, diskID int64) error {
+	if err := checkVMDisk(ctx, dbResolver, subject, vmID, diskID); err != nil {
+		return err
+	}
+
 	db := dbResolver.GetDB()
-	return db.WithContext(ctx).Where("id = ?", id).Delete(&model.VM{}).Error
+	return db.WithContext(ctx).Where("vm_id = ? AND disk_id = ?", vmID, diskID).Delete(&model.VMDisk{}).Error
 }
 
-// AddDiskToVM associates a disk with a VM.
-func AddDiskToVM(ctx context.Context, dbResolver *dbresolver.DBResolver, vmID int64, diskID int64) error {
-	db := dbResolver.GetDB()
-	return db.WithContext(ctx).Model(&model.VM{}).Where("id = ?", vmID).Update("disk_ids", gorm.Expr("array_append(disk_ids, ?)", diskID)).Error
+func checkVMDisk(ctx context.Context, dbResolver *dbresolver.DBResolver, subject Subject, vmID int64, diskID int64) error {
+	if err := checkResourceRole(ctx, dbResolver, subject, model.ResourceTypeVM, vmID, model.ResourceRoleOperator); err != nil {
+		return err
+	}
+	return CheckDisk(ctx, dbResolver, subject, diskID, model.ResourceRoleOperator)
 }
 
-// RemoveDiskFromVM removes a disk association from a VM.
-func RemoveDiskFromVM(ctx context.Context, dbResolver *dbresolver.DBResolver, vmID int64, diskID int64) error {
-	db := dbResolver.GetDB()
-	return db.WithContext(ctx).Model(&model.VM{}).Where("id = ?", vmID).Update("disk_ids", gorm.Expr("array_remove(disk_ids, ?)", diskID)).Error
+// ListDiskIDsByVMID retrieves the IDs of the disks attached to the VM.
+func ListDiskIDsByVMID(ctx context.Context, dbResolver *dbresolver.DBResolver, vmID int64) ([]int64, error) {
+	db := dbResolver.GetReadDB(ctx)
+	var diskIDs []int64
+	err := db.WithContext(ctx).Model(&model.VMDisk{}).Where("vm_id = ?", vmID).Order("id").Pluck("disk_id", &diskIDs).Error
+	return diskIDs, err
 }
 
-// ListVMs retrieves all VM records from the database.
-func ListVMs(ctx context.Context, dbResolver *dbresolver.DBResolver) ([]model.VM, error) {
+// GetVMIDByDiskID retrieves the ID of the VM the disk is attached to, 0 means the disk is not attached.
+// It reads from the primary since it guards attaching and deleting the disk.
+func GetVMIDByDiskID(ctx context.Context, dbResolver *dbresolver.DBResolver, diskID int64) (int64, error) {
 	db := dbResolver.GetDB()
-	var vms []model.VM
-	err := db.WithContext(ctx).Find(&vms).Error
-	return vms, err
+	var vmDisk model.VMDisk
+	err := db.WithContext(ctx).Where("disk_id = ?", diskID).First(&vmDisk).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return 0, nil
+		}
+		return 0, err
+	}
+	return vmDisk.VMID, nil
 }
 
-func ListVMsByOwnerID(ctx context.Context, dbResolver *dbresolver.DBResolver) ([]model.VM, error) {
+// deleteVMDisksByVMIDWithDB removes all disk associations of the VM.
+func deleteVMDisksByVMIDWithDB(ctx context.Context, db *gorm.DB, vmID int64) error {
+	return db.WithContext(ctx).Where("vm_id = ?", vmID).Delete(&model.VMDisk{}).Error
+}
+
+// ListVMs retrieves the VMs of the project visible to the subject, admins see all VMs of the project.
+// It reads the grants from the primary, like GetResourceRole.
+func ListVMs(ctx context.Context, dbResolver *dbresolver.DBResolver, subject Subject, projectID int64) ([]model.VM, error) {
 	db := dbResolver.GetDB()
+	query := db.WithContext(ctx).Where("project_id = ?", projectID)
+	if !subject.Admin {
+		query = query.Where("id IN (?)", grantedResourceIDs(db, model.ResourceTypeVM, subject))
+	}
 	var vms []model.VM
-	err := db.WithContext(ctx).Where("creator = ?", token.GetUIDFromCtx(ctx)).Find(&vms).Error
+	err := query.Order("id").Find(&vms).Error
 	return vms, err
 }
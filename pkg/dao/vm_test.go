@@ -0,0 +1,89 @@
+package dao
+
+import (
+	"asyncKubeManager/pkg/model"
+	"asyncKubeManager/pkg/server/errutil"
+	"asyncKubeManager/pkg/testutil"
+	"asyncKubeManager/pkg/token"
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestVMDiskAssociation(t *testing.T) {
+	dr := testutil.NewDBResolver(t)
+	ctx := context.Background()
+
+	vm, err := InsertVM(ctx, dr, 1, "vm-1", "ubuntu", "uid-1", 2, 2048)
+	require.NoError(t, err)
+
+	admin := Subject{UID: "root", Admin: true}
+	require.NoError(t, AddDiskToVM(ctx, dr, admin, vm.ID, 10))
+	require.NoError(t, AddDiskToVM(ctx, dr, admin, vm.ID, 11))
+	// 重复添加不会报错, 也不会产生重复记录
+	require.NoError(t, AddDiskToVM(ctx, dr, admin, vm.ID, 10))
+
+	diskIDs, err := ListDiskIDsByVMID(ctx, dr, vm.ID)
+	require.NoError(t, err)
+	assert.Equal(t, []int64{10, 11}, diskIDs)
+
+	vmID, err := GetVMIDByDiskID(ctx, dr, 11)
+	require.NoError(t, err)
+	assert.Equal(t, vm.ID, vmID)
+
+	require.NoError(t, RemoveDiskFromVM(ctx, dr, admin, vm.ID, 10))
+	diskIDs, err = ListDiskIDsByVMID(ctx, dr, vm.ID)
+	require.NoError(t, err)
+	assert.Equal(t, []int64{11}, diskIDs)
+
+	// 删除虚拟机时解除所有磁盘关联
+	require.NoError(t, DeleteVMByID(ctx, dr, admin, vm.ID))
+	vmID, err = GetVMIDByDiskID(ctx, dr, 11)
+	require.NoError(t, err)
+	assert.Equal(t, int64(0), vmID)
+}
+
+func TestVMOwnership(t *testing.T) {
+	dr := testutil.NewDBResolver(t)
+	ctx := token.WithPayload(context.Background(), token.Info{UID: "alice"})
+
+	vm, err := InsertVM(ctx, dr, 1, "vm-1", "ubuntu", "uid-1", 2, 2048)
+	require.NoError(t, err)
+	require.NoError(t, SaveResourceGrant(ctx, dr, &model.ResourceGrant{
+		ResourceType: model.ResourceTypeVM, ResourceID: vm.ID,
+		SubjectType: model.GrantSubjectUser, Subject: "bob", Role: model.ResourceRoleViewer,
+	}))
+	require.NoError(t, SaveResourceGrant(ctx, dr, &model.ResourceGrant{
+		ResourceType: model.ResourceTypeDisk, ResourceID: 10,
+		SubjectType: model.GrantSubjectUser, Subject: "alice", Role: model.ResourceRoleOwner,
+	}))
+	alice := Subject{UID: "alice"}
+	bob := Subject{UID: "bob"}
+	carol := Subject{UID: "carol"}
+
+	// 没有任何授权的用户查不到虚拟机, 角色不够时拒绝
+	found, _, err := GetVMByID(ctx, dr, carol, vm.ID, model.ResourceRoleViewer)
+	require.NoError(t, err)
+	assert.False(t, found)
+	found, _, err = GetVMByName(ctx, dr, bob, 1, "vm-1", model.ResourceRoleViewer)
+	require.NoError(t, err)
+	assert.True(t, found)
+	_, _, err = GetVMByName(ctx, dr, bob, 1, "vm-1", model.ResourceRoleOperator)
+	assert.Equal(t, errutil.ErrPermissionDenied, err)
+	found, _, err = GetVMByName(ctx, dr, alice, 2, "vm-1", model.ResourceRoleViewer)
+	require.NoError(t, err)
+	assert.False(t, found)
+
+	assert.Equal(t, errutil.ErrPermissionDenied, UpdateVMByID(ctx, dr, bob, vm.ID, map[string]interface{}{"cpu": 4}))
+	assert.Equal(t, errutil.ErrNotFound, UpdateVMByUID(ctx, dr, carol, "uid-1", map[string]interface{}{"cpu": 4}))
+	require.NoError(t, UpdateVMByName(ctx, dr, alice, 1, "vm-1", map[string]interface{}{"cpu": 4}))
+	// 挂载磁盘需要同时是虚拟机和磁盘的 operator
+	assert.Equal(t, errutil.ErrPermissionDenied, AddDiskToVM(ctx, dr, bob, vm.ID, 10))
+	assert.Equal(t, errutil.ErrNotFound, AddDiskToVM(ctx, dr, alice, vm.ID, 11))
+	require.NoError(t, AddDiskToVM(ctx, dr, alice, vm.ID, 10))
+
+	assert.Equal(t, errutil.ErrPermissionDenied, DeleteVMByID(ctx, dr, bob, vm.ID))
+	require.NoError(t, DeleteVMByID(ctx, dr, alice, vm.ID))
+}
@@ -0,0 +1,28 @@
+package dbresolver
+
+import "context"
+
+type ctxKey string
+
+const (
+	ctxSessionKey ctxKey = "session"
+)
+
+// WithSession marks the queries of ctx as belonging to the session key, usually the uid of the user.
+// Reads of the session go to the primary for a while after it writes.
+func WithSession(ctx context.Context, key string) context.Context {
+	if ctx == nil {
+		ctx = context.TODO()
+	}
+
+	return context.WithValue(ctx, ctxSessionKey, key)
+}
+
+func sessionFromCtx(ctx context.Context) string {
+	if ctx == nil {
+		return ""
+	}
+
+	key, _ := ctx.Value(ctxSessionKey).(string)
+	return key
+}
@@ -1,46 +1,272 @@
 package dbresolver
 
 import (
+	"asyncKubeManager/pkg/client/cache"
 	"asyncKubeManager/pkg/client/mysql"
-	"asyncKubeManager/pkg/model"
+	"context"
+	"errors"
 	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go.uber.org/zap"
 	"gorm.io/gorm"
 )
 
+const (
+	healthCheckInterval = time.Second * 10
+	healthCheckTimeout  = time.Second * 3
+
+	pinKeyPrefix = "dbresolver:pin:"
+	pinTimeout   = time.Second
+)
+
+// DBResolver routes queries between the primary database and its read replicas.
+// Writes and transactions always use the primary (GetDB), list and detail reads use
+// a healthy replica (GetReadDB). A session that wrote recently keeps reading from the
+// primary for RdbReadYourWritesTTL, so that it sees its own writes despite replication lag.
+// The pins are kept in process unless SetPinCache shares them between the replicas of the console.
 type DBResolver struct {
-	db    *gorm.DB
-	dbOpt *mysql.Options
+	db       *gorm.DB
+	replicas []*replica
+	next     atomic.Uint64
+
+	pinTTL   time.Duration
+	pins     sync.Map // session key -> time.Time
+	pinCache cache.Interface
+	now      func() time.Time
+
+	stopOnce sync.Once
+	stopCh   chan struct{}
+	dbOpt    *mysql.Options
 }
 
-func NewDBResolver(dbOpt *mysql.Options) (*DBResolver, error) {
-	dr := DBResolver{dbOpt: dbOpt}
+type replica struct {
+	name    string
+	db      *gorm.DB
+	healthy atomic.Bool
+}
 
-	db, err := mysql.NewMysqlClient(dbOpt)
+func NewDBResolver(dbOpt *mysql.Options) (*DBResolver, error) {
+	db, err := mysql.NewRDBClient(dbOpt)
 	if err != nil {
 		return nil, fmt.Errorf("connect to database error: %w", err)
 	}
-	db.Logger = NewResolverLogger(db.Logger, "global") // 使用日志记录器
-	dr.db = db
+	db.Logger = NewResolverLogger(db.Logger, "primary") // 使用日志记录器
+
+	replicaOpts, err := dbOpt.ReplicaOptions()
+	if err != nil {
+		return nil, err
+	}
+	replicas := make([]*gorm.DB, 0, len(replicaOpts))
+	for _, opt := range replicaOpts {
+		replicaDB, err := mysql.NewRDBClient(opt)
+		if err != nil {
+			return nil, fmt.Errorf("connect to replica %s:%d error: %w", opt.RdbHost, opt.RdbPort, err)
+		}
+		replicaDB.Logger = NewResolverLogger(replicaDB.Logger, fmt.Sprintf("replica %s:%d", opt.RdbHost, opt.RdbPort))
+		replicas = append(replicas, replicaDB)
+	}
+
+	dr, err := newDBResolver(db, replicas, dbOpt.RdbReadYourWritesTTL)
+	if err != nil {
+		return nil, err
+	}
+	dr.dbOpt = dbOpt
+	if len(dr.replicas) != 0 {
+		go dr.runHealthCheck(healthCheckInterval)
+	}
 
-	if err = db.AutoMigrate(model.GlobalDst...); err != nil {
-		return nil, fmt.Errorf("db.AutoMigrate error: %w", err)
+	return dr, nil
+}
+
+func newDBResolver(db *gorm.DB, replicas []*gorm.DB, pinTTL time.Duration) (*DBResolver, error) {
+	dr := &DBResolver{
+		db:     db,
+		pinTTL: pinTTL,
+		now:    time.Now,
+		stopCh: make(chan struct{}),
+	}
+	for i, replicaDB := range replicas {
+		r := &replica{name: fmt.Sprintf("replica-%d", i), db: replicaDB}
+		r.healthy.Store(true)
+		dr.replicas = append(dr.replicas, r)
 	}
 
-	return &dr, nil
+	if len(dr.replicas) != 0 && pinTTL > 0 {
+		if err := dr.registerPinCallbacks(); err != nil {
+			return nil, err
+		}
+	}
+	return dr, nil
 }
 
+// GetDB returns the primary database, use it for writes and transactions.
 func (dr *DBResolver) GetDB() *gorm.DB {
 	return dr.db
 }
 
-func (dr *DBResolver) Close() error {
-	sqlDB, err := dr.db.DB()
-	if err != nil {
-		return err
+// GetReadDB returns a database for reads: a healthy replica, or the primary if there is none
+// or the session of ctx wrote recently.
+func (dr *DBResolver) GetReadDB(ctx context.Context) *gorm.DB {
+	if len(dr.replicas) == 0 || dr.pinned(ctx) {
+		return dr.db
+	}
+
+	n := uint64(len(dr.replicas))
+	start := dr.next.Add(1)
+	for i := uint64(0); i < n; i++ {
+		r := dr.replicas[(start+i)%n]
+		if r.healthy.Load() {
+			return r.db
+		}
 	}
-	return sqlDB.Close()
+	return dr.db
+}
+
+// SetPinCache keeps the read-your-writes pins in the shared cache, so that a session is pinned
+// to the primary on every replica of the console, not only on the one that served the write.
+func (dr *DBResolver) SetPinCache(cacheClient cache.Interface) {
+	dr.pinCache = cacheClient
+}
+
+func (dr *DBResolver) Close() error {
+	dr.stopOnce.Do(func() {
+		close(dr.stopCh)
+	})
+
+	var errs []error
+	dr.IteratorDB(func(db *gorm.DB) {
+		sqlDB, err := db.DB()
+		if err == nil {
+			err = sqlDB.Close()
+		}
+		if err != nil {
+			errs = append(errs, err)
+		}
+	})
+	return errors.Join(errs...)
 }
 
+// IteratorDB calls f with the primary and every replica.
 func (dr *DBResolver) IteratorDB(f func(db *gorm.DB)) {
 	f(dr.db)
+	for _, r := range dr.replicas {
+		f(r.db)
+	}
+}
+
+func (dr *DBResolver) pinned(ctx context.Context) bool {
+	key := sessionFromCtx(ctx)
+	if key == "" {
+		return false
+	}
+
+	if dr.pinCache != nil {
+		ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), pinTimeout)
+		defer cancel()
+		pinned, err := dr.pinCache.Exists(ctx, pinKeyPrefix+key)
+		if err != nil {
+			// reading from the primary is always correct
+			zap.L().Warn("check read-your-writes pin failed", zap.String("session", key), zap.Error(err))
+			return true
+		}
+		return pinned
+	}
+
+	until, ok := dr.pins.Load(key)
+	if !ok {
+		return false
+	}
+	if dr.now().Before(until.(time.Time)) {
+		return true
+	}
+	dr.pins.Delete(key)
+	return false
+}
+
+// registerPinCallbacks pins the session of the statement context to the primary after every successful write.
+func (dr *DBResolver) registerPinCallbacks() error {
+	pin := func(db *gorm.DB) {
+		if db.Error != nil || db.Statement.Context == nil {
+			return
+		}
+		key := sessionFromCtx(db.Statement.Context)
+		if key == "" {
+			return
+		}
+		if dr.pinCache != nil {
+			ctx, cancel := context.WithTimeout(context.WithoutCancel(db.Statement.Context), pinTimeout)
+			defer cancel()
+			if err := dr.pinCache.Set(ctx, pinKeyPrefix+key, "1", dr.pinTTL); err != nil {
+				zap.L().Warn("set read-your-writes pin failed", zap.String("session", key), zap.Error(err))
+			}
+			return
+		}
+		dr.pins.Store(key, dr.now().Add(dr.pinTTL))
+	}
+
+	callback := dr.db.Callback()
+	if err := callback.Create().After("gorm:create").Register("dbresolver:pin", pin); err != nil {
+		return err
+	}
+	if err := callback.Update().After("gorm:update").Register("dbresolver:pin", pin); err != nil {
+		return err
+	}
+	if err := callback.Delete().After("gorm:delete").Register("dbresolver:pin", pin); err != nil {
+		return err
+	}
+	return callback.Raw().After("gorm:raw").Register("dbresolver:pin", pin)
+}
+
+func (dr *DBResolver) runHealthCheck(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-dr.stopCh:
+			return
+		case <-ticker.C:
+			dr.checkReplicas()
+			dr.sweepPins()
+		}
+	}
+}
+
+// checkReplicas pings every replica, unhealthy replicas are skipped by GetReadDB until they respond again.
+func (dr *DBResolver) checkReplicas() {
+	for _, r := range dr.replicas {
+		err := ping(r.db)
+		healthy := err == nil
+		if r.healthy.Swap(healthy) != healthy {
+			if healthy {
+				zap.L().Info("database replica recovered", zap.String("replica", r.name))
+			} else {
+				zap.L().Warn("database replica is unhealthy", zap.String("replica", r.name), zap.Error(err))
+			}
+		}
+	}
+}
+
+func (dr *DBResolver) sweepPins() {
+	now := dr.now()
+	dr.pins.Range(func(key, until any) bool {
+		if !now.Before(until.(time.Time)) {
+			dr.pins.Delete(key)
+		}
+		return true
+	})
+}
+
+func ping(db *gorm.DB) error {
+	sqlDB, err := db.DB()
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), healthCheckTimeout)
+	defer cancel()
+	return sqlDB.PingContext(ctx)
 }
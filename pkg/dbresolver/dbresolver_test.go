@@ -0,0 +1,118 @@
+package dbresolver
+
+import (
+	"asyncKubeManager/pkg/client/cache"
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+type item struct {
+	ID   int64
+	Name string
+}
+
+func openDB(t *testing.T, name string) *gorm.DB {
+	dsn := fmt.Sprintf("file:%s_%s?mode=memory&cache=shared", strings.ReplaceAll(t.Name(), "/", "_"), name)
+	db, err := gorm.Open(sqlite.Open(dsn), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	require.NoError(t, err)
+	require.NoError(t, db.AutoMigrate(&item{}))
+	return db
+}
+
+func TestDBResolver_ReadYourWrites(t *testing.T) {
+	primary, replica := openDB(t, "primary"), openDB(t, "replica")
+	dr, err := newDBResolver(primary, []*gorm.DB{replica}, time.Second*5)
+	require.NoError(t, err)
+	defer func() {
+		_ = dr.Close()
+	}()
+
+	now := time.Now()
+	dr.now = func() time.Time { return now }
+
+	alice := WithSession(context.Background(), "alice")
+	bob := WithSession(context.Background(), "bob")
+
+	assert.Same(t, replica, dr.GetReadDB(alice))
+	assert.Same(t, primary, dr.GetDB())
+
+	// 写操作后 alice 的读请求走主库, bob 不受影响
+	require.NoError(t, dr.GetDB().WithContext(alice).Create(&item{ID: 1, Name: "a"}).Error)
+	assert.Same(t, primary, dr.GetReadDB(alice))
+	assert.Same(t, replica, dr.GetReadDB(bob))
+
+	var got item
+	require.NoError(t, dr.GetReadDB(alice).WithContext(alice).First(&got, 1).Error)
+	assert.Equal(t, "a", got.Name)
+
+	// 事务中的写操作同样生效
+	require.NoError(t, dr.GetDB().WithContext(bob).Transaction(func(tx *gorm.DB) error {
+		return tx.Model(&item{}).Where("id = ?", 1).Update("name", "b").Error
+	}))
+	assert.Same(t, primary, dr.GetReadDB(bob))
+
+	now = now.Add(time.Second * 6)
+	assert.Same(t, replica, dr.GetReadDB(alice))
+	dr.sweepPins()
+	_, ok := dr.pins.Load("bob")
+	assert.False(t, ok)
+}
+
+func TestDBResolver_SharedPins(t *testing.T) {
+	pinCache := cache.NewMemoryClient()
+	newResolver := func(name string) (*DBResolver, *gorm.DB, *gorm.DB) {
+		primary, replica := openDB(t, name+"_primary"), openDB(t, name+"_replica")
+		dr, err := newDBResolver(primary, []*gorm.DB{replica}, time.Second*5)
+		require.NoError(t, err)
+		dr.SetPinCache(pinCache)
+		t.Cleanup(func() {
+			_ = dr.Close()
+		})
+		return dr, primary, replica
+	}
+	a, _, _ := newResolver("a")
+	b, bPrimary, bReplica := newResolver("b")
+
+	alice := WithSession(context.Background(), "alice")
+	assert.Same(t, bReplica, b.GetReadDB(alice))
+
+	// 在一个副本上写入后, 其它副本上的读请求同样走主库
+	require.NoError(t, a.GetDB().WithContext(alice).Create(&item{ID: 1, Name: "a"}).Error)
+	assert.Same(t, bPrimary, b.GetReadDB(alice))
+	assert.Same(t, bReplica, b.GetReadDB(WithSession(context.Background(), "bob")))
+}
+
+func TestDBResolver_UnhealthyReplica(t *testing.T) {
+	primary, r0, r1 := openDB(t, "primary"), openDB(t, "r0"), openDB(t, "r1")
+	dr, err := newDBResolver(primary, []*gorm.DB{r0, r1}, 0)
+	require.NoError(t, err)
+	defer func() {
+		_ = dr.Close()
+	}()
+
+	seen := map[*gorm.DB]bool{}
+	for i := 0; i < 4; i++ {
+		seen[dr.GetReadDB(context.Background())] = true
+	}
+	assert.True(t, seen[r0] && seen[r1])
+
+	sqlDB, err := r0.DB()
+	require.NoError(t, err)
+	require.NoError(t, sqlDB.Close())
+	dr.checkReplicas()
+	for i := 0; i < 4; i++ {
+		assert.Same(t, r1, dr.GetReadDB(context.Background()))
+	}
+
+	dr.replicas[1].healthy.Store(false)
+	assert.Same(t, primary, dr.GetReadDB(context.Background()))
+}
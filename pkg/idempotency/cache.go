@@ -0,0 +1,107 @@
+package idempotency
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"asyncKubeManager/pkg/client/cache"
+	"asyncKubeManager/pkg/model"
+)
+
+type cacheRecord struct {
+	Status model.IdempotencyStatus `json:"status"`
+	Response
+}
+
+type cacheStore struct {
+	cacheClient    cache.Interface
+	recordDuration time.Duration
+	lockDuration   time.Duration
+}
+
+// NewCacheStore returns a Store backed by cache.Interface (redis).
+func NewCacheStore(cacheClient cache.Interface) Store {
+	return &cacheStore{
+		cacheClient:    cacheClient,
+		recordDuration: DefaultRecordDuration,
+		lockDuration:   DefaultLockDuration,
+	}
+}
+
+func (s *cacheStore) Acquire(ctx context.Context, uid, key, fingerprint string) (*Response, error) {
+	processing, err := json.Marshal(cacheRecord{
+		Status:   model.IdempotencyStatusProcessing,
+		Response: Response{Fingerprint: fingerprint},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	ok, err := s.cacheClient.SetNX(ctx, cacheKey(uid, key), string(processing), s.lockDuration)
+	if err != nil {
+		return nil, fmt.Errorf("cache setnx error %w", err)
+	}
+	if ok {
+		return nil, nil
+	}
+
+	saved, err := s.cacheClient.Get(ctx, cacheKey(uid, key))
+	if err != nil {
+		// the lock may have just expired, let the client retry
+		return nil, ErrInProgress
+	}
+
+	record := cacheRecord{}
+	if err = json.Unmarshal([]byte(saved), &record); err != nil {
+		return nil, fmt.Errorf("unmarshal idempotency record error %w", err)
+	}
+
+	if record.Fingerprint != fingerprint {
+		return nil, ErrFingerprintMismatch
+	}
+	if record.Status != model.IdempotencyStatusCompleted {
+		return nil, ErrInProgress
+	}
+
+	return &record.Response, nil
+}
+
+func (s *cacheStore) Refresh(ctx context.Context, uid, key string) error {
+	saved, err := s.cacheClient.Get(ctx, cacheKey(uid, key))
+	if err != nil {
+		return fmt.Errorf("cache get error %w", err)
+	}
+
+	record := cacheRecord{}
+	if err = json.Unmarshal([]byte(saved), &record); err != nil {
+		return fmt.Errorf("unmarshal idempotency record error %w", err)
+	}
+	// the request refreshing the key is the one saving it, so a completed record is never shortened here
+	if record.Status != model.IdempotencyStatusProcessing {
+		return nil
+	}
+
+	return s.cacheClient.Expire(ctx, cacheKey(uid, key), s.lockDuration)
+}
+
+func (s *cacheStore) Save(ctx context.Context, uid, key string, resp *Response) error {
+	completed, err := json.Marshal(cacheRecord{
+		Status:   model.IdempotencyStatusCompleted,
+		Response: *resp,
+	})
+	if err != nil {
+		return err
+	}
+
+	return s.cacheClient.Set(ctx, cacheKey(uid, key), string(completed), s.recordDuration)
+}
+
+func (s *cacheStore) Release(ctx context.Context, uid, key string) error {
+	return s.cacheClient.Del(ctx, cacheKey(uid, key))
+}
+
+func cacheKey(uid, key string) string {
+	return fmt.Sprintf("idempotency:%s:%s", uid, key)
+}
@@ -0,0 +1,126 @@
+package idempotency
+
+import (
+	"context"
+	"time"
+
+	"asyncKubeManager/pkg/dao"
+	"asyncKubeManager/pkg/dbresolver"
+	"asyncKubeManager/pkg/model"
+	"go.uber.org/zap"
+)
+
+type dbStore struct {
+	dbResolver     *dbresolver.DBResolver
+	recordDuration time.Duration
+	lockDuration   time.Duration
+}
+
+// NewDBStore returns a Store backed by the relational database, used when redis is disabled.
+func NewDBStore(dbResolver *dbresolver.DBResolver) Store {
+	return &dbStore{
+		dbResolver:     dbResolver,
+		recordDuration: DefaultRecordDuration,
+		lockDuration:   DefaultLockDuration,
+	}
+}
+
+// Start removes expired records every interval until ctx is done, expired records of a single
+// key are also dropped by Acquire so the interval only bounds the size of the table.
+func (s *dbStore) Start(ctx context.Context, interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				if err := dao.DeleteExpiredIdempotencyRecords(ctx, s.dbResolver, time.Now()); err != nil {
+					zap.L().Error("delete expired idempotency records failed", zap.Error(err))
+				}
+			case <-ctx.Done():
+				zap.L().Info("Stopping idempotency cleanup")
+				return
+			}
+		}
+	}()
+}
+
+func (s *dbStore) Acquire(ctx context.Context, uid, key, fingerprint string) (*Response, error) {
+	now := time.Now()
+	inserted, err := s.lock(ctx, uid, key, fingerprint, now)
+	if err != nil {
+		return nil, err
+	}
+	if inserted {
+		return nil, nil
+	}
+
+	found, record, err := dao.GetIdempotencyRecord(ctx, s.dbResolver, uid, key)
+	if err != nil {
+		return nil, err
+	}
+	if !found {
+		// the record was released in the meantime, let the client retry
+		return nil, ErrInProgress
+	}
+
+	if record.ExpiresAt < now.UnixMilli() {
+		// the record expired or its lock was left behind by a crashed request, drop it and retry once.
+		// the delete is conditional so that a record refreshed by another request in between is kept
+		if err = dao.DeleteExpiredIdempotencyRecord(ctx, s.dbResolver, uid, key, now); err != nil {
+			return nil, err
+		}
+		inserted, err = s.lock(ctx, uid, key, fingerprint, now)
+		if err != nil {
+			return nil, err
+		}
+		if inserted {
+			return nil, nil
+		}
+		return nil, ErrInProgress
+	}
+
+	if record.Fingerprint != fingerprint {
+		return nil, ErrFingerprintMismatch
+	}
+	if record.Status != model.IdempotencyStatusCompleted {
+		return nil, ErrInProgress
+	}
+
+	return &Response{
+		Fingerprint: record.Fingerprint,
+		StatusCode:  record.StatusCode,
+		ContentType: record.ContentType,
+		Body:        record.Body,
+	}, nil
+}
+
+// lock inserts the processing record of the key unless it already exists
+func (s *dbStore) lock(ctx context.Context, uid, key, fingerprint string, now time.Time) (bool, error) {
+	return dao.InsertIdempotencyRecordIfAbsent(ctx, s.dbResolver, &model.IdempotencyRecord{
+		UID:            uid,
+		IdempotencyKey: key,
+		Fingerprint:    fingerprint,
+		Status:         model.IdempotencyStatusProcessing,
+		ExpiresAt:      now.Add(s.lockDuration).UnixMilli(),
+	})
+}
+
+func (s *dbStore) Refresh(ctx context.Context, uid, key string) error {
+	return dao.RefreshIdempotencyRecord(ctx, s.dbResolver, uid, key, time.Now().Add(s.lockDuration))
+}
+
+func (s *dbStore) Save(ctx context.Context, uid, key string, resp *Response) error {
+	return dao.UpdateIdempotencyRecord(ctx, s.dbResolver, uid, key, map[string]interface{}{
+		"status":       model.IdempotencyStatusCompleted,
+		"status_code":  resp.StatusCode,
+		"content_type": resp.ContentType,
+		"body":         resp.Body,
+		"expires_at":   time.Now().Add(s.recordDuration).UnixMilli(),
+	})
+}
+
+func (s *dbStore) Release(ctx context.Context, uid, key string) error {
+	return dao.DeleteIdempotencyRecord(ctx, s.dbResolver, uid, key)
+}
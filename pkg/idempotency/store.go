@@ -0,0 +1,62 @@
+package idempotency
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+const (
+	// HeaderKey is the request header carrying the client supplied idempotency key
+	HeaderKey = "Idempotency-Key"
+	// HeaderReplayed is set on responses replayed from the store
+	HeaderReplayed = "Idempotent-Replayed"
+
+	// DefaultRecordDuration is how long a completed response is kept for replay
+	DefaultRecordDuration = 24 * time.Hour
+	// DefaultLockDuration bounds how long a request may hold a key without refreshing it,
+	// so that a crashed replica doesn't block the key forever
+	DefaultLockDuration = time.Minute
+	// DefaultRefreshInterval is how often a running request refreshes the lock of its key
+	DefaultRefreshInterval = DefaultLockDuration / 3
+	// DefaultCleanupInterval is how often expired records are removed from stores that need it
+	DefaultCleanupInterval = 10 * time.Minute
+)
+
+var (
+	// ErrInProgress is returned when another request with the same key is being processed
+	ErrInProgress = errors.New("request with the same idempotency key is in progress")
+	// ErrFingerprintMismatch is returned when a key is reused for a different request
+	ErrFingerprintMismatch = errors.New("idempotency key was used for a different request")
+)
+
+// Response is the stored response of a completed request.
+type Response struct {
+	Fingerprint string `json:"fingerprint"`
+	StatusCode  int    `json:"status_code"`
+	ContentType string `json:"content_type"`
+	Body        []byte `json:"body"`
+}
+
+// Store keeps the state of idempotency keys.
+type Store interface {
+	// Acquire reserves the key of the user for processing. It returns the stored response
+	// if the key has already been completed, or ErrInProgress if the key is held by another request.
+	Acquire(ctx context.Context, uid, key, fingerprint string) (*Response, error)
+
+	// Refresh extends the processing lock of the key, it is called while the request is still running
+	// so that a slow handler keeps the key. It does nothing once the key is completed or released.
+	Refresh(ctx context.Context, uid, key string) error
+
+	// Save stores the response of the key and releases the processing lock.
+	Save(ctx context.Context, uid, key string, resp *Response) error
+
+	// Release drops the key so that the request can be retried.
+	Release(ctx context.Context, uid, key string) error
+}
+
+// Cleaner is implemented by stores whose expired records are not dropped by the backend itself.
+type Cleaner interface {
+	// Start removes expired records every interval until ctx is done.
+	Start(ctx context.Context, interval time.Duration)
+}
@@ -0,0 +1,117 @@
+package idempotency
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"asyncKubeManager/pkg/dao"
+	"asyncKubeManager/pkg/testutil"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testStore checks the life cycle of a key: a duplicate while processing, a reused key, replay and release
+func testStore(t *testing.T, s Store) {
+	ctx := context.Background()
+
+	resp, err := s.Acquire(ctx, "u1", "k1", "fp1")
+	require.NoError(t, err)
+	assert.Nil(t, resp)
+
+	// 处理中的重复请求
+	_, err = s.Acquire(ctx, "u1", "k1", "fp1")
+	assert.ErrorIs(t, err, ErrInProgress)
+	_, err = s.Acquire(ctx, "u1", "k1", "fp2")
+	assert.ErrorIs(t, err, ErrFingerprintMismatch)
+
+	// key 按用户隔离
+	resp, err = s.Acquire(ctx, "u2", "k1", "fp2")
+	require.NoError(t, err)
+	assert.Nil(t, resp)
+
+	require.NoError(t, s.Refresh(ctx, "u1", "k1"))
+	require.NoError(t, s.Save(ctx, "u1", "k1", &Response{
+		Fingerprint: "fp1", StatusCode: 201, ContentType: "application/json", Body: []byte(`{"id":1}`),
+	}))
+	// Save 之后的 Refresh 不影响已保存的响应
+	require.NoError(t, s.Refresh(ctx, "u1", "k1"))
+
+	resp, err = s.Acquire(ctx, "u1", "k1", "fp1")
+	require.NoError(t, err)
+	require.NotNil(t, resp)
+	assert.Equal(t, 201, resp.StatusCode)
+	assert.Equal(t, "application/json", resp.ContentType)
+	assert.Equal(t, `{"id":1}`, string(resp.Body))
+
+	_, err = s.Acquire(ctx, "u1", "k1", "fp2")
+	assert.ErrorIs(t, err, ErrFingerprintMismatch)
+
+	// 释放后可以重试
+	require.NoError(t, s.Release(ctx, "u2", "k1"))
+	resp, err = s.Acquire(ctx, "u2", "k1", "fp2")
+	require.NoError(t, err)
+	assert.Nil(t, resp)
+}
+
+func TestCacheStore(t *testing.T) {
+	cacheClient := testutil.NewFakeCache()
+	testStore(t, NewCacheStore(cacheClient))
+}
+
+func TestCacheStoreRefresh(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now()
+	cacheClient := testutil.NewFakeCache()
+	cacheClient.Now = func() time.Time { return now }
+	s := NewCacheStore(cacheClient)
+
+	_, err := s.Acquire(ctx, "u1", "k1", "fp1")
+	require.NoError(t, err)
+
+	// 处理时间超过锁的有效期时, 刷新过的锁仍然有效
+	for i := 0; i < 3; i++ {
+		now = now.Add(DefaultRefreshInterval)
+		require.NoError(t, s.Refresh(ctx, "u1", "k1"))
+	}
+	_, err = s.Acquire(ctx, "u1", "k1", "fp1")
+	assert.ErrorIs(t, err, ErrInProgress)
+
+	now = now.Add(DefaultLockDuration)
+	resp, err := s.Acquire(ctx, "u1", "k1", "fp1")
+	require.NoError(t, err)
+	assert.Nil(t, resp)
+}
+
+func TestDBStore(t *testing.T) {
+	testStore(t, NewDBStore(testutil.NewDBResolver(t)))
+}
+
+func TestDBStoreRefresh(t *testing.T) {
+	ctx := context.Background()
+	dr := testutil.NewDBResolver(t)
+	s := NewDBStore(dr)
+
+	_, err := s.Acquire(ctx, "u1", "k1", "fp1")
+	require.NoError(t, err)
+	_, record, err := dao.GetIdempotencyRecord(ctx, dr, "u1", "k1")
+	require.NoError(t, err)
+	lockedUntil := record.ExpiresAt
+
+	time.Sleep(2 * time.Millisecond)
+	require.NoError(t, s.Refresh(ctx, "u1", "k1"))
+	_, record, err = dao.GetIdempotencyRecord(ctx, dr, "u1", "k1")
+	require.NoError(t, err)
+	assert.Greater(t, record.ExpiresAt, lockedUntil)
+
+	// 已完成的记录保留保存时的有效期
+	require.NoError(t, s.Save(ctx, "u1", "k1", &Response{Fingerprint: "fp1", StatusCode: 200}))
+	_, record, err = dao.GetIdempotencyRecord(ctx, dr, "u1", "k1")
+	require.NoError(t, err)
+	savedUntil := record.ExpiresAt
+	require.NoError(t, s.Refresh(ctx, "u1", "k1"))
+	_, record, err = dao.GetIdempotencyRecord(ctx, dr, "u1", "k1")
+	require.NoError(t, err)
+	assert.Equal(t, savedUntil, record.ExpiresAt)
+}
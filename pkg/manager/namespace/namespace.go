@@ -0,0 +1,170 @@
+package namespace
+
+import (
+	"asyncKubeManager/pkg/model"
+	"context"
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+const (
+	// LabelManagedBy marks namespaces created by the console
+	LabelManagedBy = "app.kubernetes.io/managed-by"
+	// LabelProject records the project uid of the namespace
+	LabelProject = "async-km.io/project"
+
+	managedByValue    = "async-km-console"
+	resourceQuotaName = "async-km-project-quota"
+
+	// resourceVirtualMachines counts kubevirt VirtualMachine objects
+	resourceVirtualMachines corev1.ResourceName = "count/virtualmachines.kubevirt.io"
+)
+
+// NamespaceManager defines the interface for managing project namespaces.
+type NamespaceManager interface {
+	NamespaceForProject(projectName string) string
+	CreateNamespace(ctx context.Context, name, projectUID string) (*corev1.Namespace, error)
+	DeleteNamespace(ctx context.Context, name string) error
+	HasPersistentVolumeClaims(ctx context.Context, name string) (bool, error)
+	ApplyResourceQuota(ctx context.Context, namespace string, quota *model.ProjectQuota) error
+}
+
+// K8sNamespaceManager implements the NamespaceManager interface using the Kubernetes client.
+type K8sNamespaceManager struct {
+	Client kubernetes.Interface
+	// Prefix is the configured namespace, it is used as-is by the default project
+	// and as the prefix of the other projects' namespaces
+	Prefix string
+}
+
+func NewK8sNamespaceManager(kubeClient kubernetes.Interface, prefix string) *K8sNamespaceManager {
+	return &K8sNamespaceManager{
+		Client: kubeClient,
+		Prefix: prefix,
+	}
+}
+
+// NamespaceForProject returns the namespace name of the project.
+func (m *K8sNamespaceManager) NamespaceForProject(projectName string) string {
+	if projectName == model.DefaultProjectName {
+		return m.Prefix
+	}
+	return fmt.Sprintf("%s-%s", m.Prefix, projectName)
+}
+
+// CreateNamespace creates the labeled namespace of a project, an existing namespace is labeled instead.
+func (m *K8sNamespaceManager) CreateNamespace(ctx context.Context, name, projectUID string) (*corev1.Namespace, error) {
+	labels := map[string]string{
+		LabelManagedBy: managedByValue,
+		LabelProject:   projectUID,
+	}
+
+	ns, err := m.Client.CoreV1().Namespaces().Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		if !apierrors.IsNotFound(err) {
+			return nil, err
+		}
+		return m.Client.CoreV1().Namespaces().Create(ctx, &corev1.Namespace{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:   name,
+				Labels: labels,
+			},
+		}, metav1.CreateOptions{})
+	}
+
+	if owner, ok := ns.Labels[LabelProject]; ok && owner != projectUID {
+		return nil, fmt.Errorf("namespace %s already belongs to project %s", name, owner)
+	}
+	if ns.Labels == nil {
+		ns.Labels = map[string]string{}
+	}
+	for k, v := range labels {
+		ns.Labels[k] = v
+	}
+	return m.Client.CoreV1().Namespaces().Update(ctx, ns, metav1.UpdateOptions{})
+}
+
+// DeleteNamespace deletes a namespace created by the console.
+func (m *K8sNamespaceManager) DeleteNamespace(ctx context.Context, name string) error {
+	ns, err := m.Client.CoreV1().Namespaces().Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		if apierrors.IsNotFound(err) {
+			return nil
+		}
+		return err
+	}
+
+	if ns.Labels[LabelManagedBy] != managedByValue {
+		return fmt.Errorf("namespace %s is not managed by the console", name)
+	}
+	return m.Client.CoreV1().Namespaces().Delete(ctx, name, metav1.DeleteOptions{})
+}
+
+// HasPersistentVolumeClaims reports whether the namespace still holds PVCs, e.g. the disks of the project.
+func (m *K8sNamespaceManager) HasPersistentVolumeClaims(ctx context.Context, name string) (bool, error) {
+	pvcs, err := m.Client.CoreV1().PersistentVolumeClaims(name).List(ctx, metav1.ListOptions{Limit: 1})
+	if err != nil {
+		if apierrors.IsNotFound(err) {
+			return false, nil
+		}
+		return false, err
+	}
+	return len(pvcs.Items) > 0, nil
+}
+
+// ApplyResourceQuota creates or updates the ResourceQuota of the project namespace.
+func (m *K8sNamespaceManager) ApplyResourceQuota(ctx context.Context, namespace string, quota *model.ProjectQuota) error {
+	hard, err := quotaToResourceList(quota)
+	if err != nil {
+		return err
+	}
+
+	rq, err := m.Client.CoreV1().ResourceQuotas(namespace).Get(ctx, resourceQuotaName, metav1.GetOptions{})
+	if err != nil {
+		if !apierrors.IsNotFound(err) {
+			return err
+		}
+		_, err = m.Client.CoreV1().ResourceQuotas(namespace).Create(ctx, &corev1.ResourceQuota{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      resourceQuotaName,
+				Namespace: namespace,
+				Labels:    map[string]string{LabelManagedBy: managedByValue},
+			},
+			Spec: corev1.ResourceQuotaSpec{Hard: hard},
+		}, metav1.CreateOptions{})
+		return err
+	}
+
+	rq.Spec.Hard = hard
+	_, err = m.Client.CoreV1().ResourceQuotas(namespace).Update(ctx, rq, metav1.UpdateOptions{})
+	return err
+}
+
+func quotaToResourceList(quota *model.ProjectQuota) (corev1.ResourceList, error) {
+	hard := corev1.ResourceList{}
+	if quota.VMs > 0 {
+		hard[resourceVirtualMachines] = *resource.NewQuantity(quota.VMs, resource.DecimalSI)
+	}
+
+	for name, value := range map[corev1.ResourceName]string{
+		corev1.ResourceRequestsCPU:     quota.CPU,
+		corev1.ResourceRequestsMemory:  quota.Memory,
+		corev1.ResourceRequestsStorage: quota.Storage,
+	} {
+		if value == "" {
+			continue
+		}
+		q, err := resource.ParseQuantity(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid quota %s: %w", name, err)
+		}
+		hard[name] = q
+	}
+
+	return hard, nil
+}
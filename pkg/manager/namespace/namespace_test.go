@@ -0,0 +1,44 @@
+package namespace
+
+import (
+	"asyncKubeManager/pkg/testutil"
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestK8sNamespaceManager_HasPersistentVolumeClaims(t *testing.T) {
+	clients := testutil.NewClients(&corev1.PersistentVolumeClaim{
+		ObjectMeta: metav1.ObjectMeta{Name: "disk-1", Namespace: "async-km-a"},
+	})
+	m := NewK8sNamespaceManager(clients.Kube, "async-km")
+
+	has, err := m.HasPersistentVolumeClaims(context.Background(), m.NamespaceForProject("a"))
+	require.NoError(t, err)
+	assert.True(t, has)
+
+	has, err = m.HasPersistentVolumeClaims(context.Background(), m.NamespaceForProject("b"))
+	require.NoError(t, err)
+	assert.False(t, has)
+}
+
+func TestK8sNamespaceManager_DeleteNamespace(t *testing.T) {
+	clients := testutil.NewClients(&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "kube-system"}})
+	m := NewK8sNamespaceManager(clients.Kube, "async-km")
+	ctx := context.Background()
+
+	_, err := m.CreateNamespace(ctx, "async-km-a", "p-uid")
+	require.NoError(t, err)
+	require.NoError(t, m.DeleteNamespace(ctx, "async-km-a"))
+	_, err = clients.Kube.CoreV1().Namespaces().Get(ctx, "async-km-a", metav1.GetOptions{})
+	assert.Error(t, err)
+
+	// 不是控制台创建的 namespace 不会被删除
+	assert.Error(t, m.DeleteNamespace(ctx, "kube-system"))
+	// 已经不存在的 namespace 视为删除成功
+	assert.NoError(t, m.DeleteNamespace(ctx, "async-km-b"))
+}
@@ -1,10 +1,10 @@
 package pvc
 
 import (
-	"asyncKubeManager/cmd/console/app/options"
 	"context"
 	"fmt"
 	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/types"
@@ -13,29 +13,33 @@ import (
 
 // PVCManager defines the interface for managing PVC resources.
 type PVCManager interface {
-	CreatePVC(ctx context.Context, pvcName string, diskSize string, storageClass string) (*corev1.PersistentVolumeClaim, error)
+	CreatePVC(ctx context.Context, namespace, pvcName string, diskSize string) (*corev1.PersistentVolumeClaim, error)
 	DeletePVC(ctx context.Context, namespace, name string) error
 	UpdatePVC(ctx context.Context, pvc *corev1.PersistentVolumeClaim) (*corev1.PersistentVolumeClaim, error)
 	ResizePVC(ctx context.Context, namespace, name, newSize string) (*corev1.PersistentVolumeClaim, error)
+	CheckPVCExists(ctx context.Context, namespace, name string) (bool, error)
 }
 
 // K8sPVCManager implements the PVCManager interface using the Kubernetes client.
 type K8sPVCManager struct {
 	Client kubernetes.Interface
+	// StorageClass is the storage class of the PVCs created by the manager
+	StorageClass string
 }
 
-func NewK8sPVCManager(kubeClient *kubernetes.Clientset) *K8sPVCManager {
+func NewK8sPVCManager(kubeClient kubernetes.Interface, storageClass string) *K8sPVCManager {
 	return &K8sPVCManager{
-		Client: kubeClient,
+		Client:       kubeClient,
+		StorageClass: storageClass,
 	}
 }
 
-// CreatePVC creates a new PVC resource in Kubernetes.
-func (m *K8sPVCManager) CreatePVC(ctx context.Context, pvcName string, diskSize string) (*corev1.PersistentVolumeClaim, error) {
+// CreatePVC creates a new PVC resource in the given namespace.
+func (m *K8sPVCManager) CreatePVC(ctx context.Context, namespace, pvcName string, diskSize string) (*corev1.PersistentVolumeClaim, error) {
 	pvc := &corev1.PersistentVolumeClaim{
 		ObjectMeta: metav1.ObjectMeta{
 			Name:      pvcName,
-			Namespace: options.S.K8sNameSpace,
+			Namespace: namespace,
 		},
 		Spec: corev1.PersistentVolumeClaimSpec{
 			AccessModes: []corev1.PersistentVolumeAccessMode{corev1.ReadWriteOnce},
@@ -44,10 +48,10 @@ func (m *K8sPVCManager) CreatePVC(ctx context.Context, pvcName string, diskSize
 					corev1.ResourceStorage: resource.MustParse(diskSize),
 				},
 			},
-			StorageClassName: &options.S.K8sStorageClass,
+			StorageClassName: &m.StorageClass,
 		},
 	}
-	return m.Client.CoreV1().PersistentVolumeClaims(options.S.K8sNameSpace).Create(ctx, pvc, metav1.CreateOptions{})
+	return m.Client.CoreV1().PersistentVolumeClaims(namespace).Create(ctx, pvc, metav1.CreateOptions{})
 }
 
 // GetPVCByName retrieves a PVC resource by its name.
@@ -96,6 +100,9 @@ func (m *K8sPVCManager) ResizePVC(ctx context.Context, namespace, name, newSize
 func (m *K8sPVCManager) CheckPVCExists(ctx context.Context, namespace, name string) (bool, error) {
 	_, err := m.GetPVCByName(ctx, namespace, name)
 	if err != nil {
+		if apierrors.IsNotFound(err) {
+			return false, nil
+		}
 		return false, err
 	}
 	return true, nil
@@ -0,0 +1,122 @@
+package pvc
+
+import (
+	"asyncKubeManager/pkg/testutil"
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	testNamespace    = "async-km"
+	testStorageClass = "test-sc"
+)
+
+func newTestPVC(name, size string) *corev1.PersistentVolumeClaim {
+	return &corev1.PersistentVolumeClaim{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: testNamespace},
+		Spec: corev1.PersistentVolumeClaimSpec{
+			Resources: corev1.VolumeResourceRequirements{
+				Requests: corev1.ResourceList{corev1.ResourceStorage: resource.MustParse(size)},
+			},
+		},
+	}
+}
+
+func TestK8sPVCManager_CreatePVC(t *testing.T) {
+	tests := []struct {
+		name     string
+		existing []*corev1.PersistentVolumeClaim
+		pvcName  string
+		size     string
+		wantErr  bool
+	}{
+		{name: "create", pvcName: "disk-1", size: "10Gi"},
+		{name: "already exists", existing: []*corev1.PersistentVolumeClaim{newTestPVC("disk-1", "5Gi")}, pvcName: "disk-1", size: "10Gi", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clients := testutil.NewClients()
+			for _, pvc := range tt.existing {
+				require.NoError(t, clients.Kube.Tracker().Add(pvc))
+			}
+			m := NewK8sPVCManager(clients.Kube, testStorageClass)
+
+			pvc, err := m.CreatePVC(context.Background(), testNamespace, tt.pvcName, tt.size)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, testStorageClass, *pvc.Spec.StorageClassName)
+			assert.Equal(t, resource.MustParse(tt.size), pvc.Spec.Resources.Requests[corev1.ResourceStorage])
+
+			exists, err := m.CheckPVCExists(context.Background(), testNamespace, tt.pvcName)
+			require.NoError(t, err)
+			assert.True(t, exists)
+		})
+	}
+}
+
+func TestK8sPVCManager_ResizePVC(t *testing.T) {
+	tests := []struct {
+		name    string
+		pvcName string
+		newSize string
+		wantErr bool
+	}{
+		{name: "resize", pvcName: "disk-1", newSize: "20Gi"},
+		{name: "not found", pvcName: "disk-2", newSize: "20Gi", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clients := testutil.NewClients(newTestPVC("disk-1", "10Gi"))
+			m := NewK8sPVCManager(clients.Kube, testStorageClass)
+
+			_, err := m.ResizePVC(context.Background(), testNamespace, tt.pvcName, tt.newSize)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+
+			pvc, err := m.GetPVCByName(context.Background(), testNamespace, tt.pvcName)
+			require.NoError(t, err)
+			assert.Equal(t, resource.MustParse(tt.newSize), pvc.Spec.Resources.Requests[corev1.ResourceStorage])
+		})
+	}
+}
+
+func TestK8sPVCManager_CheckPVCExists(t *testing.T) {
+	clients := testutil.NewClients(newTestPVC("disk-1", "10Gi"))
+	m := NewK8sPVCManager(clients.Kube, testStorageClass)
+
+	exists, err := m.CheckPVCExists(context.Background(), testNamespace, "disk-1")
+	require.NoError(t, err)
+	assert.True(t, exists)
+
+	exists, err = m.CheckPVCExists(context.Background(), testNamespace, "disk-2")
+	require.NoError(t, err)
+	assert.False(t, exists)
+}
+
+func TestK8sPVCManager_DeletePVC(t *testing.T) {
+	clients := testutil.NewClients(newTestPVC("disk-1", "10Gi"))
+	m := NewK8sPVCManager(clients.Kube, testStorageClass)
+	ctx := context.Background()
+
+	require.NoError(t, m.DeletePVC(ctx, testNamespace, "disk-1"))
+	exists, err := m.CheckPVCExists(ctx, testNamespace, "disk-1")
+	require.NoError(t, err)
+	assert.False(t, exists)
+
+	assert.True(t, apierrors.IsNotFound(m.DeletePVC(ctx, testNamespace, "disk-1")))
+}
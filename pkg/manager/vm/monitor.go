@@ -20,7 +20,7 @@ type VMMonitor interface {
 
 // KubevirtVMMonitor implements the VMMonitor interface using the Kubernetes kubeVirtClientSet.
 type KubevirtVMMonitor struct {
-	Client *kubernetes.Clientset
+	Client kubernetes.Interface
 }
 
 // MonitorVMCreation monitors the VirtualMachine creation status and triggers an alert if not created within the timeout.
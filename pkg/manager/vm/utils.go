@@ -14,7 +14,7 @@ func GenerateVMNameFromVMModel(vm *model.VM) string {
 }
 
 // CheckVMExists checks if a VirtualMachine exists in the specified namespace.
-func CheckVMExists(ctx context.Context, client *kubernetes.Clientset, namespace, name string) (bool, error) {
+func CheckVMExists(ctx context.Context, client kubernetes.Interface, namespace, name string) (bool, error) {
 	_, err := client.CoreV1().Pods(namespace).Get(ctx, name, metav1.GetOptions{})
 	if err != nil {
 		return false, err
@@ -1,7 +1,6 @@
 package vm
 
 import (
-	"asyncKubeManager/cmd/console/app/options"
 	"asyncKubeManager/pkg/dbresolver"
 	"asyncKubeManager/pkg/manager/pvc"
 	"asyncKubeManager/pkg/token"
@@ -9,6 +8,7 @@ import (
 	"fmt"
 	"go.uber.org/zap"
 	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/api/resource"
 	"time"
 
@@ -24,48 +24,52 @@ import (
 
 // VmManager defines the interface for managing VirtualMachine resources.
 type VmManager interface {
-	CreateVM(ctx context.Context, vm *kubevirtv1.VirtualMachine) (*kubevirtv1.VirtualMachine, error)
-	DeleteVM(ctx context.Context, name string) error
-	GetVM(ctx context.Context, name string) (*kubevirtv1.VirtualMachine, error)
+	CreateVM(ctx context.Context, namespace, vmname string, cpu int64, memory int64, storage int64, osMirrorUrl string) (*cdiv1.DataVolume, *kubevirtv1.VirtualMachine, error)
+	DeleteVM(ctx context.Context, namespace, name string) error
+	GetVM(ctx context.Context, namespace, name string) (*kubevirtv1.VirtualMachine, error)
 	UpdateVM(ctx context.Context, vm *kubevirtv1.VirtualMachine) (*kubevirtv1.VirtualMachine, error)
-	ListVMs(ctx context.Context) (*kubevirtv1.VirtualMachineList, error)
+	ListVMs(ctx context.Context, namespace string) (*kubevirtv1.VirtualMachineList, error)
 
-	// CheckVMExists checks if a VirtualMachine exists in the specified .
-	CheckVMExists(ctx context.Context, name string) (bool, error)
+	// CheckVMExists checks if a VirtualMachine exists in the specified namespace.
+	CheckVMExists(ctx context.Context, namespace, name string) (bool, error)
 	// GetVMByUID retrieves a VirtualMachine resource by its UID.
-	GetVMByUID(ctx context.Context, uid types.UID) (*kubevirtv1.VirtualMachine, error)
+	GetVMByUID(ctx context.Context, namespace string, uid types.UID) (*kubevirtv1.VirtualMachine, error)
 	// StartVM sets spec.running to true to start the VM.
-	StartVM(ctx context.Context, name string) (*kubevirtv1.VirtualMachine, error)
+	StartVM(ctx context.Context, namespace, name string) (*kubevirtv1.VirtualMachine, error)
 	// StopVM sets spec.running to false to stop the VM.
-	StopVM(ctx context.Context, name string) (*kubevirtv1.VirtualMachine, error)
+	StopVM(ctx context.Context, namespace, name string) (*kubevirtv1.VirtualMachine, error)
 	// RestartVM triggers a restart by patching an annotation.
-	RestartVM(ctx context.Context, name string) (*kubevirtv1.VirtualMachine, error)
+	RestartVM(ctx context.Context, namespace, name string) (*kubevirtv1.VirtualMachine, error)
 	// PatchVM applies a generic patch to the VirtualMachine.
-	PatchVM(ctx context.Context, name string, patchData []byte) (*kubevirtv1.VirtualMachine, error)
+	PatchVM(ctx context.Context, namespace, name string, patchData []byte) (*kubevirtv1.VirtualMachine, error)
 }
 
 // KubevirtVMManager implements the VmManager interface using the KubeVirt kubeVirtClientSet.
 type KubevirtVMManager struct {
-	kubeVirtClientSet *kubevirt.Clientset
-	cdiClientSet      *cdiCli.Clientset
+	kubeVirtClientSet kubevirt.Interface
+	cdiClientSet      cdiCli.Interface
 	dbResolver        *dbresolver.DBResolver
-	pvcManager        *pvc.K8sPVCManager
+	pvcManager        pvc.PVCManager
+	// storageClass is the storage class of the DataVolumes created for VMs
+	storageClass string
 }
 
 // NewKubevirtVMManager creates a new KubevirtVMManager.
-func NewKubevirtVMManager(kubeVirtClientSet *kubevirt.Clientset, cdiClientSet *cdiCli.Clientset, dbResolver *dbresolver.DBResolver, pvcManager *pvc.K8sPVCManager) *KubevirtVMManager {
+func NewKubevirtVMManager(kubeVirtClientSet kubevirt.Interface, cdiClientSet cdiCli.Interface, dbResolver *dbresolver.DBResolver,
+	pvcManager pvc.PVCManager, storageClass string) *KubevirtVMManager {
 	return &KubevirtVMManager{
 		kubeVirtClientSet: kubeVirtClientSet,
 		cdiClientSet:      cdiClientSet,
 		dbResolver:        dbResolver,
 		pvcManager:        pvcManager,
+		storageClass:      storageClass,
 	}
 }
 
 // 将上述参数填入函数的传参列表中
-func (m *KubevirtVMManager) CreateVM(ctx context.Context, vmname string, cpu int64,
+func (m *KubevirtVMManager) CreateVM(ctx context.Context, namespace, vmname string, cpu int64,
 	memory int64, storage int64, osMirrorUrl string) (*cdiv1.DataVolume, *kubevirtv1.VirtualMachine, error) {
-	dv, err := m.CreateDataVolumeForVM(ctx, vmname, fmt.Sprintf("%dGi", storage), osMirrorUrl)
+	dv, err := m.CreateDataVolumeForVM(ctx, namespace, vmname, fmt.Sprintf("%dGi", storage), osMirrorUrl)
 	if err != nil {
 		return nil, nil, err
 	}
@@ -73,7 +77,7 @@ func (m *KubevirtVMManager) CreateVM(ctx context.Context, vmname string, cpu int
 	vm := &kubevirtv1.VirtualMachine{
 		ObjectMeta: metav1.ObjectMeta{
 			Name:      vmname,
-			Namespace: options.S.K8sNameSpace,
+			Namespace: namespace,
 			Annotations: map[string]string{
 				"creator": token.GetNameFromCtx(ctx),
 				"updater": token.GetNameFromCtx(ctx),
@@ -126,69 +130,55 @@ func (m *KubevirtVMManager) CreateVM(ctx context.Context, vmname string, cpu int
 		},
 	}
 	// 通过 KubeVirt 客户端创建 VirtualMachine 资源
-	resVM, err := m.kubeVirtClientSet.KubevirtV1().VirtualMachines(options.S.K8sNameSpace).Create(ctx, vm, metav1.CreateOptions{})
+	resVM, err := m.kubeVirtClientSet.KubevirtV1().VirtualMachines(namespace).Create(ctx, vm, metav1.CreateOptions{})
 	if err != nil {
+		// VirtualMachine 创建失败时删除已创建的 DataVolume
+		if delErr := m.DeleteDataVolume(ctx, namespace, dv.Name); delErr != nil {
+			zap.L().Error(fmt.Sprintf("删除 DataVolume %s 失败: %v", dv.Name, delErr))
+		} else {
+			zap.L().Error(fmt.Sprintf("已删除 DataVolume %s", dv.Name))
+		}
 		return nil, nil, err
 	}
 
-	defer func() {
-		// 如果在函数执行过程中有任何错误，进入该分支
-		if err != nil {
-			// 如果 VirtualMachine 已创建，则尝试删除它
-			if resVM != nil {
-				if delErr := m.DeleteVM(ctx, resVM.Name); delErr != nil {
-					zap.L().Error(fmt.Sprintf("删除 VirtualMachine %s 失败: %v", vm.Name, delErr))
-				} else {
-					zap.L().Error(fmt.Sprintf("已删除 VirtualMachine %s", vm.Name))
-				}
-			}
-
-			// 如果 DataVolume 已创建，则尝试删除它
-			if dv != nil {
-				if delErr := m.DeleteDataVolume(ctx, dv.Name); delErr != nil {
-					zap.L().Error(fmt.Sprintf("删除 DataVolume %s 失败: %v", dv.Name, delErr))
-				} else {
-					zap.L().Error(fmt.Sprintf("已删除 DataVolume %s", dv.Name))
-				}
-			}
-		}
-	}()
-
-	return dv, resVM, err
+	return dv, resVM, nil
 }
 
 // DeleteVM deletes a VirtualMachine resource.
-func (m *KubevirtVMManager) DeleteVM(ctx context.Context, name string) error {
-	return m.kubeVirtClientSet.KubevirtV1().VirtualMachines(options.S.K8sNameSpace).Delete(ctx, name, metav1.DeleteOptions{})
+func (m *KubevirtVMManager) DeleteVM(ctx context.Context, namespace, name string) error {
+	return m.kubeVirtClientSet.KubevirtV1().VirtualMachines(namespace).Delete(ctx, name, metav1.DeleteOptions{})
 }
 
 // GetVM retrieves a VirtualMachine resource.
-func (m *KubevirtVMManager) GetVM(ctx context.Context, name string) (*kubevirtv1.VirtualMachine, error) {
-	return m.kubeVirtClientSet.KubevirtV1().VirtualMachines(options.S.K8sNameSpace).Get(ctx, name, metav1.GetOptions{})
+func (m *KubevirtVMManager) GetVM(ctx context.Context, namespace, name string) (*kubevirtv1.VirtualMachine, error) {
+	return m.kubeVirtClientSet.KubevirtV1().VirtualMachines(namespace).Get(ctx, name, metav1.GetOptions{})
 }
 
 // UpdateVM updates an existing VirtualMachine resource.
 func (m *KubevirtVMManager) UpdateVM(ctx context.Context, vm *kubevirtv1.VirtualMachine) (*kubevirtv1.VirtualMachine, error) {
-	return m.kubeVirtClientSet.KubevirtV1().VirtualMachines(options.S.K8sNameSpace).Update(ctx, vm, metav1.UpdateOptions{})
+	return m.kubeVirtClientSet.KubevirtV1().VirtualMachines(vm.Namespace).Update(ctx, vm, metav1.UpdateOptions{})
 }
 
-// ListVMs lists all VirtualMachine resources in the specified .
-func (m *KubevirtVMManager) ListVMs(ctx context.Context) (*kubevirtv1.VirtualMachineList, error) {
-	return m.kubeVirtClientSet.KubevirtV1().VirtualMachines(options.S.K8sNameSpace).List(ctx, metav1.ListOptions{})
+// ListVMs lists all VirtualMachine resources in the specified namespace.
+func (m *KubevirtVMManager) ListVMs(ctx context.Context, namespace string) (*kubevirtv1.VirtualMachineList, error) {
+	return m.kubeVirtClientSet.KubevirtV1().VirtualMachines(namespace).List(ctx, metav1.ListOptions{})
 }
 
-// CheckVMExists checks if a VirtualMachine exists in the specified .
-func (m *KubevirtVMManager) CheckVMExists(ctx context.Context, name string) (bool, error) {
-	_, err := m.GetVM(ctx, name)
+// CheckVMExists checks if a VirtualMachine exists in the specified namespace.
+func (m *KubevirtVMManager) CheckVMExists(ctx context.Context, namespace, name string) (bool, error) {
+	_, err := m.GetVM(ctx, namespace, name)
 	if err != nil {
+		if apierrors.IsNotFound(err) {
+			return false, nil
+		}
 		return false, err
 	}
 	return true, nil
 }
 
 // GetVMByUID retrieves a VirtualMachine resource by its UID.
-func (m *KubevirtVMManager) GetVMByUID(ctx context.Context, uid types.UID) (*kubevirtv1.VirtualMachine, error) {
-	vms, err := m.kubeVirtClientSet.KubevirtV1().VirtualMachines(options.S.K8sNameSpace).List(ctx, metav1.ListOptions{
+func (m *KubevirtVMManager) GetVMByUID(ctx context.Context, namespace string, uid types.UID) (*kubevirtv1.VirtualMachine, error) {
+	vms, err := m.kubeVirtClientSet.KubevirtV1().VirtualMachines(namespace).List(ctx, metav1.ListOptions{
 		FieldSelector: fmt.Sprintf("metadata.uid=%s", uid),
 	})
 	if err != nil {
@@ -203,8 +193,8 @@ func (m *KubevirtVMManager) GetVMByUID(ctx context.Context, uid types.UID) (*kub
 }
 
 // StartVM sets spec.running to true to start the VirtualMachine.
-func (m *KubevirtVMManager) StartVM(ctx context.Context, name string) (*kubevirtv1.VirtualMachine, error) {
-	vm, err := m.GetVM(ctx, name)
+func (m *KubevirtVMManager) StartVM(ctx context.Context, namespace, name string) (*kubevirtv1.VirtualMachine, error) {
+	vm, err := m.GetVM(ctx, namespace, name)
 	if err != nil {
 		return nil, err
 	}
@@ -214,13 +204,14 @@ func (m *KubevirtVMManager) StartVM(ctx context.Context, name string) (*kubevirt
 		return vm, nil
 	}
 
-	*vm.Spec.RunStrategy = kubevirtv1.RunStrategyAlways
+	runStrategy := kubevirtv1.RunStrategyAlways
+	vm.Spec.RunStrategy = &runStrategy
 	return m.UpdateVM(ctx, vm)
 }
 
 // StopVM sets spec.running to false to stop the VirtualMachine.
-func (m *KubevirtVMManager) StopVM(ctx context.Context, name string) (*kubevirtv1.VirtualMachine, error) {
-	vm, err := m.GetVM(ctx, name)
+func (m *KubevirtVMManager) StopVM(ctx context.Context, namespace, name string) (*kubevirtv1.VirtualMachine, error) {
+	vm, err := m.GetVM(ctx, namespace, name)
 	if err != nil {
 		return nil, err
 	}
@@ -230,27 +221,28 @@ func (m *KubevirtVMManager) StopVM(ctx context.Context, name string) (*kubevirtv
 		return vm, nil
 	}
 
-	*vm.Spec.RunStrategy = kubevirtv1.RunStrategyHalted
+	runStrategy := kubevirtv1.RunStrategyHalted
+	vm.Spec.RunStrategy = &runStrategy
 	return m.UpdateVM(ctx, vm)
 }
 
 // RestartVM triggers a restart by patching an annotation with the current timestamp.
-func (m *KubevirtVMManager) RestartVM(ctx context.Context, name string) (*kubevirtv1.VirtualMachine, error) {
+func (m *KubevirtVMManager) RestartVM(ctx context.Context, namespace, name string) (*kubevirtv1.VirtualMachine, error) {
 	patchData := []byte(fmt.Sprintf(`{"metadata": {"annotations": {"kubevirt.io/restart": "%s"}}}`, time.Now().Format(time.RFC3339)))
-	return m.kubeVirtClientSet.KubevirtV1().VirtualMachines(options.S.K8sNameSpace).Patch(ctx, name, types.MergePatchType, patchData, metav1.PatchOptions{})
+	return m.kubeVirtClientSet.KubevirtV1().VirtualMachines(namespace).Patch(ctx, name, types.MergePatchType, patchData, metav1.PatchOptions{})
 }
 
 // PatchVM applies a generic patch to the VirtualMachine.
-func (m *KubevirtVMManager) PatchVM(ctx context.Context, name string, patchData []byte) (*kubevirtv1.VirtualMachine, error) {
-	return m.kubeVirtClientSet.KubevirtV1().VirtualMachines(options.S.K8sNameSpace).Patch(ctx, name, types.MergePatchType, patchData, metav1.PatchOptions{})
+func (m *KubevirtVMManager) PatchVM(ctx context.Context, namespace, name string, patchData []byte) (*kubevirtv1.VirtualMachine, error) {
+	return m.kubeVirtClientSet.KubevirtV1().VirtualMachines(namespace).Patch(ctx, name, types.MergePatchType, patchData, metav1.PatchOptions{})
 }
 
-func (m *KubevirtVMManager) CreateDataVolumeForVM(ctx context.Context, vmName string, diskSize string, osMirrorUrl string) (*cdiv1.DataVolume, error) {
+func (m *KubevirtVMManager) CreateDataVolumeForVM(ctx context.Context, namespace, vmName string, diskSize string, osMirrorUrl string) (*cdiv1.DataVolume, error) {
 	// Generate PVC name based on VM name
 	pvcName := GenerateDataValumName(vmName)
 
 	// Check if PVC already exists
-	exists, err := m.pvcManager.CheckPVCExists(ctx, options.S.K8sNameSpace, pvcName)
+	exists, err := m.pvcManager.CheckPVCExists(ctx, namespace, pvcName)
 	if err != nil {
 		return nil, err
 	}
@@ -261,7 +253,7 @@ func (m *KubevirtVMManager) CreateDataVolumeForVM(ctx context.Context, vmName st
 	v := cdiv1.DataVolume{
 		ObjectMeta: metav1.ObjectMeta{
 			Name:      pvcName,
-			Namespace: options.S.K8sNameSpace,
+			Namespace: namespace,
 		},
 		Spec: cdiv1.DataVolumeSpec{
 			Source: &cdiv1.DataVolumeSource{
@@ -276,13 +268,14 @@ func (m *KubevirtVMManager) CreateDataVolumeForVM(ctx context.Context, vmName st
 						corev1.ResourceStorage: resource.MustParse(diskSize),
 					},
 				},
+				StorageClassName: &m.storageClass,
 			},
 		},
 	}
 
-	return m.cdiClientSet.CdiV1beta1().DataVolumes(options.S.K8sNameSpace).Create(ctx, &v, metav1.CreateOptions{})
+	return m.cdiClientSet.CdiV1beta1().DataVolumes(namespace).Create(ctx, &v, metav1.CreateOptions{})
 }
 
-func (m *KubevirtVMManager) DeleteDataVolume(ctx context.Context, name string) error {
-	return m.cdiClientSet.CdiV1beta1().DataVolumes(options.S.K8sNameSpace).Delete(ctx, name, metav1.DeleteOptions{})
+func (m *KubevirtVMManager) DeleteDataVolume(ctx context.Context, namespace, name string) error {
+	return m.cdiClientSet.CdiV1beta1().DataVolumes(namespace).Delete(ctx, name, metav1.DeleteOptions{})
 }
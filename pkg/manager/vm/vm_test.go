@@ -0,0 +1,182 @@
+package vm
+
+import (
+	"asyncKubeManager/pkg/manager/pvc"
+	"asyncKubeManager/pkg/testutil"
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	kubevirtv1 "kubevirt.io/api/core/v1"
+)
+
+const (
+	testNamespace    = "async-km"
+	testStorageClass = "test-sc"
+	testOSMirror     = "docker://quay.io/containerdisks/ubuntu:22.04"
+)
+
+func newTestManager(t *testing.T, objects ...runtime.Object) (*KubevirtVMManager, *testutil.Clients) {
+	clients := testutil.NewClients(objects...)
+	pvcManager := pvc.NewK8sPVCManager(clients.Kube, testStorageClass)
+	return NewKubevirtVMManager(clients.Kubevirt, clients.CDI, testutil.NewDBResolver(t), pvcManager, testStorageClass), clients
+}
+
+func newTestVM(name string, runStrategy *kubevirtv1.VirtualMachineRunStrategy) *kubevirtv1.VirtualMachine {
+	return &kubevirtv1.VirtualMachine{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: testNamespace},
+		Spec:       kubevirtv1.VirtualMachineSpec{RunStrategy: runStrategy},
+	}
+}
+
+func runStrategyPtr(s kubevirtv1.VirtualMachineRunStrategy) *kubevirtv1.VirtualMachineRunStrategy {
+	return &s
+}
+
+func TestKubevirtVMManager_CreateVM(t *testing.T) {
+	tests := []struct {
+		name    string
+		objects []runtime.Object
+		vmName  string
+		wantErr bool
+		// wantDV reports whether the DataVolume should exist after the call
+		wantDV bool
+	}{
+		{name: "create", vmName: "vm-1", wantDV: true},
+		{
+			name: "pvc already exists",
+			objects: []runtime.Object{&corev1.PersistentVolumeClaim{
+				ObjectMeta: metav1.ObjectMeta{Name: GenerateDataValumName("vm-1"), Namespace: testNamespace},
+			}},
+			vmName:  "vm-1",
+			wantErr: true,
+		},
+		{
+			name:    "vm already exists",
+			objects: []runtime.Object{newTestVM("vm-1", nil)},
+			vmName:  "vm-1",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m, clients := newTestManager(t, tt.objects...)
+			ctx := context.Background()
+
+			dv, vm, err := m.CreateVM(ctx, testNamespace, tt.vmName, 2, 2*1024*1024*1024, 20, testOSMirror)
+			if tt.wantErr {
+				assert.Error(t, err)
+			} else {
+				require.NoError(t, err)
+				assert.Equal(t, GenerateDataValumName(tt.vmName), dv.Name)
+				assert.Equal(t, testStorageClass, *dv.Spec.PVC.StorageClassName)
+				assert.Equal(t, uint32(2), vm.Spec.Template.Spec.Domain.CPU.Cores)
+				assert.Equal(t, dv.Name, vm.Spec.Template.Spec.Volumes[0].DataVolume.Name)
+			}
+
+			_, err = clients.CDI.CdiV1beta1().DataVolumes(testNamespace).Get(ctx, GenerateDataValumName(tt.vmName), metav1.GetOptions{})
+			if tt.wantDV {
+				assert.NoError(t, err)
+			} else {
+				assert.True(t, apierrors.IsNotFound(err))
+			}
+		})
+	}
+}
+
+func TestKubevirtVMManager_StartStopVM(t *testing.T) {
+	tests := []struct {
+		name string
+		vm   *kubevirtv1.VirtualMachine
+		// start calls StartVM, otherwise StopVM is called
+		start   bool
+		want    kubevirtv1.VirtualMachineRunStrategy
+		wantErr bool
+	}{
+		{name: "start without run strategy", vm: newTestVM("vm-1", nil), start: true, want: kubevirtv1.RunStrategyAlways},
+		{name: "start halted", vm: newTestVM("vm-1", runStrategyPtr(kubevirtv1.RunStrategyHalted)), start: true, want: kubevirtv1.RunStrategyAlways},
+		{name: "start running", vm: newTestVM("vm-1", runStrategyPtr(kubevirtv1.RunStrategyAlways)), start: true, want: kubevirtv1.RunStrategyAlways},
+		{name: "stop running", vm: newTestVM("vm-1", runStrategyPtr(kubevirtv1.RunStrategyAlways)), want: kubevirtv1.RunStrategyHalted},
+		{name: "stop halted", vm: newTestVM("vm-1", runStrategyPtr(kubevirtv1.RunStrategyHalted)), want: kubevirtv1.RunStrategyHalted},
+		{name: "start not found", vm: newTestVM("vm-2", nil), start: true, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m, _ := newTestManager(t, tt.vm)
+			ctx := context.Background()
+
+			var err error
+			if tt.start {
+				_, err = m.StartVM(ctx, testNamespace, "vm-1")
+			} else {
+				_, err = m.StopVM(ctx, testNamespace, "vm-1")
+			}
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+
+			vm, err := m.GetVM(ctx, testNamespace, "vm-1")
+			require.NoError(t, err)
+			require.NotNil(t, vm.Spec.RunStrategy)
+			assert.Equal(t, tt.want, *vm.Spec.RunStrategy)
+		})
+	}
+}
+
+func TestKubevirtVMManager_DeleteVM(t *testing.T) {
+	tests := []struct {
+		name    string
+		vmName  string
+		wantErr bool
+	}{
+		{name: "delete", vmName: "vm-1"},
+		{name: "not found", vmName: "vm-2", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m, _ := newTestManager(t, newTestVM("vm-1", nil))
+			ctx := context.Background()
+
+			err := m.DeleteVM(ctx, testNamespace, tt.vmName)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+
+			exists, err := m.CheckVMExists(ctx, testNamespace, tt.vmName)
+			require.NoError(t, err)
+			assert.False(t, exists)
+		})
+	}
+}
+
+func TestKubevirtVMManager_DeleteVMWithDataVolume(t *testing.T) {
+	m, clients := newTestManager(t)
+	ctx := context.Background()
+
+	_, _, err := m.CreateVM(ctx, testNamespace, "vm-1", 2, 2*1024*1024*1024, 20, testOSMirror)
+	require.NoError(t, err)
+
+	// 删除任务先删除虚拟机, 再删除它的系统盘
+	require.NoError(t, m.DeleteVM(ctx, testNamespace, "vm-1"))
+	require.NoError(t, m.DeleteDataVolume(ctx, testNamespace, GenerateDataValumName("vm-1")))
+
+	_, err = clients.Kubevirt.KubevirtV1().VirtualMachines(testNamespace).Get(ctx, "vm-1", metav1.GetOptions{})
+	assert.True(t, apierrors.IsNotFound(err))
+	_, err = clients.CDI.CdiV1beta1().DataVolumes(testNamespace).Get(ctx, GenerateDataValumName("vm-1"), metav1.GetOptions{})
+	assert.True(t, apierrors.IsNotFound(err))
+
+	// 重试的删除任务遇到已经删除的资源时返回 NotFound
+	assert.True(t, apierrors.IsNotFound(m.DeleteDataVolume(ctx, testNamespace, GenerateDataValumName("vm-1"))))
+}
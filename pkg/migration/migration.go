@@ -0,0 +1,227 @@
+// Package migration applies the numbered schema migrations of the console database.
+//
+// Every migration describes its tables with its own struct copies instead of the
+// model package, so that later model changes don't change what an old migration does.
+// Applied versions are recorded in the schema_migrations table.
+package migration
+
+import (
+	"asyncKubeManager/pkg/model"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+const (
+	// lockName is the MySQL named lock and lockKey the PostgreSQL advisory lock held while migrating
+	lockName = "async_km_schema_migrations"
+	lockKey  = 7429311825
+
+	// DefaultLockTimeout is how long a replica waits for another replica to finish migrating
+	DefaultLockTimeout = time.Minute * 5
+)
+
+var ErrLockTimeout = errors.New("timeout waiting for the migration lock")
+
+// Migration is a numbered schema change. Down may be nil if the migration can't be reverted.
+type Migration struct {
+	Version int64
+	Name    string
+	Up      func(tx *gorm.DB) error
+	Down    func(tx *gorm.DB) error
+}
+
+// Status is the state of a migration in the database.
+type Status struct {
+	Version   int64  `json:"version"`
+	Name      string `json:"name"`
+	Applied   bool   `json:"applied"`
+	AppliedAt int64  `json:"applied_at"`
+}
+
+type Migrator struct {
+	db          *gorm.DB
+	migrations  []Migration
+	LockTimeout time.Duration
+}
+
+// NewMigrator returns a migrator of the given migrations, Migrations() is used if none is given.
+func NewMigrator(db *gorm.DB, migrations ...Migration) *Migrator {
+	if len(migrations) == 0 {
+		migrations = Migrations()
+	}
+	sorted := append([]Migration(nil), migrations...)
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].Version < sorted[j].Version
+	})
+
+	return &Migrator{
+		db:          db,
+		migrations:  sorted,
+		LockTimeout: DefaultLockTimeout,
+	}
+}
+
+// Up applies all pending migrations and returns the applied ones.
+func (m *Migrator) Up(ctx context.Context) (applied []Migration, err error) {
+	err = m.withLock(ctx, func() error {
+		done, err := m.appliedVersions(ctx)
+		if err != nil {
+			return err
+		}
+
+		for _, migration := range m.migrations {
+			if _, ok := done[migration.Version]; ok {
+				continue
+			}
+
+			zap.L().Info("applying migration", zap.Int64("version", migration.Version), zap.String("name", migration.Name))
+			err = m.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+				if err := migration.Up(tx); err != nil {
+					return err
+				}
+				return tx.Create(&model.SchemaMigration{
+					Version:   migration.Version,
+					Name:      migration.Name,
+					AppliedAt: time.Now().UnixMilli(),
+				}).Error
+			})
+			if err != nil {
+				return fmt.Errorf("migration %d %s: %w", migration.Version, migration.Name, err)
+			}
+			applied = append(applied, migration)
+		}
+		return nil
+	})
+	return applied, err
+}
+
+// Down reverts the last steps applied migrations and returns the reverted ones.
+func (m *Migrator) Down(ctx context.Context, steps int) (reverted []Migration, err error) {
+	err = m.withLock(ctx, func() error {
+		done, err := m.appliedVersions(ctx)
+		if err != nil {
+			return err
+		}
+
+		for i := len(m.migrations) - 1; i >= 0 && len(reverted) < steps; i-- {
+			migration := m.migrations[i]
+			if _, ok := done[migration.Version]; !ok {
+				continue
+			}
+			if migration.Down == nil {
+				return fmt.Errorf("migration %d %s can't be reverted", migration.Version, migration.Name)
+			}
+
+			zap.L().Info("reverting migration", zap.Int64("version", migration.Version), zap.String("name", migration.Name))
+			err = m.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+				if err := migration.Down(tx); err != nil {
+					return err
+				}
+				return tx.Where("version = ?", migration.Version).Delete(&model.SchemaMigration{}).Error
+			})
+			if err != nil {
+				return fmt.Errorf("migration %d %s: %w", migration.Version, migration.Name, err)
+			}
+			reverted = append(reverted, migration)
+		}
+		return nil
+	})
+	return reverted, err
+}
+
+// Status lists all known migrations and whether they are applied.
+func (m *Migrator) Status(ctx context.Context) ([]Status, error) {
+	done, err := m.appliedVersions(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	statuses := make([]Status, 0, len(m.migrations))
+	for _, migration := range m.migrations {
+		status := Status{Version: migration.Version, Name: migration.Name}
+		if record, ok := done[migration.Version]; ok {
+			status.Applied = true
+			status.AppliedAt = record.AppliedAt
+		}
+		statuses = append(statuses, status)
+	}
+	return statuses, nil
+}
+
+func (m *Migrator) appliedVersions(ctx context.Context) (map[int64]model.SchemaMigration, error) {
+	db := m.db.WithContext(ctx)
+	if err := db.AutoMigrate(&model.SchemaMigration{}); err != nil {
+		return nil, err
+	}
+
+	var records []model.SchemaMigration
+	if err := db.Find(&records).Error; err != nil {
+		return nil, err
+	}
+
+	done := make(map[int64]model.SchemaMigration, len(records))
+	for _, record := range records {
+		done[record.Version] = record
+	}
+	return done, nil
+}
+
+// WithLock runs f while holding the migration lock, e.g. to seed data that replicas starting
+// at the same time must not write twice.
+func (m *Migrator) WithLock(ctx context.Context, f func() error) error {
+	return m.withLock(ctx, f)
+}
+
+// withLock runs f while holding a database lock, so that only one replica migrates at a time.
+// The lock belongs to a dedicated connection and is released by the database if the process dies.
+func (m *Migrator) withLock(ctx context.Context, f func() error) error {
+	sqlDB, err := m.db.DB()
+	if err != nil {
+		return err
+	}
+
+	conn, err := sqlDB.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = conn.Close()
+	}()
+
+	switch m.db.Dialector.Name() {
+	case "mysql":
+		var got sql.NullInt64
+		if err = conn.QueryRowContext(ctx, "SELECT GET_LOCK(?, ?)", lockName, int(m.LockTimeout.Seconds())).Scan(&got); err != nil {
+			return err
+		}
+		if !got.Valid || got.Int64 != 1 {
+			return ErrLockTimeout
+		}
+		defer func() {
+			_, _ = conn.ExecContext(context.Background(), "SELECT RELEASE_LOCK(?)", lockName)
+		}()
+	case "postgres":
+		lockCtx, cancel := context.WithTimeout(ctx, m.LockTimeout)
+		defer cancel()
+		if _, err = conn.ExecContext(lockCtx, "SELECT pg_advisory_lock($1)", lockKey); err != nil {
+			if errors.Is(lockCtx.Err(), context.DeadlineExceeded) {
+				return ErrLockTimeout
+			}
+			return err
+		}
+		defer func() {
+			_, _ = conn.ExecContext(context.Background(), "SELECT pg_advisory_unlock($1)", lockKey)
+		}()
+	default:
+		// sqlite 只用于本地开发和测试, 没有多副本
+	}
+
+	return f()
+}
@@ -0,0 +1,140 @@
+package migration
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+func newTestDB(t *testing.T) *gorm.DB {
+	dsn := fmt.Sprintf("file:%s?mode=memory&cache=shared", strings.ReplaceAll(t.Name(), "/", "_"))
+	db, err := gorm.Open(sqlite.Open(dsn), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		sqlDB, _ := db.DB()
+		_ = sqlDB.Close()
+	})
+	return db
+}
+
+func TestMigrator_UpDown(t *testing.T) {
+	ctx := context.Background()
+	db := newTestDB(t)
+	m := NewMigrator(db)
+
+	applied, err := m.Up(ctx)
+	require.NoError(t, err)
+	assert.Len(t, applied, len(Migrations()))
+	assert.True(t, db.Migrator().HasTable("users"))
+	assert.True(t, db.Migrator().HasTable("vm_disks"))
+	assert.True(t, db.Migrator().HasColumn("users", "auth_source"))
+	assert.True(t, db.Migrator().HasIndex("users", "idx_user_identity"))
+	assert.True(t, db.Migrator().HasColumn("users", "deleted_id"))
+
+	// 已应用的版本不会重复执行
+	applied, err = m.Up(ctx)
+	require.NoError(t, err)
+	assert.Empty(t, applied)
+
+	statuses, err := m.Status(ctx)
+	require.NoError(t, err)
+	for _, status := range statuses {
+		assert.True(t, status.Applied, status.Name)
+		assert.NotZero(t, status.AppliedAt)
+	}
+
+	require.NoError(t, db.Exec("INSERT INTO casbin_rules (ptype, v0, v1, v2) VALUES ('p', 'normal', '/api/v1/vm/*', '*')").Error)
+
+	// 回滚到 v1, 回滚 v2 时 p 规则写回 permissions 表
+	reverted, err := m.Down(ctx, len(Migrations())-1)
+	require.NoError(t, err)
+	require.Len(t, reverted, len(Migrations())-1)
+	assert.False(t, db.Migrator().HasTable("resource_grants"))
+	assert.False(t, db.Migrator().HasTable("casbin_rules"))
+	var count int64
+	require.NoError(t, db.Table("permissions").Where("user_id = ?", "normal").Count(&count).Error)
+	assert.EqualValues(t, 1, count)
+
+	applied, err = m.Up(ctx)
+	require.NoError(t, err)
+	assert.Len(t, applied, len(Migrations())-1)
+	assert.False(t, db.Migrator().HasTable("permissions"))
+	require.NoError(t, db.Table("casbin_rules").Where("ptype = ? AND v0 = ?", "p", "normal").Count(&count).Error)
+	assert.EqualValues(t, 1, count)
+
+	reverted, err = m.Down(ctx, len(Migrations()))
+	require.NoError(t, err)
+	require.Len(t, reverted, len(Migrations()))
+	assert.False(t, db.Migrator().HasTable("users"))
+}
+
+func TestMigrator_Order(t *testing.T) {
+	ctx := context.Background()
+	db := newTestDB(t)
+
+	var order []int64
+	step := func(version int64) Migration {
+		return Migration{
+			Version: version,
+			Name:    fmt.Sprintf("step_%d", version),
+			Up: func(tx *gorm.DB) error {
+				order = append(order, version)
+				return nil
+			},
+		}
+	}
+	failing := Migration{
+		Version: 4,
+		Name:    "failing",
+		Up: func(tx *gorm.DB) error {
+			return errors.New("boom")
+		},
+	}
+
+	m := NewMigrator(db, step(3), failing, step(1), step(2))
+	applied, err := m.Up(ctx)
+	assert.Error(t, err)
+	assert.Len(t, applied, 3)
+	assert.Equal(t, []int64{1, 2, 3}, order)
+
+	statuses, err := m.Status(ctx)
+	require.NoError(t, err)
+	require.Len(t, statuses, 4)
+	assert.True(t, statuses[2].Applied)
+	assert.False(t, statuses[3].Applied)
+
+	// step 没有 Down, 不能回滚
+	_, err = m.Down(ctx, 1)
+	assert.Error(t, err)
+}
+
+func TestMigrator_UserRoleBindings(t *testing.T) {
+	ctx := context.Background()
+	db := newTestDB(t)
+
+	_, err := NewMigrator(db, Migrations()[:11]...).Up(ctx)
+	require.NoError(t, err)
+	insertUser := "INSERT INTO users (uid, username, role, \"primary\", tel, email, \"desc\", status, created_at, creator, updated_at, updater, external_id, deleted_at) " +
+		"VALUES (?, ?, ?, false, '', '', '', 'enabled', 0, '', 0, '', ?, ?)"
+	require.NoError(t, db.Exec(insertUser, "alice", "alice", "admin", "alice", nil).Error)
+	require.NoError(t, db.Exec(insertUser, "bob", "bob", "normal", "bob", nil).Error)
+	require.NoError(t, db.Exec(insertUser, "carol", "carol", "normal", "carol", 1).Error)
+	require.NoError(t, db.Exec("INSERT INTO casbin_rules (ptype, v0, v1) VALUES ('g', 'bob', 'admin')").Error)
+
+	// 缺少角色绑定的用户按其角色绑定, 已有的绑定和删除的用户不变
+	_, err = NewMigrator(db).Up(ctx)
+	require.NoError(t, err)
+	var bindings []v2CasbinRule
+	require.NoError(t, db.Where("ptype = ?", "g").Order("v0").Find(&bindings).Error)
+	require.Len(t, bindings, 2)
+	assert.Equal(t, []string{"alice", "admin"}, []string{bindings[0].V0, bindings[0].V1})
+	assert.Equal(t, []string{"bob", "admin"}, []string{bindings[1].V0, bindings[1].V1})
+}
@@ -0,0 +1,22 @@
+package migration
+
+// Migrations returns the migrations of the console database in order.
+// New migrations are appended with the next version, applied migrations must never change.
+func Migrations() []Migration {
+	return []Migration{
+		v1InitialSchema,
+		v2CasbinRules,
+		v3ResourceGrants,
+		v4RefreshTokens,
+		v5LocalAccounts,
+		v6UserIdentities,
+		v7MFA,
+		v8PersonalAccessTokens,
+		v9ServiceAccounts,
+		v10UserLockout,
+		v11UniqueNames,
+		v12UserRoleBindings,
+		v13UserIdentityDeleted,
+		v14TokenDenylist,
+	}
+}
@@ -0,0 +1,23 @@
+package migration
+
+import "gorm.io/gorm"
+
+// v10UserLockout records when the lockout of a user after failed logins ends,
+// so that only those locks are lifted by the next successful login.
+var v10UserLockout = Migration{
+	Version: 10,
+	Name:    "user_lockout",
+	Up: func(tx *gorm.DB) error {
+		return tx.Migrator().AddColumn(&v10User{}, "LockedUntil")
+	},
+	Down: func(tx *gorm.DB) error {
+		// sqlite 的 DropColumn 会重建表并丢掉索引, 直接 ALTER TABLE 以保留 v6 的 idx_user_identity
+		return tx.Exec("ALTER TABLE users DROP COLUMN locked_until").Error
+	},
+}
+
+type v10User struct {
+	LockedUntil int64 `gorm:"not null; default:0"`
+}
+
+func (v10User) TableName() string { return "users" }
@@ -0,0 +1,66 @@
+package migration
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// v11UniqueNames backs the names of the valid personal access tokens of a user and the names of the
+// service accounts of a project with unique indexes, so that concurrent creations can't duplicate them.
+var v11UniqueNames = Migration{
+	Version: 11,
+	Name:    "unique_names",
+	Up: func(tx *gorm.DB) error {
+		// 过期未吊销的 token 记为在过期时吊销, 唯一索引只约束有效的 token
+		if err := tx.Model(&v11PersonalAccessToken{}).
+			Where("revoked_at = 0 AND expires_at <= ?", time.Now().UnixMilli()).
+			Update("revoked_at", gorm.Expr("expires_at")).Error; err != nil {
+			return err
+		}
+		if err := tx.Migrator().CreateIndex(&v11PersonalAccessToken{}, "idx_personal_access_token_name"); err != nil {
+			return err
+		}
+
+		if err := tx.Migrator().AddColumn(&v11ServiceAccount{}, "DeletedID"); err != nil {
+			return err
+		}
+		if err := tx.Exec("UPDATE service_accounts SET deleted_id = id WHERE deleted_at IS NOT NULL").Error; err != nil {
+			return err
+		}
+		if err := tx.Migrator().DropIndex(&v11ServiceAccount{}, "idx_service_account_name"); err != nil {
+			return err
+		}
+		return tx.Migrator().CreateIndex(&v11ServiceAccount{}, "idx_service_account_project_name")
+	},
+	Down: func(tx *gorm.DB) error {
+		if err := tx.Migrator().DropIndex(&v11ServiceAccount{}, "idx_service_account_project_name"); err != nil {
+			return err
+		}
+		if err := tx.Migrator().CreateIndex(&v9ServiceAccount{}, "idx_service_account_name"); err != nil {
+			return err
+		}
+		// 与 v10 相同, 直接 ALTER TABLE 以免 sqlite 重建表时丢掉索引
+		if err := tx.Exec("ALTER TABLE service_accounts DROP COLUMN deleted_id").Error; err != nil {
+			return err
+		}
+		return tx.Migrator().DropIndex(&v11PersonalAccessToken{}, "idx_personal_access_token_name")
+	},
+}
+
+type v11PersonalAccessToken struct {
+	UID       string `gorm:"not null; index:idx_personal_access_token_name,unique; type:varchar(32)"`
+	Name      string `gorm:"not null; index:idx_personal_access_token_name,unique; type:varchar(64)"`
+	ExpiresAt int64  `gorm:"not null"`
+	RevokedAt int64  `gorm:"not null; default:0; index:idx_personal_access_token_name,unique"`
+}
+
+func (v11PersonalAccessToken) TableName() string { return "personal_access_tokens" }
+
+type v11ServiceAccount struct {
+	Name      string `gorm:"not null; index:idx_service_account_project_name,unique; type:varchar(64)"`
+	ProjectID int64  `gorm:"not null; default:0; index:idx_service_account_project_name,unique"`
+	DeletedID int64  `gorm:"not null; default:0; index:idx_service_account_project_name,unique"`
+}
+
+func (v11ServiceAccount) TableName() string { return "service_accounts" }
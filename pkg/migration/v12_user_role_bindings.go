@@ -0,0 +1,25 @@
+package migration
+
+import "gorm.io/gorm"
+
+// v12UserRoleBindings binds the users and service accounts without a casbin role binding to their role.
+// Bindings used to be rebuilt on every start, now they are written when a role is assigned.
+var v12UserRoleBindings = Migration{
+	Version: 12,
+	Name:    "user_role_bindings",
+	Up: func(tx *gorm.DB) error {
+		for _, table := range []string{"users", "service_accounts"} {
+			err := tx.Exec("INSERT INTO casbin_rules (ptype, v0, v1, v2, v3, v4, v5) " +
+				"SELECT 'g', uid, role, '', '', '', '' FROM " + table + " " +
+				"WHERE deleted_at IS NULL AND uid NOT IN (SELECT v0 FROM casbin_rules WHERE ptype = 'g')").Error
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	},
+	// Down keeps the bindings, they are valid casbin rules of the previous versions as well
+	Down: func(tx *gorm.DB) error {
+		return nil
+	},
+}
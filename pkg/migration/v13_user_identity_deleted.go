@@ -0,0 +1,40 @@
+package migration
+
+import "gorm.io/gorm"
+
+// v13UserIdentityDeleted keeps idx_user_identity unique among the existing users only, so that
+// an external identity whose user was deleted can sign in again as a new user.
+var v13UserIdentityDeleted = Migration{
+	Version: 13,
+	Name:    "user_identity_deleted",
+	Up: func(tx *gorm.DB) error {
+		if err := tx.Migrator().AddColumn(&v13User{}, "DeletedID"); err != nil {
+			return err
+		}
+		if err := tx.Exec("UPDATE users SET deleted_id = id WHERE deleted_at IS NOT NULL").Error; err != nil {
+			return err
+		}
+		if err := tx.Migrator().DropIndex(&v6User{}, "idx_user_identity"); err != nil {
+			return err
+		}
+		return tx.Migrator().CreateIndex(&v13User{}, "idx_user_identity")
+	},
+	Down: func(tx *gorm.DB) error {
+		if err := tx.Migrator().DropIndex(&v13User{}, "idx_user_identity"); err != nil {
+			return err
+		}
+		// 与 v10 相同, 直接 ALTER TABLE 以免 sqlite 重建表时丢掉索引
+		if err := tx.Exec("ALTER TABLE users DROP COLUMN deleted_id").Error; err != nil {
+			return err
+		}
+		return tx.Migrator().CreateIndex(&v6User{}, "idx_user_identity")
+	},
+}
+
+type v13User struct {
+	AuthSource string `gorm:"not null; default:'ldap'; index:idx_user_identity,unique; type:varchar(16)"`
+	ExternalID string `gorm:"not null; default:''; index:idx_user_identity,unique; type:varchar(255)"`
+	DeletedID  int64  `gorm:"not null; default:0; index:idx_user_identity,unique"`
+}
+
+func (v13User) TableName() string { return "users" }
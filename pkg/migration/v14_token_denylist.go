@@ -0,0 +1,24 @@
+package migration
+
+import "gorm.io/gorm"
+
+// v14TokenDenylist adds the denylist of revoked tokens used when redis is disabled.
+var v14TokenDenylist = Migration{
+	Version: 14,
+	Name:    "token_denylist",
+	Up: func(tx *gorm.DB) error {
+		return tx.AutoMigrate(&v14TokenDenylistEntry{})
+	},
+	Down: func(tx *gorm.DB) error {
+		return tx.Migrator().DropTable(&v14TokenDenylistEntry{})
+	},
+}
+
+type v14TokenDenylistEntry struct {
+	ID          int64  `gorm:"primary_key;AUTO_INCREMENT"`
+	DenylistKey string `gorm:"not null; index:idx_token_denylist_key,unique; type:varchar(255)"`
+	Value       string `gorm:"not null; type:varchar(64)"`
+	ExpiresAt   int64  `gorm:"not null; index:idx_token_denylist_expires_at"`
+}
+
+func (v14TokenDenylistEntry) TableName() string { return "token_denylist" }
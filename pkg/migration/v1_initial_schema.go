@@ -0,0 +1,165 @@
+package migration
+
+import "gorm.io/gorm"
+
+// v1InitialSchema creates the tables that existed before versioned migrations.
+// It uses AutoMigrate so that databases created by hand or by the old AutoMigrate are adopted.
+var v1InitialSchema = Migration{
+	Version: 1,
+	Name:    "initial_schema",
+	Up: func(tx *gorm.DB) error {
+		return tx.AutoMigrate(v1Tables...)
+	},
+	Down: func(tx *gorm.DB) error {
+		return tx.Migrator().DropTable(v1Tables...)
+	},
+}
+
+var v1Tables = []any{
+	&v1User{},
+	&v1UserOperatorLog{},
+	&v1VM{},
+	&v1VMDisk{},
+	&v1EventLog{},
+	&v1Permission{},
+	&v1IdempotencyRecord{},
+	&v1Project{},
+	&v1ProjectMember{},
+	&v1ProjectQuota{},
+}
+
+type v1User struct {
+	ID        int64  `gorm:"primary_key;AUTO_INCREMENT"`
+	UID       string `gorm:"not null; index:idx_user_uid,unique; type:varchar(32)"`
+	Username  string `gorm:"not null; index:idx_user_username; type:varchar(32)"`
+	Role      string `gorm:"not null; type:varchar(32)"`
+	Primary   bool   `gorm:"not null"`
+	Tel       string `gorm:"not null; type:varchar(32)"`
+	Email     string `gorm:"not null; type:varchar(32)"`
+	Desc      string `gorm:"not null; type:varchar(255)"`
+	Status    string `gorm:"not null; type:varchar(32)"`
+	CreatedAt int64  `gorm:"autoCreateTime:milli; not null; index:idx_user_created_at"`
+	Creator   string `gorm:"not null; type:varchar(32)"`
+	UpdatedAt int64  `gorm:"autoUpdateTime:milli; not null"`
+	Updater   string `gorm:"not null; type:varchar(32)"`
+	gorm.DeletedAt
+}
+
+func (v1User) TableName() string { return "users" }
+
+type v1UserOperatorLog struct {
+	ID        int64  `gorm:"primary_key;AUTO_INCREMENT"`
+	UID       string `gorm:"not null; index:idx_user_operator_log_uid; type:varchar(32)"`
+	Operator  string `gorm:"not null; type:varchar(255)"`
+	Operation string `gorm:"not null; type:varchar(255)"`
+	CreatedAt int64  `gorm:"autoCreateTime:milli; not null; index:idx_user_operator_log_created_at"`
+	Creator   string `gorm:"not null; type:varchar(32)"`
+}
+
+func (v1UserOperatorLog) TableName() string { return "user_operator_logs" }
+
+type v1VM struct {
+	ID        int64  `gorm:"primary_key;AUTO_INCREMENT"`
+	UID       string `gorm:"not null; index:idx_vm_uid; type:varchar(32)"`
+	ProjectID int64  `gorm:"not null; index:idx_vm_project_id;"`
+	VMName    string `gorm:"not null; index:idx_vm_name; type:varchar(32)"`
+	CPU       int64  `gorm:"not null; index:idx_vm_cpu;"`
+	Memory    int64  `gorm:"not null; index:idx_vm_memory;"`
+	DVID      string `gorm:"not null;"`
+	DVName    string `gorm:"not null;"`
+	OsMirror  string `gorm:"not null;"`
+	Status    string `gorm:"not null; type:varchar(32); index:idx_vm_status;"`
+	CreatedAt int64  `gorm:"autoCreateTime:milli; not null; index:idx_vm_created_at"`
+	Creator   string `gorm:"not null; type:varchar(32)"`
+	UpdatedAt int64  `gorm:"autoUpdateTime:milli; not null"`
+	Updater   string `gorm:"not null; type:varchar(32)"`
+	gorm.DeletedAt
+}
+
+func (v1VM) TableName() string { return "vm" }
+
+type v1VMDisk struct {
+	ID        int64  `gorm:"primary_key;AUTO_INCREMENT"`
+	VMID      int64  `gorm:"not null; index:idx_vm_disk,unique"`
+	DiskID    int64  `gorm:"not null; index:idx_vm_disk,unique; index:idx_vm_disk_disk_id"`
+	CreatedAt int64  `gorm:"autoCreateTime:milli; not null"`
+	Creator   string `gorm:"not null; type:varchar(32)"`
+}
+
+func (v1VMDisk) TableName() string { return "vm_disks" }
+
+type v1EventLog struct {
+	ID           uint   `gorm:"primary_key"`
+	ResourceType string `gorm:"not null; index:idx_event_log_resource_type; type:varchar(32)"`
+	ResourceUID  string `gorm:"not null; index:idx_event_log_resource_uid; type:varchar(32)"`
+	ProjectID    int64  `gorm:"not null; index:idx_event_log_project_id"`
+	EventType    string `gorm:"not null"`
+	Operation    string `gorm:"not null"`
+	CreatedAt    int64  `gorm:"autoCreateTime:milli; not null"`
+	Creator      string `gorm:"not null"`
+}
+
+func (v1EventLog) TableName() string { return "event_logs" }
+
+type v1Permission struct {
+	ID       uint   `gorm:"primaryKey"`
+	UserID   string `gorm:"not null"`
+	Resource string `gorm:"not null"`
+	Action   string `gorm:"not null"`
+}
+
+func (v1Permission) TableName() string { return "permissions" }
+
+type v1IdempotencyRecord struct {
+	ID             int64  `gorm:"primary_key;AUTO_INCREMENT"`
+	UID            string `gorm:"not null; index:idx_uid_key,unique; type:varchar(32)"`
+	IdempotencyKey string `gorm:"not null; index:idx_uid_key,unique; type:varchar(255)"`
+	Fingerprint    string `gorm:"not null; type:varchar(64)"`
+	Status         string `gorm:"not null; type:varchar(32)"`
+	StatusCode     int    `gorm:"not null"`
+	ContentType    string `gorm:"not null; type:varchar(255)"`
+	Body           []byte
+	CreatedAt      int64 `gorm:"autoCreateTime:milli; not null"`
+	ExpiresAt      int64 `gorm:"not null; index:idx_idempotency_expires_at"`
+}
+
+func (v1IdempotencyRecord) TableName() string { return "idempotency_records" }
+
+type v1Project struct {
+	ID        int64  `gorm:"primary_key;AUTO_INCREMENT"`
+	UID       string `gorm:"not null; index:idx_project_uid,unique; type:varchar(32)"`
+	Name      string `gorm:"not null; index:idx_project_name,unique; type:varchar(50)"`
+	Namespace string `gorm:"not null; index:idx_project_namespace,unique; type:varchar(63)"`
+	Desc      string `gorm:"not null; type:varchar(255)"`
+	CreatedAt int64  `gorm:"autoCreateTime:milli; not null; index:idx_project_created_at"`
+	Creator   string `gorm:"not null; type:varchar(32)"`
+	UpdatedAt int64  `gorm:"autoUpdateTime:milli; not null"`
+	Updater   string `gorm:"not null; type:varchar(32)"`
+	gorm.DeletedAt
+}
+
+func (v1Project) TableName() string { return "projects" }
+
+type v1ProjectMember struct {
+	ID        int64  `gorm:"primary_key;AUTO_INCREMENT"`
+	ProjectID int64  `gorm:"not null; index:idx_project_user,unique"`
+	UID       string `gorm:"not null; index:idx_project_user,unique; index:idx_project_member_uid; type:varchar(32)"`
+	Role      string `gorm:"not null; type:varchar(32)"`
+	CreatedAt int64  `gorm:"autoCreateTime:milli; not null"`
+	Creator   string `gorm:"not null; type:varchar(32)"`
+}
+
+func (v1ProjectMember) TableName() string { return "project_members" }
+
+type v1ProjectQuota struct {
+	ID        int64  `gorm:"primary_key;AUTO_INCREMENT"`
+	ProjectID int64  `gorm:"not null; index:idx_project_quota_project_id,unique"`
+	VMs       int64  `gorm:"not null"`
+	CPU       string `gorm:"not null; type:varchar(32)"`
+	Memory    string `gorm:"not null; type:varchar(32)"`
+	Storage   string `gorm:"not null; type:varchar(32)"`
+	UpdatedAt int64  `gorm:"autoUpdateTime:milli; not null"`
+	Updater   string `gorm:"not null; type:varchar(32)"`
+}
+
+func (v1ProjectQuota) TableName() string { return "project_quotas" }
@@ -0,0 +1,49 @@
+package migration
+
+import "gorm.io/gorm"
+
+// v2CasbinRules replaces the permissions table, which could only store "p" rules
+// with three fields, by the generic casbin_rules table. Existing permissions become "p" rules.
+var v2CasbinRules = Migration{
+	Version: 2,
+	Name:    "casbin_rules",
+	Up: func(tx *gorm.DB) error {
+		if err := tx.AutoMigrate(&v2CasbinRule{}); err != nil {
+			return err
+		}
+		if !tx.Migrator().HasTable(&v1Permission{}) {
+			return nil
+		}
+		err := tx.Exec("INSERT INTO casbin_rules (ptype, v0, v1, v2, v3, v4, v5) " +
+			"SELECT DISTINCT 'p', user_id, resource, action, '', '', '' FROM permissions").Error
+		if err != nil {
+			return err
+		}
+		return tx.Migrator().DropTable(&v1Permission{})
+	},
+	// Down keeps only the "p" rules, grouping rules can't be stored in the permissions table
+	Down: func(tx *gorm.DB) error {
+		if err := tx.AutoMigrate(&v1Permission{}); err != nil {
+			return err
+		}
+		err := tx.Exec("INSERT INTO permissions (user_id, resource, action) " +
+			"SELECT v0, v1, v2 FROM casbin_rules WHERE ptype = 'p'").Error
+		if err != nil {
+			return err
+		}
+		return tx.Migrator().DropTable(&v2CasbinRule{})
+	},
+}
+
+type v2CasbinRule struct {
+	ID    uint64 `gorm:"primary_key;AUTO_INCREMENT"`
+	Ptype string `gorm:"not null; index:idx_casbin_rule,unique; type:varchar(16)"`
+	V0    string `gorm:"not null; default:''; index:idx_casbin_rule,unique; type:varchar(100)"`
+	V1    string `gorm:"not null; default:''; index:idx_casbin_rule,unique; type:varchar(100)"`
+	V2    string `gorm:"not null; default:''; index:idx_casbin_rule,unique; type:varchar(100)"`
+	V3    string `gorm:"not null; default:''; index:idx_casbin_rule,unique; type:varchar(100)"`
+	V4    string `gorm:"not null; default:''; index:idx_casbin_rule,unique; type:varchar(100)"`
+	V5    string `gorm:"not null; default:''; index:idx_casbin_rule,unique; type:varchar(100)"`
+}
+
+func (v2CasbinRule) TableName() string { return "casbin_rules" }
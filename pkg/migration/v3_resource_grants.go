@@ -0,0 +1,48 @@
+package migration
+
+import "gorm.io/gorm"
+
+// v3ResourceGrants adds the owner and sharing grants of VMs and disks.
+// The creators of existing resources become their owners.
+var v3ResourceGrants = Migration{
+	Version: 3,
+	Name:    "resource_grants",
+	Up: func(tx *gorm.DB) error {
+		if err := tx.AutoMigrate(&v3ResourceGrant{}); err != nil {
+			return err
+		}
+
+		err := tx.Exec("INSERT INTO resource_grants (resource_type, resource_id, subject_type, subject, role, created_at, creator) " +
+			"SELECT 'VM', id, 'user', creator, 'owner', created_at, creator FROM vm WHERE creator <> '' AND deleted_at IS NULL").Error
+		if err != nil {
+			return err
+		}
+
+		// the disks table is created by the disk module
+		if !tx.Migrator().HasTable("disks") || !tx.Migrator().HasColumn("disks", "creator") {
+			return nil
+		}
+		query := "INSERT INTO resource_grants (resource_type, resource_id, subject_type, subject, role, created_at, creator) " +
+			"SELECT 'Disk', id, 'user', creator, 'owner', created_at, creator FROM disks WHERE creator <> ''"
+		if tx.Migrator().HasColumn("disks", "deleted_at") {
+			query += " AND deleted_at IS NULL"
+		}
+		return tx.Exec(query).Error
+	},
+	Down: func(tx *gorm.DB) error {
+		return tx.Migrator().DropTable(&v3ResourceGrant{})
+	},
+}
+
+type v3ResourceGrant struct {
+	ID           int64  `gorm:"primary_key;AUTO_INCREMENT"`
+	ResourceType string `gorm:"not null; index:idx_resource_grant,unique; type:varchar(32)"`
+	ResourceID   int64  `gorm:"not null; index:idx_resource_grant,unique"`
+	SubjectType  string `gorm:"not null; index:idx_resource_grant,unique; index:idx_resource_grant_subject; type:varchar(16)"`
+	Subject      string `gorm:"not null; index:idx_resource_grant,unique; index:idx_resource_grant_subject; type:varchar(64)"`
+	Role         string `gorm:"not null; type:varchar(16)"`
+	CreatedAt    int64  `gorm:"autoCreateTime:milli; not null"`
+	Creator      string `gorm:"not null; type:varchar(32)"`
+}
+
+func (v3ResourceGrant) TableName() string { return "resource_grants" }
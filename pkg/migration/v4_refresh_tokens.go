@@ -0,0 +1,28 @@
+package migration
+
+import "gorm.io/gorm"
+
+// v4RefreshTokens adds the hashed refresh tokens of the passport API.
+var v4RefreshTokens = Migration{
+	Version: 4,
+	Name:    "refresh_tokens",
+	Up: func(tx *gorm.DB) error {
+		return tx.AutoMigrate(&v4RefreshToken{})
+	},
+	Down: func(tx *gorm.DB) error {
+		return tx.Migrator().DropTable(&v4RefreshToken{})
+	},
+}
+
+type v4RefreshToken struct {
+	ID        int64  `gorm:"primary_key;AUTO_INCREMENT"`
+	TokenHash string `gorm:"not null; index:idx_refresh_token_hash,unique; type:varchar(64)"`
+	FamilyID  string `gorm:"not null; index:idx_refresh_token_family; type:varchar(32)"`
+	UID       string `gorm:"not null; index:idx_refresh_token_uid; type:varchar(32)"`
+	SessionID string `gorm:"not null; type:varchar(32)"`
+	CreatedAt int64  `gorm:"autoCreateTime:milli; not null"`
+	ExpiresAt int64  `gorm:"not null; index:idx_refresh_token_expires_at"`
+	RevokedAt int64  `gorm:"not null; default:0"`
+}
+
+func (v4RefreshToken) TableName() string { return "refresh_tokens" }
@@ -0,0 +1,34 @@
+package migration
+
+import "gorm.io/gorm"
+
+// v5LocalAccounts adds the auth source and the bcrypt password of local accounts to users,
+// existing users were all created by LDAP logins.
+var v5LocalAccounts = Migration{
+	Version: 5,
+	Name:    "local_accounts",
+	Up: func(tx *gorm.DB) error {
+		for _, field := range []string{"AuthSource", "PasswordHash", "PasswordUpdatedAt"} {
+			if err := tx.Migrator().AddColumn(&v5User{}, field); err != nil {
+				return err
+			}
+		}
+		return nil
+	},
+	Down: func(tx *gorm.DB) error {
+		for _, field := range []string{"AuthSource", "PasswordHash", "PasswordUpdatedAt"} {
+			if err := tx.Migrator().DropColumn(&v5User{}, field); err != nil {
+				return err
+			}
+		}
+		return nil
+	},
+}
+
+type v5User struct {
+	AuthSource        string `gorm:"not null; default:'ldap'; type:varchar(16)"`
+	PasswordHash      string `gorm:"not null; default:''; type:varchar(255)"`
+	PasswordUpdatedAt int64  `gorm:"not null; default:0"`
+}
+
+func (v5User) TableName() string { return "users" }
@@ -0,0 +1,32 @@
+package migration
+
+import "gorm.io/gorm"
+
+// v6UserIdentities maps the users to their authentication provider by (auth_source, external_id).
+// The UID of the existing LDAP users is their LDAP uid and local users use their UID, so both become the external ID.
+var v6UserIdentities = Migration{
+	Version: 6,
+	Name:    "user_identities",
+	Up: func(tx *gorm.DB) error {
+		if err := tx.Migrator().AddColumn(&v6User{}, "ExternalID"); err != nil {
+			return err
+		}
+		if err := tx.Exec("UPDATE users SET external_id = uid").Error; err != nil {
+			return err
+		}
+		return tx.Migrator().CreateIndex(&v6User{}, "idx_user_identity")
+	},
+	Down: func(tx *gorm.DB) error {
+		if err := tx.Migrator().DropIndex(&v6User{}, "idx_user_identity"); err != nil {
+			return err
+		}
+		return tx.Migrator().DropColumn(&v6User{}, "ExternalID")
+	},
+}
+
+type v6User struct {
+	AuthSource string `gorm:"not null; default:'ldap'; index:idx_user_identity,unique; type:varchar(16)"`
+	ExternalID string `gorm:"not null; default:''; index:idx_user_identity,unique; type:varchar(255)"`
+}
+
+func (v6User) TableName() string { return "users" }
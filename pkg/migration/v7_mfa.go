@@ -0,0 +1,47 @@
+package migration
+
+import "gorm.io/gorm"
+
+// v7MFA adds the TOTP factors, the hashed recovery codes and the roles MFA is enforced for.
+var v7MFA = Migration{
+	Version: 7,
+	Name:    "mfa",
+	Up: func(tx *gorm.DB) error {
+		return tx.AutoMigrate(&v7UserMFA{}, &v7MFARecoveryCode{}, &v7MFARolePolicy{})
+	},
+	Down: func(tx *gorm.DB) error {
+		return tx.Migrator().DropTable(&v7UserMFA{}, &v7MFARecoveryCode{}, &v7MFARolePolicy{})
+	},
+}
+
+type v7UserMFA struct {
+	ID          int64  `gorm:"primary_key;AUTO_INCREMENT"`
+	UID         string `gorm:"not null; index:idx_user_mfa_uid,unique; type:varchar(32)"`
+	Secret      string `gorm:"not null; type:varchar(64)"`
+	ConfirmedAt int64  `gorm:"not null; default:0"`
+	LastStep    int64  `gorm:"not null; default:0"`
+	CreatedAt   int64  `gorm:"autoCreateTime:milli; not null"`
+	UpdatedAt   int64  `gorm:"autoUpdateTime:milli; not null"`
+}
+
+func (v7UserMFA) TableName() string { return "user_mfas" }
+
+type v7MFARecoveryCode struct {
+	ID        int64  `gorm:"primary_key;AUTO_INCREMENT"`
+	UID       string `gorm:"not null; index:idx_mfa_recovery_code_uid; type:varchar(32)"`
+	CodeHash  string `gorm:"not null; index:idx_mfa_recovery_code_hash,unique; type:varchar(64)"`
+	UsedAt    int64  `gorm:"not null; default:0"`
+	CreatedAt int64  `gorm:"autoCreateTime:milli; not null"`
+}
+
+func (v7MFARecoveryCode) TableName() string { return "mfa_recovery_codes" }
+
+type v7MFARolePolicy struct {
+	ID        int64  `gorm:"primary_key;AUTO_INCREMENT"`
+	Role      string `gorm:"not null; index:idx_mfa_role_policy_role,unique; type:varchar(32)"`
+	Enforced  bool   `gorm:"not null; default:false"`
+	Updater   string `gorm:"not null; type:varchar(32)"`
+	UpdatedAt int64  `gorm:"autoUpdateTime:milli; not null"`
+}
+
+func (v7MFARolePolicy) TableName() string { return "mfa_role_policies" }
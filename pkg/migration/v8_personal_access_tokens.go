@@ -0,0 +1,29 @@
+package migration
+
+import "gorm.io/gorm"
+
+// v8PersonalAccessTokens adds the hashed personal access tokens of the users.
+var v8PersonalAccessTokens = Migration{
+	Version: 8,
+	Name:    "personal_access_tokens",
+	Up: func(tx *gorm.DB) error {
+		return tx.AutoMigrate(&v8PersonalAccessToken{})
+	},
+	Down: func(tx *gorm.DB) error {
+		return tx.Migrator().DropTable(&v8PersonalAccessToken{})
+	},
+}
+
+type v8PersonalAccessToken struct {
+	ID         int64  `gorm:"primary_key;AUTO_INCREMENT"`
+	UID        string `gorm:"not null; index:idx_personal_access_token_uid; type:varchar(32)"`
+	Name       string `gorm:"not null; type:varchar(64)"`
+	TokenHash  string `gorm:"not null; index:idx_personal_access_token_hash,unique; type:varchar(64)"`
+	Scopes     string `gorm:"not null; type:varchar(255)"`
+	ExpiresAt  int64  `gorm:"not null"`
+	LastUsedAt int64  `gorm:"not null; default:0"`
+	RevokedAt  int64  `gorm:"not null; default:0"`
+	CreatedAt  int64  `gorm:"autoCreateTime:milli; not null"`
+}
+
+func (v8PersonalAccessToken) TableName() string { return "personal_access_tokens" }
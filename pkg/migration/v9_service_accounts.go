@@ -0,0 +1,35 @@
+package migration
+
+import "gorm.io/gorm"
+
+// v9ServiceAccounts adds the service accounts, the principals of machine-to-machine access.
+var v9ServiceAccounts = Migration{
+	Version: 9,
+	Name:    "service_accounts",
+	Up: func(tx *gorm.DB) error {
+		return tx.AutoMigrate(&v9ServiceAccount{})
+	},
+	Down: func(tx *gorm.DB) error {
+		return tx.Migrator().DropTable(&v9ServiceAccount{})
+	},
+}
+
+type v9ServiceAccount struct {
+	ID          int64  `gorm:"primary_key;AUTO_INCREMENT"`
+	UID         string `gorm:"not null; index:idx_service_account_uid,unique; type:varchar(32)"`
+	Name        string `gorm:"not null; index:idx_service_account_name; type:varchar(64)"`
+	Desc        string `gorm:"not null; type:varchar(255)"`
+	ProjectID   int64  `gorm:"not null; default:0; index:idx_service_account_project_id"`
+	ProjectRole string `gorm:"not null; default:''; type:varchar(32)"`
+	Role        string `gorm:"not null; type:varchar(32)"`
+	Status      string `gorm:"not null; type:varchar(32)"`
+	SecretHash  string `gorm:"not null; type:varchar(64)"`
+	LastUsedAt  int64  `gorm:"not null; default:0"`
+	CreatedAt   int64  `gorm:"autoCreateTime:milli; not null"`
+	Creator     string `gorm:"not null; type:varchar(32)"`
+	UpdatedAt   int64  `gorm:"autoUpdateTime:milli; not null"`
+	Updater     string `gorm:"not null; type:varchar(32)"`
+	gorm.DeletedAt
+}
+
+func (v9ServiceAccount) TableName() string { return "service_accounts" }
@@ -0,0 +1,18 @@
+package model
+
+// CasbinRule is a casbin policy or grouping rule, V0..V5 are the fields of the rule after ptype.
+// Unused trailing fields are empty.
+type CasbinRule struct {
+	ID    uint64 `gorm:"primary_key;AUTO_INCREMENT"`
+	Ptype string `gorm:"not null; index:idx_casbin_rule,unique; type:varchar(16)"`
+	V0    string `gorm:"not null; default:''; index:idx_casbin_rule,unique; type:varchar(100)"`
+	V1    string `gorm:"not null; default:''; index:idx_casbin_rule,unique; type:varchar(100)"`
+	V2    string `gorm:"not null; default:''; index:idx_casbin_rule,unique; type:varchar(100)"`
+	V3    string `gorm:"not null; default:''; index:idx_casbin_rule,unique; type:varchar(100)"`
+	V4    string `gorm:"not null; default:''; index:idx_casbin_rule,unique; type:varchar(100)"`
+	V5    string `gorm:"not null; default:''; index:idx_casbin_rule,unique; type:varchar(100)"`
+}
+
+func (CasbinRule) TableName() string {
+	return "casbin_rules"
+}
@@ -1,14 +1,17 @@
 package model
 
+import "gorm.io/gorm"
+
 // EventLog represents a record of an event that occurred within the system.
 type EventLog struct {
-	ID           uint         `gorm:"primary_key" json:"id"`         // Primary key
-	ResourceType ResourceType `gorm:"not null; index:resource_type"` // Resource type (VM or Disk)
-	ResourceUID  string       `gorm:"not null; index:resource_uid"`
-	EventType    EventType    `gorm:"not null" json:"event_type"`                       // Type of event (e.g., creation, deletion)
-	Operation    string       `gorm:"not null" json:"operation"`                        // The operation that was performed
-	CreatedAt    int64        `gorm:"autoCreateTime:milli; not null" json:"created_at"` // Event creation timestamp
-	Creator      string       `gorm:"not null" json:"creator"`                          // The user who triggered the event
+	ID           uint         `gorm:"primary_key" json:"id"`                                         // Primary key
+	ResourceType ResourceType `gorm:"not null; index:idx_event_log_resource_type; type:varchar(32)"` // Resource type (VM or Disk)
+	ResourceUID  string       `gorm:"not null; index:idx_event_log_resource_uid; type:varchar(32)"`
+	ProjectID    int64        `gorm:"not null; index:idx_event_log_project_id" json:"project_id"` // Project of the resource
+	EventType    EventType    `gorm:"not null" json:"event_type"`                                 // Type of event (e.g., creation, deletion)
+	Operation    string       `gorm:"not null" json:"operation"`                                  // The operation that was performed
+	CreatedAt    int64        `gorm:"autoCreateTime:milli; not null" json:"created_at"`           // Event creation timestamp
+	Creator      string       `gorm:"not null" json:"creator"`                                    // The user who triggered the event
 }
 
 // EventType defines the type for event types.
@@ -26,3 +29,14 @@ const (
 func (EventLog) TableName() string {
 	return "event_logs"
 }
+
+// BeforeCreate fills the project of VM events from the VM, so that the writers of the log channel
+// don't have to resolve it themselves.
+func (l *EventLog) BeforeCreate(tx *gorm.DB) error {
+	if l.ProjectID != 0 || l.ResourceType != ResourceTypeVM || l.ResourceUID == "" {
+		return nil
+	}
+	// the VM may already be soft deleted when its deletion event is written
+	return tx.Session(&gorm.Session{NewDB: true}).Unscoped().Model(&VM{}).
+		Select("project_id").Where("uid = ?", l.ResourceUID).Limit(1).Scan(&l.ProjectID).Error
+}
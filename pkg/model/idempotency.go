@@ -0,0 +1,28 @@
+package model
+
+// IdempotencyRecord stores the first response of a mutating request so that
+// retries carrying the same Idempotency-Key can be replayed. It is only used
+// when redis is disabled.
+type IdempotencyRecord struct {
+	ID             int64             `gorm:"primary_key;AUTO_INCREMENT"`
+	UID            string            `gorm:"not null; index:idx_uid_key,unique; type:varchar(32)"`  // Owner of the key
+	IdempotencyKey string            `gorm:"not null; index:idx_uid_key,unique; type:varchar(255)"` // Idempotency-Key header value
+	Fingerprint    string            `gorm:"not null; type:varchar(64)"`                            // Hash of method, URL and body
+	Status         IdempotencyStatus `gorm:"not null; type:varchar(32)"`
+	StatusCode     int               `gorm:"not null"`
+	ContentType    string            `gorm:"not null; type:varchar(255)"`
+	Body           []byte
+	CreatedAt      int64 `gorm:"autoCreateTime:milli; not null"`
+	ExpiresAt      int64 `gorm:"not null; index:idx_idempotency_expires_at"`
+}
+
+type IdempotencyStatus string
+
+const (
+	IdempotencyStatusProcessing IdempotencyStatus = "processing"
+	IdempotencyStatusCompleted  IdempotencyStatus = "completed"
+)
+
+func (IdempotencyRecord) TableName() string {
+	return "idempotency_records"
+}
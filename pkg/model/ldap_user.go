@@ -3,7 +3,9 @@ package model
 import (
 	"errors"
 	"fmt"
+	"strconv"
 	"strings"
+	"time"
 )
 
 // LdapUser represents a user resource in LDAP
@@ -20,6 +22,10 @@ type LdapUser struct {
 	UIDNumber       string `ldap:"uidNumber"`       // User ID Number
 	HomeDirectory   string `ldap:"homeDirectory"`   // Home Directory
 	UserPassword    []byte `ldap:"userPassword"`    // User Password (binary)
+	// MemberOf is the DNs of the groups of the user, it is maintained by the server and never written
+	MemberOf []string `ldap:"memberOf"`
+	// ShadowExpire is the day since 1970-01-01 the account expires on, the console disables an account by setting it to 1
+	ShadowExpire string `ldap:"shadowExpire"`
 }
 
 // Validate validates the fields of LdapUser
@@ -51,6 +57,19 @@ func (u *LdapUser) Validate() error {
 	return nil
 }
 
+// Disabled reports whether the account has expired by shadowExpire
+func (u *LdapUser) Disabled() bool {
+	if u.ShadowExpire == "" {
+		return false
+	}
+	days, err := strconv.ParseInt(u.ShadowExpire, 10, 64)
+	if err != nil || days < 0 {
+		// -1 表示永不过期
+		return false
+	}
+	return days*24*int64(time.Hour/time.Second) <= time.Now().Unix()
+}
+
 // ParseDN parses CN and OU from DN
 func (u *LdapUser) ParseDN() error {
 	parts := strings.Split(u.DN, ",")
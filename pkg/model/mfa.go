@@ -0,0 +1,46 @@
+package model
+
+// UserMFA is the TOTP second factor of a user. It is used for login once ConfirmedAt is set by the
+// verification of a first code, an unconfirmed factor is replaced by the next enrollment.
+type UserMFA struct {
+	ID  int64  `gorm:"primary_key;AUTO_INCREMENT"`
+	UID string `gorm:"not null; index:idx_user_mfa_uid,unique; type:varchar(32)"`
+	// Secret is the base32 TOTP secret shared with the authenticator app
+	Secret      string `gorm:"not null; type:varchar(64)" json:"-"`
+	ConfirmedAt int64  `gorm:"not null; default:0"`
+	// LastStep is the time step of the last accepted code, a code is never accepted twice
+	LastStep  int64 `gorm:"not null; default:0" json:"-"`
+	CreatedAt int64 `gorm:"autoCreateTime:milli; not null"`
+	UpdatedAt int64 `gorm:"autoUpdateTime:milli; not null"`
+}
+
+func (UserMFA) TableName() string {
+	return "user_mfas"
+}
+
+// MFARecoveryCode is a one-time code replacing the TOTP code when the authenticator app is lost,
+// only its sha256 hash is stored.
+type MFARecoveryCode struct {
+	ID        int64  `gorm:"primary_key;AUTO_INCREMENT"`
+	UID       string `gorm:"not null; index:idx_mfa_recovery_code_uid; type:varchar(32)"`
+	CodeHash  string `gorm:"not null; index:idx_mfa_recovery_code_hash,unique; type:varchar(64)"`
+	UsedAt    int64  `gorm:"not null; default:0"`
+	CreatedAt int64  `gorm:"autoCreateTime:milli; not null"`
+}
+
+func (MFARecoveryCode) TableName() string {
+	return "mfa_recovery_codes"
+}
+
+// MFARolePolicy enforces MFA for the users of a role, they have to enroll on their next login
+type MFARolePolicy struct {
+	ID        int64    `gorm:"primary_key;AUTO_INCREMENT"`
+	Role      UserRole `gorm:"not null; index:idx_mfa_role_policy_role,unique; type:varchar(32)"`
+	Enforced  bool     `gorm:"not null; default:false"`
+	Updater   string   `gorm:"not null; type:varchar(32)"`
+	UpdatedAt int64    `gorm:"autoUpdateTime:milli; not null"`
+}
+
+func (MFARolePolicy) TableName() string {
+	return "mfa_role_policies"
+}
@@ -1,3 +0,0 @@
-package model
-
-var GlobalDst = []any{}
@@ -0,0 +1,33 @@
+package model
+
+import "strings"
+
+// PersonalAccessToken is a long-lived token of a user for automation, e.g. CI pipelines.
+// Only its sha256 hash is stored, the token is shown once when it is created.
+// The names of the valid tokens of a user are unique, idx_personal_access_token_name includes
+// RevokedAt and expired tokens are revoked before a token of their name is issued.
+type PersonalAccessToken struct {
+	ID        int64  `gorm:"primary_key;AUTO_INCREMENT"`
+	UID       string `gorm:"not null; index:idx_personal_access_token_uid; index:idx_personal_access_token_name,unique; type:varchar(32)"`
+	Name      string `gorm:"not null; index:idx_personal_access_token_name,unique; type:varchar(64)"`
+	TokenHash string `gorm:"not null; index:idx_personal_access_token_hash,unique; type:varchar(64)" json:"-"`
+	// Scopes are the comma separated API groups the token can access, see auth.PersonalAccessTokenScopes
+	Scopes     string `gorm:"not null; type:varchar(255)"`
+	ExpiresAt  int64  `gorm:"not null"`
+	LastUsedAt int64  `gorm:"not null; default:0"`
+	// RevokedAt is set when the token is revoked, 0 means the token is still valid
+	RevokedAt int64 `gorm:"not null; default:0; index:idx_personal_access_token_name,unique"`
+	CreatedAt int64 `gorm:"autoCreateTime:milli; not null"`
+}
+
+func (PersonalAccessToken) TableName() string {
+	return "personal_access_tokens"
+}
+
+// ScopeList returns the scopes of the token
+func (t *PersonalAccessToken) ScopeList() []string {
+	if t.Scopes == "" {
+		return nil
+	}
+	return strings.Split(t.Scopes, ",")
+}
@@ -0,0 +1,67 @@
+package model
+
+import "gorm.io/gorm"
+
+// Project groups users and resources, each project maps to its own kubernetes namespace.
+type Project struct {
+	ID        int64  `gorm:"primary_key;AUTO_INCREMENT"`
+	UID       string `gorm:"not null; index:idx_project_uid,unique; type:varchar(32)"`
+	Name      string `gorm:"not null; index:idx_project_name,unique; type:varchar(50)"`
+	Namespace string `gorm:"not null; index:idx_project_namespace,unique; type:varchar(63)"` // Kubernetes namespace of the project
+	Desc      string `gorm:"not null; type:varchar(255)"`
+	CreatedAt int64  `gorm:"autoCreateTime:milli; not null; index:idx_project_created_at"`
+	Creator   string `gorm:"not null; type:varchar(32)"`
+	UpdatedAt int64  `gorm:"autoUpdateTime:milli; not null"`
+	Updater   string `gorm:"not null; type:varchar(32)"`
+	gorm.DeletedAt
+}
+
+func (Project) TableName() string {
+	return "projects"
+}
+
+// DefaultProjectName is the project mapped to the configured namespace,
+// which holds the resources created before projects existed.
+const DefaultProjectName = "default"
+
+// ProjectMember binds a user to a project with a role.
+type ProjectMember struct {
+	ID        int64       `gorm:"primary_key;AUTO_INCREMENT"`
+	ProjectID int64       `gorm:"not null; index:idx_project_user,unique"`
+	UID       string      `gorm:"not null; index:idx_project_user,unique; index:idx_project_member_uid; type:varchar(32)"`
+	Role      ProjectRole `gorm:"not null; type:varchar(32)"`
+	CreatedAt int64       `gorm:"autoCreateTime:milli; not null"`
+	Creator   string      `gorm:"not null; type:varchar(32)"`
+}
+
+type ProjectRole string
+
+const (
+	// ProjectRoleAdmin manages members and quota and operates all resources of the project
+	ProjectRoleAdmin ProjectRole = "admin"
+	// ProjectRoleMember creates and operates resources of the project
+	ProjectRoleMember ProjectRole = "member"
+	// ProjectRoleViewer only reads resources of the project
+	ProjectRoleViewer ProjectRole = "viewer"
+)
+
+func (ProjectMember) TableName() string {
+	return "project_members"
+}
+
+// ProjectQuota limits the resources of a project, it is applied as a ResourceQuota in the project namespace.
+// Empty values mean unlimited.
+type ProjectQuota struct {
+	ID        int64  `gorm:"primary_key;AUTO_INCREMENT"`
+	ProjectID int64  `gorm:"not null; index:idx_project_quota_project_id,unique"`
+	VMs       int64  `gorm:"not null"`                   // Max number of virtual machines
+	CPU       string `gorm:"not null; type:varchar(32)"` // Max requested cpu, e.g. "16"
+	Memory    string `gorm:"not null; type:varchar(32)"` // Max requested memory, e.g. "64Gi"
+	Storage   string `gorm:"not null; type:varchar(32)"` // Max requested storage, e.g. "1Ti"
+	UpdatedAt int64  `gorm:"autoUpdateTime:milli; not null"`
+	Updater   string `gorm:"not null; type:varchar(32)"`
+}
+
+func (ProjectQuota) TableName() string {
+	return "project_quotas"
+}
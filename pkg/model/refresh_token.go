@@ -0,0 +1,20 @@
+package model
+
+// RefreshToken is an opaque token exchanged for a new access token, only its sha256 hash is stored.
+// The refresh tokens rotated from the same login share a FamilyID, reusing a rotated token revokes the family.
+type RefreshToken struct {
+	ID        int64  `gorm:"primary_key;AUTO_INCREMENT"`
+	TokenHash string `gorm:"not null; index:idx_refresh_token_hash,unique; type:varchar(64)"`
+	FamilyID  string `gorm:"not null; index:idx_refresh_token_family; type:varchar(32)"`
+	UID       string `gorm:"not null; index:idx_refresh_token_uid; type:varchar(32)"`
+	// SessionID is the jti of the access token issued together with the refresh token
+	SessionID string `gorm:"not null; type:varchar(32)"`
+	CreatedAt int64  `gorm:"autoCreateTime:milli; not null"`
+	ExpiresAt int64  `gorm:"not null; index:idx_refresh_token_expires_at"`
+	// RevokedAt is set when the token is rotated or revoked, 0 means the token is still valid
+	RevokedAt int64 `gorm:"not null; default:0"`
+}
+
+func (RefreshToken) TableName() string {
+	return "refresh_tokens"
+}
@@ -0,0 +1,50 @@
+package model
+
+// ResourceGrant gives a user, or every user of a group, a role on a VM or a disk.
+// The creator of a resource is recorded as its owner grant.
+type ResourceGrant struct {
+	ID           int64            `gorm:"primary_key;AUTO_INCREMENT"`
+	ResourceType ResourceType     `gorm:"not null; index:idx_resource_grant,unique; type:varchar(32)"`
+	ResourceID   int64            `gorm:"not null; index:idx_resource_grant,unique"`
+	SubjectType  GrantSubjectType `gorm:"not null; index:idx_resource_grant,unique; index:idx_resource_grant_subject; type:varchar(16)"`
+	Subject      string           `gorm:"not null; index:idx_resource_grant,unique; index:idx_resource_grant_subject; type:varchar(64)"` // uid or group name
+	Role         ResourceRole     `gorm:"not null; type:varchar(16)"`
+	CreatedAt    int64            `gorm:"autoCreateTime:milli; not null"`
+	Creator      string           `gorm:"not null; type:varchar(32)"`
+}
+
+func (ResourceGrant) TableName() string {
+	return "resource_grants"
+}
+
+type GrantSubjectType string
+
+const (
+	GrantSubjectUser GrantSubjectType = "user"
+	// GrantSubjectGroup is a casbin role, it covers every user bound to the role.
+	// The built-in roles, see UserRole.Builtin, are not groups.
+	GrantSubjectGroup GrantSubjectType = "group"
+)
+
+type ResourceRole string
+
+const (
+	// ResourceRoleViewer reads the resource
+	ResourceRoleViewer ResourceRole = "viewer"
+	// ResourceRoleOperator also operates the resource, e.g. starts, stops or attaches disks
+	ResourceRoleOperator ResourceRole = "operator"
+	// ResourceRoleOwner also deletes the resource and manages its grants
+	ResourceRoleOwner ResourceRole = "owner"
+)
+
+var resourceRoleLevels = map[ResourceRole]int{
+	ResourceRoleViewer:   1,
+	ResourceRoleOperator: 2,
+	ResourceRoleOwner:    3,
+}
+
+// Allows reports whether the role includes the permissions of need.
+func (r ResourceRole) Allows(need ResourceRole) bool {
+	level, ok := resourceRoleLevels[r]
+	return ok && level >= resourceRoleLevels[need]
+}
@@ -0,0 +1,12 @@
+package model
+
+// SchemaMigration records a migration applied to the database.
+type SchemaMigration struct {
+	Version   int64  `gorm:"primary_key;autoIncrement:false"`
+	Name      string `gorm:"not null; type:varchar(255)"`
+	AppliedAt int64  `gorm:"not null"`
+}
+
+func (SchemaMigration) TableName() string {
+	return "schema_migrations"
+}
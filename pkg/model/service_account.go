@@ -0,0 +1,34 @@
+package model
+
+import "gorm.io/gorm"
+
+// ServiceAccount is a non-human principal for machine-to-machine access. It exchanges its client
+// credentials for access tokens by the client credentials grant, its UID is the client_id and only
+// the sha256 hash of its secret is stored. It is bound to Role in casbin like a user.
+type ServiceAccount struct {
+	ID   int64  `gorm:"primary_key;AUTO_INCREMENT"`
+	UID  string `gorm:"not null; index:idx_service_account_uid,unique; type:varchar(32)"`
+	Name string `gorm:"not null; index:idx_service_account_project_name,unique; type:varchar(64)"`
+	Desc string `gorm:"not null; type:varchar(255)"`
+	// ProjectID is the project owning the account, the account is a member of it with ProjectRole.
+	// 0 means the account is owned by the admins.
+	ProjectID   int64       `gorm:"not null; default:0; index:idx_service_account_project_id; index:idx_service_account_project_name,unique"`
+	ProjectRole ProjectRole `gorm:"not null; default:''; type:varchar(32)"`
+	Role        UserRole    `gorm:"not null; type:varchar(32)"`
+	Status      UserStatus  `gorm:"not null; type:varchar(32)"`
+	SecretHash  string      `gorm:"not null; type:varchar(64)" json:"-"`
+	LastUsedAt  int64       `gorm:"not null; default:0"`
+	CreatedAt   int64       `gorm:"autoCreateTime:milli; not null"`
+	// Creator is the user who created the account, the audit logs of the account show it
+	Creator   string `gorm:"not null; type:varchar(32)"`
+	UpdatedAt int64  `gorm:"autoUpdateTime:milli; not null"`
+	Updater   string `gorm:"not null; type:varchar(32)"`
+	// DeletedID is the ID of a deleted account and 0 otherwise, so that idx_service_account_project_name
+	// only keeps the names of the existing accounts unique
+	DeletedID int64 `gorm:"not null; default:0; index:idx_service_account_project_name,unique"`
+	gorm.DeletedAt
+}
+
+func (ServiceAccount) TableName() string {
+	return "service_accounts"
+}
@@ -0,0 +1,15 @@
+package model
+
+// TokenDenylistEntry is a revoked access token or the revocation time of a user's tokens,
+// keyed like the redis denylist of the token manager. It is only used when redis is disabled.
+type TokenDenylistEntry struct {
+	ID          int64  `gorm:"primary_key;AUTO_INCREMENT"`
+	DenylistKey string `gorm:"not null; index:idx_token_denylist_key,unique; type:varchar(255)"`
+	Value       string `gorm:"not null; type:varchar(64)"`
+	// ExpiresAt is a unix millisecond, 0 means the entry never expires
+	ExpiresAt int64 `gorm:"not null; index:idx_token_denylist_expires_at"`
+}
+
+func (TokenDenylistEntry) TableName() string {
+	return "token_denylist"
+}
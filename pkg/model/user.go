@@ -4,25 +4,53 @@ import "gorm.io/gorm"
 
 type User struct {
 	ID        int64      `gorm:"primary_key;AUTO_INCREMENT"`
-	UID       string     `gorm:"not null; index:uid,unique; type:varchar(32)"`
-	Username  string     `gorm:"not null; index:username; type:varchar(32)"`
+	UID       string     `gorm:"not null; index:idx_user_uid,unique; type:varchar(32)"`
+	Username  string     `gorm:"not null; index:idx_user_username; type:varchar(32)"`
 	Role      UserRole   `gorm:"not null"`
 	Primary   bool       `gorm:"not null"`
 	Tel       string     `gorm:"not null; type:varchar(32)"`
 	Email     string     `gorm:"not null; type:varchar(32)"`
 	Desc      string     `gorm:"not null; type:varchar(255)"`
 	Status    UserStatus `gorm:"not null"`
-	CreatedAt int64      `gorm:"autoCreateTime:milli; not null; index:idx_created_at"`
+	CreatedAt int64      `gorm:"autoCreateTime:milli; not null; index:idx_user_created_at"`
 	Creator   string     `gorm:"not null; type:varchar(32)"`
 	UpdatedAt int64      `gorm:"autoUpdateTime:milli; not null"`
 	Updater   string     `gorm:"not null; type:varchar(32)"`
 	gorm.DeletedAt
+	// AuthSource 用户的认证方式, local 用户的密码以 bcrypt 哈希保存在 PasswordHash 中
+	AuthSource AuthSource `gorm:"not null; default:'ldap'; index:idx_user_identity,unique; type:varchar(16)"`
+	// ExternalID 用户在认证方式中的 ID, 如 LDAP 的 uid 或 OIDC 的 sub, 本地用户为 UID.
+	// 用户按 (AuthSource, ExternalID) 对应, 不同认证方式的同名用户不会被合并
+	ExternalID string `gorm:"not null; default:''; index:idx_user_identity,unique; type:varchar(255)"`
+	// DeletedID is the ID of a deleted user and 0 otherwise, so that idx_user_identity only keeps
+	// the identities of the existing users unique
+	DeletedID         int64  `gorm:"not null; default:0; index:idx_user_identity,unique" json:"-"`
+	PasswordHash      string `gorm:"not null; default:''; type:varchar(255)" json:"-"`
+	PasswordUpdatedAt int64  `gorm:"not null; default:0"`
+	// LockedUntil 连续登录失败被锁定的截止时间(毫秒), 到期后登录成功自动解锁. 0 表示不是因登录失败锁定
+	LockedUntil int64 `gorm:"not null; default:0"`
 }
 type UserRole string
 
 const (
 	UserRoleAdmin  UserRole = "admin"
 	UserRoleNormal UserRole = "normal"
+	// UserRoleServiceAccount is the default role of the service accounts
+	UserRoleServiceAccount UserRole = "service_account"
+)
+
+// Builtin reports whether the role is one of the roles every user or service account is bound to.
+// Such a role is too broad to be a group of resource grants.
+func (r UserRole) Builtin() bool {
+	return r == UserRoleAdmin || r == UserRoleNormal || r == UserRoleServiceAccount
+}
+
+// AuthSource is the authentication provider of a user, it is the name of an enabled provider
+type AuthSource string
+
+const (
+	AuthSourceLDAP  AuthSource = "ldap"
+	AuthSourceLocal AuthSource = "local"
 )
 
 type UserStatus string
@@ -52,20 +80,38 @@ var DefaultUser = User{
 
 type UserOperatorLog struct {
 	ID        int64            `gorm:"primary_key;AUTO_INCREMENT"`
-	UID       string           `gorm:"not null; index:uid"`
+	UID       string           `gorm:"not null; index:idx_user_operator_log_uid; type:varchar(32)"`
 	Operator  UserOperatorType `gorm:"not null; type:varchar(255)"`
 	Operation string           `gorm:"not null; type:varchar(255)"`
-	CreatedAt int64            `gorm:"autoCreateTime:milli; not null; index:idx_created_at"`
+	CreatedAt int64            `gorm:"autoCreateTime:milli; not null; index:idx_user_operator_log_created_at"`
 	Creator   string           `gorm:"not null; type:varchar(32)"`
 }
 
 type UserOperatorType string
 
 const (
-	UserOperatorLogin      UserOperatorType = "login"
-	UserOperatorFirstLogin UserOperatorType = "first_login"
-	UserOperatorUpdate     UserOperatorType = "update"
-	UserOperatorError      UserOperatorType = "error"
+	UserOperatorLogin       UserOperatorType = "login"
+	UserOperatorFirstLogin  UserOperatorType = "first_login"
+	UserOperatorUpdate      UserOperatorType = "update"
+	UserOperatorError       UserOperatorType = "error"
+	UserOperatorLogout      UserOperatorType = "logout"
+	UserOperatorLogoutAll   UserOperatorType = "logout_all"
+	UserOperatorForceLogout UserOperatorType = "force_logout"
+	UserOperatorLock        UserOperatorType = "lock"
+	UserOperatorUnlock      UserOperatorType = "unlock"
+	UserOperatorCreate      UserOperatorType = "create"
+	UserOperatorPassword    UserOperatorType = "password_change"
+	// UserOperatorSync is a change of the directory sync, e.g. a role or email update
+	UserOperatorSync UserOperatorType = "ldap_sync"
+	// UserOperatorLDAPUser and UserOperatorLDAPGroup are changes of the directory by an admin, UID is the admin
+	UserOperatorLDAPUser  UserOperatorType = "ldap_user"
+	UserOperatorLDAPGroup UserOperatorType = "ldap_group"
+	// UserOperatorMFA is an enrollment, reset or removal of the second factor
+	UserOperatorMFA UserOperatorType = "mfa"
+	// UserOperatorPersonalAccessToken is a creation or revocation of a personal access token
+	UserOperatorPersonalAccessToken UserOperatorType = "personal_access_token"
+	// UserOperatorServiceAccount is a change of a service account, UID is the service account
+	UserOperatorServiceAccount UserOperatorType = "service_account"
 )
 
 func (UserOperatorLog) TableName() string {
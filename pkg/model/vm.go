@@ -4,21 +4,21 @@ import "gorm.io/gorm"
 
 type VM struct {
 	ID        int64    `gorm:"primary_key;AUTO_INCREMENT"` // Primary key
-	UID       string   `gorm:"not null; index:hash_id;"`
-	VMName    string   `gorm:"not null; index:vm_name; type:varchar(32)"` // Virtual machine name
-	CPU       int64    `gorm:"not null; index:cpu;"`                      // CPU cores
-	Memory    int64    `gorm:"not null; index:memory;"`                   // Memory size (in MB)
-	DiskIDs   []int64  `gorm:"not null; index:disk_ids;"`                 // List of associated disk IDs
-	Disks     []Disk   `gorm:"-"`                                         // Associated disks (not stored in DB)
+	UID       string   `gorm:"not null; index:idx_vm_uid; type:varchar(32)"`
+	ProjectID int64    `gorm:"not null; index:idx_vm_project_id;"`            // Project the VM belongs to
+	VMName    string   `gorm:"not null; index:idx_vm_name; type:varchar(32)"` // Virtual machine name
+	CPU       int64    `gorm:"not null; index:idx_vm_cpu;"`                   // CPU cores
+	Memory    int64    `gorm:"not null; index:idx_vm_memory;"`                // Memory size (in MB)
+	Disks     []Disk   `gorm:"-"`                                             // Associated disks (not stored in DB)
 	DVID      string   `gorm:"not null;"`
 	DVName    string   `gorm:"not null;"`
 	OsMirror  string   `gorm:"not null;"`
 	Os        OSMirror `gorm:"-"`
-	Status    VMStatus `gorm:"not null; type:varchar(32); index:status;"`            // VM status
-	CreatedAt int64    `gorm:"autoCreateTime:milli; not null; index:idx_created_at"` // Creation time
-	Creator   string   `gorm:"not null; type:varchar(32)"`                           // Creator
-	UpdatedAt int64    `gorm:"autoUpdateTime:milli; not null"`                       // Update time
-	Updater   string   `gorm:"not null; type:varchar(32)"`                           // Updater
+	Status    VMStatus `gorm:"not null; type:varchar(32); index:idx_vm_status;"`        // VM status
+	CreatedAt int64    `gorm:"autoCreateTime:milli; not null; index:idx_vm_created_at"` // Creation time
+	Creator   string   `gorm:"not null; type:varchar(32)"`                              // Creator
+	UpdatedAt int64    `gorm:"autoUpdateTime:milli; not null"`                          // Update time
+	Updater   string   `gorm:"not null; type:varchar(32)"`                              // Updater
 
 	gorm.DeletedAt // Soft delete field
 }
@@ -0,0 +1,14 @@
+package model
+
+// VMDisk associates a disk with the VM it is attached to.
+type VMDisk struct {
+	ID        int64  `gorm:"primary_key;AUTO_INCREMENT"`
+	VMID      int64  `gorm:"not null; index:idx_vm_disk,unique"`
+	DiskID    int64  `gorm:"not null; index:idx_vm_disk,unique; index:idx_vm_disk_disk_id"`
+	CreatedAt int64  `gorm:"autoCreateTime:milli; not null"`
+	Creator   string `gorm:"not null; type:varchar(32)"`
+}
+
+func (VMDisk) TableName() string {
+	return "vm_disks"
+}
@@ -7,6 +7,7 @@ import (
 	"os"
 	"path/filepath"
 	"strings"
+	"time"
 
 	"github.com/spf13/viper"
 	"go.uber.org/zap"
@@ -17,19 +18,37 @@ const (
 	// 默认值定义
 	defaultNamespace    = "async-km"
 	defaultStorageClass = "async-km-sc"
-	defaultJWTSecret    = "cebc04fc7d4383ebf11bf661ba69977e" // MD5 async-km
+
+	defaultCasbinModelPath = "config/casbin_model.conf"
+
+	// 登录失败锁定默认值
+	defaultLoginUserThreshold   = 5
+	defaultLoginIPThreshold     = 20
+	defaultLoginFailWindow      = 15 * time.Minute
+	defaultLoginLockoutDuration = 30 * time.Minute
+
+	// 本地账号默认值
+	defaultBootstrapAdmin    = "admin"
+	defaultPasswordMinLength = 8
+	defaultPasswordRating    = "strong"
+
+	// 认证方式默认值
+	defaultOIDCName = "oidc"
 
 	// Server defaults
 	defaultBindAddress = "0.0.0.0"
 	defaultServerPort  = 9090
 
 	// MySQL defaults
+	defaultMySQLDriver   = "mysql"
 	defaultMySQLHost     = "localhost"
 	defaultMySQLPort     = 3306
 	defaultMySQLUser     = "root"
 	defaultMySQLPassword = "123456"
 	defaultMySQLDB       = "async_km"
 
+	defaultReadYourWritesTTL = time.Second * 5
+
 	// Redis defaults
 	defaultRedisDB = 0
 
@@ -39,6 +58,19 @@ const (
 	defaultLDAPUserDN = "cn=admin,dc=example,dc=com"
 	defaultLDAPBaseDN = "dc=example,dc=com"
 
+	defaultLDAPSyncInterval = 10 * time.Minute
+
+	defaultLDAPTLSMode             = "ldaps"
+	defaultLDAPPoolSize            = 4
+	defaultLDAPTimeout             = 30 * time.Second
+	defaultLDAPHealthCheckInterval = 30 * time.Second
+
+	// Captcha defaults
+	defaultCaptchaDriver        = "math"
+	defaultCaptchaLength        = 4
+	defaultCaptchaTTL           = time.Minute
+	defaultCaptchaAudioLanguage = "zh"
+
 	defauletKubeNameSpace   = "async-km"
 	defaultKubeStorageClass = "async-km-sc"
 )
@@ -55,6 +87,10 @@ type Config struct {
 	LDAP   LDAPConfig   `mapstructure:"ldap"`
 	K8s    K8sConfig    `mapstructure:"kubernetes"`
 	Logger LoggerConfig `mapstructure:"logger"`
+	// 验证码配置, 配置了redis时验证码保存在redis中
+	Captcha CaptchaConfig `mapstructure:"captcha"`
+	// OpenID Connect 登录配置, 需要在 server.auth-providers 中启用 oidc
+	OIDC OIDCConfig `mapstructure:"oidc"`
 }
 
 // ServerConfig 服务器配置
@@ -68,6 +104,29 @@ type ServerConfig struct {
 	DebugMode       bool   `mapstructure:"debug-mode"`
 	K8sNameSpace    string `mapstructure:"k8s-namespace"`
 	K8sStorageClass string `mapstructure:"k8s-storage-class"`
+	CasbinModelPath string `mapstructure:"casbin-model"`
+	// 每个用户同时登录的会话上限, 0 表示不限制
+	MaxSessions int `mapstructure:"max-sessions"`
+	// jwt-signing-key 为 PEM 格式的私钥文件, 优先于 jwt-secret
+	JWTSigningKey string `mapstructure:"jwt-signing-key"`
+	// jwt-verify-keys 为轮换前签名密钥的公钥文件, 在旧 token 过期前保留
+	JWTVerifyKeys []string `mapstructure:"jwt-verify-keys"`
+	// 登录失败锁定, 阈值为 0 表示不限制
+	LoginUserThreshold   int64         `mapstructure:"login-user-threshold"`
+	LoginIPThreshold     int64         `mapstructure:"login-ip-threshold"`
+	LoginFailWindow      time.Duration `mapstructure:"login-fail-window"`
+	LoginLockoutDuration time.Duration `mapstructure:"login-lockout-duration"`
+	// 每分钟允许的 API 请求数, 0 表示不限制
+	APIUserRateLimit int `mapstructure:"api-user-rate-limit"`
+	APIIPRateLimit   int `mapstructure:"api-ip-rate-limit"`
+	// 首次启动且没有管理员时创建的本地管理员, 默认为 admin, 为空表示不创建, 未配置密码时生成随机密码并只输出一次到标准错误
+	BootstrapAdmin         string `mapstructure:"bootstrap-admin"`
+	BootstrapAdminPassword string `mapstructure:"bootstrap-admin-password"`
+	// 本地账号的密码强度要求, password-rating 可选 week, moderate, strong 和 veryStrong
+	PasswordMinLength int    `mapstructure:"password-min-length"`
+	PasswordRating    string `mapstructure:"password-rating"`
+	// 启用的认证方式, 可选 local, ldap 和 oidc, 未指定时按顺序尝试密码登录
+	AuthProviders []string `mapstructure:"auth-providers"`
 }
 
 // CacheConfig Redis缓存配置
@@ -77,14 +136,18 @@ type CacheConfig struct {
 	DB       int    `mapstructure:"redis-db"`
 }
 
-// MySQLConfig MySQL数据库配置
+// MySQLConfig 数据库配置, rdb-driver 可选 mysql, postgres 和 sqlite
 type MySQLConfig struct {
+	RdbDriver   string `mapstructure:"rdb-driver"`
 	RdbUser     string `mapstructure:"rdb-user"`
 	RdbPassword string `mapstructure:"rdb-password"`
 	RdbHost     string `mapstructure:"rdb-host"`
 	RdbPort     int    `mapstructure:"rdb-port"`
 	RdbDbname   string `mapstructure:"rdb-dbname"`
 	RdbLogLevel int    `mapstructure:"rdb-log-level"`
+	// 只读副本 host:port, 与主库共用账号和库名
+	RdbReplicas          []string      `mapstructure:"rdb-replicas"`
+	RdbReadYourWritesTTL time.Duration `mapstructure:"rdb-read-your-writes-ttl"`
 }
 
 // LDAPConfig LDAP配置
@@ -94,6 +157,21 @@ type LDAPConfig struct {
 	LDAPUserName string `mapstructure:"ldap-user-name"`
 	LDAPPassword string `mapstructure:"ldap-password"`
 	BaseDN       string `mapstructure:"ldap-base-dn"`
+	// LDAP 组到平台角色或项目角色的映射, 如 console-admins=admin, team-a=demo:member
+	GroupMappings []string `mapstructure:"ldap-group-mappings"`
+	// 同步 LDAP 用户角色, 项目, 状态, 邮箱和电话的间隔, 0 表示不同步
+	SyncInterval time.Duration `mapstructure:"ldap-sync-interval"`
+	// 连接方式, 可选 ldaps, starttls 和 none
+	TLSMode string `mapstructure:"ldap-tls-mode"`
+	// 校验服务端证书的 CA 证书文件, 为空时使用系统 CA
+	CAFile string `mapstructure:"ldap-ca-file"`
+	// 校验服务端证书的域名, 为空时使用 Host
+	ServerName         string `mapstructure:"ldap-server-name"`
+	InsecureSkipVerify bool   `mapstructure:"ldap-insecure-skip-verify"`
+	// 以管理员身份绑定的连接数, 用户登录时使用单独的连接
+	PoolSize            int           `mapstructure:"ldap-pool-size"`
+	Timeout             time.Duration `mapstructure:"ldap-timeout"`
+	HealthCheckInterval time.Duration `mapstructure:"ldap-health-check-interval"`
 }
 
 // K8sConfig Kubernetes配置
@@ -116,6 +194,27 @@ type LoggerConfig struct {
 	Compress      bool   `mapstructure:"log-compress"`
 }
 
+// CaptchaConfig 验证码配置, driver 可选 math, string 和 audio
+type CaptchaConfig struct {
+	Driver string `mapstructure:"captcha-driver"`
+	// string 验证码的字符数或 audio 验证码的数字个数
+	Length int `mapstructure:"captcha-length"`
+	// math 和 string 验证码的干扰字符数, 越多越难识别
+	Noise         int           `mapstructure:"captcha-noise"`
+	TTL           time.Duration `mapstructure:"captcha-ttl"`
+	AudioLanguage string        `mapstructure:"captcha-audio-language"`
+}
+
+// OIDCConfig OpenID Connect 配置, issuer 为空表示不启用
+type OIDCConfig struct {
+	Name         string   `mapstructure:"oidc-name"`
+	Issuer       string   `mapstructure:"oidc-issuer"`
+	ClientID     string   `mapstructure:"oidc-client-id"`
+	ClientSecret string   `mapstructure:"oidc-client-secret"`
+	RedirectURL  string   `mapstructure:"oidc-redirect-url"`
+	Scopes       []string `mapstructure:"oidc-scopes"`
+}
+
 func GetGlobalConfig() *Config {
 	return globalConfig
 }
@@ -132,10 +231,21 @@ func NewDefaultConfig() *Config {
 		Server: ServerConfig{
 			BindAddress:     defaultBindAddress,
 			Port:            defaultServerPort,
-			JWTSecret:       defaultJWTSecret,
+			CasbinModelPath: defaultCasbinModelPath,
 			K8sNameSpace:    defaultNamespace,
 			K8sStorageClass: defaultStorageClass,
 			DebugMode:       false,
+
+			LoginUserThreshold:   defaultLoginUserThreshold,
+			LoginIPThreshold:     defaultLoginIPThreshold,
+			LoginFailWindow:      defaultLoginFailWindow,
+			LoginLockoutDuration: defaultLoginLockoutDuration,
+
+			BootstrapAdmin:    defaultBootstrapAdmin,
+			PasswordMinLength: defaultPasswordMinLength,
+			PasswordRating:    defaultPasswordRating,
+
+			AuthProviders: []string{"local", "ldap"},
 		},
 		Cache: CacheConfig{
 			Host:     "", // 默认为空,表示不启用Redis
@@ -143,18 +253,28 @@ func NewDefaultConfig() *Config {
 			DB:       defaultRedisDB,
 		},
 		MySQL: MySQLConfig{
+			RdbDriver:   defaultMySQLDriver,
 			RdbHost:     defaultMySQLHost,
 			RdbPort:     defaultMySQLPort,
 			RdbUser:     defaultMySQLUser,
 			RdbPassword: defaultMySQLPassword,
 			RdbDbname:   defaultMySQLDB,
 			RdbLogLevel: 1,
+
+			RdbReadYourWritesTTL: defaultReadYourWritesTTL,
 		},
 		LDAP: LDAPConfig{
 			Host:         defaultLDAPHost,
 			Port:         defaultLDAPPort,
 			LDAPUserName: defaultLDAPUserDN,
 			BaseDN:       defaultLDAPBaseDN,
+
+			SyncInterval: defaultLDAPSyncInterval,
+
+			TLSMode:             defaultLDAPTLSMode,
+			PoolSize:            defaultLDAPPoolSize,
+			Timeout:             defaultLDAPTimeout,
+			HealthCheckInterval: defaultLDAPHealthCheckInterval,
 		},
 		K8s: K8sConfig{
 			KubeConfigPath:   defaultKubeConfig,
@@ -170,6 +290,16 @@ func NewDefaultConfig() *Config {
 			MaxAge:        180,
 			Compress:      false,
 		},
+		Captcha: CaptchaConfig{
+			Driver:        defaultCaptchaDriver,
+			Length:        defaultCaptchaLength,
+			TTL:           defaultCaptchaTTL,
+			AudioLanguage: defaultCaptchaAudioLanguage,
+		},
+		OIDC: OIDCConfig{
+			Name:   defaultOIDCName,
+			Scopes: []string{"openid", "profile", "email"},
+		},
 	}
 }
 
@@ -231,6 +361,48 @@ func ValidateConfig(cfg *Config) []error {
 			errs = append(errs, err)
 		}
 	}
+	if cfg.Server.JWTSigningKey != "" {
+		if _, err := os.Stat(cfg.Server.JWTSigningKey); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	for _, path := range cfg.Server.JWTVerifyKeys {
+		if _, err := os.Stat(path); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if cfg.Server.LoginUserThreshold < 0 || cfg.Server.LoginIPThreshold < 0 {
+		errs = append(errs, fmt.Errorf("invalid login threshold"))
+	}
+	if cfg.Server.LoginFailWindow <= 0 || cfg.Server.LoginLockoutDuration <= 0 {
+		errs = append(errs, fmt.Errorf("invalid login fail window or lockout duration"))
+	}
+	if cfg.Server.APIUserRateLimit < 0 || cfg.Server.APIIPRateLimit < 0 {
+		errs = append(errs, fmt.Errorf("invalid api rate limit"))
+	}
+	if cfg.Server.MaxSessions < 0 {
+		errs = append(errs, fmt.Errorf("invalid max sessions"))
+	}
+	if cfg.Server.PasswordMinLength < 1 {
+		errs = append(errs, fmt.Errorf("invalid password min length"))
+	}
+	switch cfg.Server.PasswordRating {
+	case "week", "moderate", "strong", "veryStrong":
+	default:
+		errs = append(errs, fmt.Errorf("invalid password rating %q", cfg.Server.PasswordRating))
+	}
+
+	for _, provider := range cfg.Server.AuthProviders {
+		switch provider {
+		case "local", "ldap":
+		case "oidc":
+			if cfg.OIDC.Issuer == "" || cfg.OIDC.ClientID == "" || cfg.OIDC.RedirectURL == "" {
+				errs = append(errs, fmt.Errorf("oidc issuer, client id and redirect url are required by the oidc auth provider"))
+			}
+		default:
+			errs = append(errs, fmt.Errorf("invalid auth provider %q", provider))
+		}
+	}
 
 	// 验证Redis配置
 	if cfg.Cache.DB < 0 || cfg.Cache.DB > 15 {
@@ -238,14 +410,54 @@ func ValidateConfig(cfg *Config) []error {
 	}
 
 	// 验证MySQL配置
+	switch cfg.MySQL.RdbDriver {
+	case "mysql", "postgres", "sqlite":
+	default:
+		errs = append(errs, fmt.Errorf("invalid rdb driver %q", cfg.MySQL.RdbDriver))
+	}
 	if cfg.MySQL.RdbPort < 0 || cfg.MySQL.RdbPort > 65535 {
 		errs = append(errs, fmt.Errorf("invalid mysql port"))
 	}
+	if len(cfg.MySQL.RdbReplicas) != 0 && cfg.MySQL.RdbDriver == "sqlite" {
+		errs = append(errs, fmt.Errorf("rdb replicas are not supported by sqlite"))
+	}
 
 	// 验证LDAP配置
 	if cfg.LDAP.Port < 0 || cfg.LDAP.Port > 65535 {
 		errs = append(errs, fmt.Errorf("invalid ldap port"))
 	}
+	if cfg.LDAP.SyncInterval < 0 {
+		errs = append(errs, fmt.Errorf("invalid ldap sync interval"))
+	}
+	for _, mapping := range cfg.LDAP.GroupMappings {
+		if !strings.Contains(mapping, "=") {
+			errs = append(errs, fmt.Errorf("invalid ldap group mapping %q", mapping))
+		}
+	}
+	switch cfg.LDAP.TLSMode {
+	case "ldaps", "starttls", "none":
+	default:
+		errs = append(errs, fmt.Errorf("invalid ldap tls mode %q", cfg.LDAP.TLSMode))
+	}
+	if cfg.LDAP.PoolSize <= 0 {
+		errs = append(errs, fmt.Errorf("invalid ldap pool size"))
+	}
+	if cfg.LDAP.Timeout <= 0 || cfg.LDAP.HealthCheckInterval < 0 {
+		errs = append(errs, fmt.Errorf("invalid ldap timeout or health check interval"))
+	}
+
+	// 验证验证码配置
+	switch cfg.Captcha.Driver {
+	case "math", "string", "audio":
+	default:
+		errs = append(errs, fmt.Errorf("invalid captcha driver %q", cfg.Captcha.Driver))
+	}
+	if cfg.Captcha.Length <= 0 || cfg.Captcha.Noise < 0 {
+		errs = append(errs, fmt.Errorf("invalid captcha length or noise"))
+	}
+	if cfg.Captcha.TTL <= 0 {
+		errs = append(errs, fmt.Errorf("invalid captcha ttl"))
+	}
 
 	// 验证日志配置
 	if cfg.Logger.LogLevel < int(zap.DebugLevel) || cfg.Logger.LogLevel > int(zap.FatalLevel) {
@@ -37,4 +37,18 @@ var (
 	ErrInvalidLicense   = NewError(http.StatusBadRequest, "license invalid")
 	ErrJSONFormat       = NewError(http.StatusBadRequest, "json format error")
 	ErrFullPool         = NewError(http.StatusForbidden, "full pool for more tasks")
+
+	ErrPersonalAccessTokenLogout = NewError(http.StatusBadRequest, "personal access token can't log out, revoke the token instead")
+	ErrSessionDisabled           = NewError(http.StatusBadRequest, "sessions are not stored without redis")
+
+	ErrProjectNotFound  = NewError(http.StatusNotFound, "project not found")
+	ErrProjectNotEmpty  = NewError(http.StatusBadRequest, "project still has resources")
+	ErrLastProjectAdmin = NewError(http.StatusBadRequest, "project must keep at least one admin")
+
+	ErrIdempotencyInProgress = NewError(http.StatusConflict, "request with the same idempotency key is in progress")
+	ErrIdempotencyKeyReused  = NewError(http.StatusUnprocessableEntity, "idempotency key was used for a different request")
+	ErrRequestTooLarge       = NewError(http.StatusRequestEntityTooLarge, "request body too large")
+
+	ErrTooManyRequests = NewError(http.StatusTooManyRequests, "too many requests, please try again later")
+	ErrAccountLocked   = NewError(http.StatusForbidden, "the account is locked, please try again later or contact the administrator")
 )
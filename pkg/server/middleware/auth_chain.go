@@ -0,0 +1,36 @@
+package middleware
+
+import (
+	"asyncKubeManager/pkg/auth"
+	"asyncKubeManager/pkg/idempotency"
+	"asyncKubeManager/pkg/token"
+	"asyncKubeManager/pkg/utils/limiter"
+
+	"github.com/gin-gonic/gin"
+)
+
+// AuthChain builds the middlewares of the routes requiring a login
+type AuthChain struct {
+	TokenManager token.Manager
+	Enforcer     *auth.Enforcer
+	// UserRateLimiter limits the requests of each user, nil disables the limit
+	UserRateLimiter limiter.RateLimiter
+	// IdempotencyStore replays the responses of the Idempotency-Key header, nil disables the header
+	IdempotencyStore idempotency.Store
+}
+
+// Handlers returns CheckToken, UserRateLimit, Authorize, the given authorization middlewares and Idempotency in this order.
+// Rate limited requests don't take an Idempotency-Key, and a stored response is only replayed once the user passed
+// every authorization middleware again.
+func (a *AuthChain) Handlers(authorizers ...gin.HandlerFunc) []gin.HandlerFunc {
+	handlers := []gin.HandlerFunc{CheckToken(a.TokenManager)}
+	if a.UserRateLimiter != nil {
+		handlers = append(handlers, UserRateLimit(a.UserRateLimiter))
+	}
+	handlers = append(handlers, Authorize(a.Enforcer))
+	handlers = append(handlers, authorizers...)
+	if a.IdempotencyStore != nil {
+		handlers = append(handlers, Idempotency(a.IdempotencyStore))
+	}
+	return handlers
+}
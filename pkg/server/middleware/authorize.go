@@ -0,0 +1,42 @@
+package middleware
+
+import (
+	"asyncKubeManager/pkg/auth"
+	"asyncKubeManager/pkg/server/encoding"
+	"asyncKubeManager/pkg/server/errutil"
+	"asyncKubeManager/pkg/token"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// Authorize checks the casbin policies of the user for the route pattern and the HTTP method of the request.
+// It must be used after CheckToken.
+func Authorize(enforcer *auth.Enforcer) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		payload, err := token.PayloadFromCtx(c)
+		if err != nil {
+			encoding.HandleError(c, errutil.ErrUnauthorized)
+			return
+		}
+
+		obj, act := c.FullPath(), c.Request.Method
+		// 个人访问令牌只能访问其 scopes 中的 API 分组
+		if !auth.ScopeAllows(payload.Scopes, obj) {
+			zap.L().Info("out of token scopes", zap.String("uid", payload.UID), zap.String("obj", obj), zap.Strings("scopes", payload.Scopes))
+			encoding.HandleError(c, errutil.ErrPermissionDenied)
+			return
+		}
+		allowed, err := enforcer.Enforce(payload.UID, obj, act)
+		if err != nil {
+			zap.L().Error("enforce policy failed", zap.String("uid", payload.UID), zap.String("obj", obj), zap.Error(err))
+			encoding.HandleError(c, errutil.ErrInternalServer)
+			return
+		}
+		if !allowed {
+			zap.L().Info("permission denied", zap.String("uid", payload.UID), zap.String("obj", obj), zap.String("act", act))
+			encoding.HandleError(c, errutil.ErrPermissionDenied)
+			return
+		}
+	}
+}
@@ -0,0 +1,202 @@
+package middleware
+
+import (
+	"asyncKubeManager/pkg/idempotency"
+	"asyncKubeManager/pkg/server/encoding"
+	"asyncKubeManager/pkg/server/errutil"
+	"asyncKubeManager/pkg/tenant"
+	"asyncKubeManager/pkg/token"
+	"asyncKubeManager/pkg/types"
+	"asyncKubeManager/pkg/utils"
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+const (
+	maxIdempotencyKeyLength = 255
+	// maxIdempotencyBodySize bounds the request body buffered for the fingerprint
+	maxIdempotencyBodySize = 4 << 20
+)
+
+// bodyWriter copies the response body so that it can be stored for replay.
+type bodyWriter struct {
+	gin.ResponseWriter
+	body *bytes.Buffer
+}
+
+func (w *bodyWriter) Write(b []byte) (int, error) {
+	w.body.Write(b)
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *bodyWriter) WriteString(s string) (int, error) {
+	w.body.WriteString(s)
+	return w.ResponseWriter.WriteString(s)
+}
+
+func isMutatingMethod(method string) bool {
+	switch method {
+	case http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete:
+		return true
+	}
+	return false
+}
+
+// idempotencyRefresher keeps the lock of an acquired Idempotency-Key while the handler runs
+type idempotencyRefresher struct {
+	store idempotency.Store
+	uid   string
+	key   string
+
+	stopRefresh context.CancelFunc
+	refreshDone chan struct{}
+}
+
+// Idempotency replays the first response of a mutating request for retries carrying the same
+// Idempotency-Key header. Keys are scoped to the authenticated user, so it must run after CheckToken,
+// and after Authorize so that a stored response is only replayed to a user still allowed to call the route.
+// Requests without a key are passed through untouched.
+func Idempotency(store idempotency.Store) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		key := c.GetHeader(idempotency.HeaderKey)
+		if key == "" || !isMutatingMethod(c.Request.Method) {
+			return
+		}
+		if len(key) > maxIdempotencyKeyLength {
+			encoding.HandleError(c, errutil.ErrIllegalParameter)
+			return
+		}
+		payload, err := token.PayloadFromCtx(c.Request.Context())
+		if err != nil {
+			encoding.HandleError(c, errutil.ErrUnauthorized)
+			return
+		}
+
+		body, err := io.ReadAll(http.MaxBytesReader(c.Writer, c.Request.Body, maxIdempotencyBodySize))
+		if err != nil {
+			var maxBytesErr *http.MaxBytesError
+			if errors.As(err, &maxBytesErr) {
+				encoding.HandleError(c, errutil.ErrRequestTooLarge)
+				return
+			}
+			encoding.HandleError(c, errutil.ErrIllegalParameter)
+			return
+		}
+		c.Request.Body = io.NopCloser(bytes.NewReader(body))
+
+		// 同一个 key 用于其它项目时是不同的请求, 项目由 ProjectScope 解析, 不属于项目的路由为 0
+		projectID := strconv.FormatInt(tenant.GetProjectIDFromCtx(c.Request.Context()), 10)
+		fingerprint := utils.SHA256Hex(c.Request.Method + " " + c.Request.URL.RequestURI() + "\n" + projectID + "\n" + string(body))
+		resp, err := store.Acquire(c.Request.Context(), payload.UID, key, fingerprint)
+		switch {
+		case errors.Is(err, idempotency.ErrInProgress):
+			encoding.HandleError(c, errutil.ErrIdempotencyInProgress)
+			return
+		case errors.Is(err, idempotency.ErrFingerprintMismatch):
+			encoding.HandleError(c, errutil.ErrIdempotencyKeyReused)
+			return
+		case err != nil:
+			zap.L().Error("idempotency store acquire failed", zap.String("key", key), zap.Error(err))
+			encoding.HandleError(c, errutil.ErrInternalServer)
+			return
+		}
+		if resp != nil {
+			c.Header(idempotency.HeaderReplayed, "true")
+			c.Data(resp.StatusCode, resp.ContentType, resp.Body)
+			c.Abort()
+			return
+		}
+
+		refresher := &idempotencyRefresher{store: store, uid: payload.UID, key: key}
+		refresher.start(idempotency.DefaultRefreshInterval)
+		defer func() {
+			if r := recover(); r != nil {
+				refresher.stop()
+				releaseIdempotencyKey(store, payload.UID, key)
+				panic(r)
+			}
+		}()
+
+		w := &bodyWriter{ResponseWriter: c.Writer, body: &bytes.Buffer{}}
+		c.Writer = w
+		c.Next()
+		refresher.stop()
+
+		// failures the client may recover from are not stored, so the client can retry with the same key
+		if isRetryableStatus(w.Status()) {
+			releaseIdempotencyKey(store, payload.UID, key)
+			return
+		}
+
+		// the timeout starts after the handler, a slow handler must not leave the key locked.
+		// the context is detached since the request context may already be canceled
+		ctx, cancel := context.WithTimeout(context.Background(), types.DefaultTimeout)
+		defer cancel()
+		if err := store.Save(ctx, payload.UID, key, &idempotency.Response{
+			Fingerprint: fingerprint,
+			StatusCode:  w.Status(),
+			ContentType: w.Header().Get("Content-Type"),
+			Body:        w.body.Bytes(),
+		}); err != nil {
+			zap.L().Error("idempotency store save failed", zap.String("key", key), zap.Error(err))
+		}
+	}
+}
+
+// start keeps the lock of the key until stop, so that a handler running longer than the lock keeps the key
+func (r *idempotencyRefresher) start(interval time.Duration) {
+	ctx, cancel := context.WithCancel(context.Background())
+	r.stopRefresh = cancel
+	r.refreshDone = make(chan struct{})
+
+	go func() {
+		defer close(r.refreshDone)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				refreshCtx, refreshCancel := context.WithTimeout(ctx, types.DefaultTimeout)
+				if err := r.store.Refresh(refreshCtx, r.uid, r.key); err != nil {
+					zap.L().Error("idempotency store refresh failed", zap.String("key", r.key), zap.Error(err))
+				}
+				refreshCancel()
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+}
+
+// stop ends the refresh and waits for it, so that a late refresh can't shorten the saved response
+func (r *idempotencyRefresher) stop() {
+	r.stopRefresh()
+	<-r.refreshDone
+}
+
+// isRetryableStatus reports whether a response is a transient failure that must not be replayed,
+// e.g. an expired token, a permission granted later, a conflict or a rate limit
+func isRetryableStatus(status int) bool {
+	switch status {
+	case http.StatusUnauthorized, http.StatusForbidden, http.StatusConflict, http.StatusTooManyRequests:
+		return true
+	}
+	return status >= http.StatusInternalServerError
+}
+
+func releaseIdempotencyKey(store idempotency.Store, uid, key string) {
+	ctx, cancel := context.WithTimeout(context.Background(), types.DefaultTimeout)
+	defer cancel()
+	if err := store.Release(ctx, uid, key); err != nil {
+		zap.L().Error("idempotency store release failed", zap.String("key", key), zap.Error(err))
+	}
+}
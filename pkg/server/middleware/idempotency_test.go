@@ -0,0 +1,206 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"asyncKubeManager/pkg/idempotency"
+	"asyncKubeManager/pkg/model"
+	"asyncKubeManager/pkg/server/encoding"
+	"asyncKubeManager/pkg/server/errutil"
+	"asyncKubeManager/pkg/tenant"
+	"asyncKubeManager/pkg/testutil"
+	"asyncKubeManager/pkg/token"
+	"asyncKubeManager/pkg/utils/limiter"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type idempotencyTestServer struct {
+	router *gin.Engine
+	jwt    string
+	// calls counts the requests that reached the handler, status is the status the handler answers with
+	calls   atomic.Int32
+	status  atomic.Int32
+	release chan struct{}
+	// denied rejects the requests before the Idempotency middleware, like a revoked permission
+	denied atomic.Bool
+}
+
+func newIdempotencyTestServer(t *testing.T, store idempotency.Store, middlewares ...gin.HandlerFunc) *idempotencyTestServer {
+	gin.SetMode(gin.TestMode)
+	manager := token.NewJWTTokenManagerWithKey(token.NewHMACKey([]byte("idempotency-test")))
+	jwt, err := manager.IssueTo(token.Info{UID: "u1"}, time.Hour)
+	require.NoError(t, err)
+
+	s := &idempotencyTestServer{router: gin.New(), jwt: jwt}
+	s.status.Store(http.StatusCreated)
+
+	g := s.router.Group("/api", CheckToken(manager))
+	g.Use(middlewares...)
+	g.Use(func(c *gin.Context) {
+		if s.denied.Load() {
+			encoding.HandleError(c, errutil.ErrPermissionDenied)
+		}
+	})
+	g.Use(Idempotency(store))
+	g.POST("/items", func(c *gin.Context) {
+		s.calls.Add(1)
+		if s.release != nil {
+			<-s.release
+		}
+		c.JSON(int(s.status.Load()), gin.H{"name": c.Query("name"), "call": s.calls.Load()})
+	})
+	return s
+}
+
+func (s *idempotencyTestServer) post(url, key string) *httptest.ResponseRecorder {
+	return s.postToProject(url, key, "")
+}
+
+func (s *idempotencyTestServer) postToProject(url, key, projectID string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, url, strings.NewReader(`{"cpu":2}`))
+	req.Header.Set("Authorization", "Bearer "+s.jwt)
+	req.Header.Set(idempotency.HeaderKey, key)
+	if projectID != "" {
+		req.Header.Set(HeaderProjectID, projectID)
+	}
+	w := httptest.NewRecorder()
+	s.router.ServeHTTP(w, req)
+	return w
+}
+
+// testProjectScope scopes the request to the project whose ID is the X-Project-ID header, like ProjectScope
+func testProjectScope(c *gin.Context) {
+	id, _ := strconv.ParseInt(c.GetHeader(HeaderProjectID), 10, 64)
+	c.Request = c.Request.WithContext(tenant.WithProject(c.Request.Context(), &model.Project{ID: id}))
+}
+
+func testIdempotency(t *testing.T, newStore func(t *testing.T) idempotency.Store) {
+	t.Run("replay", func(t *testing.T) {
+		s := newIdempotencyTestServer(t, newStore(t))
+
+		first := s.post("/api/items?name=a", "k1")
+		require.Equal(t, http.StatusCreated, first.Code)
+		second := s.post("/api/items?name=a", "k1")
+		assert.Equal(t, http.StatusCreated, second.Code)
+		assert.Equal(t, "true", second.Header().Get(idempotency.HeaderReplayed))
+		assert.Equal(t, first.Body.String(), second.Body.String())
+		assert.EqualValues(t, 1, s.calls.Load())
+	})
+
+	t.Run("fingerprint mismatch", func(t *testing.T) {
+		s := newIdempotencyTestServer(t, newStore(t))
+
+		require.Equal(t, http.StatusCreated, s.post("/api/items?name=a", "k1").Code)
+		// 查询参数不同的请求不能复用同一个 key
+		assert.Equal(t, http.StatusUnprocessableEntity, s.post("/api/items?name=b", "k1").Code)
+		assert.EqualValues(t, 1, s.calls.Load())
+	})
+
+	t.Run("different project", func(t *testing.T) {
+		s := newIdempotencyTestServer(t, newStore(t), testProjectScope)
+
+		require.Equal(t, http.StatusCreated, s.postToProject("/api/items", "k1", "1").Code)
+		// 同样的请求发往其它项目不能重放第一个项目的响应
+		assert.Equal(t, http.StatusUnprocessableEntity, s.postToProject("/api/items", "k1", "2").Code)
+		assert.Equal(t, "true", s.postToProject("/api/items", "k1", "1").Header().Get(idempotency.HeaderReplayed))
+		assert.EqualValues(t, 1, s.calls.Load())
+	})
+
+	t.Run("concurrent duplicate", func(t *testing.T) {
+		s := newIdempotencyTestServer(t, newStore(t))
+		s.release = make(chan struct{})
+
+		done := make(chan int)
+		go func() {
+			done <- s.post("/api/items", "k1").Code
+		}()
+		require.Eventually(t, func() bool { return s.calls.Load() == 1 }, time.Second, time.Millisecond)
+
+		assert.Equal(t, http.StatusConflict, s.post("/api/items", "k1").Code)
+		close(s.release)
+		assert.Equal(t, http.StatusCreated, <-done)
+		assert.EqualValues(t, 1, s.calls.Load())
+	})
+
+	t.Run("release on error", func(t *testing.T) {
+		s := newIdempotencyTestServer(t, newStore(t))
+
+		for _, status := range []int{http.StatusInternalServerError, http.StatusForbidden, http.StatusTooManyRequests} {
+			s.status.Store(int32(status))
+			assert.Equal(t, status, s.post("/api/items", "k1").Code)
+		}
+		s.status.Store(http.StatusCreated)
+		w := s.post("/api/items", "k1")
+		assert.Equal(t, http.StatusCreated, w.Code)
+		assert.Empty(t, w.Header().Get(idempotency.HeaderReplayed))
+		assert.EqualValues(t, 4, s.calls.Load())
+
+		// 客户端错误和成功一样保存
+		s.status.Store(http.StatusBadRequest)
+		require.Equal(t, http.StatusBadRequest, s.post("/api/items", "k2").Code)
+		assert.Equal(t, http.StatusBadRequest, s.post("/api/items", "k2").Code)
+		assert.EqualValues(t, 5, s.calls.Load())
+	})
+
+	t.Run("rate limited", func(t *testing.T) {
+		store := newStore(t)
+		s := newIdempotencyTestServer(t, store, UserRateLimit(limiter.NewMemoryRateLimiter(limiter.Limit{Interval: time.Hour, Burst: 1})))
+
+		require.Equal(t, http.StatusCreated, s.post("/api/items", "k1").Code)
+		assert.Equal(t, http.StatusTooManyRequests, s.post("/api/items", "k2").Code)
+		// 限流先于 key 的检查, 重放也要计数
+		assert.Equal(t, http.StatusTooManyRequests, s.post("/api/items", "k1").Code)
+		assert.EqualValues(t, 1, s.calls.Load())
+
+		// 被限流的请求没有占用 key, 之后可以用同一个 key 重试
+		resp, err := store.Acquire(context.Background(), "u1", "k2", "fingerprint")
+		require.NoError(t, err)
+		assert.Nil(t, resp)
+	})
+
+	t.Run("permission revoked", func(t *testing.T) {
+		s := newIdempotencyTestServer(t, newStore(t))
+
+		require.Equal(t, http.StatusCreated, s.post("/api/items", "k1").Code)
+		// 权限被收回后不再重放之前的响应
+		s.denied.Store(true)
+		w := s.post("/api/items", "k1")
+		assert.Equal(t, http.StatusForbidden, w.Code)
+		assert.Empty(t, w.Header().Get(idempotency.HeaderReplayed))
+		assert.EqualValues(t, 1, s.calls.Load())
+	})
+
+	t.Run("unauthorized", func(t *testing.T) {
+		s := newIdempotencyTestServer(t, newStore(t))
+
+		req := httptest.NewRequest(http.MethodPost, "/api/items", strings.NewReader(`{}`))
+		req.Header.Set(idempotency.HeaderKey, "k1")
+		w := httptest.NewRecorder()
+		s.router.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+		assert.Equal(t, http.StatusCreated, s.post("/api/items", "k1").Code)
+	})
+}
+
+func TestIdempotencyCacheStore(t *testing.T) {
+	testIdempotency(t, func(t *testing.T) idempotency.Store {
+		return idempotency.NewCacheStore(testutil.NewFakeCache())
+	})
+}
+
+func TestIdempotencyDBStore(t *testing.T) {
+	testIdempotency(t, func(t *testing.T) idempotency.Store {
+		return idempotency.NewDBStore(testutil.NewDBResolver(t))
+	})
+}
@@ -0,0 +1,76 @@
+package middleware
+
+import (
+	"asyncKubeManager/pkg/dao"
+	"asyncKubeManager/pkg/dbresolver"
+	"asyncKubeManager/pkg/model"
+	"asyncKubeManager/pkg/server/encoding"
+	"asyncKubeManager/pkg/server/errutil"
+	"asyncKubeManager/pkg/tenant"
+	"asyncKubeManager/pkg/token"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// HeaderProjectID selects the project a request is scoped to, the default project is used if it is absent.
+const HeaderProjectID = "X-Project-ID"
+
+// ProjectScope resolves the project of the request and checks that the user is a member of it.
+// Admins may access every project. It must be used after CheckToken.
+func ProjectScope(dbResolver *dbresolver.DBResolver) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var (
+			found   bool
+			project *model.Project
+			err     error
+		)
+		if projectUID := c.GetHeader(HeaderProjectID); projectUID != "" {
+			found, project, err = dao.GetProjectByUID(c, dbResolver, projectUID)
+		} else {
+			found, project, err = dao.GetProjectByName(c, dbResolver, model.DefaultProjectName)
+		}
+		if err != nil {
+			zap.L().Error("get project failed", zap.Error(err))
+			encoding.HandleError(c, errutil.ErrInternalServer)
+			return
+		}
+		if !found {
+			encoding.HandleError(c, errutil.ErrProjectNotFound)
+			return
+		}
+
+		role := model.ProjectRoleAdmin
+		if token.GetUserRoleFromCtx(c) != model.UserRoleAdmin {
+			found, member, err := dao.GetProjectMember(c, dbResolver, project.ID, token.GetUIDFromCtx(c))
+			if err != nil {
+				zap.L().Error("get project member failed", zap.Error(err))
+				encoding.HandleError(c, errutil.ErrInternalServer)
+				return
+			}
+			if !found {
+				encoding.HandleError(c, errutil.ErrPermissionDenied)
+				return
+			}
+			role = member.Role
+		}
+
+		ctx := tenant.WithProject(c.Request.Context(), project)
+		ctx = tenant.WithProjectRole(ctx, role)
+		c.Request = c.Request.WithContext(ctx)
+	}
+}
+
+// RequireProjectRole aborts the request unless the user has one of the given roles in the project.
+// It must be used after ProjectScope.
+func RequireProjectRole(roles ...model.ProjectRole) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		current := tenant.GetProjectRoleFromCtx(c)
+		for _, role := range roles {
+			if current == role {
+				return
+			}
+		}
+		encoding.HandleError(c, errutil.ErrPermissionDenied)
+	}
+}
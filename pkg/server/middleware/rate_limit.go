@@ -0,0 +1,61 @@
+package middleware
+
+import (
+	"asyncKubeManager/pkg/server/encoding"
+	"asyncKubeManager/pkg/server/errutil"
+	"asyncKubeManager/pkg/token"
+	"asyncKubeManager/pkg/utils/limiter"
+	"math"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// RateLimitKeyFunc returns the key a request is counted by, an empty key skips the limit
+type RateLimitKeyFunc func(c *gin.Context) string
+
+// KeyByIP counts the requests of a client IP
+func KeyByIP(c *gin.Context) string {
+	return "ip:" + c.ClientIP()
+}
+
+// UserRateLimit limits the requests of each authenticated user, it must run after CheckToken.
+func UserRateLimit(rateLimiter limiter.RateLimiter) gin.HandlerFunc {
+	return RateLimit(rateLimiter, func(c *gin.Context) string {
+		payload, err := token.PayloadFromCtx(c.Request.Context())
+		if err != nil {
+			return ""
+		}
+		return "user:" + payload.UID
+	})
+}
+
+// RateLimit rejects the requests exceeding the limit of their key with 429.
+// Limiter errors let the request through, so that a redis outage doesn't stop the API.
+func RateLimit(rateLimiter limiter.RateLimiter, keyFunc RateLimitKeyFunc) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		key := keyFunc(c)
+		if key != "" && !allow(c, rateLimiter, key) {
+			return
+		}
+		c.Next()
+	}
+}
+
+// allow counts the request by key, a rejected request is answered with 429
+func allow(c *gin.Context, rateLimiter limiter.RateLimiter, key string) bool {
+	res, err := rateLimiter.Allow(c, key)
+	if err != nil {
+		zap.L().Error("rate limiter allow failed", zap.String("key", key), zap.Error(err))
+		return true
+	}
+
+	c.Header("X-RateLimit-Remaining", strconv.FormatInt(res.Remaining, 10))
+	if !res.Allowed {
+		c.Header("Retry-After", strconv.Itoa(int(math.Ceil(res.RetryAfter.Seconds()))))
+		encoding.HandleError(c, errutil.ErrTooManyRequests)
+		return false
+	}
+	return true
+}
@@ -3,15 +3,20 @@
 package middleware
 
 import (
+	"asyncKubeManager/pkg/dbresolver"
 	"asyncKubeManager/pkg/server/encoding"
 	"asyncKubeManager/pkg/server/errutil"
 	"asyncKubeManager/pkg/token"
 	"strings"
 
 	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
 	"go.uber.org/zap"
 )
 
+// loggedTokenPrefix is the length of a token logged when its jti is unknown
+const loggedTokenPrefix = 6
+
 // tokenFromHeader tries to retrieve the token string from the
 // "Authorization" request header: "Authorization: BEARER T".
 func tokenFromHeader(c *gin.Context) string {
@@ -57,8 +62,31 @@ func findTokenVal(c *gin.Context, getTokenFns ...func(c *gin.Context) string) st
 	return tokenStr
 }
 
+// loggedToken identifies the token in the logs without revealing it, a JWT by its jti
+// and any other token by its first characters
+func loggedToken(tokenVal string) string {
+	if token.IsPersonalAccessToken(tokenVal) {
+		return token.PersonalAccessTokenPrefix + "***"
+	}
+	clm := token.Claims{}
+	if _, _, err := jwt.NewParser().ParseUnverified(tokenVal, &clm); err == nil && clm.ID != "" {
+		return "jti:" + clm.ID
+	}
+	if len(tokenVal) > loggedTokenPrefix {
+		return tokenVal[:loggedTokenPrefix] + "***"
+	}
+	return "***"
+}
+
+// CheckToken verifies the JWT of a login, or a personal access token recognized by token.PersonalAccessTokenPrefix.
+// A request already verified by the CheckToken of an outer route group is passed through.
 func CheckToken(manager token.Manager) gin.HandlerFunc {
 	return func(c *gin.Context) {
+		// 外层路由组已经校验过 token, 不重复校验
+		if _, err := token.PayloadFromCtx(c.Request.Context()); err == nil {
+			return
+		}
+
 		tokenVal := findTokenVal(c, tokenFromHeader, tokenFromCookie, tokenFromQuery)
 		if tokenVal == "" {
 			encoding.HandleError(c, errutil.ErrUnauthorized)
@@ -67,15 +95,18 @@ func CheckToken(manager token.Manager) gin.HandlerFunc {
 
 		payload, err := manager.Verify(tokenVal)
 		if err != nil {
-			zap.L().Info("解析token错误", zap.String("tokenVal", tokenVal), zap.Error(err))
+			zap.L().Info("解析token错误", zap.String("tokenVal", loggedToken(tokenVal)), zap.Error(err))
 			encoding.HandleError(c, errutil.ErrUnauthorized)
 			return
 		}
 
-		zap.L().Debug("token info", zap.String("tokenVal", tokenVal), zap.Any("payload", payload))
+		zap.L().Debug("token info", zap.String("tokenVal", loggedToken(tokenVal)), zap.Any("payload", payload))
 
 		ctx := token.WithPayload(c.Request.Context(), payload)
+		// 写操作之后的一段时间内该用户的读请求走主库
+		ctx = dbresolver.WithSession(ctx, payload.UID)
 		c.Request = c.Request.WithContext(ctx)
-		return
+		// logout 需要原始token来吊销
+		c.Set("token", tokenVal)
 	}
 }
@@ -0,0 +1,67 @@
+//go:build !debug
+
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"asyncKubeManager/pkg/token"
+	"asyncKubeManager/pkg/utils/limiter"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoggedToken(t *testing.T) {
+	manager := token.NewJWTTokenManagerWithKey(token.NewHMACKey([]byte("logged-token-test")))
+	jwtString, err := manager.IssueTo(token.Info{UID: "u1"}, time.Hour)
+	require.NoError(t, err)
+	clm := token.Claims{}
+	_, _, err = jwt.NewParser().ParseUnverified(jwtString, &clm)
+	require.NoError(t, err)
+
+	cases := []struct {
+		tokenVal string
+		want     string
+	}{
+		{jwtString, "jti:" + clm.ID},
+		{token.PersonalAccessTokenPrefix + "secret-part", token.PersonalAccessTokenPrefix + "***"},
+		{"opaque-refresh-token", "opaque***"},
+		{"short", "***"},
+	}
+	for _, tc := range cases {
+		logged := loggedToken(tc.tokenVal)
+		assert.Equal(t, tc.want, logged)
+		if len(tc.tokenVal) > loggedTokenPrefix {
+			assert.False(t, strings.Contains(logged, tc.tokenVal[loggedTokenPrefix:]))
+		}
+	}
+}
+
+func TestCheckTokenNested(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	manager := token.NewJWTTokenManagerWithKey(token.NewHMACKey([]byte("nested-test")))
+	jwtString, err := manager.IssueTo(token.Info{UID: "u1"}, time.Hour)
+	require.NoError(t, err)
+
+	router := gin.New()
+	router.ContextWithFallback = true
+	outer := router.Group("/api", CheckToken(manager), UserRateLimit(limiter.NewMemoryRateLimiter(limiter.Limit{Interval: time.Hour, Burst: 1})))
+	outer.Group("", CheckToken(manager)).GET("/items", func(c *gin.Context) {
+		c.Status(http.StatusOK)
+	})
+
+	// 内层的 CheckToken 直接放行外层校验过的请求, 不重复校验
+	req := httptest.NewRequest(http.MethodGet, "/api/items", nil)
+	req.Header.Set("Authorization", "Bearer "+jwtString)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+}
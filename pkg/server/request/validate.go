@@ -85,6 +85,10 @@ func registerCustomAll(valid *i18nValidator) {
 	registerTranslation(valid.va, tagExportName, zhTranslator, "{0}只能包含字母和数字以及-_")
 	registerTranslation(valid.va, tagExportName, enTranslate, "{0} can only contain alphanumeric characters and -_")
 
+	_ = valid.va.RegisterValidation(tagProjectName, projectName)
+	registerTranslation(valid.va, tagProjectName, zhTranslator, "{0}只能包含小写字母和数字以及-，且必须以字母或数字开头和结尾")
+	registerTranslation(valid.va, tagProjectName, enTranslate, "{0} can only contain lowercase alphanumeric characters and -, and must start and end with an alphanumeric character")
+
 	// 注册错误翻译
 	registerTranslation(valid.va, tagIpBlock, zhTranslator, "{0}必须是一个有效的IPv4地址或是一个包含IPv4地址的有效无类别域间路由(CIDR)")
 	registerTranslation(valid.va, tagIpBlock, enTranslate, "{0} must be a valid IPv4 address or contain a valid CIDR notation for an IPv4 address")
@@ -107,6 +111,7 @@ const (
 	tagTenantUsername = "_tenant_username"
 	tagPassword       = "_password"
 	tagExportName     = "_export_name"
+	tagProjectName    = "_project_name"
 	tagIpBlock        = "ipv4|cidrv4"
 )
 
@@ -115,6 +120,8 @@ var (
 	usernameRegex   = regexp.MustCompile("^[a-zA-Z0-9_-]+$")
 	passwordRegex   = regexp.MustCompile("^[a-zA-Z0-9~!@$%^&*.]+$")
 	exportNameRegex = regexp.MustCompile("^[\u4e00-\u9fa5a-zA-Z0-9_-]+$")
+	// 项目名会作为 kubernetes namespace 的一部分, 需要满足 DNS-1123 label
+	projectNameRegex = regexp.MustCompile("^[a-z0-9]([-a-z0-9]*[a-z0-9])?$")
 )
 
 func username(fl validator.FieldLevel) bool {
@@ -128,3 +135,7 @@ func password(fl validator.FieldLevel) bool {
 func exportName(fl validator.FieldLevel) bool {
 	return exportNameRegex.MatchString(fl.Field().String())
 }
+
+func projectName(fl validator.FieldLevel) bool {
+	return projectNameRegex.MatchString(fl.Field().String())
+}
@@ -0,0 +1,74 @@
+package tenant
+
+import (
+	"asyncKubeManager/pkg/model"
+	"context"
+	"fmt"
+)
+
+type ctxKey string
+
+const (
+	ctxProjectKey     ctxKey = "project"
+	ctxProjectRoleKey ctxKey = "project_role"
+)
+
+// WithProject stores the project the request is scoped to.
+func WithProject(ctx context.Context, project *model.Project) context.Context {
+	if ctx == nil {
+		ctx = context.TODO()
+	}
+
+	return context.WithValue(ctx, ctxProjectKey, project)
+}
+
+// ProjectFromCtx returns the project the request is scoped to.
+func ProjectFromCtx(ctx context.Context) (*model.Project, error) {
+	if ctx == nil {
+		return nil, fmt.Errorf("ctx is nil")
+	}
+
+	project, ok := ctx.Value(ctxProjectKey).(*model.Project)
+	if !ok || project == nil {
+		return nil, fmt.Errorf("ctx project not found")
+	}
+
+	return project, nil
+}
+
+// GetProjectIDFromCtx returns the id of the project, or 0 if the request isn't scoped.
+func GetProjectIDFromCtx(ctx context.Context) int64 {
+	project, err := ProjectFromCtx(ctx)
+	if err != nil {
+		return 0
+	}
+	return project.ID
+}
+
+// GetNamespaceFromCtx returns the kubernetes namespace of the project, or "" if the request isn't scoped.
+func GetNamespaceFromCtx(ctx context.Context) string {
+	project, err := ProjectFromCtx(ctx)
+	if err != nil {
+		return ""
+	}
+	return project.Namespace
+}
+
+// WithProjectRole stores the role of the current user in the project.
+func WithProjectRole(ctx context.Context, role model.ProjectRole) context.Context {
+	if ctx == nil {
+		ctx = context.TODO()
+	}
+
+	return context.WithValue(ctx, ctxProjectRoleKey, role)
+}
+
+// GetProjectRoleFromCtx returns the role of the current user in the project.
+func GetProjectRoleFromCtx(ctx context.Context) model.ProjectRole {
+	if ctx == nil {
+		return ""
+	}
+
+	role, _ := ctx.Value(ctxProjectRoleKey).(model.ProjectRole)
+	return role
+}
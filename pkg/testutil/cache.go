@@ -0,0 +1,10 @@
+package testutil
+
+import "asyncKubeManager/pkg/client/cache"
+
+// FakeCache is an in-memory cache.Interface, its Now field controls the expiration of keys.
+type FakeCache = cache.MemoryClient
+
+func NewFakeCache() *FakeCache {
+	return cache.NewMemoryClient()
+}
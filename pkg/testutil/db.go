@@ -0,0 +1,38 @@
+package testutil
+
+import (
+	"asyncKubeManager/pkg/client/mysql"
+	"asyncKubeManager/pkg/dbresolver"
+	"asyncKubeManager/pkg/migration"
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+
+	"gorm.io/gorm/logger"
+)
+
+// NewDBResolver returns a DBResolver backed by an in-memory SQLite database with all tables migrated.
+// Every test gets its own database, which is closed when the test finishes.
+func NewDBResolver(t testing.TB) *dbresolver.DBResolver {
+	t.Helper()
+
+	dsn := fmt.Sprintf("file:%s?mode=memory&cache=shared", strings.ReplaceAll(t.Name(), "/", "_"))
+	dr, err := dbresolver.NewDBResolver(mysql.NewMysqlOptions(
+		mysql.SetDefaultRdbDriver(mysql.DriverSQLite),
+		mysql.SetDefaultRdbDbname(dsn),
+		mysql.SetDefaultRdbLogLevel(logger.Silent),
+	))
+	if err != nil {
+		t.Fatalf("new db resolver: %v", err)
+	}
+	t.Cleanup(func() {
+		_ = dr.Close()
+	})
+
+	if _, err = migration.NewMigrator(dr.GetDB()).Up(context.Background()); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+
+	return dr
+}
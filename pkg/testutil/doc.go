@@ -0,0 +1,3 @@
+// Package testutil provides fake clients and an in-memory database for unit tests,
+// so that managers and tasks can be tested without any external service.
+package testutil
@@ -0,0 +1,53 @@
+package testutil
+
+import (
+	"k8s.io/apimachinery/pkg/runtime"
+	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	k8sfake "k8s.io/client-go/kubernetes/fake"
+	cdifake "kubevirt.io/client-go/containerizeddataimporter/fake"
+	kubevirtfake "kubevirt.io/client-go/kubevirt/fake"
+)
+
+var (
+	kubevirtScheme = runtime.NewScheme()
+	cdiScheme      = runtime.NewScheme()
+)
+
+func init() {
+	utilruntime.Must(kubevirtfake.AddToScheme(kubevirtScheme))
+	utilruntime.Must(cdifake.AddToScheme(cdiScheme))
+}
+
+// Clients holds the fake clientsets of a test.
+type Clients struct {
+	Kube     *k8sfake.Clientset
+	Kubevirt *kubevirtfake.Clientset
+	CDI      *cdifake.Clientset
+}
+
+// NewClients returns fake Kubernetes, KubeVirt and CDI clientsets,
+// every object is added to the clientset that serves its type.
+func NewClients(objects ...runtime.Object) *Clients {
+	var kubeObjs, kubevirtObjs, cdiObjs []runtime.Object
+	for _, obj := range objects {
+		switch {
+		case recognizes(kubevirtScheme, obj):
+			kubevirtObjs = append(kubevirtObjs, obj)
+		case recognizes(cdiScheme, obj):
+			cdiObjs = append(cdiObjs, obj)
+		default:
+			kubeObjs = append(kubeObjs, obj)
+		}
+	}
+
+	return &Clients{
+		Kube:     k8sfake.NewSimpleClientset(kubeObjs...),
+		Kubevirt: kubevirtfake.NewSimpleClientset(kubevirtObjs...),
+		CDI:      cdifake.NewSimpleClientset(cdiObjs...),
+	}
+}
+
+func recognizes(scheme *runtime.Scheme, obj runtime.Object) bool {
+	gvks, _, err := scheme.ObjectKinds(obj)
+	return err == nil && len(gvks) > 0
+}
@@ -0,0 +1,85 @@
+// Package denylist stores the revoked tokens of the token manager in the relational database,
+// it replaces the redis denylist when redis is disabled.
+package denylist
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"asyncKubeManager/pkg/dao"
+	"asyncKubeManager/pkg/dbresolver"
+	"asyncKubeManager/pkg/model"
+	"go.uber.org/zap"
+)
+
+// DefaultCleanupInterval is how often the expired entries are removed
+const DefaultCleanupInterval = 10 * time.Minute
+
+// ErrNotFound is returned by Get for missing or expired keys
+var ErrNotFound = errors.New("denylist key not found")
+
+// DBDenylist implements token.Denylist with the token_denylist table.
+type DBDenylist struct {
+	dbResolver *dbresolver.DBResolver
+}
+
+// NewDBDenylist returns a denylist backed by the relational database.
+func NewDBDenylist(dbResolver *dbresolver.DBResolver) *DBDenylist {
+	return &DBDenylist{dbResolver: dbResolver}
+}
+
+// Start removes expired entries every interval until ctx is done, expired entries are ignored
+// by Get and Exists so the interval only bounds the size of the table.
+func (d *DBDenylist) Start(ctx context.Context, interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				if err := dao.DeleteExpiredTokenDenylistEntries(ctx, d.dbResolver, time.Now()); err != nil {
+					zap.L().Error("delete expired token denylist entries failed", zap.Error(err))
+				}
+			case <-ctx.Done():
+				zap.L().Info("Stopping token denylist cleanup")
+				return
+			}
+		}
+	}()
+}
+
+func (d *DBDenylist) Get(ctx context.Context, key string) (string, error) {
+	found, entry, err := dao.GetTokenDenylistEntry(ctx, d.dbResolver, key, time.Now())
+	if err != nil {
+		return "", err
+	}
+	if !found {
+		return "", ErrNotFound
+	}
+	return entry.Value, nil
+}
+
+func (d *DBDenylist) Set(ctx context.Context, key string, value string, duration time.Duration) error {
+	var expiresAt int64
+	if duration > 0 {
+		expiresAt = time.Now().Add(duration).UnixMilli()
+	}
+	return dao.SaveTokenDenylistEntry(ctx, d.dbResolver, &model.TokenDenylistEntry{
+		DenylistKey: key,
+		Value:       value,
+		ExpiresAt:   expiresAt,
+	})
+}
+
+func (d *DBDenylist) Exists(ctx context.Context, keys ...string) (bool, error) {
+	if len(keys) == 0 {
+		return false, nil
+	}
+	count, err := dao.CountTokenDenylistEntries(ctx, d.dbResolver, keys, time.Now())
+	if err != nil {
+		return false, err
+	}
+	return count > 0, nil
+}
@@ -0,0 +1,63 @@
+package denylist
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"asyncKubeManager/pkg/testutil"
+	"asyncKubeManager/pkg/token"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDBDenylist(t *testing.T) {
+	ctx := context.Background()
+	d := NewDBDenylist(testutil.NewDBResolver(t))
+
+	_, err := d.Get(ctx, "missing")
+	assert.ErrorIs(t, err, ErrNotFound)
+
+	require.NoError(t, d.Set(ctx, "forever", "1", 0))
+	require.NoError(t, d.Set(ctx, "expired", "1", time.Millisecond))
+	// 同一个 key 再次写入时覆盖值和过期时间
+	require.NoError(t, d.Set(ctx, "forever", "2", 0))
+	time.Sleep(2 * time.Millisecond)
+
+	val, err := d.Get(ctx, "forever")
+	require.NoError(t, err)
+	assert.Equal(t, "2", val)
+	_, err = d.Get(ctx, "expired")
+	assert.ErrorIs(t, err, ErrNotFound)
+
+	exists, err := d.Exists(ctx, "expired")
+	require.NoError(t, err)
+	assert.False(t, exists)
+	exists, err = d.Exists(ctx, "expired", "forever")
+	require.NoError(t, err)
+	assert.True(t, exists)
+}
+
+func TestDBDenylist_Revoke(t *testing.T) {
+	issuer := token.NewJWTTokenManager([]byte("fake"), jwt.SigningMethodHS256,
+		token.SetDenylist(NewDBDenylist(testutil.NewDBResolver(t)), time.Hour))
+
+	first, err := issuer.IssueTo(token.Info{UID: "1", Username: "admin"}, time.Hour)
+	require.NoError(t, err)
+	second, err := issuer.IssueTo(token.Info{UID: "1", Username: "admin"}, time.Hour)
+	require.NoError(t, err)
+
+	require.NoError(t, issuer.Revoke(first))
+	_, err = issuer.Verify(first)
+	assert.ErrorIs(t, err, token.ErrTokenRevoked)
+	_, err = issuer.Verify(second)
+	assert.NoError(t, err)
+
+	// iat_ms 精度为毫秒, 同一毫秒内签发的token不会被吊销
+	time.Sleep(2 * time.Millisecond)
+	require.NoError(t, issuer.RevokeUser("1"))
+	_, err = issuer.Verify(second)
+	assert.ErrorIs(t, err, token.ErrTokenRevoked)
+}
@@ -2,10 +2,17 @@ package token
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
 	"fmt"
+	"sort"
+	"strconv"
+	"sync"
 	"time"
 
 	"asyncKubeManager/pkg/client/cache"
+	"asyncKubeManager/pkg/utils"
 
 	"github.com/golang-jwt/jwt/v5"
 	"go.uber.org/zap"
@@ -14,23 +21,49 @@ import (
 const (
 	DefaultIssuerName    = "async"
 	DefaultCacheDuration = 24 * time.Hour
+	// DefaultAccessTokenDuration is the lifetime of an access token, it is renewed with a refresh token
+	DefaultAccessTokenDuration = 15 * time.Minute
+
+	// denylistKeyPrefix + jti marks a revoked token until it expires
+	denylistKeyPrefix = "token-denylist:"
+	// revokedBeforeKeyPrefix + uid stores a unix millisecond, the user's tokens issued before it are revoked
+	revokedBeforeKeyPrefix = "token-revoked-before:"
+)
+
+var (
+	ErrTokenRevoked    = errors.New("token has been revoked")
+	ErrSessionDisabled = errors.New("sessions are only stored in duration mode")
 )
 
 type Claims struct {
 	Info
+	// IssuedAtMilli is iat in milliseconds, iat only has seconds so a token issued right after RevokeUser
+	// could not be told apart from the revoked ones
+	IssuedAtMilli int64 `json:"iat_ms,omitempty"`
 	// Currently, we are not using any field in jwt.StandardClaims
 	jwt.RegisteredClaims
 }
 
 type jwtToken struct {
-	name       string
-	signKey    any
-	verifyKey  any
-	signMethod jwt.SigningMethod
+	name    string
+	signKey *Key
+	// verifyKeys are selected by the kid header, rotated keys stay here until their tokens expired
+	verifyKeys map[string]*Key
 
 	cacheClient   cache.Interface
 	cacheDuration time.Duration
 	duration      bool
+	// maxSessions limits the sessions of a user in duration mode, 0 means unlimited
+	maxSessions int
+	// sessionMu serializes adding sessions when the cache can't run addSessionScript
+	sessionMu sync.Mutex
+
+	// denylist stores the revoked tokens, nil disables revocation
+	denylist         Denylist
+	maxTokenDuration time.Duration
+
+	// personalAccessTokens verifies the tokens starting with PersonalAccessTokenPrefix, nil rejects them
+	personalAccessTokens PersonalAccessTokenVerifier
 }
 
 func (jt *jwtToken) GetTokenFromCtx(ctx context.Context) (string, error) {
@@ -42,6 +75,10 @@ func (jt *jwtToken) GetTokenFromCtx(ctx context.Context) (string, error) {
 	return token, nil
 }
 func (jt *jwtToken) Verify(tokenString string) (Info, error) {
+	if IsPersonalAccessToken(tokenString) {
+		return jt.verifyPersonalAccessToken(tokenString)
+	}
+
 	clm := Claims{}
 	// verify token signature and expiration time
 	_, err := jwt.ParseWithClaims(tokenString, &clm, jt.keyFunc)
@@ -50,19 +87,13 @@ func (jt *jwtToken) Verify(tokenString string) (Info, error) {
 		return clm.Info, err
 	}
 
-	if jt.duration {
-		saveToken, err := jt.cacheClient.Get(context.Background(), "token:"+clm.Info.UID)
-		if err != nil {
-			return clm.Info, fmt.Errorf("cache not found %w", err)
-		}
-
-		if saveToken != tokenString {
-			return clm.Info, fmt.Errorf("token not match %s\n%s", saveToken, tokenString)
-		}
+	if err = jt.checkRevoked(&clm); err != nil {
+		return clm.Info, err
+	}
 
-		// renew token
-		if err = jt.cacheClient.Set(context.Background(), "token:"+clm.Info.UID, tokenString, jt.cacheDuration); err != nil {
-			return clm.Info, fmt.Errorf("cache renew error %w", err)
+	if jt.duration {
+		if err = jt.touchSession(&clm); err != nil {
+			return clm.Info, err
 		}
 	}
 
@@ -70,11 +101,22 @@ func (jt *jwtToken) Verify(tokenString string) (Info, error) {
 }
 
 func (jt *jwtToken) IssueTo(info Info, expiresIn time.Duration) (string, error) {
-	issueAt := jwt.NewNumericDate(time.Now())
+	return jt.IssueSession(info, expiresIn, SessionMeta{})
+}
+
+func (jt *jwtToken) IssueSession(info Info, expiresIn time.Duration, meta SessionMeta) (string, error) {
+	now := time.Now()
+	issueAt := jwt.NewNumericDate(now)
+	sessionID := meta.SessionID
+	if sessionID == "" {
+		sessionID = utils.NextID()
+	}
 	notBefore := issueAt
 	clm := &Claims{
-		Info: info,
+		Info:          info,
+		IssuedAtMilli: now.UnixMilli(),
 		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        sessionID,
 			IssuedAt:  issueAt,
 			Issuer:    jt.name,
 			NotBefore: notBefore,
@@ -85,35 +127,382 @@ func (jt *jwtToken) IssueTo(info Info, expiresIn time.Duration) (string, error)
 		clm.ExpiresAt = jwt.NewNumericDate(clm.IssuedAt.Add(expiresIn))
 	}
 
-	token := jwt.NewWithClaims(jt.signMethod, clm)
+	token := jwt.NewWithClaims(jt.signKey.Method, clm)
+	if jt.signKey.ID != "" {
+		token.Header["kid"] = jt.signKey.ID
+	}
 
-	tokenString, err := token.SignedString(jt.signKey)
+	tokenString, err := token.SignedString(jt.signKey.Private)
 	if err != nil {
 		return "", fmt.Errorf("sign token error %w", err)
 	}
 
 	if jt.duration {
-		if err = jt.cacheClient.Set(context.Background(), "token:"+info.UID, tokenString, jt.cacheDuration); err != nil {
-			return "", fmt.Errorf("cache set error %w", err)
+		now := time.Now().UnixMilli()
+		s := &Session{
+			SessionMeta: meta,
+			ID:          clm.ID,
+			UID:         info.UID,
+			CreatedAt:   now,
+			LastSeenAt:  now,
+		}
+		if err = jt.addSession(s); err != nil {
+			return "", err
 		}
 	}
 
 	return tokenString, nil
 }
 
+// addSession stores the session of a new token, evicting the oldest sessions of the user beyond maxSessions
+// unless the session is unlimited. The cache runs it as one script, the memory cache under sessionMu.
+func (jt *jwtToken) addSession(s *Session) error {
+	val, err := encodeSession(s)
+	if err != nil {
+		return fmt.Errorf("encode session error %w", err)
+	}
+	maxSessions := jt.maxSessions
+	if s.Unlimited {
+		maxSessions = 0
+	}
+
+	ctx := context.Background()
+	_, err = jt.cacheClient.Eval(ctx, addSessionScript, []string{sessionIndexKey(s.UID)},
+		sessionKeyPrefixOf(s.UID), s.ID, val, jt.cacheDuration.Milliseconds(), maxSessions)
+	if !errors.Is(err, cache.ErrScriptNotSupported) {
+		if err != nil {
+			return fmt.Errorf("cache add session error %w", err)
+		}
+		return nil
+	}
+
+	// 内存缓存只在本进程内使用, 加锁保证淘汰和写入不被并发的登录打断
+	jt.sessionMu.Lock()
+	defer jt.sessionMu.Unlock()
+	if err = jt.evictSessions(s.UID, maxSessions); err != nil {
+		return err
+	}
+	if err = jt.cacheClient.Set(ctx, sessionKey(s.UID, s.ID), val, jt.cacheDuration); err != nil {
+		return fmt.Errorf("cache set error %w", err)
+	}
+	return jt.indexSession(ctx, s.UID, s.ID)
+}
+
+func (jt *jwtToken) Revoke(tokenString string) error {
+	clm := Claims{}
+	// 已过期的token无需吊销, 签名错误的token不能信任其中的uid
+	if _, err := jwt.ParseWithClaims(tokenString, &clm, jt.keyFunc); err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+	if jt.denylist != nil {
+		ttl := cache.NeverExpire
+		if clm.ExpiresAt != nil {
+			ttl = time.Until(clm.ExpiresAt.Time)
+			if ttl <= 0 {
+				return nil
+			}
+		}
+		if err := jt.denylist.Set(ctx, denylistKeyPrefix+tokenID(tokenString, &clm), "1", ttl); err != nil {
+			return fmt.Errorf("denylist set error %w", err)
+		}
+	}
+
+	if jt.duration {
+		if err := jt.deleteSessions(ctx, clm.UID, clm.ID); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (jt *jwtToken) RevokeUser(uid string) error {
+	ctx := context.Background()
+	if jt.denylist != nil {
+		now := strconv.FormatInt(time.Now().UnixMilli(), 10)
+		if err := jt.denylist.Set(ctx, revokedBeforeKeyPrefix+uid, now, jt.revokedBeforeTTL()); err != nil {
+			return fmt.Errorf("denylist set error %w", err)
+		}
+	}
+
+	if jt.duration {
+		ids, err := jt.cacheClient.SMembers(ctx, sessionIndexKey(uid))
+		if err != nil {
+			return fmt.Errorf("cache smembers error %w", err)
+		}
+		keys := []string{sessionIndexKey(uid)}
+		for _, id := range ids {
+			keys = append(keys, sessionKey(uid, id))
+		}
+		if err = jt.cacheClient.Del(ctx, keys...); err != nil {
+			return fmt.Errorf("cache del error %w", err)
+		}
+	}
+
+	return nil
+}
+
+func (jt *jwtToken) ListSessions(uid string) ([]Session, error) {
+	if !jt.duration {
+		return nil, ErrSessionDisabled
+	}
+
+	ctx := context.Background()
+	ids, err := jt.cacheClient.SMembers(ctx, sessionIndexKey(uid))
+	if err != nil {
+		return nil, fmt.Errorf("cache smembers error %w", err)
+	}
+
+	sessions := make([]Session, 0, len(ids))
+	var expired []string
+	for _, id := range ids {
+		key := sessionKey(uid, id)
+		val, err := jt.cacheClient.Get(ctx, key)
+		if err != nil {
+			// 已过期的会话从索引中移除
+			expired = append(expired, id)
+			continue
+		}
+		s, err := decodeSession(val)
+		if err != nil {
+			zap.L().Warn("session damaged", zap.String("key", key), zap.Error(err))
+			continue
+		}
+		sessions = append(sessions, *s)
+	}
+	if len(expired) > 0 {
+		if err = jt.cacheClient.SRem(ctx, sessionIndexKey(uid), expired...); err != nil {
+			zap.L().Warn("remove expired sessions from index failed", zap.String("uid", uid), zap.Error(err))
+		}
+	}
+	sortSessions(sessions)
+
+	return sessions, nil
+}
+
+func (jt *jwtToken) RevokeSession(uid, sessionID string) error {
+	if !jt.duration {
+		return ErrSessionDisabled
+	}
+
+	ctx := context.Background()
+	key := sessionKey(uid, sessionID)
+	exists, err := jt.cacheClient.Exists(ctx, key)
+	if err != nil {
+		return fmt.Errorf("cache exists error %w", err)
+	}
+	if !exists {
+		return ErrSessionNotFound
+	}
+
+	return jt.deleteSessions(ctx, uid, sessionID)
+}
+
+// indexSession adds the session to the index of the user, the index lives as long as the newest session
+func (jt *jwtToken) indexSession(ctx context.Context, uid, sessionID string) error {
+	if err := jt.cacheClient.SAdd(ctx, sessionIndexKey(uid), sessionID); err != nil {
+		return fmt.Errorf("cache sadd error %w", err)
+	}
+	if err := jt.cacheClient.Expire(ctx, sessionIndexKey(uid), jt.cacheDuration); err != nil {
+		return fmt.Errorf("cache expire error %w", err)
+	}
+	return nil
+}
+
+// deleteSessions removes the sessions and their index entries
+func (jt *jwtToken) deleteSessions(ctx context.Context, uid string, sessionIDs ...string) error {
+	keys := make([]string, 0, len(sessionIDs))
+	for _, id := range sessionIDs {
+		keys = append(keys, sessionKey(uid, id))
+	}
+	if err := jt.cacheClient.Del(ctx, keys...); err != nil {
+		return fmt.Errorf("cache del error %w", err)
+	}
+	if err := jt.cacheClient.SRem(ctx, sessionIndexKey(uid), sessionIDs...); err != nil {
+		return fmt.Errorf("cache srem error %w", err)
+	}
+	return nil
+}
+
+// touchSession checks that the session of the token is still alive, renews it and records the last seen time
+func (jt *jwtToken) touchSession(clm *Claims) error {
+	ctx := context.Background()
+	key := sessionKey(clm.UID, clm.ID)
+	val, err := jt.cacheClient.Get(ctx, key)
+	if err != nil {
+		return fmt.Errorf("session not found %w", err)
+	}
+
+	s, err := decodeSession(val)
+	if err != nil {
+		return fmt.Errorf("session damaged %w", err)
+	}
+	s.LastSeenAt = time.Now().UnixMilli()
+	if val, err = encodeSession(s); err != nil {
+		return fmt.Errorf("encode session error %w", err)
+	}
+
+	// renew session, SetXX doesn't bring back a session revoked or evicted since it was read
+	renewed, err := jt.cacheClient.SetXX(ctx, key, val, jt.cacheDuration)
+	if err != nil {
+		return fmt.Errorf("cache renew error %w", err)
+	}
+	if !renewed {
+		return ErrSessionNotFound
+	}
+	if err = jt.cacheClient.Expire(ctx, sessionIndexKey(clm.UID), jt.cacheDuration); err != nil {
+		return fmt.Errorf("cache renew error %w", err)
+	}
+	return nil
+}
+
+// evictSessions removes the oldest sessions of the user so that a new one fits in maxSessions,
+// it is the fallback of addSessionScript for the caches without scripts
+func (jt *jwtToken) evictSessions(uid string, maxSessions int) error {
+	if maxSessions <= 0 {
+		return nil
+	}
+
+	sessions, err := jt.ListSessions(uid)
+	if err != nil {
+		return err
+	}
+	if len(sessions) < maxSessions {
+		return nil
+	}
+
+	// sessions 按创建时间倒序, 保留最新的 maxSessions-1 个
+	ids := make([]string, 0, len(sessions)-maxSessions+1)
+	for _, s := range sessions[maxSessions-1:] {
+		ids = append(ids, s.ID)
+	}
+	return jt.deleteSessions(context.Background(), uid, ids...)
+}
+
+// checkRevoked rejects the token if it is in the denylist or the user's tokens are revoked.
+// Cache errors reject the token as well.
+func (jt *jwtToken) checkRevoked(clm *Claims) error {
+	if jt.denylist == nil {
+		return nil
+	}
+
+	ctx := context.Background()
+	if clm.ID != "" {
+		exists, err := jt.denylist.Exists(ctx, denylistKeyPrefix+clm.ID)
+		if err != nil {
+			return fmt.Errorf("denylist check error %w", err)
+		}
+		if exists {
+			return ErrTokenRevoked
+		}
+	}
+
+	exists, err := jt.denylist.Exists(ctx, revokedBeforeKeyPrefix+clm.UID)
+	if err != nil {
+		return fmt.Errorf("denylist check error %w", err)
+	}
+	if !exists {
+		return nil
+	}
+	val, err := jt.denylist.Get(ctx, revokedBeforeKeyPrefix+clm.UID)
+	if err != nil {
+		return fmt.Errorf("denylist check error %w", err)
+	}
+	revokedBefore, err := strconv.ParseInt(val, 10, 64)
+	if err != nil {
+		return fmt.Errorf("denylist value damaged %w", err)
+	}
+	if clm.IssuedAtMilli > 0 {
+		if clm.IssuedAtMilli < revokedBefore {
+			return ErrTokenRevoked
+		}
+		return nil
+	}
+	// 没有iat_ms的旧token只有秒级的iat, 同一秒内签发的也吊销
+	if clm.IssuedAt == nil || clm.IssuedAt.UnixMilli() <= revokedBefore {
+		return ErrTokenRevoked
+	}
+
+	return nil
+}
+
+// revokedBeforeTTL keeps the user's revocation until every token issued before it expired.
+func (jt *jwtToken) revokedBeforeTTL() time.Duration {
+	if jt.maxTokenDuration > 0 {
+		return jt.maxTokenDuration + time.Second
+	}
+	return cache.NeverExpire
+}
+
+// tokenID returns the jti, tokens issued before the jti was added are identified by their hash.
+func tokenID(tokenString string, clm *Claims) string {
+	if clm.ID != "" {
+		return clm.ID
+	}
+	sum := sha256.Sum256([]byte(tokenString))
+	return hex.EncodeToString(sum[:])
+}
+
+func (jt *jwtToken) JWKS() JWKSet {
+	set := JWKSet{Keys: []JWK{}}
+	seen := map[string]bool{}
+	for _, key := range append([]*Key{jt.signKey}, jt.sortedVerifyKeys()...) {
+		if seen[key.ID] {
+			continue
+		}
+		if jwk, ok := key.JWK(); ok {
+			seen[key.ID] = true
+			set.Keys = append(set.Keys, jwk)
+		}
+	}
+	return set
+}
+
+func (jt *jwtToken) sortedVerifyKeys() []*Key {
+	keys := make([]*Key, 0, len(jt.verifyKeys))
+	for _, key := range jt.verifyKeys {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i].ID < keys[j].ID })
+	return keys
+}
+
+// keyFunc picks the verification key by the kid header, tokens without kid are verified by the HMAC key.
+// The algorithm of the token must match the key, so that a public key is never used as a HMAC secret.
 func (jt *jwtToken) keyFunc(t *jwt.Token) (any, error) {
-	if jt.verifyKey != nil {
-		return jt.verifyKey, nil
-	} else {
-		return jt.signKey, nil
+	kid, _ := t.Header["kid"].(string)
+	key, ok := jt.verifyKeys[kid]
+	if !ok && kid == jt.signKey.ID {
+		key, ok = jt.signKey, true
+	}
+	if !ok {
+		return nil, fmt.Errorf("unknown key id %q", kid)
 	}
+
+	if t.Method.Alg() != key.Method.Alg() {
+		return nil, fmt.Errorf("unexpected signing method %s", t.Method.Alg())
+	}
+	return key.Public, nil
 }
 
 type Option func(o *jwtToken)
 
 func SetVerifyKey(verifyKey []byte) Option {
 	return func(jt *jwtToken) {
-		jt.verifyKey = verifyKey
+		key := NewHMACKey(verifyKey)
+		key.Method = jt.signKey.Method
+		jt.verifyKeys[key.ID] = key
+	}
+}
+
+// AddVerifyKeys adds keys that only verify tokens, e.g. the previous signing key during a key rotation
+func AddVerifyKeys(keys ...*Key) Option {
+	return func(jt *jwtToken) {
+		for _, key := range keys {
+			jt.verifyKeys[key.ID] = key
+		}
 	}
 }
 
@@ -125,11 +514,49 @@ func SetDuration(cacheClient cache.Interface, duration time.Duration) Option {
 	}
 }
 
+// SetMaxSessions limits the concurrent sessions of a user, the oldest session is logged out when a new one exceeds max.
+// It requires SetDuration, 0 means unlimited.
+func SetMaxSessions(max int) Option {
+	return func(jt *jwtToken) {
+		jt.maxSessions = max
+	}
+}
+
+// Denylist stores the revoked tokens until they expire, cache.Interface implements it.
+type Denylist interface {
+	// Get retrieves the value of the given key, return error if key doesn't exist
+	Get(ctx context.Context, key string) (string, error)
+
+	// Set sets the value and living duration of the given key, zero duration means never expire
+	Set(ctx context.Context, key string, value string, duration time.Duration) error
+
+	// Exists checks the existence of a give key
+	Exists(ctx context.Context, keys ...string) (bool, error)
+}
+
+// SetDenylist enables token revocation, the revoked tokens are stored in denylist until they expire.
+// maxTokenDuration is the longest expiresIn passed to IssueTo, 0 keeps the revocation of a user forever.
+func SetDenylist(denylist Denylist, maxTokenDuration time.Duration) Option {
+	return func(jt *jwtToken) {
+		jt.denylist = denylist
+		jt.maxTokenDuration = maxTokenDuration
+	}
+}
+
 func NewJWTTokenManager(signKey []byte, signMethod jwt.SigningMethod, options ...Option) Manager {
+	return NewJWTTokenManagerWithKey(&Key{
+		Method:  signMethod,
+		Private: signKey,
+		Public:  signKey,
+	}, options...)
+}
+
+// NewJWTTokenManagerWithKey returns a Manager signing tokens with the given key, see LoadSigningKey.
+func NewJWTTokenManagerWithKey(signKey *Key, options ...Option) Manager {
 	jt := &jwtToken{
 		name:       DefaultIssuerName,
 		signKey:    signKey,
-		signMethod: signMethod,
+		verifyKeys: map[string]*Key{},
 	}
 
 	for _, opt := range options {
@@ -1,10 +1,18 @@
 package token
 
 import (
+	"context"
+	"sync"
 	"testing"
+	"time"
 
+	"asyncKubeManager/pkg/client/cache"
+
+	"github.com/alicebob/miniredis/v2"
 	"github.com/golang-jwt/jwt/v5"
 	"github.com/google/go-cmp/cmp"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestTokenVerifyWithoutCacheValidate(t *testing.T) {
@@ -31,3 +39,236 @@ func TestTokenVerifyWithoutCacheValidate(t *testing.T) {
 
 	}
 }
+
+func TestTokenRevoke(t *testing.T) {
+	denylist := cache.NewMemoryClient()
+	issuer := NewJWTTokenManager([]byte("fake"), jwt.SigningMethodHS256, SetDenylist(denylist, time.Hour))
+
+	first, err := issuer.IssueTo(Info{UID: "1", Username: "admin"}, time.Hour)
+	require.NoError(t, err)
+	second, err := issuer.IssueTo(Info{UID: "1", Username: "admin"}, time.Hour)
+	require.NoError(t, err)
+
+	require.NoError(t, issuer.Revoke(first))
+
+	_, err = issuer.Verify(first)
+	assert.ErrorIs(t, err, ErrTokenRevoked)
+	_, err = issuer.Verify(second)
+	assert.NoError(t, err)
+}
+
+func TestTokenRevokeUser(t *testing.T) {
+	denylist := cache.NewMemoryClient()
+	issuer := NewJWTTokenManager([]byte("fake"), jwt.SigningMethodHS256, SetDenylist(denylist, time.Hour))
+
+	revoked, err := issuer.IssueTo(Info{UID: "1", Username: "admin"}, time.Hour)
+	require.NoError(t, err)
+	other, err := issuer.IssueTo(Info{UID: "2", Username: "user"}, time.Hour)
+	require.NoError(t, err)
+
+	// iat_ms 精度为毫秒, 同一毫秒内签发的token不会被吊销
+	time.Sleep(2 * time.Millisecond)
+	require.NoError(t, issuer.RevokeUser("1"))
+
+	_, err = issuer.Verify(revoked)
+	assert.ErrorIs(t, err, ErrTokenRevoked)
+	_, err = issuer.Verify(other)
+	assert.NoError(t, err)
+
+	// 吊销之后签发的token不受影响, 即使在同一秒内
+	time.Sleep(2 * time.Millisecond)
+	renewed, err := issuer.IssueTo(Info{UID: "1", Username: "admin"}, time.Hour)
+	require.NoError(t, err)
+	_, err = issuer.Verify(renewed)
+	assert.NoError(t, err)
+}
+
+func TestTokenSessions(t *testing.T) {
+	sessionCache := cache.NewMemoryClient()
+	issuer := NewJWTTokenManager([]byte("fake"), jwt.SigningMethodHS256, SetDuration(sessionCache, time.Hour))
+
+	admin := Info{UID: "1", Username: "admin"}
+	laptop, err := issuer.IssueSession(admin, time.Hour, SessionMeta{Device: "laptop", IP: "10.0.0.1"})
+	require.NoError(t, err)
+	phone, err := issuer.IssueSession(admin, time.Hour, SessionMeta{Device: "phone", IP: "10.0.0.2"})
+	require.NoError(t, err)
+
+	// 第二次登录不影响第一个会话
+	_, err = issuer.Verify(laptop)
+	assert.NoError(t, err)
+	_, err = issuer.Verify(phone)
+	assert.NoError(t, err)
+
+	sessions, err := issuer.ListSessions("1")
+	require.NoError(t, err)
+	require.Len(t, sessions, 2)
+	devices := []string{sessions[0].Device, sessions[1].Device}
+	assert.ElementsMatch(t, []string{"laptop", "phone"}, devices)
+
+	require.NoError(t, issuer.RevokeSession("1", SessionID(laptop)))
+	_, err = issuer.Verify(laptop)
+	assert.Error(t, err)
+	_, err = issuer.Verify(phone)
+	assert.NoError(t, err)
+
+	assert.ErrorIs(t, issuer.RevokeSession("1", SessionID(laptop)), ErrSessionNotFound)
+}
+
+func TestTokenIssueSessionID(t *testing.T) {
+	issuer := NewJWTTokenManager([]byte("fake"), jwt.SigningMethodHS256, SetDuration(cache.NewMemoryClient(), time.Hour))
+
+	tokenString, err := issuer.IssueSession(Info{UID: "1"}, time.Hour, SessionMeta{SessionID: "session-1"})
+	require.NoError(t, err)
+	assert.Equal(t, "session-1", SessionID(tokenString))
+	sessions, err := issuer.ListSessions("1")
+	require.NoError(t, err)
+	require.Len(t, sessions, 1)
+	assert.Equal(t, "session-1", sessions[0].ID)
+}
+
+func TestTokenSessionIndex(t *testing.T) {
+	sessionCache := cache.NewMemoryClient()
+	issuer := NewJWTTokenManager([]byte("fake"), jwt.SigningMethodHS256, SetDuration(sessionCache, time.Hour))
+
+	admin := Info{UID: "1", Username: "admin"}
+	expired, err := issuer.IssueTo(admin, time.Hour)
+	require.NoError(t, err)
+	_, err = issuer.IssueTo(admin, time.Hour)
+	require.NoError(t, err)
+
+	// 过期的会话在列出时从索引中移除
+	require.NoError(t, sessionCache.Del(context.Background(), sessionKey("1", SessionID(expired))))
+	sessions, err := issuer.ListSessions("1")
+	require.NoError(t, err)
+	require.Len(t, sessions, 1)
+	ids, err := sessionCache.SMembers(context.Background(), sessionIndexKey("1"))
+	require.NoError(t, err)
+	assert.Equal(t, []string{sessions[0].ID}, ids)
+
+	require.NoError(t, issuer.RevokeUser("1"))
+	keys, err := sessionCache.Keys(context.Background(), "*")
+	require.NoError(t, err)
+	assert.Empty(t, keys)
+}
+
+// revokingCache revokes the session right after touchSession read it
+type revokingCache struct {
+	cache.Interface
+	revoke func()
+}
+
+func (c *revokingCache) Get(ctx context.Context, key string) (string, error) {
+	val, err := c.Interface.Get(ctx, key)
+	if c.revoke != nil {
+		c.revoke()
+	}
+	return val, err
+}
+
+func testTokenTouchRevokedSession(t *testing.T, sessionCache cache.Interface) {
+	revoking := &revokingCache{Interface: sessionCache}
+	issuer := NewJWTTokenManager([]byte("fake"), jwt.SigningMethodHS256, SetDuration(revoking, time.Hour))
+
+	admin := Info{UID: "1", Username: "admin"}
+	tokenString, err := issuer.IssueTo(admin, time.Hour)
+	require.NoError(t, err)
+
+	// 续期不会重新创建在读取之后被吊销的会话
+	revoking.revoke = func() {
+		revoking.revoke = nil
+		require.NoError(t, issuer.RevokeSession("1", SessionID(tokenString)))
+	}
+	_, err = issuer.Verify(tokenString)
+	assert.ErrorIs(t, err, ErrSessionNotFound)
+
+	exists, err := sessionCache.Exists(context.Background(), sessionKey("1", SessionID(tokenString)))
+	require.NoError(t, err)
+	assert.False(t, exists)
+	_, err = issuer.Verify(tokenString)
+	assert.Error(t, err)
+}
+
+func TestTokenTouchRevokedSession(t *testing.T) {
+	testTokenTouchRevokedSession(t, cache.NewMemoryClient())
+}
+
+func TestTokenTouchRevokedSessionRedis(t *testing.T) {
+	testTokenTouchRevokedSession(t, newRedisCache(t))
+}
+
+func newRedisCache(t *testing.T) cache.Interface {
+	mr := miniredis.RunT(t)
+	stopCh := make(chan struct{})
+	t.Cleanup(func() { close(stopCh) })
+	cacheClient, err := cache.NewRedisClient(&cache.Options{Host: mr.Addr()}, stopCh)
+	require.NoError(t, err)
+	return cacheClient
+}
+
+func testTokenMaxSessions(t *testing.T, sessionCache cache.Interface) {
+	issuer := NewJWTTokenManager([]byte("fake"), jwt.SigningMethodHS256,
+		SetDuration(sessionCache, time.Hour), SetMaxSessions(2))
+
+	admin := Info{UID: "1", Username: "admin"}
+	var tokens []string
+	for i := 0; i < 3; i++ {
+		tokenString, err := issuer.IssueTo(admin, time.Hour)
+		require.NoError(t, err)
+		tokens = append(tokens, tokenString)
+		// CreatedAt 的精度是毫秒, 保证会话的先后顺序
+		time.Sleep(2 * time.Millisecond)
+	}
+
+	sessions, err := issuer.ListSessions("1")
+	require.NoError(t, err)
+	require.Len(t, sessions, 2)
+
+	_, err = issuer.Verify(tokens[0])
+	assert.Error(t, err, "the oldest session should be logged out")
+	for _, tokenString := range tokens[1:] {
+		_, err = issuer.Verify(tokenString)
+		assert.NoError(t, err)
+	}
+
+	// 并发登录也不会超过最大会话数
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := issuer.IssueTo(admin, time.Hour)
+			assert.NoError(t, err)
+		}()
+	}
+	wg.Wait()
+	sessions, err = issuer.ListSessions("1")
+	require.NoError(t, err)
+	assert.Len(t, sessions, 2)
+}
+
+func TestTokenMaxSessions(t *testing.T) {
+	testTokenMaxSessions(t, cache.NewMemoryClient())
+}
+
+func TestTokenMaxSessionsRedis(t *testing.T) {
+	testTokenMaxSessions(t, newRedisCache(t))
+}
+
+func TestTokenUnlimitedSessions(t *testing.T) {
+	sessionCache := cache.NewMemoryClient()
+	issuer := NewJWTTokenManager([]byte("fake"), jwt.SigningMethodHS256,
+		SetDuration(sessionCache, time.Hour), SetMaxSessions(1))
+
+	// service account 的并行任务不互相踢下线
+	robot := Info{UID: "robot", Username: "robot"}
+	var tokens []string
+	for i := 0; i < 3; i++ {
+		tokenString, err := issuer.IssueSession(robot, time.Hour, SessionMeta{Device: "service account", Unlimited: true})
+		require.NoError(t, err)
+		tokens = append(tokens, tokenString)
+	}
+	for _, tokenString := range tokens {
+		_, err := issuer.Verify(tokenString)
+		assert.NoError(t, err)
+	}
+}
@@ -0,0 +1,147 @@
+package token
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// writeKeyPair writes the PKCS8 private key and the PKIX public key to PEM files
+func writeKeyPair(t *testing.T, name string, private any, public any) (string, string) {
+	t.Helper()
+	dir := t.TempDir()
+
+	privateDER, err := x509.MarshalPKCS8PrivateKey(private)
+	require.NoError(t, err)
+	privatePath := filepath.Join(dir, name+".key")
+	require.NoError(t, os.WriteFile(privatePath, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: privateDER}), 0o600))
+
+	publicDER, err := x509.MarshalPKIXPublicKey(public)
+	require.NoError(t, err)
+	publicPath := filepath.Join(dir, name+".pub")
+	require.NoError(t, os.WriteFile(publicPath, pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: publicDER}), 0o644))
+
+	return privatePath, publicPath
+}
+
+func TestLoadSigningKey(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	edPublic, edPrivate, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+
+	tests := []struct {
+		name    string
+		private any
+		public  any
+		alg     string
+	}{
+		{"rsa", rsaKey, &rsaKey.PublicKey, "RS256"},
+		{"ecdsa", ecKey, &ecKey.PublicKey, "ES256"},
+		{"ed25519", edPrivate, edPublic, "EdDSA"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			privatePath, publicPath := writeKeyPair(t, tt.name, tt.private, tt.public)
+
+			signKey, err := LoadSigningKey(privatePath)
+			require.NoError(t, err)
+			assert.Equal(t, tt.alg, signKey.Method.Alg())
+			verifyKey, err := LoadVerificationKey(publicPath)
+			require.NoError(t, err)
+			assert.Equal(t, signKey.ID, verifyKey.ID)
+			assert.Nil(t, verifyKey.Private)
+
+			issuer := NewJWTTokenManagerWithKey(signKey)
+			tokenString, err := issuer.IssueTo(Info{UID: "1", Username: "admin"}, time.Hour)
+			require.NoError(t, err)
+
+			// 其他服务只持有公钥也能验证
+			verifier := NewJWTTokenManagerWithKey(verifyKey)
+			got, err := verifier.Verify(tokenString)
+			require.NoError(t, err)
+			assert.Equal(t, "admin", got.Username)
+
+			jwks := issuer.JWKS()
+			require.Len(t, jwks.Keys, 1)
+			assert.Equal(t, signKey.ID, jwks.Keys[0].Kid)
+			assert.Equal(t, tt.alg, jwks.Keys[0].Alg)
+
+			// 发布的 JWK 可以还原为验证密钥
+			parsed, err := ParseJWK(jwks.Keys[0])
+			require.NoError(t, err)
+			assert.Equal(t, signKey.ID, parsed.ID)
+			assert.Equal(t, tt.alg, parsed.Method.Alg())
+			assert.Equal(t, verifyKey.Public, parsed.Public)
+		})
+	}
+}
+
+func TestKeyRotation(t *testing.T) {
+	oldKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	newKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	oldPrivate, oldPublic := writeKeyPair(t, "old", oldKey, &oldKey.PublicKey)
+	newPrivate, _ := writeKeyPair(t, "new", newKey, &newKey.PublicKey)
+
+	oldSignKey, err := LoadSigningKey(oldPrivate)
+	require.NoError(t, err)
+	oldToken, err := NewJWTTokenManagerWithKey(oldSignKey).IssueTo(Info{UID: "1"}, time.Hour)
+	require.NoError(t, err)
+
+	newSignKey, err := LoadSigningKey(newPrivate)
+	require.NoError(t, err)
+	oldVerifyKey, err := LoadVerificationKey(oldPublic)
+	require.NoError(t, err)
+
+	// 轮换后旧 token 仍然有效, 新 token 使用新密钥签名
+	rotated := NewJWTTokenManagerWithKey(newSignKey, AddVerifyKeys(oldVerifyKey))
+	_, err = rotated.Verify(oldToken)
+	assert.NoError(t, err)
+	newToken, err := rotated.IssueTo(Info{UID: "1"}, time.Hour)
+	require.NoError(t, err)
+	_, err = rotated.Verify(newToken)
+	assert.NoError(t, err)
+	assert.Len(t, rotated.JWKS().Keys, 2)
+
+	// 移除旧密钥后旧 token 失效
+	_, err = NewJWTTokenManagerWithKey(newSignKey).Verify(oldToken)
+	assert.Error(t, err)
+}
+
+func TestKeyAlgorithmMismatch(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	_, publicPath := writeKeyPair(t, "rsa", rsaKey, &rsaKey.PublicKey)
+	verifyKey, err := LoadVerificationKey(publicPath)
+	require.NoError(t, err)
+	publicPEM, err := os.ReadFile(publicPath)
+	require.NoError(t, err)
+
+	// 用公钥作为 HMAC 密钥伪造的 token 不能通过验证
+	forged := jwt.NewWithClaims(jwt.SigningMethodHS256, &Claims{Info: Info{UID: "1"}})
+	forged.Header["kid"] = verifyKey.ID
+	tokenString, err := forged.SignedString(publicPEM)
+	require.NoError(t, err)
+
+	_, err = NewJWTTokenManagerWithKey(verifyKey).Verify(tokenString)
+	assert.Error(t, err)
+
+	// HMAC 密钥不会公开
+	assert.Empty(t, NewJWTTokenManager([]byte("fake"), jwt.SigningMethodHS256).JWKS().Keys)
+}
@@ -13,6 +13,8 @@ type Info struct {
 	Name     string         `json:"name,omitempty"`
 	RoleID   model.UserRole `json:"user_role,omitempty"`
 	Primary  bool           `json:"primary,omitempty"`
+	// Scopes restricts a personal access token to the API groups, it is empty for the tokens of a login
+	Scopes []string `json:"scopes,omitempty"`
 	// DataAuth []int64 `json:"data_auth,omitempty"`
 }
 
@@ -21,9 +23,28 @@ type Manager interface {
 	// IssueTo issues a token a User, return error if issuing process failed
 	IssueTo(info Info, expiresIn time.Duration) (string, error)
 
-	// Verify verifies a token, and return a user info if it's a valid token, otherwise return error
+	// IssueSession issues a token like IssueTo and records the client in the session of the token
+	IssueSession(info Info, expiresIn time.Duration, meta SessionMeta) (string, error)
+
+	// Verify verifies a token, and return a user info if it's a valid token, otherwise return error.
+	// Personal access tokens are recognized by PersonalAccessTokenPrefix.
 	Verify(string) (Info, error)
 
+	// Revoke revokes a token, Verify rejects it until it expires
+	Revoke(tokenString string) error
+
+	// RevokeUser revokes every token issued to the user before now
+	RevokeUser(uid string) error
+
+	// ListSessions returns the active sessions of the user, the newest first
+	ListSessions(uid string) ([]Session, error)
+
+	// RevokeSession logs out one session of the user, returns ErrSessionNotFound if it doesn't exist
+	RevokeSession(uid, sessionID string) error
+
+	// JWKS returns the public keys verifying the tokens, HMAC keys are not included
+	JWKS() JWKSet
+
 	// GetTokenFromCtx extracts the token from the given context.
 	// It returns the token string if found, otherwise returns an error.
 	GetTokenFromCtx(ctx context.Context) (string, error)
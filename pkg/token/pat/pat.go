@@ -0,0 +1,176 @@
+package pat
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"asyncKubeManager/pkg/auth"
+	"asyncKubeManager/pkg/dao"
+	"asyncKubeManager/pkg/dbresolver"
+	"asyncKubeManager/pkg/model"
+	"asyncKubeManager/pkg/token"
+	"asyncKubeManager/pkg/utils"
+
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+const (
+	// MaxDuration is the longest lifetime of a personal access token
+	MaxDuration = 365 * 24 * time.Hour
+	// MaxTokensPerUser limits the valid tokens of a user
+	MaxTokensPerUser = 50
+
+	// tokenBytes is the random length of a token
+	tokenBytes = 32
+	// lastUsedInterval throttles the updates of LastUsedAt, a token used by a pipeline is verified on every request
+	lastUsedInterval = time.Minute
+)
+
+var (
+	// ErrInvalidToken is returned for unknown, revoked or expired tokens and for the tokens of disabled users
+	ErrInvalidToken  = errors.New("invalid personal access token")
+	ErrInvalidScope  = errors.New("invalid personal access token scope")
+	ErrDuplicateName = errors.New("a valid personal access token of the name exists")
+	ErrTooManyTokens = errors.New("too many personal access tokens")
+	ErrTokenNotFound = errors.New("personal access token not found")
+)
+
+// Manager issues the personal access tokens of the users and verifies them for token.Manager,
+// only the hash of a token is stored
+type Manager struct {
+	dbResolver *dbresolver.DBResolver
+	now        func() time.Time
+}
+
+func NewManager(dbResolver *dbresolver.DBResolver) *Manager {
+	return &Manager{
+		dbResolver: dbResolver,
+		now:        time.Now,
+	}
+}
+
+// Issue creates a token of the user, the returned token string is not stored and can't be shown again
+func (m *Manager) Issue(ctx context.Context, uid, name string, scopes []string, expiresIn time.Duration) (string, *model.PersonalAccessToken, error) {
+	if len(scopes) == 0 {
+		return "", nil, ErrInvalidScope
+	}
+	for _, scope := range scopes {
+		if !auth.ValidScope(scope) {
+			return "", nil, fmt.Errorf("%w: %s", ErrInvalidScope, scope)
+		}
+	}
+	if expiresIn <= 0 || expiresIn > MaxDuration {
+		return "", nil, fmt.Errorf("the lifetime of a personal access token must be at most %s", MaxDuration)
+	}
+
+	tokenString, err := generate()
+	if err != nil {
+		return "", nil, err
+	}
+	now := m.now()
+	pat := &model.PersonalAccessToken{
+		UID:       uid,
+		Name:      name,
+		TokenHash: utils.SHA256Hex(tokenString),
+		Scopes:    strings.Join(scopes, ","),
+		ExpiresAt: now.Add(expiresIn).UnixMilli(),
+	}
+	err = m.dbResolver.GetDB().Transaction(func(tx *gorm.DB) error {
+		if err := dao.RevokeExpiredPersonalAccessTokenNameWithDB(ctx, tx, uid, name, now); err != nil {
+			return err
+		}
+		count, err := dao.CountActivePersonalAccessTokensWithDB(ctx, tx, uid, now)
+		if err != nil {
+			return err
+		}
+		if count >= MaxTokensPerUser {
+			return ErrTooManyTokens
+		}
+		if err = dao.InsertPersonalAccessTokenWithDB(ctx, tx, pat); err != nil {
+			if errors.Is(err, gorm.ErrDuplicatedKey) {
+				return ErrDuplicateName
+			}
+			return err
+		}
+		return nil
+	})
+	if err != nil {
+		return "", nil, err
+	}
+	return tokenString, pat, nil
+}
+
+// VerifyPersonalAccessToken implements token.PersonalAccessTokenVerifier, the token acts for its user
+// with the current role of the user, restricted to the scopes of the token
+func (m *Manager) VerifyPersonalAccessToken(ctx context.Context, tokenString string) (token.Info, error) {
+	now := m.now()
+	found, pat, err := dao.GetPersonalAccessTokenByHash(ctx, m.dbResolver, utils.SHA256Hex(tokenString))
+	if err != nil {
+		return token.Info{}, err
+	}
+	if !found || pat.RevokedAt != 0 || pat.ExpiresAt <= now.UnixMilli() {
+		return token.Info{}, ErrInvalidToken
+	}
+
+	found, user, err := dao.GetUserByUID(ctx, m.dbResolver, pat.UID)
+	if err != nil {
+		return token.Info{}, err
+	}
+	if !found || user.Status == model.UserStatusDisabled {
+		return token.Info{}, ErrInvalidToken
+	}
+	// 锁定期间不能通过 token 访问, 到期的登录失败锁定与登录时一样视为已解锁
+	if user.Status == model.UserStatusLocked && (user.LockedUntil == 0 || now.UnixMilli() < user.LockedUntil) {
+		return token.Info{}, ErrInvalidToken
+	}
+
+	if now.Sub(time.UnixMilli(pat.LastUsedAt)) >= lastUsedInterval {
+		if err = dao.UpdatePersonalAccessTokenLastUsed(ctx, m.dbResolver, pat.ID, now); err != nil {
+			zap.L().Warn("UpdatePersonalAccessTokenLastUsed", zap.Int64("id", pat.ID), zap.Error(err))
+		}
+	}
+
+	return token.Info{
+		UID:      user.UID,
+		Username: user.Username,
+		RoleID:   user.Role,
+		Primary:  user.Primary,
+		Scopes:   pat.ScopeList(),
+	}, nil
+}
+
+// List returns the tokens of the user, uid "" lists the tokens of all users
+func (m *Manager) List(ctx context.Context, uid string) ([]model.PersonalAccessToken, error) {
+	return dao.ListPersonalAccessTokens(ctx, m.dbResolver, uid)
+}
+
+// Revoke revokes the token of the user, uid "" revokes the token of any user
+func (m *Manager) Revoke(ctx context.Context, id int64, uid string) error {
+	revoked, err := dao.RevokePersonalAccessToken(ctx, m.dbResolver, id, uid, m.now())
+	if err != nil {
+		return err
+	}
+	if !revoked {
+		return ErrTokenNotFound
+	}
+	return nil
+}
+
+// RevokeUser revokes all tokens of the user
+func (m *Manager) RevokeUser(ctx context.Context, uid string) error {
+	return dao.RevokePersonalAccessTokensByUID(ctx, m.dbResolver, uid, m.now())
+}
+
+func generate() (string, error) {
+	b := make([]byte, tokenBytes)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("generate personal access token error %w", err)
+	}
+	return token.PersonalAccessTokenPrefix + base64.RawURLEncoding.EncodeToString(b), nil
+}
@@ -0,0 +1,107 @@
+package pat
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"asyncKubeManager/pkg/dao"
+	"asyncKubeManager/pkg/model"
+	"asyncKubeManager/pkg/testutil"
+	"asyncKubeManager/pkg/token"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestManager(t *testing.T) {
+	ctx := context.Background()
+	dr := testutil.NewDBResolver(t)
+	_, err := dao.InsertUserWithDB(ctx, dr.GetDB(), "alice", "alice", "", "", "", model.UserRoleNormal)
+	require.NoError(t, err)
+	m := NewManager(dr)
+
+	_, _, err = m.Issue(ctx, "alice", "ci", []string{"auth"}, time.Hour)
+	assert.ErrorIs(t, err, ErrInvalidScope)
+	_, _, err = m.Issue(ctx, "alice", "ci", []string{"vm"}, 2*MaxDuration)
+	assert.Error(t, err)
+
+	tokenString, pat, err := m.Issue(ctx, "alice", "ci", []string{"vm", "disk"}, time.Hour)
+	require.NoError(t, err)
+	assert.True(t, token.IsPersonalAccessToken(tokenString))
+	assert.NotContains(t, pat.TokenHash, tokenString)
+	_, _, err = m.Issue(ctx, "alice", "ci", []string{"vm"}, time.Hour)
+	assert.ErrorIs(t, err, ErrDuplicateName)
+
+	info, err := m.VerifyPersonalAccessToken(ctx, tokenString)
+	require.NoError(t, err)
+	assert.Equal(t, "alice", info.UID)
+	assert.Equal(t, model.UserRoleNormal, info.RoleID)
+	assert.Equal(t, []string{"vm", "disk"}, info.Scopes)
+
+	pats, err := m.List(ctx, "alice")
+	require.NoError(t, err)
+	require.Len(t, pats, 1)
+	assert.NotZero(t, pats[0].LastUsedAt)
+
+	_, err = m.VerifyPersonalAccessToken(ctx, token.PersonalAccessTokenPrefix+"unknown")
+	assert.ErrorIs(t, err, ErrInvalidToken)
+
+	// 只能吊销自己的 token
+	assert.ErrorIs(t, m.Revoke(ctx, pat.ID, "bob"), ErrTokenNotFound)
+	require.NoError(t, m.Revoke(ctx, pat.ID, "alice"))
+	_, err = m.VerifyPersonalAccessToken(ctx, tokenString)
+	assert.ErrorIs(t, err, ErrInvalidToken)
+
+	// 吊销的 token 不占用名字
+	_, _, err = m.Issue(ctx, "alice", "ci", []string{"vm"}, time.Hour)
+	assert.NoError(t, err)
+}
+
+func TestManager_Expired(t *testing.T) {
+	ctx := context.Background()
+	dr := testutil.NewDBResolver(t)
+	_, err := dao.InsertUserWithDB(ctx, dr.GetDB(), "alice", "alice", "", "", "", model.UserRoleNormal)
+	require.NoError(t, err)
+	m := NewManager(dr)
+
+	tokenString, _, err := m.Issue(ctx, "alice", "ci", []string{"vm"}, time.Hour)
+	require.NoError(t, err)
+
+	// 禁用的用户的 token 不可用
+	require.NoError(t, dao.UpdateUserByID(ctx, dr, "alice", map[string]interface{}{"status": model.UserStatusDisabled}))
+	_, err = m.VerifyPersonalAccessToken(ctx, tokenString)
+	assert.ErrorIs(t, err, ErrInvalidToken)
+	require.NoError(t, dao.UpdateUserByID(ctx, dr, "alice", map[string]interface{}{"status": model.UserStatusLocked}))
+	_, err = m.VerifyPersonalAccessToken(ctx, tokenString)
+	assert.ErrorIs(t, err, ErrInvalidToken)
+	require.NoError(t, dao.UpdateUserByID(ctx, dr, "alice", map[string]interface{}{"status": model.UserStatusEnabled}))
+
+	m.now = func() time.Time { return time.Now().Add(2 * time.Hour) }
+	_, err = m.VerifyPersonalAccessToken(ctx, tokenString)
+	assert.ErrorIs(t, err, ErrInvalidToken)
+
+	// 过期的 token 不占用名字
+	_, _, err = m.Issue(ctx, "alice", "ci", []string{"vm"}, time.Hour)
+	assert.NoError(t, err)
+}
+
+func TestTokenManagerVerify(t *testing.T) {
+	ctx := context.Background()
+	dr := testutil.NewDBResolver(t)
+	_, err := dao.InsertUserWithDB(ctx, dr.GetDB(), "alice", "alice", "", "", "", model.UserRoleNormal)
+	require.NoError(t, err)
+	m := NewManager(dr)
+	tokenString, _, err := m.Issue(ctx, "alice", "ci", []string{"vm"}, time.Hour)
+	require.NoError(t, err)
+
+	disabled := token.NewJWTTokenManager([]byte("secret"), jwt.SigningMethodHS256)
+	_, err = disabled.Verify(tokenString)
+	assert.ErrorIs(t, err, token.ErrPersonalAccessTokenDisabled)
+
+	manager := token.NewJWTTokenManager([]byte("secret"), jwt.SigningMethodHS256, token.SetPersonalAccessTokens(m))
+	info, err := manager.Verify(tokenString)
+	require.NoError(t, err)
+	assert.Equal(t, "alice", info.UID)
+}
@@ -0,0 +1,44 @@
+package token
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+)
+
+// PersonalAccessTokenPrefix starts every personal access token, Verify passes these tokens
+// to the PersonalAccessTokenVerifier instead of parsing them as a JWT
+const PersonalAccessTokenPrefix = "akm_pat_"
+
+// personalAccessTokenTimeout bounds the lookup of a personal access token, Verify has no context
+const personalAccessTokenTimeout = 5 * time.Second
+
+var ErrPersonalAccessTokenDisabled = errors.New("personal access tokens are not enabled")
+
+// PersonalAccessTokenVerifier verifies a personal access token and returns the user it acts for,
+// Info.Scopes restricts the API groups the token can access
+type PersonalAccessTokenVerifier interface {
+	VerifyPersonalAccessToken(ctx context.Context, tokenString string) (Info, error)
+}
+
+// IsPersonalAccessToken reports whether the token is a personal access token
+func IsPersonalAccessToken(tokenString string) bool {
+	return strings.HasPrefix(tokenString, PersonalAccessTokenPrefix)
+}
+
+// SetPersonalAccessTokens enables the personal access tokens verified by verifier
+func SetPersonalAccessTokens(verifier PersonalAccessTokenVerifier) Option {
+	return func(jt *jwtToken) {
+		jt.personalAccessTokens = verifier
+	}
+}
+
+func (jt *jwtToken) verifyPersonalAccessToken(tokenString string) (Info, error) {
+	if jt.personalAccessTokens == nil {
+		return Info{}, ErrPersonalAccessTokenDisabled
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), personalAccessTokenTimeout)
+	defer cancel()
+	return jt.personalAccessTokens.VerifyPersonalAccessToken(ctx, tokenString)
+}
@@ -0,0 +1,189 @@
+package refresh
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"time"
+
+	"asyncKubeManager/pkg/dao"
+	"asyncKubeManager/pkg/dbresolver"
+	"asyncKubeManager/pkg/model"
+	"asyncKubeManager/pkg/utils"
+
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+// DefaultDuration is how long a refresh token can be exchanged for a new access token
+const DefaultDuration = 7 * 24 * time.Hour
+
+// tokenBytes is the random length of a refresh token
+const tokenBytes = 32
+
+var (
+	// ErrInvalidToken is returned for unknown or expired refresh tokens
+	ErrInvalidToken = errors.New("invalid refresh token")
+	// ErrTokenReused is returned when a rotated refresh token is used again, the whole family is revoked
+	ErrTokenReused = errors.New("refresh token reused")
+)
+
+// ReusedError is returned by Rotate when a rotated refresh token is used again, it lists the sessions
+// of the revoked family so that all of them can be logged out. It matches ErrTokenReused with errors.Is.
+type ReusedError struct {
+	UID        string
+	FamilyID   string
+	SessionIDs []string
+}
+
+func (e *ReusedError) Error() string {
+	return ErrTokenReused.Error()
+}
+
+func (e *ReusedError) Is(target error) bool {
+	return target == ErrTokenReused
+}
+
+// CheckFunc checks that the owner of a refresh token may still log in, it runs in the rotation transaction
+// and must not have side effects outside the database
+type CheckFunc func(old *model.RefreshToken) error
+
+// Manager issues opaque refresh tokens and rotates them on every use, only the hash of a token is stored
+type Manager struct {
+	dbResolver *dbresolver.DBResolver
+	duration   time.Duration
+	now        func() time.Time
+}
+
+func NewManager(dbResolver *dbresolver.DBResolver, duration time.Duration) *Manager {
+	return &Manager{
+		dbResolver: dbResolver,
+		duration:   duration,
+		now:        time.Now,
+	}
+}
+
+// Duration returns the lifetime of the refresh tokens
+func (m *Manager) Duration() time.Duration {
+	return m.duration
+}
+
+// Issue creates the refresh token of a new login, it starts a new token family.
+func (m *Manager) Issue(ctx context.Context, uid, sessionID string) (string, error) {
+	return m.IssueWithDB(ctx, m.dbResolver.GetDB(), uid, sessionID)
+}
+
+func (m *Manager) IssueWithDB(ctx context.Context, db *gorm.DB, uid, sessionID string) (string, error) {
+	// 顺便清理过期的 refresh token
+	if err := dao.DeleteExpiredRefreshTokens(ctx, m.dbResolver, m.now()); err != nil {
+		zap.L().Warn("DeleteExpiredRefreshTokens", zap.Error(err))
+	}
+
+	return m.insert(ctx, db, utils.NextID(), uid, sessionID)
+}
+
+// Rotate exchanges the refresh token for a new one of the same family bound to sessionID, check is called
+// in the same transaction. The caller issues the access token of sessionID and logs out the old session
+// once Rotate succeeded, so that a rolled back rotation leaves the old session untouched.
+// If the token has been rotated already, the family is revoked and a *ReusedError listing the sessions
+// of the family is returned.
+func (m *Manager) Rotate(ctx context.Context, refreshToken, sessionID string, check CheckFunc) (string, *model.RefreshToken, error) {
+	var (
+		newToken string
+		old      *model.RefreshToken
+		reused   bool
+	)
+
+	now := m.now()
+	err := m.dbResolver.GetDB().Transaction(func(tx *gorm.DB) error {
+		found, record, err := dao.GetRefreshTokenByHashWithDB(ctx, tx, utils.SHA256Hex(refreshToken))
+		if err != nil {
+			return err
+		}
+		if !found || record.ExpiresAt <= now.UnixMilli() {
+			return ErrInvalidToken
+		}
+		old = record
+
+		revoked, err := dao.RevokeRefreshTokenWithDB(ctx, tx, record.ID, now)
+		if err != nil {
+			return err
+		}
+		if !revoked {
+			reused = true
+			return nil
+		}
+
+		if err = check(record); err != nil {
+			return err
+		}
+
+		newToken, err = m.insert(ctx, tx, record.FamilyID, record.UID, sessionID)
+		return err
+	})
+	if err != nil {
+		return "", nil, err
+	}
+
+	if reused {
+		sessionIDs, err := m.revokeFamily(ctx, old.FamilyID, now)
+		if err != nil {
+			return "", nil, err
+		}
+		return "", old, &ReusedError{UID: old.UID, FamilyID: old.FamilyID, SessionIDs: sessionIDs}
+	}
+
+	return newToken, old, nil
+}
+
+// RevokeSession revokes the refresh tokens of a session, e.g. on logout
+func (m *Manager) RevokeSession(ctx context.Context, uid, sessionID string) error {
+	return dao.RevokeRefreshTokensBySession(ctx, m.dbResolver, uid, sessionID, m.now())
+}
+
+// RevokeUser revokes all refresh tokens of the user
+func (m *Manager) RevokeUser(ctx context.Context, uid string) error {
+	return dao.RevokeRefreshTokensByUID(ctx, m.dbResolver, uid, m.now())
+}
+
+func (m *Manager) revokeFamily(ctx context.Context, familyID string, now time.Time) ([]string, error) {
+	var sessionIDs []string
+	err := m.dbResolver.GetDB().Transaction(func(tx *gorm.DB) error {
+		if err := dao.RevokeRefreshTokenFamilyWithDB(ctx, tx, familyID, now); err != nil {
+			return err
+		}
+		var err error
+		sessionIDs, err = dao.ListRefreshTokenSessionsOfFamilyWithDB(ctx, tx, familyID)
+		return err
+	})
+	return sessionIDs, err
+}
+
+func (m *Manager) insert(ctx context.Context, db *gorm.DB, familyID, uid, sessionID string) (string, error) {
+	refreshToken, err := generate()
+	if err != nil {
+		return "", err
+	}
+
+	err = dao.InsertRefreshTokenWithDB(ctx, db, &model.RefreshToken{
+		TokenHash: utils.SHA256Hex(refreshToken),
+		FamilyID:  familyID,
+		UID:       uid,
+		SessionID: sessionID,
+		ExpiresAt: m.now().Add(m.duration).UnixMilli(),
+	})
+	if err != nil {
+		return "", err
+	}
+	return refreshToken, nil
+}
+
+func generate() (string, error) {
+	b := make([]byte, tokenBytes)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("generate refresh token error %w", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
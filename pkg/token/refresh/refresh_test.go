@@ -0,0 +1,99 @@
+package refresh
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"asyncKubeManager/pkg/model"
+	"asyncKubeManager/pkg/testutil"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestManager_Rotate(t *testing.T) {
+	ctx := context.Background()
+	m := NewManager(testutil.NewDBResolver(t), time.Hour)
+
+	first, err := m.Issue(ctx, "1", "session-1")
+	require.NoError(t, err)
+
+	second, old, err := m.Rotate(ctx, first, "session-2", func(old *model.RefreshToken) error {
+		assert.Equal(t, "session-1", old.SessionID)
+		return nil
+	})
+	require.NoError(t, err)
+	assert.NotEqual(t, first, second)
+	assert.Equal(t, "1", old.UID)
+
+	// 已轮换的 token 再次使用, 整个 family 被吊销
+	_, _, err = m.Rotate(ctx, first, "session-3", func(old *model.RefreshToken) error {
+		t.Fatal("a reused token must not be checked")
+		return nil
+	})
+	assert.ErrorIs(t, err, ErrTokenReused)
+	var reused *ReusedError
+	require.ErrorAs(t, err, &reused)
+	assert.Equal(t, "1", reused.UID)
+	assert.ElementsMatch(t, []string{"session-1", "session-2"}, reused.SessionIDs)
+
+	_, _, err = m.Rotate(ctx, second, "session-3", func(old *model.RefreshToken) error {
+		return nil
+	})
+	assert.ErrorIs(t, err, ErrTokenReused)
+}
+
+func TestManager_RotateInvalid(t *testing.T) {
+	ctx := context.Background()
+	m := NewManager(testutil.NewDBResolver(t), time.Hour)
+	check := func(old *model.RefreshToken) error {
+		return nil
+	}
+
+	_, _, err := m.Rotate(ctx, "unknown", "session-2", check)
+	assert.ErrorIs(t, err, ErrInvalidToken)
+
+	refreshToken, err := m.Issue(ctx, "1", "session-1")
+	require.NoError(t, err)
+	m.now = func() time.Time { return time.Now().Add(2 * time.Hour) }
+	_, _, err = m.Rotate(ctx, refreshToken, "session-2", check)
+	assert.ErrorIs(t, err, ErrInvalidToken)
+}
+
+func TestManager_RevokeSession(t *testing.T) {
+	ctx := context.Background()
+	m := NewManager(testutil.NewDBResolver(t), time.Hour)
+
+	refreshToken, err := m.Issue(ctx, "1", "session-1")
+	require.NoError(t, err)
+	require.NoError(t, m.RevokeSession(ctx, "1", "session-1"))
+
+	// 注销后的 refresh token 视为重复使用
+	_, _, err = m.Rotate(ctx, refreshToken, "session-2", func(old *model.RefreshToken) error {
+		return nil
+	})
+	assert.ErrorIs(t, err, ErrTokenReused)
+}
+
+func TestManager_RotateRollback(t *testing.T) {
+	ctx := context.Background()
+	m := NewManager(testutil.NewDBResolver(t), time.Hour)
+
+	refreshToken, err := m.Issue(ctx, "1", "session-1")
+	require.NoError(t, err)
+
+	// 检查失败时轮换回滚, 原 refresh token 仍然可用
+	disabled := errors.New("user disabled")
+	_, _, err = m.Rotate(ctx, refreshToken, "session-2", func(old *model.RefreshToken) error {
+		return disabled
+	})
+	assert.ErrorIs(t, err, disabled)
+
+	_, old, err := m.Rotate(ctx, refreshToken, "session-3", func(old *model.RefreshToken) error {
+		return nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "session-1", old.SessionID)
+}
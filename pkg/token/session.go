@@ -0,0 +1,151 @@
+package token
+
+import (
+	"encoding/json"
+	"errors"
+	"sort"
+	"strings"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	// sessionKeyPrefix + uid + ":" + jti stores the Session of a token
+	sessionKeyPrefix = "session:"
+	// sessionIndexKeyPrefix + uid is the set of the user's session IDs, so that the sessions are found without KEYS.
+	// It may contain expired sessions, they are removed when the sessions are listed.
+	sessionIndexKeyPrefix = "session-index:"
+)
+
+var ErrSessionNotFound = errors.New("session not found")
+
+// addSessionScript evicts the oldest sessions of the user and adds the new one atomically, so that concurrent
+// logins can't exceed the max sessions. Index entries of expired sessions are dropped on the way.
+// KEYS[1] is the session index of the user, ARGV are the session key prefix of the user, the session ID,
+// the encoded session, the ttl in milliseconds (0 never expires) and the max sessions (0 means unlimited).
+const addSessionScript = `
+local prefix, ttl, max = ARGV[1], tonumber(ARGV[4]), tonumber(ARGV[5])
+if max > 0 then
+	local sessions = {}
+	for _, id in ipairs(redis.call('SMEMBERS', KEYS[1])) do
+		local val = redis.call('GET', prefix .. id)
+		if val then
+			local ok, s = pcall(cjson.decode, val)
+			local created = 0
+			if ok and type(s) == 'table' and tonumber(s.created_at) then
+				created = tonumber(s.created_at)
+			end
+			table.insert(sessions, {id = id, created = created})
+		else
+			redis.call('SREM', KEYS[1], id)
+		end
+	end
+	if #sessions >= max then
+		table.sort(sessions, function(a, b) return a.created < b.created end)
+		for i = 1, #sessions - max + 1 do
+			redis.call('DEL', prefix .. sessions[i].id)
+			redis.call('SREM', KEYS[1], sessions[i].id)
+		end
+	end
+end
+if ttl > 0 then
+	redis.call('SET', prefix .. ARGV[2], ARGV[3], 'PX', ttl)
+else
+	redis.call('SET', prefix .. ARGV[2], ARGV[3])
+end
+redis.call('SADD', KEYS[1], ARGV[2])
+if ttl > 0 then
+	redis.call('PEXPIRE', KEYS[1], ttl)
+end
+return 1
+`
+
+// SessionMeta describes the client a token is issued to
+type SessionMeta struct {
+	Device    string `json:"device"`
+	IP        string `json:"ip"`
+	UserAgent string `json:"user_agent"`
+	// SessionID is the jti of the new token, empty generates one. It lets the caller bind the session
+	// to database records before the token is issued
+	SessionID string `json:"-"`
+	// Unlimited sessions don't evict the older sessions of the user when it reaches the max sessions,
+	// service accounts use it since their parallel jobs must not log out each other
+	Unlimited bool `json:"-"`
+}
+
+// Session is a logged in client of a user, it is identified by the jti of its token
+type Session struct {
+	SessionMeta
+	ID  string `json:"id"`
+	UID string `json:"uid"`
+	// CreatedAt and LastSeenAt are unix milliseconds
+	CreatedAt  int64 `json:"created_at"`
+	LastSeenAt int64 `json:"last_seen_at"`
+}
+
+func sessionKey(uid, sessionID string) string {
+	return sessionKeyPrefix + uid + ":" + sessionID
+}
+
+func sessionKeyPrefixOf(uid string) string {
+	return sessionKeyPrefix + uid + ":"
+}
+
+func sessionIndexKey(uid string) string {
+	return sessionIndexKeyPrefix + uid
+}
+
+func encodeSession(s *Session) (string, error) {
+	data, err := json.Marshal(s)
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+func decodeSession(val string) (*Session, error) {
+	s := &Session{}
+	if err := json.Unmarshal([]byte(val), s); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// sortSessions sorts the sessions by creation time, the newest first
+func sortSessions(sessions []Session) {
+	sort.Slice(sessions, func(i, j int) bool {
+		if sessions[i].CreatedAt != sessions[j].CreatedAt {
+			return sessions[i].CreatedAt > sessions[j].CreatedAt
+		}
+		return sessions[i].ID > sessions[j].ID
+	})
+}
+
+// SessionID returns the session ID (jti) of a token without verifying it,
+// the token must have been verified already, e.g. by the CheckToken middleware.
+func SessionID(tokenString string) string {
+	clm := Claims{}
+	if _, _, err := jwt.NewParser().ParseUnverified(tokenString, &clm); err != nil {
+		return ""
+	}
+	return clm.ID
+}
+
+// DeviceFromUserAgent returns a short description of the client platform, used when the client doesn't name its device
+func DeviceFromUserAgent(userAgent string) string {
+	platforms := []struct{ keyword, name string }{
+		{"iPhone", "iPhone"},
+		{"iPad", "iPad"},
+		{"Android", "Android"},
+		{"Windows", "Windows"},
+		{"Mac OS", "macOS"},
+		{"CrOS", "ChromeOS"},
+		{"Linux", "Linux"},
+	}
+	for _, p := range platforms {
+		if strings.Contains(userAgent, p.keyword) {
+			return p.name
+		}
+	}
+	return "unknown"
+}
@@ -1,7 +1,11 @@
 package limiter
 
 import (
+	"asyncKubeManager/pkg/client/cache"
+	"context"
+	"github.com/alicebob/miniredis/v2"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 	"go.uber.org/zap"
 	"golang.org/x/time/rate"
 	"testing"
@@ -41,3 +45,46 @@ func TestNewLoginLimiter(t *testing.T) {
 	assert.Equal(t, false, limiter.IsLimit("key1", int64(threshold)))
 
 }
+
+func TestLoginLimiter_Lock(t *testing.T) {
+	now := time.Now()
+	cacheClient := cache.NewMemoryClient()
+	cacheClient.Now = func() time.Time { return now }
+
+	limiter := NewCacheLoginLimiter(cacheClient, time.Minute)
+	for i := 0; i < 2; i++ {
+		limiter.LoginFailToReachLimit("user:admin", 3)
+	}
+	assert.Equal(t, true, limiter.LoginFailToReachLimit("user:admin", 3))
+	limiter.Lock("user:admin", time.Hour)
+
+	// 计数窗口已过, 锁定仍然有效
+	now = now.Add(30 * time.Minute)
+	assert.Equal(t, true, limiter.IsLimit("user:admin", 3))
+
+	now = now.Add(time.Hour)
+	assert.Equal(t, false, limiter.IsLimit("user:admin", 3))
+
+	limiter.LoginFailToReachLimit("user:admin", 3)
+	limiter.Clean("user:admin")
+	assert.Equal(t, int64(0), limiter.Count("user:admin"))
+}
+
+func TestCacheLoginLimiter(t *testing.T) {
+	mr := miniredis.RunT(t)
+	stopCh := make(chan struct{})
+	t.Cleanup(func() { close(stopCh) })
+	cacheClient, err := cache.NewRedisClient(&cache.Options{Host: mr.Addr()}, stopCh)
+	require.NoError(t, err)
+
+	limiter := NewCacheLoginLimiter(cacheClient, time.Minute)
+	assert.Equal(t, false, limiter.LoginFailToReachLimit("user:local:admin", 2))
+	// 计数和过期时间一起设置
+	assert.Equal(t, time.Minute, mr.TTL(loginFailKeyPrefix+"user:local:admin"))
+	assert.Equal(t, true, limiter.LoginFailToReachLimit("user:local:admin", 2))
+
+	mr.FastForward(time.Minute)
+	exists, err := cacheClient.Exists(context.Background(), loginFailKeyPrefix+"user:local:admin")
+	require.NoError(t, err)
+	assert.False(t, exists)
+}
@@ -1,77 +1,134 @@
 package limiter
 
 import (
-	"sync"
-	"sync/atomic"
+	"asyncKubeManager/pkg/client/cache"
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
 	"time"
+
+	"go.uber.org/zap"
 )
 
 const (
 	defaultLoginLimiterExpireAt = time.Hour * 4
-)
 
-type failStatus struct {
-	count     int64
-	createdAt time.Time
-}
+	loginFailKeyPrefix = "login-fail:"
+)
 
-func (s *failStatus) Incr() {
-	atomic.AddInt64(&s.count, 1)
-}
+// incrScript increments KEYS[1] and sets its expiration to ARGV[1] milliseconds on the first failure,
+// atomically, so that a count is never left without expiration
+const incrScript = `
+local count = redis.call('INCR', KEYS[1])
+if count == 1 then
+	redis.call('PEXPIRE', KEYS[1], ARGV[1])
+end
+return count
+`
 
-func (s *failStatus) Count() int64 {
-	return atomic.LoadInt64(&s.count)
+// LoginPolicy configures the lockout after failed logins, a zero threshold disables the limit
+type LoginPolicy struct {
+	// UserThreshold is the failed logins of a user ID before the user is locked
+	UserThreshold int64
+	// IPThreshold is the failed logins from a client IP before the IP is blocked
+	IPThreshold int64
+	// Window is how long a failed login is counted
+	Window time.Duration
+	// LockoutDuration is how long a user or IP stays locked after reaching the threshold
+	LockoutDuration time.Duration
 }
 
-func newFailStatus() *failStatus {
-	return &failStatus{
-		count:     0,
-		createdAt: time.Now(),
-	}
+// DefaultLoginPolicy locks a user after 5 and a client IP after 20 failed logins in 15 minutes, for 30 minutes
+var DefaultLoginPolicy = LoginPolicy{
+	UserThreshold:   5,
+	IPThreshold:     20,
+	Window:          15 * time.Minute,
+	LockoutDuration: 30 * time.Minute,
 }
 
+// LoginLimiter counts the failed logins of a key, e.g. a user ID or a client IP.
+// The counts are kept in a cache.Interface, so that replicas sharing a redis share the counts.
+// A count expires expireDuration after the first failure.
 type LoginLimiter struct {
-	counts         *sync.Map
+	cache          cache.Interface
 	expireDuration time.Duration
 }
 
+// NewLoginLimiter returns a LoginLimiter keeping the counts in memory.
 func NewLoginLimiter(expireDuration ...time.Duration) *LoginLimiter {
+	return NewCacheLoginLimiter(cache.NewMemoryClient(), expireDuration...)
+}
+
+// NewCacheLoginLimiter returns a LoginLimiter keeping the counts in cacheClient.
+func NewCacheLoginLimiter(cacheClient cache.Interface, expireDuration ...time.Duration) *LoginLimiter {
 	duration := defaultLoginLimiterExpireAt
 	if len(expireDuration) > 0 {
 		duration = expireDuration[0]
 	}
 
 	return &LoginLimiter{
+		cache:          cacheClient,
 		expireDuration: duration,
-		counts:         new(sync.Map),
 	}
 }
 
-func (l *LoginLimiter) getOrCreateStatus(key string) *failStatus {
-	status, _ := l.counts.LoadOrStore(key, newFailStatus())
-	fs, ok := status.(*failStatus)
-	if !ok {
-		return newFailStatus()
+// Count returns the failed logins of the key, cache errors are logged and count as 0
+func (l *LoginLimiter) Count(key string) int64 {
+	val, err := l.cache.Get(context.Background(), loginFailKeyPrefix+key)
+	if err != nil {
+		return 0
 	}
-
-	if time.Since(fs.createdAt) > l.expireDuration {
-		l.Clean(key)
-		return newFailStatus()
+	count, err := strconv.ParseInt(val, 10, 64)
+	if err != nil {
+		zap.L().Warn("login limiter count damaged", zap.String("key", key), zap.Error(err))
+		return 0
 	}
-
-	return fs
+	return count
 }
 
 func (l *LoginLimiter) IsLimit(key string, threshold int64) bool {
-	return l.getOrCreateStatus(key).Count() >= threshold
+	return l.Count(key) >= threshold
 }
 
 func (l *LoginLimiter) LoginFailToReachLimit(key string, threshold int64) bool {
-	status := l.getOrCreateStatus(key)
-	status.Incr()
-	return status.Count() >= threshold
+	count, err := l.incr(context.Background(), loginFailKeyPrefix+key)
+	if err != nil {
+		zap.L().Error("login limiter incr failed", zap.String("key", key), zap.Error(err))
+		return false
+	}
+	return count >= threshold
+}
+
+func (l *LoginLimiter) incr(ctx context.Context, key string) (int64, error) {
+	val, err := l.cache.Eval(ctx, incrScript, []string{key}, l.expireDuration.Milliseconds())
+	if errors.Is(err, cache.ErrScriptNotSupported) {
+		// 内存缓存只在本进程内使用, 进程退出时计数一起消失, 不会留下永不过期的计数
+		count, err := l.cache.Incr(ctx, key)
+		if err == nil && count == 1 {
+			err = l.cache.Expire(ctx, key, l.expireDuration)
+		}
+		return count, err
+	}
+	if err != nil {
+		return 0, err
+	}
+	count, ok := val.(int64)
+	if !ok {
+		return 0, fmt.Errorf("unexpected result %v of the incr script", val)
+	}
+	return count, nil
+}
+
+// Lock keeps the count of the key for duration, so that IsLimit stays true until the lockout ends
+func (l *LoginLimiter) Lock(key string, duration time.Duration) {
+	if err := l.cache.Expire(context.Background(), loginFailKeyPrefix+key, duration); err != nil {
+		zap.L().Error("login limiter lock failed", zap.String("key", key), zap.Error(err))
+	}
 }
 
 func (l *LoginLimiter) Clean(key string) {
-	l.counts.Delete(key)
+	if err := l.cache.Del(context.Background(), loginFailKeyPrefix+key); err != nil {
+		zap.L().Error("login limiter clean failed", zap.String("key", key), zap.Error(err))
+	}
 }
@@ -0,0 +1,158 @@
+package limiter
+
+import (
+	"asyncKubeManager/pkg/client/cache"
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Limit allows Burst events at once, then one event every Interval.
+type Limit struct {
+	Interval time.Duration
+	Burst    int
+}
+
+// PerMinute allows n events per minute with a burst of n
+func PerMinute(n int) Limit {
+	return Limit{Interval: time.Minute / time.Duration(n), Burst: n}
+}
+
+// Result describes the decision for one event
+type Result struct {
+	Allowed bool
+	// Remaining is the number of events allowed right now after this one
+	Remaining int64
+	// RetryAfter is how long to wait before the event would be allowed, 0 if it is allowed
+	RetryAfter time.Duration
+}
+
+// RateLimiter limits the events of a key, e.g. the requests of a user or a client IP.
+// Both implementations use the generic cell rate algorithm (GCRA), which only stores
+// the theoretical arrival time of the next event per key.
+type RateLimiter interface {
+	Allow(ctx context.Context, key string) (Result, error)
+}
+
+// gcra decides an event arriving at now, tat is the stored theoretical arrival time.
+// It returns the result and the new tat to store if the event is allowed.
+func gcra(limit Limit, tat, now time.Time) (Result, time.Time) {
+	if tat.Before(now) {
+		tat = now
+	}
+	newTAT := tat.Add(limit.Interval)
+	allowAt := newTAT.Add(-limit.Interval * time.Duration(limit.Burst))
+	if now.Before(allowAt) {
+		return Result{Allowed: false, RetryAfter: allowAt.Sub(now)}, tat
+	}
+	return Result{Allowed: true, Remaining: int64(now.Sub(allowAt) / limit.Interval)}, newTAT
+}
+
+type memoryRateLimiter struct {
+	limit Limit
+	now   func() time.Time
+
+	mu        sync.Mutex
+	tats      map[string]time.Time
+	lastSweep time.Time
+}
+
+// NewMemoryRateLimiter returns a RateLimiter keeping the state in process memory
+func NewMemoryRateLimiter(limit Limit) RateLimiter {
+	return &memoryRateLimiter{
+		limit: limit,
+		now:   time.Now,
+		tats:  map[string]time.Time{},
+	}
+}
+
+func (l *memoryRateLimiter) Allow(ctx context.Context, key string) (Result, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	l.sweep(now)
+
+	res, tat := gcra(l.limit, l.tats[key], now)
+	if res.Allowed {
+		l.tats[key] = tat
+	}
+	return res, nil
+}
+
+// sweep drops the keys whose tat has passed, they are the same as missing keys
+func (l *memoryRateLimiter) sweep(now time.Time) {
+	if now.Sub(l.lastSweep) < time.Minute {
+		return
+	}
+	l.lastSweep = now
+	for key, tat := range l.tats {
+		if tat.Before(now) {
+			delete(l.tats, key)
+		}
+	}
+}
+
+// gcraScript is gcra run by redis, the key expires when its tat has passed.
+// KEYS[1] key, ARGV[1] interval ms, ARGV[2] burst, ARGV[3] now ms.
+// It returns {allowed, remaining, retry after ms}.
+const gcraScript = `
+local interval = tonumber(ARGV[1])
+local burst = tonumber(ARGV[2])
+local now = tonumber(ARGV[3])
+local tat = tonumber(redis.call('GET', KEYS[1]) or now)
+if tat < now then
+	tat = now
+end
+local new_tat = tat + interval
+local allow_at = new_tat - interval * burst
+if now < allow_at then
+	return {0, 0, allow_at - now}
+end
+redis.call('SET', KEYS[1], new_tat, 'PX', new_tat - now)
+return {1, math.floor((now - allow_at) / interval), 0}
+`
+
+type cacheRateLimiter struct {
+	cache  cache.Interface
+	prefix string
+	limit  Limit
+	now    func() time.Time
+}
+
+// NewCacheRateLimiter returns a RateLimiter keeping the state in cacheClient, which must support Eval.
+// The replicas sharing the redis share the limit, keys are prefixed with prefix.
+func NewCacheRateLimiter(cacheClient cache.Interface, prefix string, limit Limit) RateLimiter {
+	return &cacheRateLimiter{
+		cache:  cacheClient,
+		prefix: prefix,
+		limit:  limit,
+		now:    time.Now,
+	}
+}
+
+func (l *cacheRateLimiter) Allow(ctx context.Context, key string) (Result, error) {
+	val, err := l.cache.Eval(ctx, gcraScript, []string{l.prefix + key},
+		l.limit.Interval.Milliseconds(), l.limit.Burst, l.now().UnixMilli())
+	if err != nil {
+		return Result{}, err
+	}
+
+	values, ok := val.([]interface{})
+	if !ok || len(values) != 3 {
+		return Result{}, fmt.Errorf("unexpected rate limit script result %v", val)
+	}
+	var n [3]int64
+	for i, v := range values {
+		if n[i], ok = v.(int64); !ok {
+			return Result{}, fmt.Errorf("unexpected rate limit script result %v", val)
+		}
+	}
+
+	return Result{
+		Allowed:    n[0] == 1,
+		Remaining:  n[1],
+		RetryAfter: time.Duration(n[2]) * time.Millisecond,
+	}, nil
+}
@@ -0,0 +1,66 @@
+package limiter
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"asyncKubeManager/pkg/client/cache"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testRateLimiter checks a limiter of 3 events at once and one every 200ms, advance moves its clock forward
+func testRateLimiter(t *testing.T, l RateLimiter, advance func(time.Duration)) {
+	ctx := context.Background()
+
+	for i := 2; i >= 0; i-- {
+		res, err := l.Allow(ctx, "user:1")
+		require.NoError(t, err)
+		assert.True(t, res.Allowed)
+		assert.EqualValues(t, i, res.Remaining)
+	}
+
+	res, err := l.Allow(ctx, "user:1")
+	require.NoError(t, err)
+	assert.False(t, res.Allowed)
+	assert.Equal(t, 200*time.Millisecond, res.RetryAfter)
+
+	// 其他 key 不受影响
+	res, err = l.Allow(ctx, "user:2")
+	require.NoError(t, err)
+	assert.True(t, res.Allowed)
+
+	advance(200 * time.Millisecond)
+	res, err = l.Allow(ctx, "user:1")
+	require.NoError(t, err)
+	assert.True(t, res.Allowed)
+	assert.EqualValues(t, 0, res.Remaining)
+}
+
+func TestMemoryRateLimiter(t *testing.T) {
+	now := time.Now()
+	l := NewMemoryRateLimiter(Limit{Interval: 200 * time.Millisecond, Burst: 3})
+	l.(*memoryRateLimiter).now = func() time.Time { return now }
+
+	testRateLimiter(t, l, func(d time.Duration) { now = now.Add(d) })
+}
+
+func TestCacheRateLimiter(t *testing.T) {
+	mr := miniredis.RunT(t)
+	stopCh := make(chan struct{})
+	t.Cleanup(func() { close(stopCh) })
+	cacheClient, err := cache.NewRedisClient(&cache.Options{Host: mr.Addr()}, stopCh)
+	require.NoError(t, err)
+
+	now := time.Now()
+	l := NewCacheRateLimiter(cacheClient, "rate-limit:test:", Limit{Interval: 200 * time.Millisecond, Burst: 3})
+	l.(*cacheRateLimiter).now = func() time.Time { return now }
+
+	testRateLimiter(t, l, func(d time.Duration) {
+		now = now.Add(d)
+		mr.FastForward(d)
+	})
+}
@@ -2,6 +2,7 @@ package pwdutil
 
 import (
 	"asyncKubeManager/pkg/utils"
+	"errors"
 	"fmt"
 	"math/rand"
 	"strings"
@@ -191,3 +192,37 @@ func RandPassword(passwordLength int, special ...bool) (string, error) {
 
 	return password, nil
 }
+
+// maxPasswordBytes is the longest password bcrypt accepts
+const maxPasswordBytes = 72
+
+var (
+	ErrPasswordTooShort = errors.New("password is too short")
+	ErrPasswordTooLong  = errors.New("password is too long")
+	ErrPasswordTooWeak  = errors.New("password is too weak")
+)
+
+// Policy is the strength required of the passwords set by users
+type Policy struct {
+	MinLength int
+	Rating    PasswordRatingType
+}
+
+var DefaultPolicy = Policy{
+	MinLength: 8,
+	Rating:    Strong,
+}
+
+// Check returns an error if the password doesn't meet the policy
+func (p Policy) Check(pwd string) error {
+	if len([]rune(pwd)) < p.MinLength {
+		return fmt.Errorf("%w, at least %d characters", ErrPasswordTooShort, p.MinLength)
+	}
+	if len(pwd) > maxPasswordBytes {
+		return fmt.Errorf("%w, at most %d bytes", ErrPasswordTooLong, maxPasswordBytes)
+	}
+	if !CheckPasswordRating(pwd, p.Rating) {
+		return fmt.Errorf("%w, mix upper and lower case letters, digits and symbols", ErrPasswordTooWeak)
+	}
+	return nil
+}
@@ -2,6 +2,7 @@ package pwdutil
 
 import (
 	"github.com/stretchr/testify/assert"
+	"strings"
 	"testing"
 )
 
@@ -9,3 +10,11 @@ func TestCheckPasswordRating(t *testing.T) {
 	allow := CheckPasswordRating("12345678A", Strong)
 	assert.Equal(t, true, allow)
 }
+
+func TestPolicy_Check(t *testing.T) {
+	p := Policy{MinLength: 8, Rating: Strong}
+	assert.NoError(t, p.Check("12345678Ab"))
+	assert.ErrorIs(t, p.Check("1234Ab"), ErrPasswordTooShort)
+	assert.ErrorIs(t, p.Check("aaaaaaaa"), ErrPasswordTooWeak)
+	assert.ErrorIs(t, p.Check(strings.Repeat("1234567Ab", 9)), ErrPasswordTooLong)
+}
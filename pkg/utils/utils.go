@@ -24,6 +24,15 @@ func String2Bytes(s string) (b []byte) {
 	return unsafe.Slice(unsafe.StringData(s), len(s))
 }
 
+// TruncateString cuts s to at most n characters, e.g. to fit a varchar column
+func TruncateString(s string, n int) string {
+	r := []rune(s)
+	if len(r) > n {
+		return string(r[:n])
+	}
+	return s
+}
+
 // String2IntArray convert string split by , to []int
 func String2IntArray(ptr *string) ([]int, error) {
 	if ptr == nil {